@@ -12,9 +12,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/containerd/containerd/reference/docker"
 	"github.com/distribution/reference"
@@ -23,15 +29,28 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/analyzer"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/annotation"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/benchmark"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/rule"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/chunkdict/generator"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/committer"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/copier"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/doctor"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/packer"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/prefetch"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/server"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/signature"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/verifier"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/viewer"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/workspace"
 )
 
 var (
@@ -42,8 +61,24 @@ var (
 
 var maxCacheMaxRecords uint = 200
 
+// nydusOnlyConvertFlags are the convert options only
+// supported by nydus target format.
+var nydusOnlyConvertFlags = []string{
+	"backend-type", "backend-config", "backend-config-file", "backend-config-set", "backend-force-push",
+	"chunk-dict", "merge-platform", "oci-ref", "with-referrer",
+	"fs-version", "fs-align-chunk", "backend-aligned-chunk", "fs-chunk-size",
+	"prefetch-dir", "prefetch-patterns", "prefetch-hint-from", "prefetch-file", "annotate-prefetch",
+	"compressor", "batch-size",
+}
+
 const defaultLogLevel = logrus.InfoLevel
 
+// invalidOption marks the error of command line options,
+// nydusify exits with utils.ExitCodeValidation for it.
+func invalidOption(err error) error {
+	return utils.WithExitCode(utils.ExitCodeValidation, err)
+}
+
 func isPossibleValue(excepted []string, value string) bool {
 	for _, v := range excepted {
 		if value == v {
@@ -56,7 +91,7 @@ func isPossibleValue(excepted []string, value string) bool {
 // This only works for OSS backend right now
 func parseBackendConfig(backendConfigJSON, backendConfigFile string) (string, error) {
 	if backendConfigJSON != "" && backendConfigFile != "" {
-		return "", fmt.Errorf("--backend-config conflicts with --backend-config-file")
+		return "", invalidOption(fmt.Errorf("--backend-config conflicts with --backend-config-file"))
 	}
 
 	if backendConfigFile != "" {
@@ -70,18 +105,27 @@ func parseBackendConfig(backendConfigJSON, backendConfigFile string) (string, er
 	return backendConfigJSON, nil
 }
 
+// readOnlyBackendTypes are the backend types only used to read the blobs by
+// nydusd or nydusify, for example checking or mounting the image.
+var readOnlyBackendTypes = []string{"oss", "s3", "http-proxy"}
+
 func getBackendConfig(c *cli.Context, prefix string, required bool) (string, string, error) {
+	return getBackendConfigOfTypes(c, prefix, required, []string{"oss", "s3"})
+}
+
+// getBackendConfigOfTypes is the same as getBackendConfig, but the backend
+// type should be one of possibleBackendTypes.
+func getBackendConfigOfTypes(c *cli.Context, prefix string, required bool, possibleBackendTypes []string) (string, string, error) {
 	backendType := c.String(prefix + "backend-type")
 	if backendType == "" {
 		if required {
-			return "", "", errors.Errorf("backend type is empty, please specify option '--%sbackend-type'", prefix)
+			return "", "", invalidOption(errors.Errorf("backend type is empty, please specify option '--%sbackend-type'", prefix))
 		}
 		return "", "", nil
 	}
 
-	possibleBackendTypes := []string{"oss", "s3"}
 	if !isPossibleValue(possibleBackendTypes, backendType) {
-		return "", "", fmt.Errorf("--%sbackend-type should be one of %v", prefix, possibleBackendTypes)
+		return "", "", invalidOption(fmt.Errorf("--%sbackend-type should be one of %v", prefix, possibleBackendTypes))
 	}
 
 	backendConfig, err := parseBackendConfig(
@@ -89,13 +133,70 @@ func getBackendConfig(c *cli.Context, prefix string, required bool) (string, str
 	)
 	if err != nil {
 		return "", "", err
-	} else if (backendType == "oss" || backendType == "s3") && strings.TrimSpace(backendConfig) == "" {
-		return "", "", errors.Errorf("backend configuration is empty, please specify option '--%sbackend-config'", prefix)
+	} else if strings.TrimSpace(backendConfig) == "" {
+		return "", "", invalidOption(errors.Errorf("backend configuration is empty, please specify option '--%sbackend-config'", prefix))
+	}
+	if backendConfig, err = expandBackendConfig(c, backendConfig); err != nil {
+		return "", "", err
+	}
+	if _, err := backend.ParseConfig(backendType, []byte(backendConfig)); err != nil {
+		return "", "", invalidOption(errors.Wrap(err, "invalid backend configuration"))
 	}
 
 	return backendType, backendConfig, nil
 }
 
+// expandBackendConfig substitutes the variables in backend config with the
+// values of '--backend-config-set', or the environment variables.
+func expandBackendConfig(c *cli.Context, config string) (string, error) {
+	sets := map[string]string{}
+	for _, set := range c.StringSlice("backend-config-set") {
+		name, value, ok := strings.Cut(set, "=")
+		if !ok || name == "" {
+			return "", invalidOption(errors.Errorf("invalid --backend-config-set %q, expected KEY=VALUE", set))
+		}
+		sets[name] = value
+	}
+	expanded, err := backend.ExpandConfig(config, func(name string) (string, bool) {
+		if value, ok := sets[name]; ok {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	})
+	if err != nil {
+		return "", invalidOption(err)
+	}
+	return expanded, nil
+}
+
+// getMountBackendConfig returns the storage backend config for nydusd to mount
+// the target image, the target registry is used if not specified.
+func getMountBackendConfig(c *cli.Context) (string, string, error) {
+	backendType, backendConfig, err := getBackendConfigOfTypes(c, "", false, readOnlyBackendTypes)
+	if err != nil {
+		return "", "", err
+	} else if backendConfig != "" {
+		return backendType, backendConfig, nil
+	}
+
+	parsed, err := reference.ParseNormalizedNamed(c.String("target"))
+	if err != nil {
+		return "", "", invalidOption(err)
+	}
+
+	backendConfigStruct, err := backend.NewRegistryConfig(parsed, c.Bool("target-insecure"))
+	if err != nil {
+		return "", "", errors.Wrap(err, "parse registry backend configuration")
+	}
+
+	bytes, err := json.Marshal(backendConfigStruct)
+	if err != nil {
+		return "", "", errors.Wrap(err, "marshal registry backend configuration")
+	}
+
+	return "registry", string(bytes), nil
+}
+
 // Add suffix to source image reference as the target
 // image reference, like this:
 // Source: localhost:5000/nginx:latest
@@ -103,10 +204,10 @@ func getBackendConfig(c *cli.Context, prefix string, required bool) (string, str
 func addReferenceSuffix(source, suffix string) (string, error) {
 	named, err := docker.ParseDockerRef(source)
 	if err != nil {
-		return "", fmt.Errorf("invalid source image reference: %s", err)
+		return "", invalidOption(fmt.Errorf("invalid source image reference: %s", err))
 	}
 	if _, ok := named.(docker.Digested); ok {
-		return "", fmt.Errorf("unsupported digested image reference: %s", named.String())
+		return "", invalidOption(fmt.Errorf("unsupported digested image reference: %s", named.String()))
 	}
 	named = docker.TagNameOnly(named)
 	target := named.String() + suffix
@@ -117,10 +218,10 @@ func getTargetReference(c *cli.Context) (string, error) {
 	target := c.String("target")
 	targetSuffix := c.String("target-suffix")
 	if target != "" && targetSuffix != "" {
-		return "", fmt.Errorf("--target conflicts with --target-suffix")
+		return "", invalidOption(fmt.Errorf("--target conflicts with --target-suffix"))
 	}
 	if target == "" && targetSuffix == "" {
-		return "", fmt.Errorf("--target or --target-suffix is required")
+		return "", invalidOption(fmt.Errorf("--target or --target-suffix is required"))
 	}
 	var err error
 	if targetSuffix != "" {
@@ -136,28 +237,91 @@ func getCacheReference(c *cli.Context, target string) (string, error) {
 	cache := c.String("build-cache")
 	cacheTag := c.String("build-cache-tag")
 	if cache != "" && cacheTag != "" {
-		return "", fmt.Errorf("--build-cache conflicts with --build-cache-tag")
+		return "", invalidOption(fmt.Errorf("--build-cache conflicts with --build-cache-tag"))
 	}
 	if cacheTag != "" {
 		named, err := docker.ParseDockerRef(target)
 		if err != nil {
-			return "", fmt.Errorf("invalid target image reference: %s", err)
+			return "", invalidOption(fmt.Errorf("invalid target image reference: %s", err))
 		}
 		cache = fmt.Sprintf("%s/%s:%s", docker.Domain(named), docker.Path(named), cacheTag)
 	}
 	return cache, nil
 }
 
+// getBatchItems reads the image list specified by `--batch`, the target
+// and cache reference of each source image are generated if not specified.
+func getBatchItems(c *cli.Context) ([]converter.BatchItem, error) {
+	if c.String("target") != "" {
+		return nil, invalidOption(fmt.Errorf("--target conflicts with --batch, specify the target in the image list or use --target-suffix"))
+	}
+
+	var filter *regexp.Regexp
+	if pattern := c.String("source-filter"); pattern != "" {
+		var err error
+		if filter, err = regexp.Compile(pattern); err != nil {
+			return nil, invalidOption(errors.Wrap(err, "invalid --source-filter"))
+		}
+	}
+
+	reader := os.Stdin
+	if batch := c.String("batch"); batch != "-" {
+		file, err := os.Open(batch)
+		if err != nil {
+			return nil, errors.Wrap(err, "open image list")
+		}
+		defer file.Close()
+		reader = file
+	}
+	items, err := converter.ParseBatchList(reader, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	targetSuffix := c.String("target-suffix")
+	for idx := range items {
+		if items[idx].Target == "" {
+			if targetSuffix == "" {
+				return nil, invalidOption(fmt.Errorf("target of %s is not specified in the image list, --target-suffix is required", items[idx].Source))
+			}
+			if items[idx].Target, err = addReferenceSuffix(items[idx].Source, targetSuffix); err != nil {
+				return nil, err
+			}
+		}
+		if items[idx].CacheRef, err = getCacheReference(c, items[idx].Target); err != nil {
+			return nil, err
+		}
+	}
+
+	return items, nil
+}
+
 func getPrefetchPatterns(c *cli.Context) (string, error) {
 	prefetchedDir := c.String("prefetch-dir")
 	prefetchPatterns := c.Bool("prefetch-patterns")
+	prefetchHintFrom := c.String("prefetch-hint-from")
+	prefetchFile := c.String("prefetch-file")
 
 	if len(prefetchedDir) > 0 && prefetchPatterns {
-		return "", fmt.Errorf("--prefetch-dir conflicts with --prefetch-patterns")
+		return "", invalidOption(fmt.Errorf("--prefetch-dir conflicts with --prefetch-patterns"))
+	}
+	if len(prefetchHintFrom) > 0 && (len(prefetchedDir) > 0 || prefetchPatterns) {
+		return "", invalidOption(fmt.Errorf("--prefetch-hint-from conflicts with --prefetch-dir and --prefetch-patterns"))
+	}
+	if len(prefetchFile) > 0 && (len(prefetchedDir) > 0 || prefetchPatterns || len(prefetchHintFrom) > 0) {
+		return "", invalidOption(fmt.Errorf("--prefetch-file conflicts with --prefetch-dir, --prefetch-patterns and --prefetch-hint-from"))
 	}
 
 	var patterns string
 
+	if len(prefetchHintFrom) > 0 {
+		files, err := prefetch.FromImage(context.Background(), prefetchHintFrom, c.Bool("target-insecure"))
+		if err != nil {
+			return "", errors.Wrapf(err, "get prefetch hint from image %s", prefetchHintFrom)
+		}
+		patterns = strings.Join(files, "\n")
+	}
+
 	if prefetchPatterns {
 		bytes, err := io.ReadAll(os.Stdin)
 		if err != nil {
@@ -166,6 +330,19 @@ func getPrefetchPatterns(c *cli.Context) (string, error) {
 		patterns = string(bytes)
 	}
 
+	if len(prefetchFile) > 0 {
+		file, err := os.Open(prefetchFile)
+		if err != nil {
+			return "", invalidOption(errors.Wrap(err, "open prefetch file"))
+		}
+		defer file.Close()
+		files, err := prefetch.ParsePatterns(file)
+		if err != nil {
+			return "", invalidOption(errors.Wrapf(err, "read prefetch patterns from %s", prefetchFile))
+		}
+		patterns = strings.Join(files, "\n")
+	}
+
 	if len(prefetchedDir) > 0 {
 		patterns = prefetchedDir
 	}
@@ -177,6 +354,56 @@ func getPrefetchPatterns(c *cli.Context) (string, error) {
 	return patterns, nil
 }
 
+func getSigner(c *cli.Context, verify bool) (*signature.Signer, error) {
+	signer, err := signature.New(signature.Opt{
+		Tool:                  c.String("signature-tool"),
+		BinaryPath:            c.String("signature-tool-path"),
+		Key:                   c.String("signature-key"),
+		CertificateIdentity:   c.String("certificate-identity"),
+		CertificateOIDCIssuer: c.String("certificate-oidc-issuer"),
+		Verify:                verify,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create image signer")
+	}
+	return signer, nil
+}
+
+func getConvertHooks(c *cli.Context) ([]hook.ConvertHook, error) {
+	hooks := []hook.ConvertHook{}
+	for _, spec := range c.StringSlice("hook") {
+		execHook, err := hook.ParseExecHook(spec)
+		if err != nil {
+			return nil, invalidOption(errors.Wrap(err, "parse hook"))
+		}
+		hooks = append(hooks, execHook)
+	}
+	return hooks, nil
+}
+
+// getTrustPolicy returns the policy restricting the source images to be
+// converted, nil is returned if no restriction is specified.
+func getTrustPolicy(c *cli.Context) (*converter.TrustPolicy, error) {
+	policy := &converter.TrustPolicy{
+		AllowedSources: c.StringSlice("allow-source"),
+		DeniedSources:  c.StringSlice("deny-source"),
+	}
+	if lockfile := c.String("source-lockfile"); lockfile != "" {
+		file, err := os.Open(lockfile)
+		if err != nil {
+			return nil, invalidOption(errors.Wrap(err, "open source lockfile"))
+		}
+		defer file.Close()
+		if policy.Digests, err = converter.ParseLockfile(file); err != nil {
+			return nil, invalidOption(errors.Wrapf(err, "parse source lockfile %s", lockfile))
+		}
+	}
+	if len(policy.AllowedSources) == 0 && len(policy.DeniedSources) == 0 && policy.Digests == nil {
+		return nil, nil
+	}
+	return policy, nil
+}
+
 func main() {
 	logrus.SetFormatter(&logrus.TextFormatter{
 		FullTimestamp: true,
@@ -206,6 +433,35 @@ func main() {
 			Usage:   "Set log level (panic, fatal, error, warn, info, debug, trace)",
 			EnvVars: []string{"LOG_LEVEL"},
 		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			Value:   "text",
+			Usage:   "Set log format, possible values: 'text', 'json'",
+			EnvVars: []string{"LOG_FORMAT"},
+		},
+		&cli.BoolFlag{
+			Name:    "backend-audit",
+			Value:   false,
+			Usage:   "Print the requests and bytes sent to OSS, S3 or http-proxy storage backend per operation class after the command",
+			EnvVars: []string{"BACKEND_AUDIT"},
+		},
+		&cli.StringFlag{
+			Name:    "backend-price-list",
+			Value:   "",
+			Usage:   "JSON file of the storage provider pricing to estimate the cost of backend requests, implies --backend-audit",
+			EnvVars: []string{"BACKEND_PRICE_LIST"},
+		},
+	}
+
+	app.Before = func(c *cli.Context) error {
+		if err := setupLogFormat(c); err != nil {
+			return err
+		}
+		return setupBackendAudit(c)
+	}
+	app.After = printBackendAudit
+	app.OnUsageError = func(_ *cli.Context, err error, _ bool) error {
+		return invalidOption(err)
 	}
 
 	app.Commands = []*cli.Command{
@@ -215,8 +471,8 @@ func main() {
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "source",
-					Required: true,
-					Usage:    "Source OCI image reference",
+					Required: false,
+					Usage:    "Source OCI image reference, required unless --batch is specified",
 					EnvVars:  []string{"SOURCE"},
 				},
 				&cli.StringFlag{
@@ -231,6 +487,36 @@ func main() {
 					Usage:    "Generate the target image reference by adding a suffix to the source image reference, conflicts with --target",
 					EnvVars:  []string{"TARGET_SUFFIX"},
 				},
+				&cli.StringFlag{
+					Name:    "target-format",
+					Value:   converter.TargetFormatNydus,
+					Usage:   "Format of the target image, possible values: 'nydus', 'estargz'",
+					EnvVars: []string{"TARGET_FORMAT"},
+				},
+				&cli.StringFlag{
+					Name:     "batch",
+					Required: false,
+					Usage:    "File (or '-' for STDIN) listing the images to convert in one process, each line is formatted as '<source> [<target>]', conflicts with --source",
+					EnvVars:  []string{"BATCH"},
+				},
+				&cli.UintFlag{
+					Name:    "batch-concurrency",
+					Value:   1,
+					Usage:   "Maximum number of images converted in parallel in batch mode",
+					EnvVars: []string{"BATCH_CONCURRENCY"},
+				},
+				&cli.StringFlag{
+					Name:    "batch-status-file",
+					Value:   "",
+					Usage:   "File to track per-image conversion status in batch mode, the succeeded images are skipped when resuming with the same file, default to '<batch>.status.json'",
+					EnvVars: []string{"BATCH_STATUS_FILE"},
+				},
+				&cli.StringFlag{
+					Name:    "source-filter",
+					Value:   "",
+					Usage:   "Only convert the source images matching the regular expression in batch mode",
+					EnvVars: []string{"SOURCE_FILTER"},
+				},
 				&cli.BoolFlag{
 					Name:     "source-insecure",
 					Required: false,
@@ -263,6 +549,11 @@ func main() {
 					Usage:     "Json configuration file for storage backend",
 					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
 				},
+				&cli.StringSliceFlag{
+					Name:    "backend-config-set",
+					Usage:   "Set the variable in backend config in KEY=VALUE format, '${KEY}' in config is substituted with VALUE, or the environment variable if not set",
+					EnvVars: []string{"BACKEND_CONFIG_SETS"},
+				},
 				&cli.BoolFlag{
 					Name:  "backend-force-push",
 					Value: false, Usage: "Force to push Nydus blobs even if they already exist in storage backend",
@@ -347,6 +638,40 @@ func main() {
 					Usage:   "Associate a reference to the source image, see https://github.com/opencontainers/distribution-spec/blob/main/spec.md#listing-referrers",
 					EnvVars: []string{"WITH_REFERRER"},
 				},
+				&cli.StringFlag{
+					Name:    "foreign-layer-policy",
+					Value:   converter.ForeignLayerPolicyConvert,
+					Usage:   "Policy of the non-distributable (foreign) layers in source image, possible values: 'convert' (fetch from the layer URLs and convert), 'skip' (drop from the target image), 'fail'",
+					EnvVars: []string{"FOREIGN_LAYER_POLICY"},
+				},
+				&cli.BoolFlag{
+					Name:    "audit-whiteout",
+					Value:   false,
+					Usage:   "Log how the whiteouts and opaque directories of source layers are translated, and warn the suspicious ones, for example the whiteout of non-existent path",
+					EnvVars: []string{"AUDIT_WHITEOUT"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "exclude-path",
+					Usage:   "Drop the entries matching the pattern (and the entries under them) from source layers, for example 'var/cache/*', can be specified multiple times",
+					EnvVars: []string{"EXCLUDE_PATHS"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "rewrite-path",
+					Usage:   "Move the entry and the entries under it in source layers in the format of FROM=TO, for example 'opt/app=app', can be specified multiple times",
+					EnvVars: []string{"REWRITE_PATHS"},
+				},
+				&cli.UintFlag{
+					Name:    "pull-concurrency",
+					Value:   5,
+					Usage:   "Number of source layers downloaded concurrently",
+					EnvVars: []string{"PULL_CONCURRENCY"},
+				},
+				&cli.UintFlag{
+					Name:    "pull-retries",
+					Value:   3,
+					Usage:   "Number of attempts to resume an interrupted source layer download with HTTP range request, the layer digest is verified on completion",
+					EnvVars: []string{"PULL_RETRIES"},
+				},
 				&cli.BoolFlag{
 					Name:    "oci",
 					Value:   false,
@@ -390,6 +715,35 @@ func main() {
 					Usage:   "Read prefetch list from STDIN, please input absolute paths line by line",
 					EnvVars: []string{"PREFETCH_PATTERNS"},
 				},
+				&cli.StringFlag{
+					Name:    "prefetch-hint-from",
+					Value:   "",
+					Usage:   "Read prefetch list from the annotation of an image generated by 'nydusify prefetch-hint', for example the previous version of target image",
+					EnvVars: []string{"PREFETCH_HINT_FROM"},
+				},
+				&cli.PathFlag{
+					Name:      "prefetch-file",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "Read prefetch list from file, one absolute path or glob per line, a glob is reduced to the directory of its static prefix",
+					EnvVars:   []string{"PREFETCH_FILE"},
+				},
+				&cli.BoolFlag{
+					Name:    "annotate-prefetch",
+					Value:   false,
+					Usage:   "Store the prefetch list in the annotation of target image, so that it is prefetched by the snapshotter at runtime",
+					EnvVars: []string{"ANNOTATE_PREFETCH"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "annotation",
+					Usage:   "Add the annotation in the format of KEY=VALUE to the manifest (or index) of target image, can be specified multiple times",
+					EnvVars: []string{"ANNOTATIONS"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "annotation-policy",
+					Usage:   "Transform the annotations inherited from source image by the rule 'strip:KEY_PATTERN' or 'rewrite:KEY=VALUE', for example 'strip:org.opencontainers.image.created', can be specified multiple times",
+					EnvVars: []string{"ANNOTATION_POLICIES"},
+				},
 				&cli.StringFlag{
 					Name:    "compressor",
 					Value:   "zstd",
@@ -415,6 +769,23 @@ func main() {
 					Usage:   "Working directory for image conversion",
 					EnvVars: []string{"WORK_DIR"},
 				},
+				&cli.StringSliceFlag{
+					Name:    "temp-dir",
+					Usage:   "Additional directories on other volumes to spread the temporary files of conversion, the one with the most available space is used, can be specified multiple times",
+					EnvVars: []string{"TEMP_DIRS"},
+				},
+				&cli.BoolFlag{
+					Name:    "checkpoint",
+					Value:   false,
+					Usage:   "Keep the progress of conversion under the work directory on failure, so that running the same command again resumes from the pulled, converted and pushed layers",
+					EnvVars: []string{"CHECKPOINT"},
+				},
+				&cli.BoolFlag{
+					Name:    "skip-space-check",
+					Value:   false,
+					Usage:   "Skip checking the available disk space of work directory before conversion",
+					EnvVars: []string{"SKIP_SPACE_CHECK"},
+				},
 				&cli.StringFlag{
 					Name:    "nydus-image",
 					Value:   "nydus-image",
@@ -427,50 +798,173 @@ func main() {
 					Usage:   "File path to save the metrics collected during conversion in JSON format, for example: './output.json'",
 					EnvVars: []string{"OUTPUT_JSON"},
 				},
+
+				&cli.BoolFlag{
+					Name:    "sign",
+					Value:   false,
+					Usage:   "Sign the target image after pushing",
+					EnvVars: []string{"SIGN"},
+				},
+				&cli.BoolFlag{
+					Name:    "verify-source",
+					Value:   false,
+					Usage:   "Verify the signature of source image before conversion",
+					EnvVars: []string{"VERIFY_SOURCE"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-tool",
+					Value:   "cosign",
+					Usage:   "Tool to sign or verify image signature, possible values: 'cosign', 'notation'",
+					EnvVars: []string{"SIGNATURE_TOOL"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-tool-path",
+					Value:   "",
+					Usage:   "Path to the signature tool binary, default to search in PATH",
+					EnvVars: []string{"SIGNATURE_TOOL_PATH"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-key",
+					Value:   "",
+					Usage:   "Key reference of signature tool, cosign works in keyless mode if not specified",
+					EnvVars: []string{"SIGNATURE_KEY"},
+				},
+				&cli.StringFlag{
+					Name:    "certificate-identity",
+					Value:   "",
+					Usage:   "Expected identity in the certificate for cosign keyless verification",
+					EnvVars: []string{"CERTIFICATE_IDENTITY"},
+				},
+				&cli.StringFlag{
+					Name:    "certificate-oidc-issuer",
+					Value:   "",
+					Usage:   "Expected OIDC issuer in the certificate for cosign keyless verification",
+					EnvVars: []string{"CERTIFICATE_OIDC_ISSUER"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "hook",
+					Usage:   "Run hook command at conversion stage, formatted as '<stage>=<command>', possible stages: 'pre-layer', 'post-layer', 'pre-push', can be specified multiple times",
+					EnvVars: []string{"HOOK"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "allow-source",
+					Usage:   "Only convert the source images whose normalized reference starts with the prefix, e.g. 'docker.io/library/', can be specified multiple times",
+					EnvVars: []string{"ALLOW_SOURCE"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "deny-source",
+					Usage:   "Refuse to convert the source images whose normalized reference starts with the prefix, takes precedence over --allow-source, can be specified multiple times",
+					EnvVars: []string{"DENY_SOURCE"},
+				},
+				&cli.BoolFlag{
+					Name:    "attach-provenance",
+					Value:   false,
+					Usage:   "Attach the SLSA provenance of conversion to the target image as an OCI referrer after pushing",
+					EnvVars: []string{"ATTACH_PROVENANCE"},
+				},
+				&cli.PathFlag{
+					Name:      "attach-sbom",
+					TakesFile: true,
+					Usage:     "Attach the SBOM document (SPDX or CycloneDX in JSON format) to the target image as an OCI referrer after pushing",
+					EnvVars:   []string{"ATTACH_SBOM"},
+				},
+				&cli.PathFlag{
+					Name:      "source-lockfile",
+					TakesFile: true,
+					Usage:     "File pinning the digests of source images, one '<source> <digest>' per line, only the pinned images with matched digest are converted",
+					EnvVars:   []string{"SOURCE_LOCKFILE"},
+				},
 			},
 			Action: func(c *cli.Context) error {
 				setupLogLevel(c)
 
-				targetRef, err := getTargetReference(c)
-				if err != nil {
-					return err
+				batch := c.String("batch")
+				if batch == "" && c.String("source") == "" {
+					return invalidOption(fmt.Errorf("--source or --batch is required"))
+				}
+				if batch != "" && c.String("source") != "" {
+					return invalidOption(fmt.Errorf("--source conflicts with --batch"))
+				}
+				if batch == "-" && c.Bool("prefetch-patterns") {
+					return invalidOption(fmt.Errorf("--batch from STDIN conflicts with --prefetch-patterns"))
+				}
+				if batch != "" && c.String("prefetch-hint-from") != "" {
+					return invalidOption(fmt.Errorf("--batch conflicts with --prefetch-hint-from"))
+				}
+				if batch != "" && c.String("attach-sbom") != "" {
+					return invalidOption(fmt.Errorf("--batch conflicts with --attach-sbom"))
+				}
+				if batch != "" && c.Bool("checkpoint") {
+					return invalidOption(fmt.Errorf("--batch conflicts with --checkpoint, the batch is resumed by --batch-status-file"))
 				}
 
-				backendType, backendConfig, err := getBackendConfig(c, "", false)
-				if err != nil {
-					return err
+				if c.Uint("pull-concurrency") < 1 {
+					return invalidOption(fmt.Errorf("--pull-concurrency should be greater than 0"))
+				}
+
+				foreignLayerPolicy := c.String("foreign-layer-policy")
+				if !isPossibleValue(converter.ForeignLayerPolicies, foreignLayerPolicy) {
+					return invalidOption(fmt.Errorf("--foreign-layer-policy should be one of %v", converter.ForeignLayerPolicies))
 				}
 
-				cacheRef, err := getCacheReference(c, targetRef)
+				targetFormat := c.String("target-format")
+				possibleTargetFormats := []string{converter.TargetFormatNydus, converter.TargetFormatEstargz}
+				if !isPossibleValue(possibleTargetFormats, targetFormat) {
+					return invalidOption(fmt.Errorf("--target-format should be one of %v", possibleTargetFormats))
+				}
+				if targetFormat != converter.TargetFormatNydus {
+					for _, name := range nydusOnlyConvertFlags {
+						if c.IsSet(name) {
+							return invalidOption(fmt.Errorf("--%s is only supported by nydus target format", name))
+						}
+					}
+				}
+
+				var targetRef, cacheRef string
+				var err error
+				if batch == "" {
+					if targetRef, err = getTargetReference(c); err != nil {
+						return err
+					}
+					if cacheRef, err = getCacheReference(c, targetRef); err != nil {
+						return err
+					}
+				}
+
+				backendType, backendConfig, err := getBackendConfig(c, "", false)
 				if err != nil {
 					return err
 				}
+
 				cacheMaxRecords := c.Uint("build-cache-max-records")
 				if cacheMaxRecords < 1 {
-					return fmt.Errorf("--build-cache-max-records should be greater than 0")
+					return invalidOption(fmt.Errorf("--build-cache-max-records should be greater than 0"))
 				}
 				if cacheMaxRecords > maxCacheMaxRecords {
-					return fmt.Errorf("--build-cache-max-records should not be greater than %d", maxCacheMaxRecords)
+					return invalidOption(fmt.Errorf("--build-cache-max-records should not be greater than %d", maxCacheMaxRecords))
 				}
 				cacheVersion := c.String("build-cache-version")
 
 				fsVersion := c.String("fs-version")
 				possibleFsVersions := []string{"5", "6"}
 				if !isPossibleValue(possibleFsVersions, fsVersion) {
-					return fmt.Errorf("--fs-version should be one of %v", possibleFsVersions)
+					return invalidOption(fmt.Errorf("--fs-version should be one of %v", possibleFsVersions))
 				}
 
 				prefetchPatterns, err := getPrefetchPatterns(c)
 				if err != nil {
 					return err
 				}
+				if c.Bool("annotate-prefetch") && prefetchPatterns == "/" {
+					return invalidOption(fmt.Errorf("--annotate-prefetch requires the prefetch list specified by --prefetch-dir, --prefetch-patterns, --prefetch-hint-from or --prefetch-file"))
+				}
 
 				chunkDictRef := ""
 				chunkDict := c.String("chunk-dict")
 				if chunkDict != "" {
 					_, _, chunkDictRef, err = converter.ParseChunkDictArgs(chunkDict)
 					if err != nil {
-						return errors.Wrap(err, "parse chunk dict arguments")
+						return invalidOption(errors.Wrap(err, "parse chunk dict arguments"))
 					}
 				}
 
@@ -490,13 +984,19 @@ func main() {
 
 				opt := converter.Opt{
 					WorkDir:        c.String("work-dir"),
+					TempDirs:       c.StringSlice("temp-dir"),
+					SkipSpaceCheck: c.Bool("skip-space-check"),
 					NydusImagePath: c.String("nydus-image"),
 
 					Source:         c.String("source"),
 					Target:         targetRef,
+					TargetFormat:   targetFormat,
 					SourceInsecure: c.Bool("source-insecure"),
 					TargetInsecure: c.Bool("target-insecure"),
 
+					PullConcurrency: c.Uint("pull-concurrency"),
+					PullRetries:     c.Uint("pull-retries"),
+
 					BackendType:      backendType,
 					BackendConfig:    backendConfig,
 					BackendForcePush: c.Bool("backend-force-push"),
@@ -510,6 +1010,7 @@ func main() {
 					ChunkDictInsecure: c.Bool("chunk-dict-insecure"),
 
 					PrefetchPatterns: prefetchPatterns,
+					AnnotatePrefetch: c.Bool("annotate-prefetch"),
 					MergePlatform:    c.Bool("merge-platform"),
 					Docker2OCI:       docker2OCI,
 					FsVersion:        fsVersion,
@@ -518,50 +1019,268 @@ func main() {
 					ChunkSize:        c.String("chunk-size"),
 					BatchSize:        c.String("batch-size"),
 
-					OCIRef:       c.Bool("oci-ref"),
-					WithReferrer: c.Bool("with-referrer"),
-					AllPlatforms: c.Bool("all-platforms"),
-					Platforms:    c.String("platform"),
+					OCIRef:             c.Bool("oci-ref"),
+					WithReferrer:       c.Bool("with-referrer"),
+					ForeignLayerPolicy: foreignLayerPolicy,
+					AuditWhiteout:      c.Bool("audit-whiteout"),
+					AllPlatforms:       c.Bool("all-platforms"),
+					Platforms:          c.String("platform"),
 
 					OutputJSON: c.String("output-json"),
+
+					SignTarget:   c.Bool("sign"),
+					VerifySource: c.Bool("verify-source"),
+
+					AttachProvenance: c.Bool("attach-provenance"),
+					SBOMPath:         c.String("attach-sbom"),
+					ToolVersion:      gitVersion,
+
+					Checkpoint: c.Bool("checkpoint"),
+				}
+
+				if opt.SignTarget || opt.VerifySource {
+					if opt.Signer, err = getSigner(c, opt.VerifySource); err != nil {
+						return err
+					}
+				}
+
+				if opt.Hooks, err = getConvertHooks(c); err != nil {
+					return err
+				}
+
+				if opt.TrustPolicy, err = getTrustPolicy(c); err != nil {
+					return err
+				}
+
+				if opt.PathRules, err = converter.ParsePathRules(c.StringSlice("exclude-path"), c.StringSlice("rewrite-path")); err != nil {
+					return invalidOption(err)
 				}
 
-				return converter.Convert(context.Background(), opt)
+				if opt.Annotations, err = annotation.ParseAnnotations(c.StringSlice("annotation")); err != nil {
+					return invalidOption(err)
+				}
+				if opt.AnnotationPolicy, err = annotation.ParsePolicy(c.StringSlice("annotation-policy")); err != nil {
+					return invalidOption(err)
+				}
+
+				ctx, stop := signalContext()
+				defer stop()
+
+				if batch != "" {
+					items, err := getBatchItems(c)
+					if err != nil {
+						return err
+					}
+					statusPath := c.String("batch-status-file")
+					if statusPath == "" && batch != "-" {
+						statusPath = batch + ".status.json"
+					}
+					_, err = converter.BatchConvert(ctx, opt, items, converter.BatchOpt{
+						Concurrency: c.Uint("batch-concurrency"),
+						StatusPath:  statusPath,
+					})
+					return err
+				}
+
+				return converter.Convert(ctx, opt)
 			},
 		},
 		{
-			Name:  "check",
-			Usage: "Verify nydus image format and content",
+			Name:  "serve",
+			Usage: "Run as a conversion service, which accepts the conversion jobs by HTTP API",
 			Flags: []cli.Flag{
 				&cli.StringFlag{
-					Name:     "source",
-					Required: false,
-					Usage:    "Source OCI image reference",
-					EnvVars:  []string{"SOURCE"},
+					Name:    "address",
+					Value:   "127.0.0.1:8080",
+					Usage:   "Address to serve the HTTP API on",
+					EnvVars: []string{"ADDRESS"},
 				},
 				&cli.StringFlag{
-					Name:     "target",
-					Required: true,
-					Usage:    "Target (Nydus) image reference",
-					EnvVars:  []string{"TARGET"},
+					Name:    "state-dir",
+					Value:   "./jobs",
+					Usage:   "Directory to persist the jobs, the queued and interrupted jobs are resumed by restarting with the same directory",
+					EnvVars: []string{"STATE_DIR"},
+				},
+				&cli.UintFlag{
+					Name:    "concurrency",
+					Value:   1,
+					Usage:   "Maximum number of jobs run in parallel",
+					EnvVars: []string{"CONCURRENCY"},
 				},
 				&cli.BoolFlag{
-					Name:     "source-insecure",
-					Required: false,
-					Usage:    "Skip verifying server certs for HTTPS source registry",
-					EnvVars:  []string{"SOURCE_INSECURE"},
+					Name:    "source-insecure",
+					Usage:   "Skip verifying server certs for HTTPS source registry",
+					EnvVars: []string{"SOURCE_INSECURE"},
 				},
 				&cli.BoolFlag{
-					Name:     "target-insecure",
-					Required: false,
-					Usage:    "Skip verifying server certs for HTTPS target registry",
-					EnvVars:  []string{"TARGET_INSECURE"},
+					Name:    "target-insecure",
+					Usage:   "Skip verifying server certs for HTTPS target registry",
+					EnvVars: []string{"TARGET_INSECURE"},
 				},
-
 				&cli.StringFlag{
 					Name:    "backend-type",
 					Value:   "",
-					Usage:   "Type of storage backend, enable verification of file data in Nydus image if specified, possible values: 'oss', 's3'",
+					Usage:   "Type of storage backend, possible values: 'oss', 's3'",
+					EnvVars: []string{"BACKEND_TYPE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-config",
+					Value:   "",
+					Usage:   "Json configuration string for storage backend",
+					EnvVars: []string{"BACKEND_CONFIG"},
+				},
+				&cli.PathFlag{
+					Name:      "backend-config-file",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "Json configuration file for storage backend",
+					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "backend-config-set",
+					Usage:   "Set the variable in backend config in KEY=VALUE format, '${KEY}' in config is substituted with VALUE, or the environment variable if not set",
+					EnvVars: []string{"BACKEND_CONFIG_SETS"},
+				},
+				&cli.StringFlag{
+					Name:    "platform",
+					Value:   "linux/" + runtime.GOARCH,
+					Usage:   "Convert images for specific platforms by default, for example: 'linux/amd64,linux/arm64'",
+					EnvVars: []string{"PLATFORM"},
+				},
+				&cli.StringFlag{
+					Name:    "fs-version",
+					Value:   "6",
+					Usage:   "Nydus image format version number by default, possible values: 5, 6",
+					EnvVars: []string{"FS_VERSION"},
+				},
+				&cli.StringFlag{
+					Name:    "compressor",
+					Value:   "zstd",
+					Usage:   "Algorithm to compress image data blob by default, possible values: none, lz4_block, zstd",
+					EnvVars: []string{"COMPRESSOR"},
+				},
+				&cli.StringFlag{
+					Name:    "work-dir",
+					Value:   "./tmp",
+					Usage:   "Working directory for image conversion",
+					EnvVars: []string{"WORK_DIR"},
+				},
+				&cli.StringFlag{
+					Name:    "nydus-image",
+					Value:   "nydus-image",
+					Usage:   "Path to the nydus-image binary, default to search in PATH",
+					EnvVars: []string{"NYDUS_IMAGE"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				if !isPossibleValue([]string{"5", "6"}, c.String("fs-version")) {
+					return invalidOption(fmt.Errorf("--fs-version should be one of %v", []string{"5", "6"}))
+				}
+				backendType, backendConfig, err := getBackendConfig(c, "", false)
+				if err != nil {
+					return err
+				}
+
+				srv, err := server.New(server.Opt{
+					StateDir:    c.String("state-dir"),
+					Concurrency: c.Uint("concurrency"),
+					Base: converter.Opt{
+						WorkDir:        c.String("work-dir"),
+						NydusImagePath: c.String("nydus-image"),
+
+						SourceInsecure: c.Bool("source-insecure"),
+						TargetInsecure: c.Bool("target-insecure"),
+
+						PullConcurrency: 5,
+						PullRetries:     3,
+
+						BackendType:   backendType,
+						BackendConfig: backendConfig,
+
+						CacheMaxRecords: maxCacheMaxRecords,
+						CacheVersion:    "v1",
+
+						PrefetchPatterns:   "/",
+						FsVersion:          c.String("fs-version"),
+						Compressor:         c.String("compressor"),
+						TargetFormat:       converter.TargetFormatNydus,
+						ForeignLayerPolicy: converter.ForeignLayerPolicyConvert,
+						Platforms:          c.String("platform"),
+
+						ToolVersion: gitVersion,
+					},
+				})
+				if err != nil {
+					return invalidOption(err)
+				}
+
+				ctx, stop := signalContext()
+				defer stop()
+
+				httpServer := &http.Server{
+					Addr:              c.String("address"),
+					Handler:           srv.Handler(),
+					ReadHeaderTimeout: 10 * time.Second,
+				}
+				go func() {
+					<-ctx.Done()
+					if err := httpServer.Shutdown(context.Background()); err != nil {
+						logrus.WithError(err).Warn("shutdown HTTP server")
+					}
+				}()
+
+				done := make(chan struct{})
+				go func() {
+					srv.Run(ctx)
+					close(done)
+				}()
+
+				logrus.Infof("serving conversion API on %s", c.String("address"))
+				if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					stop()
+					<-done
+					return errors.Wrap(err, "serve HTTP API")
+				}
+				// Wait for the running jobs to be interrupted and queued again.
+				<-done
+				return nil
+			},
+		},
+		{
+			Name:  "check",
+			Usage: "Verify nydus image format and content",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "source",
+					Required: false,
+					Usage:    "Source OCI image reference",
+					EnvVars:  []string{"SOURCE"},
+				},
+				&cli.StringFlag{
+					Name:     "target",
+					Required: true,
+					Usage:    "Target (Nydus) image reference",
+					EnvVars:  []string{"TARGET"},
+				},
+				&cli.BoolFlag{
+					Name:     "source-insecure",
+					Required: false,
+					Usage:    "Skip verifying server certs for HTTPS source registry",
+					EnvVars:  []string{"SOURCE_INSECURE"},
+				},
+				&cli.BoolFlag{
+					Name:     "target-insecure",
+					Required: false,
+					Usage:    "Skip verifying server certs for HTTPS target registry",
+					EnvVars:  []string{"TARGET_INSECURE"},
+				},
+
+				&cli.StringFlag{
+					Name:    "backend-type",
+					Value:   "",
+					Usage:   "Type of storage backend, enable verification of file data in Nydus image if specified, possible values: 'oss', 's3', 'http-proxy'",
 					EnvVars: []string{"BACKEND_TYPE"},
 				},
 				&cli.StringFlag{
@@ -608,18 +1327,139 @@ func main() {
 					Usage:   "Path to the nydusd binary, default to search in PATH",
 					EnvVars: []string{"NYDUSD"},
 				},
+
+				&cli.BoolFlag{
+					Name:    "verify-signature",
+					Value:   false,
+					Usage:   "Verify the signature of target image",
+					EnvVars: []string{"VERIFY_SIGNATURE"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-tool",
+					Value:   "cosign",
+					Usage:   "Tool to sign or verify image signature, possible values: 'cosign', 'notation'",
+					EnvVars: []string{"SIGNATURE_TOOL"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-tool-path",
+					Value:   "",
+					Usage:   "Path to the signature tool binary, default to search in PATH",
+					EnvVars: []string{"SIGNATURE_TOOL_PATH"},
+				},
+				&cli.StringFlag{
+					Name:    "signature-key",
+					Value:   "",
+					Usage:   "Key reference of signature tool, cosign works in keyless mode if not specified",
+					EnvVars: []string{"SIGNATURE_KEY"},
+				},
+				&cli.StringFlag{
+					Name:    "certificate-identity",
+					Value:   "",
+					Usage:   "Expected identity in the certificate for cosign keyless verification",
+					EnvVars: []string{"CERTIFICATE_IDENTITY"},
+				},
+				&cli.StringFlag{
+					Name:    "certificate-oidc-issuer",
+					Value:   "",
+					Usage:   "Expected OIDC issuer in the certificate for cosign keyless verification",
+					EnvVars: []string{"CERTIFICATE_OIDC_ISSUER"},
+				},
+
+				&cli.BoolFlag{
+					Name:    "perf",
+					Value:   false,
+					Usage:   "Mount the Nydus image with an empty cache to measure the stat, random read and sequential read performance, the result is saved to perf_result.json of work directory",
+					EnvVars: []string{"PERF"},
+				},
+				&cli.PathFlag{
+					Name:      "perf-baseline",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "JSON file of the expected performance, for example the perf_result.json of a previous check, fail the check if the performance regresses beyond --perf-tolerance",
+					EnvVars:   []string{"PERF_BASELINE"},
+				},
+				&cli.Float64Flag{
+					Name:    "perf-tolerance",
+					Value:   0.2,
+					Usage:   "Allowed ratio of performance regression against --perf-baseline",
+					EnvVars: []string{"PERF_TOLERANCE"},
+				},
+				&cli.IntFlag{
+					Name:    "perf-random-reads",
+					Value:   1000,
+					Usage:   "Number of 4KiB random reads to measure the random read performance",
+					EnvVars: []string{"PERF_RANDOM_READS"},
+				},
+
+				&cli.BoolFlag{
+					Name:    "against-running-snapshotter",
+					Value:   false,
+					Usage:   "Compare the source image with the snapshot mounted by the running nydus-snapshotter on this node instead of mounting the target image, requires --source and --snapshot-id",
+					EnvVars: []string{"AGAINST_RUNNING_SNAPSHOTTER"},
+				},
+				&cli.StringFlag{
+					Name:    "snapshot-id",
+					Value:   "",
+					Usage:   "ID of the snapshot to be compared with --against-running-snapshotter",
+					EnvVars: []string{"SNAPSHOT_ID"},
+				},
+				&cli.PathFlag{
+					Name:      "snapshotter-system-sock",
+					Value:     tool.DefaultSnapshotterSystemSock,
+					TakesFile: true,
+					Usage:     "Socket of the system controller API of nydus-snapshotter",
+					EnvVars:   []string{"SNAPSHOTTER_SYSTEM_SOCK"},
+				},
 			},
 			Action: func(c *cli.Context) error {
 				setupLogLevel(c)
 
-				backendType, backendConfig, err := getBackendConfig(c, "", false)
+				backendType, backendConfig, err := getBackendConfigOfTypes(c, "", false, readOnlyBackendTypes)
 				if err != nil {
 					return err
 				}
 
+				var perfBaseline *rule.PerfResult
+				if c.String("perf-baseline") != "" {
+					if !c.Bool("perf") {
+						return invalidOption(fmt.Errorf("--perf-baseline requires --perf"))
+					}
+					data, err := os.ReadFile(c.String("perf-baseline"))
+					if err != nil {
+						return invalidOption(errors.Wrap(err, "read performance baseline"))
+					}
+					perfBaseline = &rule.PerfResult{}
+					if err := json.Unmarshal(data, perfBaseline); err != nil {
+						return invalidOption(errors.Wrap(err, "parse performance baseline"))
+					}
+				}
+				if tolerance := c.Float64("perf-tolerance"); tolerance < 0 || tolerance >= 1 {
+					return invalidOption(fmt.Errorf("--perf-tolerance should be in [0, 1)"))
+				}
+
+				snapshotID := ""
+				if c.Bool("against-running-snapshotter") {
+					if err := utils.RequireLinux("comparing with running snapshotter"); err != nil {
+						return err
+					}
+					if c.String("source") == "" {
+						return invalidOption(fmt.Errorf("--against-running-snapshotter requires --source"))
+					}
+					if snapshotID = c.String("snapshot-id"); snapshotID == "" {
+						return invalidOption(fmt.Errorf("--against-running-snapshotter requires --snapshot-id"))
+					}
+				}
+
 				_, arch, err := provider.ExtractOsArch(c.String("platform"))
 				if err != nil {
-					return err
+					return invalidOption(err)
+				}
+
+				var signer *signature.Signer
+				if c.Bool("verify-signature") {
+					if signer, err = getSigner(c, true); err != nil {
+						return err
+					}
 				}
 
 				checker, err := checker.New(checker.Opt{
@@ -634,6 +1474,15 @@ func main() {
 					BackendType:    backendType,
 					BackendConfig:  backendConfig,
 					ExpectedArch:   arch,
+					Signer:         signer,
+
+					Perf:            c.Bool("perf"),
+					PerfBaseline:    perfBaseline,
+					PerfTolerance:   c.Float64("perf-tolerance"),
+					PerfRandomReads: c.Int("perf-random-reads"),
+
+					SnapshotID:      snapshotID,
+					SnapshotterSock: c.String("snapshotter-system-sock"),
 				})
 				if err != nil {
 					return err
@@ -642,6 +1491,262 @@ func main() {
 				return checker.Check(context.Background())
 			},
 		},
+		{
+			Name:  "verify-blob",
+			Usage: "Verify the integrity of data chunks referenced by Nydus bootstrap in storage backend",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "bootstrap",
+					Required: true,
+					Usage:    "File path of Nydus bootstrap",
+					EnvVars:  []string{"BOOTSTRAP"},
+				},
+				&cli.StringFlag{
+					Name:    "target",
+					Value:   "",
+					Usage:   "Nydus image reference, read data blobs from its registry repository",
+					EnvVars: []string{"TARGET"},
+				},
+				&cli.BoolFlag{
+					Name:    "target-insecure",
+					Value:   false,
+					Usage:   "Skip verifying server certs for HTTPS target registry",
+					EnvVars: []string{"TARGET_INSECURE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-type",
+					Value:   "",
+					Usage:   "Type of storage backend to read data blobs, possible values: 'oss', 's3', 'http-proxy'",
+					EnvVars: []string{"BACKEND_TYPE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-config",
+					Value:   "",
+					Usage:   "Json string for storage backend configuration",
+					EnvVars: []string{"BACKEND_CONFIG"},
+				},
+				&cli.PathFlag{
+					Name:      "backend-config-file",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "Json configuration file for storage backend",
+					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
+				},
+				&cli.StringFlag{
+					Name:    "blob-dir",
+					Value:   "",
+					Usage:   "Local directory to read data blobs",
+					EnvVars: []string{"BLOB_DIR"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "blob",
+					Usage:   "Only verify the specified blob ID, can be specified multiple times",
+					EnvVars: []string{"BLOB"},
+				},
+				&cli.UintFlag{
+					Name:    "concurrency",
+					Value:   1,
+					Usage:   "Maximum number of blobs verified in parallel",
+					EnvVars: []string{"CONCURRENCY"},
+				},
+				&cli.StringFlag{
+					Name:    "nydus-image",
+					Value:   "nydus-image",
+					Usage:   "Path to the nydus-image binary, default to search in PATH",
+					EnvVars: []string{"NYDUS_IMAGE"},
+				},
+				&cli.StringFlag{
+					Name:    "output-json",
+					Value:   "",
+					Usage:   "File path to save the verification report in JSON format",
+					EnvVars: []string{"OUTPUT_JSON"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				backendType, backendConfig, err := getBackendConfigOfTypes(c, "", false, readOnlyBackendTypes)
+				if err != nil {
+					return err
+				}
+
+				sources := 0
+				for _, set := range []bool{c.String("target") != "", backendType != "", c.String("blob-dir") != ""} {
+					if set {
+						sources++
+					}
+				}
+				if sources != 1 {
+					return invalidOption(fmt.Errorf("one of --target, --backend-type and --blob-dir should be specified"))
+				}
+
+				var blobReader verifier.BlobReader
+				switch {
+				case c.String("target") != "":
+					remoter, err := provider.DefaultRemote(c.String("target"), c.Bool("target-insecure"))
+					if err != nil {
+						return errors.Wrap(err, "create remote")
+					}
+					blobReader = verifier.RemoteBlobReader(remoter)
+				case backendType != "":
+					bkd, err := backend.NewBackend(backendType, []byte(backendConfig), nil)
+					if err != nil {
+						return errors.Wrap(err, "create backend")
+					}
+					blobReader = verifier.BackendBlobReader(bkd)
+				default:
+					blobReader = verifier.LocalBlobReader(c.String("blob-dir"))
+				}
+
+				v, err := verifier.New(verifier.Opt{
+					NydusImagePath: c.String("nydus-image"),
+					BootstrapPath:  c.String("bootstrap"),
+					BlobIDs:        c.StringSlice("blob"),
+					Concurrency:    c.Uint("concurrency"),
+					BlobReader:     blobReader,
+				})
+				if err != nil {
+					return err
+				}
+				report, err := v.Verify(context.Background())
+				if err != nil {
+					return err
+				}
+
+				if outputJSON := c.String("output-json"); outputJSON != "" {
+					data, err := json.MarshalIndent(report, "", "  ")
+					if err != nil {
+						return errors.Wrap(err, "marshal verification report")
+					}
+					if err := os.WriteFile(outputJSON, data, 0644); err != nil {
+						return errors.Wrap(err, "write verification report")
+					}
+				}
+
+				corrupted, missing := report.Corrupted()
+				if corrupted > 0 || missing > 0 {
+					return utils.WithExitCode(utils.ExitCodeValidation, fmt.Errorf("found %d corrupted and %d missing chunks", corrupted, missing))
+				}
+				logrus.Infof("All chunks in %d blobs are verified", len(report.Blobs))
+
+				return nil
+			},
+		},
+		{
+			Name:  "prefetch-hint",
+			Usage: "Generate prefetch list of Nydus image from the file access trace of container runtime",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "trace",
+					Required: true,
+					Usage:    "Path to the file access trace, or '-' to read from STDIN",
+					EnvVars:  []string{"TRACE"},
+				},
+				&cli.StringFlag{
+					Name:    "trace-format",
+					Value:   prefetch.TraceFormatNydusd,
+					Usage:   "Format of the trace, possible values: 'nydusd' (access pattern metrics of nydusd), 'fanotify' (accessed file paths line by line)",
+					EnvVars: []string{"TRACE_FORMAT"},
+				},
+				&cli.StringFlag{
+					Name:    "bootstrap",
+					Usage:   "Path to the Nydus image bootstrap, required by 'nydusd' trace format to resolve file paths",
+					EnvVars: []string{"BOOTSTRAP"},
+				},
+				&cli.StringFlag{
+					Name:    "strip-prefix",
+					Value:   "",
+					Usage:   "Strip the prefix from file paths in trace, the files without the prefix are ignored, e.g. rootfs mountpoint of container",
+					EnvVars: []string{"STRIP_PREFIX"},
+				},
+				&cli.UintFlag{
+					Name:    "max-files",
+					Value:   0,
+					Usage:   "Maximum number of files in prefetch list, 0 means no limit",
+					EnvVars: []string{"MAX_FILES"},
+				},
+				&cli.StringFlag{
+					Name:    "output",
+					Value:   "",
+					Usage:   "File path to save the prefetch list line by line, which can be passed to 'nydusify convert --prefetch-patterns' by STDIN",
+					EnvVars: []string{"OUTPUT"},
+				},
+				&cli.StringFlag{
+					Name:    "target",
+					Value:   "",
+					Usage:   "Store the prefetch list in the annotation of target image, which can be used by 'nydusify convert --prefetch-hint-from'",
+					EnvVars: []string{"TARGET"},
+				},
+				&cli.BoolFlag{
+					Name:    "target-insecure",
+					Value:   false,
+					Usage:   "Skip verifying server certs for HTTPS target registry",
+					EnvVars: []string{"TARGET_INSECURE"},
+				},
+				&cli.StringFlag{
+					Name:    "nydus-image",
+					Value:   "nydus-image",
+					Usage:   "Path to the nydus-image binary, default to search in PATH",
+					EnvVars: []string{"NYDUS_IMAGE"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				traceFormat := c.String("trace-format")
+				possibleTraceFormats := []string{prefetch.TraceFormatNydusd, prefetch.TraceFormatFanotify}
+				if !isPossibleValue(possibleTraceFormats, traceFormat) {
+					return invalidOption(fmt.Errorf("--trace-format should be one of %v", possibleTraceFormats))
+				}
+				if traceFormat == prefetch.TraceFormatNydusd && c.String("bootstrap") == "" {
+					return invalidOption(fmt.Errorf("--bootstrap is required by %s trace format", traceFormat))
+				}
+
+				trace := os.Stdin
+				if c.String("trace") != "-" {
+					file, err := os.Open(c.String("trace"))
+					if err != nil {
+						return errors.Wrap(err, "open trace")
+					}
+					defer file.Close()
+					trace = file
+				}
+
+				files, err := prefetch.Generate(prefetch.Opt{
+					TraceFormat:    traceFormat,
+					NydusImagePath: c.String("nydus-image"),
+					BootstrapPath:  c.String("bootstrap"),
+					StripPrefix:    c.String("strip-prefix"),
+					MaxFiles:       c.Uint("max-files"),
+				}, trace)
+				if err != nil {
+					return err
+				}
+				if len(files) == 0 {
+					return fmt.Errorf("no accessed file is found in trace")
+				}
+				logrus.Infof("Generated prefetch list with %d files", len(files))
+
+				list := strings.Join(files, "\n") + "\n"
+				if output := c.String("output"); output != "" {
+					if err := os.WriteFile(output, []byte(list), 0644); err != nil {
+						return errors.Wrap(err, "write prefetch list")
+					}
+				}
+				if target := c.String("target"); target != "" {
+					desc, err := prefetch.Annotate(context.Background(), target, c.Bool("target-insecure"), files)
+					if err != nil {
+						return errors.Wrapf(err, "annotate image %s", target)
+					}
+					logrus.Infof("Pushed image %s with prefetch list, digest %s", target, desc.Digest)
+				}
+				if c.String("output") == "" && c.String("target") == "" {
+					fmt.Print(list)
+				}
+
+				return nil
+			},
+		},
 		{
 			Name:  "chunkdict",
 			Usage: "Deduplicate chunk for Nydus image (experimental)",
@@ -738,23 +1843,331 @@ func main() {
 							SourceInsecure: c.Bool("source-insecure"),
 							TargetInsecure: c.Bool("target-insecure"),
 
-							BackendType:      backendType,
-							BackendConfig:    backendConfig,
-							BackendForcePush: c.Bool("backend-force-push"),
+							BackendType:      backendType,
+							BackendConfig:    backendConfig,
+							BackendForcePush: c.Bool("backend-force-push"),
+
+							WorkDir:        c.String("work-dir"),
+							NydusImagePath: c.String("nydus-image"),
+							ExpectedArch:   arch,
+							AllPlatforms:   c.Bool("all-platforms"),
+							Platforms:      c.String("platform"),
+						})
+						if err != nil {
+							return err
+						}
+
+						return generator.Generate(context.Background())
+					},
+				},
+			},
+		},
+		{
+			Name:  "analyze",
+			Usage: "Analyze the chunk level overlap of Nydus images to evaluate the deduplication with chunk dictionary",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:     "sources",
+					Required: true,
+					Usage:    "Two or more Nydus image references (Multiple images should be split by commas)",
+					EnvVars:  []string{"SOURCES"},
+				},
+				&cli.BoolFlag{
+					Name:    "source-insecure",
+					Value:   false,
+					Usage:   "Skip verifying server certs for HTTPS source registry",
+					EnvVars: []string{"SOURCE_INSECURE"},
+				},
+				&cli.UintFlag{
+					Name:    "candidates",
+					Value:   3,
+					Usage:   "Maximum number of images recommended to generate chunk dictionary from",
+					EnvVars: []string{"CANDIDATES"},
+				},
+				&cli.StringFlag{
+					Name:  "platform",
+					Value: "linux/" + runtime.GOARCH,
+					Usage: "Specify platform identifier to choose image manifest, possible values: 'linux/amd64' and 'linux/arm64'",
+				},
+				&cli.StringFlag{
+					Name:    "output-json",
+					Value:   "",
+					Usage:   "File path to save the analysis report in JSON format, print to stdout if unset",
+					EnvVars: []string{"OUTPUT_JSON"},
+				},
+
+				&cli.StringFlag{
+					Name:    "work-dir",
+					Value:   "./tmp",
+					Usage:   "Working directory to store the image bootstraps during analysis",
+					EnvVars: []string{"WORK_DIR"},
+				},
+				&cli.StringFlag{
+					Name:    "nydus-image",
+					Value:   "nydus-image",
+					Usage:   "Path to the nydus-image binary, default to search in PATH",
+					EnvVars: []string{"NYDUS_IMAGE"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				sources := c.StringSlice("sources")
+				if len(sources) < 2 {
+					return invalidOption(fmt.Errorf("--sources should contain at least two images"))
+				}
+
+				_, arch, err := provider.ExtractOsArch(c.String("platform"))
+				if err != nil {
+					return invalidOption(err)
+				}
+
+				ctx, stop := signalContext()
+				defer stop()
+
+				report, err := analyzer.Run(ctx, analyzer.Opt{
+					Sources:        sources,
+					SourceInsecure: c.Bool("source-insecure"),
+					ExpectedArch:   arch,
+					WorkDir:        c.String("work-dir"),
+					NydusImagePath: c.String("nydus-image"),
+					Candidates:     c.Uint("candidates"),
+				})
+				if err != nil {
+					return err
+				}
+
+				logrus.Infof(
+					"total %s, unique %s, shared %s in %d chunks, savings with chunk dictionary %s (%.2f%%)",
+					humanize.IBytes(report.TotalSize), humanize.IBytes(report.UniqueSize),
+					humanize.IBytes(report.SharedSize), report.SharedChunks,
+					humanize.IBytes(report.Savings), report.SavingsRatio*100,
+				)
+
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal analysis report")
+				}
+				if output := c.String("output-json"); output != "" {
+					return os.WriteFile(output, data, 0644)
+				}
+				fmt.Println(string(data))
+				return nil
+			},
+		},
+		{
+			Name:  "doctor",
+			Usage: "Check the prerequisites of environment, and report the readiness before running a long conversion",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    "image",
+					Usage:   "Image reference to check the registry connectivity and credentials, can be specified multiple times",
+					EnvVars: []string{"IMAGES"},
+				},
+				&cli.BoolFlag{
+					Name:    "insecure",
+					Value:   false,
+					Usage:   "Skip verifying server certs for HTTPS registry",
+					EnvVars: []string{"INSECURE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-type",
+					Value:   "",
+					Usage:   "Type of storage backend to check, possible values: 'oss', 's3', 'http-proxy'",
+					EnvVars: []string{"BACKEND_TYPE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-config",
+					Value:   "",
+					Usage:   "Json configuration string for storage backend",
+					EnvVars: []string{"BACKEND_CONFIG"},
+				},
+				&cli.PathFlag{
+					Name:      "backend-config-file",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "Json configuration file for storage backend",
+					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "backend-config-set",
+					Usage:   "Set the variable in backend config in KEY=VALUE format, '${KEY}' in config is substituted with VALUE, or the environment variable if not set",
+					EnvVars: []string{"BACKEND_CONFIG_SETS"},
+				},
+				&cli.StringSliceFlag{
+					Name:    "work-dir",
+					Value:   cli.NewStringSlice("./tmp"),
+					Usage:   "Working directory to check the available space, can be specified multiple times",
+					EnvVars: []string{"WORK_DIRS"},
+				},
+				&cli.StringFlag{
+					Name:    "min-space",
+					Value:   "10GiB",
+					Usage:   "Minimum available space required in each working directory",
+					EnvVars: []string{"MIN_SPACE"},
+				},
+				&cli.DurationFlag{
+					Name:    "timeout",
+					Value:   30 * time.Second,
+					Usage:   "Timeout of each registry or storage backend check, 0 means no limit",
+					EnvVars: []string{"TIMEOUT"},
+				},
+				&cli.StringFlag{
+					Name:    "output-json",
+					Value:   "",
+					Usage:   "File path to save the readiness report in JSON format, print to stdout if unset",
+					EnvVars: []string{"OUTPUT_JSON"},
+				},
+
+				&cli.StringFlag{
+					Name:    "nydus-image",
+					Value:   "nydus-image",
+					Usage:   "Path to the nydus-image binary, default to search in PATH",
+					EnvVars: []string{"NYDUS_IMAGE"},
+				},
+				&cli.StringFlag{
+					Name:    "nydusd",
+					Value:   "nydusd",
+					Usage:   "Path to the nydusd binary, default to search in PATH",
+					EnvVars: []string{"NYDUSD"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				backendType, backendConfig, err := getBackendConfigOfTypes(c, "", false, readOnlyBackendTypes)
+				if err != nil {
+					return err
+				}
+				requiredSpace, err := humanize.ParseBytes(c.String("min-space"))
+				if err != nil {
+					return invalidOption(errors.Wrap(err, "invalid --min-space"))
+				}
+
+				ctx, stop := signalContext()
+				defer stop()
+
+				report := doctor.Run(ctx, doctor.Opt{
+					NydusImagePath: c.String("nydus-image"),
+					NydusdPath:     c.String("nydusd"),
+					Images:         c.StringSlice("image"),
+					Insecure:       c.Bool("insecure"),
+					BackendType:    backendType,
+					BackendConfig:  backendConfig,
+					WorkDirs:       c.StringSlice("work-dir"),
+					RequiredSpace:  requiredSpace,
+					Timeout:        c.Duration("timeout"),
+				})
+				for _, check := range report.Checks {
+					entry := logrus.WithField("status", check.Status)
+					switch check.Status {
+					case doctor.StatusFail:
+						entry.Errorf("%s: %s", check.Name, check.Message)
+					case doctor.StatusWarn:
+						entry.Warnf("%s: %s", check.Name, check.Message)
+					default:
+						entry.Infof("%s: %s", check.Name, check.Message)
+					}
+				}
+
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal readiness report")
+				}
+				if output := c.String("output-json"); output != "" {
+					if err := os.WriteFile(output, data, 0644); err != nil {
+						return err
+					}
+				} else {
+					fmt.Println(string(data))
+				}
+				if !report.Ready {
+					return utils.WithExitCode(utils.ExitCodeValidation, errors.New("environment is not ready, see the failed checks"))
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "Remove the leftover work directories, checkpoints and temporary files in the working directories",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    "work-dir",
+					Value:   cli.NewStringSlice("./tmp"),
+					Usage:   "Working directory (or pack output directory) to prune, can be specified multiple times",
+					EnvVars: []string{"WORK_DIRS"},
+				},
+				&cli.DurationFlag{
+					Name:    "older-than",
+					Value:   7 * 24 * time.Hour,
+					Usage:   "Remove the entries not modified within the duration, 0 disables it",
+					EnvVars: []string{"OLDER_THAN"},
+				},
+				&cli.StringFlag{
+					Name:    "max-size",
+					Value:   "",
+					Usage:   "Remove the oldest entries until their total size is within the size, e.g. 100GiB, the entries modified in the last hour are kept",
+					EnvVars: []string{"MAX_SIZE"},
+				},
+				&cli.BoolFlag{
+					Name:    "dry-run",
+					Value:   false,
+					Usage:   "Only report the entries to be removed",
+					EnvVars: []string{"DRY_RUN"},
+				},
+				&cli.StringFlag{
+					Name:    "output-json",
+					Value:   "",
+					Usage:   "File path to save the prune report in JSON format",
+					EnvVars: []string{"OUTPUT_JSON"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+
+				var maxSize uint64
+				if c.String("max-size") != "" {
+					var err error
+					if maxSize, err = humanize.ParseBytes(c.String("max-size")); err != nil {
+						return invalidOption(errors.Wrap(err, "invalid --max-size"))
+					}
+				}
 
-							WorkDir:        c.String("work-dir"),
-							NydusImagePath: c.String("nydus-image"),
-							ExpectedArch:   arch,
-							AllPlatforms:   c.Bool("all-platforms"),
-							Platforms:      c.String("platform"),
-						})
-						if err != nil {
-							return err
+				report, err := workspace.Prune(workspace.PruneOpt{
+					Roots:     c.StringSlice("work-dir"),
+					OlderThan: c.Duration("older-than"),
+					MaxSize:   maxSize,
+					DryRun:    c.Bool("dry-run"),
+				})
+				if err != nil {
+					return err
+				}
+				for _, entry := range report.Entries {
+					action := "keep"
+					if entry.Pruned {
+						action = "remove"
+						if c.Bool("dry-run") {
+							action = "would remove"
 						}
+					}
+					logrus.WithFields(logrus.Fields{
+						"kind":     entry.Kind,
+						"size":     humanize.IBytes(entry.Size),
+						"modified": entry.ModTime.Format(time.RFC3339),
+					}).Infof("%s %s", action, entry.Path)
+				}
+				logrus.Infof("Pruned %s of %s in %d entries", humanize.IBytes(report.PrunedSize), humanize.IBytes(report.TotalSize), len(report.Entries))
 
-						return generator.Generate(context.Background())
-					},
-				},
+				if output := c.String("output-json"); output != "" {
+					data, err := json.MarshalIndent(report, "", "  ")
+					if err != nil {
+						return errors.Wrap(err, "marshal prune report")
+					}
+					if err := os.WriteFile(output, data, 0644); err != nil {
+						return err
+					}
+				}
+				return nil
 			},
 		},
 		{
@@ -779,7 +2192,7 @@ func main() {
 					Name:     "backend-type",
 					Value:    "",
 					Required: false,
-					Usage:    "Type of storage backend, possible values: 'oss', 's3'",
+					Usage:    "Type of storage backend, possible values: 'oss', 's3', 'http-proxy'",
 					EnvVars:  []string{"BACKEND_TYPE"},
 				},
 				&cli.StringFlag{
@@ -828,29 +2241,13 @@ func main() {
 			},
 			Action: func(c *cli.Context) error {
 				setupLogLevel(c)
+				if err := utils.RequireLinux("mounting the Nydus image"); err != nil {
+					return err
+				}
 
-				backendType, backendConfig, err := getBackendConfig(c, "", false)
+				backendType, backendConfig, err := getMountBackendConfig(c)
 				if err != nil {
 					return err
-				} else if backendConfig == "" {
-
-					backendType = "registry"
-					parsed, err := reference.ParseNormalizedNamed(c.String("target"))
-					if err != nil {
-						return err
-					}
-
-					backendConfigStruct, err := utils.NewRegistryBackendConfig(parsed, c.Bool("target-insecure"))
-					if err != nil {
-						return errors.Wrap(err, "parse registry backend configuration")
-					}
-
-					bytes, err := json.Marshal(backendConfigStruct)
-					if err != nil {
-						return errors.Wrap(err, "marshal registry backend configuration")
-					}
-					backendConfig = string(bytes)
-
 				}
 
 				_, arch, err := provider.ExtractOsArch(c.String("platform"))
@@ -876,6 +2273,148 @@ func main() {
 				return fsViewer.View(context.Background())
 			},
 		},
+		{
+			Name:  "benchmark",
+			Usage: "Measure the cold start performance of nydus image with nydusd",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "target",
+					Required: true,
+					Usage:    "Target (Nydus) image reference",
+					EnvVars:  []string{"TARGET"},
+				},
+				&cli.BoolFlag{
+					Name:     "target-insecure",
+					Required: false,
+					Usage:    "Skip verifying server certs for HTTPS target registry",
+					EnvVars:  []string{"TARGET_INSECURE"},
+				},
+
+				&cli.StringFlag{
+					Name:     "backend-type",
+					Value:    "",
+					Required: false,
+					Usage:    "Type of storage backend, possible values: 'oss', 's3', 'http-proxy'",
+					EnvVars:  []string{"BACKEND_TYPE"},
+				},
+				&cli.StringFlag{
+					Name:    "backend-config",
+					Value:   "",
+					Usage:   "Json configuration string for storage backend",
+					EnvVars: []string{"BACKEND_CONFIG"},
+				},
+				&cli.PathFlag{
+					Name:      "backend-config-file",
+					Value:     "",
+					TakesFile: true,
+					Usage:     "Json configuration file for storage backend",
+					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
+				},
+				&cli.BoolFlag{
+					Name:    "prefetch",
+					Value:   false,
+					Usage:   "Enable full image data prefetch",
+					EnvVars: []string{"PREFETCH"},
+				},
+				&cli.PathFlag{
+					Name:      "file-list",
+					TakesFile: true,
+					Usage:     "File containing the paths in image to read, one path per line, all the regular files are read if unset",
+					EnvVars:   []string{"FILE_LIST"},
+				},
+				&cli.StringFlag{
+					Name:  "platform",
+					Value: "linux/" + runtime.GOARCH,
+					Usage: "Specify platform identifier to choose image manifest, possible values: 'linux/amd64' and 'linux/arm64'",
+				},
+				&cli.StringFlag{
+					Name:    "output-json",
+					Value:   "",
+					Usage:   "File path to save the benchmark result in JSON format, print to stdout if unset",
+					EnvVars: []string{"OUTPUT_JSON"},
+				},
+
+				&cli.StringFlag{
+					Name:    "work-dir",
+					Value:   "./tmp",
+					Usage:   "Working directory for benchmark, will be cleaned up after benchmark",
+					EnvVars: []string{"WORK_DIR"},
+				},
+				&cli.StringFlag{
+					Name:    "nydusd",
+					Value:   "nydusd",
+					Usage:   "The nydusd binary path, if unset, search in PATH environment",
+					EnvVars: []string{"NYDUSD"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				setupLogLevel(c)
+				if err := utils.RequireLinux("benchmarking the Nydus image"); err != nil {
+					return err
+				}
+
+				backendType, backendConfig, err := getMountBackendConfig(c)
+				if err != nil {
+					return err
+				}
+
+				_, arch, err := provider.ExtractOsArch(c.String("platform"))
+				if err != nil {
+					return invalidOption(err)
+				}
+
+				var files []string
+				if fileList := c.String("file-list"); fileList != "" {
+					file, err := os.Open(fileList)
+					if err != nil {
+						return invalidOption(errors.Wrap(err, "open file list"))
+					}
+					defer file.Close()
+					if files, err = benchmark.ParseFileList(file); err != nil {
+						return err
+					}
+				}
+
+				workDir := c.String("work-dir")
+				ctx, stop := signalContext()
+				defer stop()
+
+				result, err := benchmark.Run(ctx, benchmark.Opt{
+					Opt: viewer.Opt{
+						WorkDir:        workDir,
+						Target:         c.String("target"),
+						TargetInsecure: c.Bool("target-insecure"),
+						MountPath:      filepath.Join(workDir, "mnt"),
+						NydusdPath:     c.String("nydusd"),
+						BackendType:    backendType,
+						BackendConfig:  backendConfig,
+						ExpectedArch:   arch,
+						Prefetch:       c.Bool("prefetch"),
+					},
+					Files: files,
+				})
+				if err != nil {
+					return err
+				}
+
+				logrus.Infof(
+					"image ready in %s, cold read %s in %s (%s/s), warm read %s in %s (%s/s)",
+					result.ReadyElapsed,
+					humanize.IBytes(uint64(result.ColdRead.Bytes)), result.ColdRead.Elapsed, humanize.IBytes(uint64(result.ColdRead.Throughput)),
+					humanize.IBytes(uint64(result.WarmRead.Bytes)), result.WarmRead.Elapsed, humanize.IBytes(uint64(result.WarmRead.Throughput)),
+				)
+
+				data, err := json.MarshalIndent(result, "", "  ")
+				if err != nil {
+					return errors.Wrap(err, "marshal benchmark result")
+				}
+				if output := c.String("output-json"); output != "" {
+					return os.WriteFile(output, data, 0644)
+				}
+				fmt.Println(string(data))
+				return nil
+			},
+		},
 		{
 			Name:    "build",
 			Aliases: []string{"pack"},
@@ -884,8 +2423,8 @@ func main() {
 				&cli.StringFlag{
 					Name:     "source-dir",
 					Aliases:  []string{"target-dir"}, // for compatibility
-					Required: true,
-					Usage:    "Source directory to build Nydus filesystem from",
+					Required: false,
+					Usage:    "Source directory to build Nydus filesystem from, required unless '--self-test' is specified",
 					EnvVars:  []string{"SOURCE_DIR"},
 				},
 				&cli.StringFlag{
@@ -898,8 +2437,8 @@ func main() {
 				&cli.StringFlag{
 					Name:     "name",
 					Aliases:  []string{"meta", "bootstrap"}, // for compatibility
-					Required: true,
-					Usage:    "Image name, which will be used as suffix for the generated Nydus image bootstrap/data blobs",
+					Required: false,
+					Usage:    "Image name, which will be used as suffix for the generated Nydus image bootstrap/data blobs, required unless '--self-test' is specified",
 					EnvVars:  []string{"BOOTSTRAP", "IMAGE_NAME"},
 				},
 
@@ -913,7 +2452,7 @@ func main() {
 					Name:        "backend-type",
 					Value:       "oss",
 					DefaultText: "oss",
-					Usage:       "Type of storage backend, possible values: 'oss', 's3'",
+					Usage:       "Type of storage backend, possible values: 'oss', 's3', 'registry', the bootstrap and blobs are pushed as an OCI artifact tagged by '--name' for 'registry'",
 					EnvVars:     []string{"BACKEND_TYPE"},
 				},
 				&cli.StringFlag{
@@ -928,6 +2467,17 @@ func main() {
 					Usage:     "Json configuration file for storage backend",
 					EnvVars:   []string{"BACKEND_CONFIG_FILE"},
 				},
+				&cli.StringSliceFlag{
+					Name:    "backend-config-set",
+					Usage:   "Set the variable in backend config in KEY=VALUE format, '${KEY}' in config is substituted with VALUE, or the environment variable if not set",
+					EnvVars: []string{"BACKEND_CONFIG_SETS"},
+				},
+				&cli.BoolFlag{
+					Name:    "self-test",
+					Value:   false,
+					Usage:   "Push, check, pull and delete a random artifact in storage backend to validate the credentials and permissions, without building",
+					EnvVars: []string{"SELF_TEST"},
+				},
 
 				&cli.StringFlag{
 					Name:    "chunk-dict",
@@ -973,6 +2523,78 @@ func main() {
 					Usage:   "size of nydus image data chunk, must be power of two and between 0x1000-0x100000, [default: 0x100000]",
 					EnvVars: []string{"CHUNK_SIZE"},
 				},
+				&cli.StringFlag{
+					Name:    "digest-algorithm",
+					Value:   utils.DigestSHA256,
+					Usage:   "Digest algorithm of the extra bootstrap and blob digests recorded in output.json and verified before pushing, the blobs are still named by sha256 blob ID, possible values: 'sha256', 'sha512', 'blake3'",
+					EnvVars: []string{"DIGEST_ALGORITHM"},
+				},
+				&cli.BoolFlag{
+					Name:    "reproducible",
+					Value:   false,
+					Usage:   "Build with sorted entries and fixed timestamps, so that packing the same source directory yields the same bootstrap and blob",
+					EnvVars: []string{"REPRODUCIBLE"},
+				},
+				&cli.Int64Flag{
+					Name:    "source-date-epoch",
+					Value:   0,
+					Usage:   "Unix timestamp used as the modification time of all files with '--reproducible'",
+					EnvVars: []string{"SOURCE_DATE_EPOCH"},
+				},
+				&cli.StringFlag{
+					Name:    "hardlink",
+					Value:   packer.HardlinkPreserve,
+					Usage:   "Handle the hardlinks in source directory, possible values: 'preserve' (keep the files linked), 'copy' (store as separated files)",
+					EnvVars: []string{"HARDLINK"},
+				},
+				&cli.StringFlag{
+					Name:    "special-files",
+					Value:   packer.SpecialFileKeep,
+					Usage:   "Handle the sockets, fifos and device files in source directory, possible values: 'keep', 'skip', 'fail'",
+					EnvVars: []string{"SPECIAL_FILES"},
+				},
+				&cli.StringFlag{
+					Name:    "sparse",
+					Value:   packer.SparseDedup,
+					Usage:   "Handle the sparse files in source directory, possible values: 'dedup' (store holes as deduplicated zero chunks), 'fail'",
+					EnvVars: []string{"SPARSE"},
+				},
+				&cli.BoolFlag{
+					Name:    "verify-mount",
+					Value:   false,
+					Usage:   "Mount the packed image by nydusd and compare the inode stats of files with the source directory",
+					EnvVars: []string{"VERIFY_MOUNT"},
+				},
+				&cli.StringFlag{
+					Name:    "nydusd",
+					Value:   "nydusd",
+					Usage:   "Path to the nydusd binary for '--verify-mount', default to search in PATH",
+					EnvVars: []string{"NYDUSD"},
+				},
+				&cli.BoolFlag{
+					Name:    "skip-space-check",
+					Value:   false,
+					Usage:   "Skip checking the available disk space of output directory before packing",
+					EnvVars: []string{"SKIP_SPACE_CHECK"},
+				},
+				&cli.DurationFlag{
+					Name:    "backend-timeout",
+					Value:   0,
+					Usage:   "Timeout of each storage backend operation, for example uploading a blob, 0 means no limit",
+					EnvVars: []string{"BACKEND_TIMEOUT"},
+				},
+				&cli.PathFlag{
+					Name:      "blob-cache-file",
+					TakesFile: true,
+					Usage:     "File to record the blobs known to exist in storage backend, so that the blobs are not checked or uploaded again by later packs",
+					EnvVars:   []string{"BLOB_CACHE_FILE"},
+				},
+				&cli.DurationFlag{
+					Name:    "blob-cache-ttl",
+					Value:   time.Hour,
+					Usage:   "Time for a blob recorded in '--blob-cache-file' to be trusted to exist in storage backend",
+					EnvVars: []string{"BLOB_CACHE_TTL"},
+				},
 
 				&cli.StringFlag{
 					Name:    "nydus-image",
@@ -982,13 +2604,22 @@ func main() {
 				},
 			},
 			Before: func(ctx *cli.Context) error {
+				if ctx.Bool("self-test") {
+					return nil
+				}
+				if ctx.String("name") == "" {
+					return invalidOption(errors.New("image name is empty, please specify option '--name'"))
+				}
 				sourcePath := ctx.String("source-dir")
+				if sourcePath == "" {
+					return invalidOption(errors.New("source directory is empty, please specify option '--source-dir'"))
+				}
 				fi, err := os.Stat(sourcePath)
 				if err != nil {
-					return errors.Wrapf(err, "failed to check source directory")
+					return invalidOption(errors.Wrapf(err, "failed to check source directory"))
 				}
 				if !fi.IsDir() {
-					return errors.Errorf("source path '%s' is not a directory", sourcePath)
+					return invalidOption(errors.Errorf("source path '%s' is not a directory", sourcePath))
 				}
 				return nil
 			},
@@ -1003,29 +2634,52 @@ func main() {
 				)
 
 				// if backend-push is specified, we should make sure backend-config-file exists
-				if c.Bool("backend-push") || c.Bool("compact") {
-					_backendType, _backendConfig, err := getBackendConfig(c, "", true)
+				if c.Bool("backend-push") || c.Bool("compact") || c.Bool("self-test") {
+					_backendType, _backendConfig, err := getBackendConfigOfTypes(c, "", true, []string{"oss", "s3", "registry"})
 					if err != nil {
 						return err
 					}
 					// we can verify the _backendType in the `packer.ParseBackendConfigString` function
 					cfg, err := packer.ParseBackendConfigString(_backendType, _backendConfig)
 					if err != nil {
-						return errors.Errorf("failed to parse backend-config '%s', err = %v", _backendConfig, err)
+						return invalidOption(errors.Errorf("failed to parse backend-config '%s', err = %v", _backendConfig, err))
 					}
 					backendConfig = cfg
 				}
 
+				if c.Bool("self-test") {
+					return selfTestBackend(c, backendConfig)
+				}
+
+				var blobCache *backend.ExistenceCache
+				if c.String("blob-cache-file") != "" {
+					if blobCache, err = backend.NewExistenceCache(c.Duration("blob-cache-ttl"), c.String("blob-cache-file")); err != nil {
+						return invalidOption(err)
+					}
+					defer func() {
+						if err := blobCache.Save(); err != nil {
+							logrus.WithError(err).Warn("save blob existence cache")
+						}
+					}()
+				}
+
 				if p, err = packer.New(packer.Opt{
 					LogLevel:       logrus.GetLevel(),
 					NydusImagePath: c.String("nydus-image"),
 					OutputDir:      c.String("output-dir"),
 					BackendConfig:  backendConfig,
+					SkipSpaceCheck: c.Bool("skip-space-check"),
+					BackendTimeout: c.Duration("backend-timeout"),
+
+					BlobExistenceCache: blobCache,
 				}); err != nil {
 					return err
 				}
 
-				if res, err = p.Pack(context.Background(), packer.PackRequest{
+				ctx, stop := signalContext()
+				defer stop()
+
+				if res, err = p.Pack(ctx, packer.PackRequest{
 					SourceDir:    c.String("source-dir"),
 					ImageName:    c.String("name"),
 					PushToRemote: c.Bool("backend-push"),
@@ -1033,6 +2687,17 @@ func main() {
 					Compressor:   c.String("compressor"),
 					ChunkSize:    c.String("chunk-size"),
 
+					DigestAlgorithm: c.String("digest-algorithm"),
+
+					Reproducible: c.Bool("reproducible"),
+					Timestamp:    time.Unix(c.Int64("source-date-epoch"), 0),
+
+					Hardlink:    c.String("hardlink"),
+					SpecialFile: c.String("special-files"),
+					Sparse:      c.String("sparse"),
+					VerifyMount: c.Bool("verify-mount"),
+					NydusdPath:  c.String("nydusd"),
+
 					ChunkDict:         c.String("chunk-dict"),
 					Parent:            c.String("parent-bootstrap"),
 					TryCompact:        c.Bool("compact"),
@@ -1041,6 +2706,7 @@ func main() {
 					return err
 				}
 				logrus.Infof("successfully built Nydus image (bootstrap:'%s', blob:'%s')", res.Meta, res.Blob)
+				logrus.Infof("digests of Nydus image (bootstrap:'%s', blob:'%s')", res.MetaDigest, res.BlobDigest)
 				return nil
 			},
 		},
@@ -1231,6 +2897,9 @@ func main() {
 			},
 			Action: func(c *cli.Context) error {
 				setupLogLevel(c)
+				if err := utils.RequireLinux("committing container changes"); err != nil {
+					return err
+				}
 				parsePaths := func(paths []string) ([]string, []string) {
 					withPaths := []string{}
 					withoutPaths := []string{}
@@ -1277,8 +2946,114 @@ func main() {
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		logrus.Fatal(err)
+		code := exitCode(err)
+		entry := logrus.WithField("exit_code", code)
+		var packErr *packer.Error
+		if errors.As(err, &packErr) {
+			entry = entry.WithFields(logrus.Fields{"error_kind": packErr.Kind, "hint": packErr.Hint})
+		}
+		entry.Error(err)
+		os.Exit(code)
+	}
+}
+
+// exitCode returns the exit code of command error, the missing required
+// flags are reported by urfave/cli without usage error callback.
+func exitCode(err error) int {
+	if strings.HasPrefix(err.Error(), "Required flag") {
+		return utils.ExitCodeValidation
+	}
+	return utils.ExitCode(err)
+}
+
+// selfTestBackend runs the self test of build against the storage backend,
+// and prints the report in JSON format.
+func selfTestBackend(c *cli.Context, backendConfig packer.BackendConfig) error {
+	workDir, err := os.MkdirTemp("", "nydusify-self-test-")
+	if err != nil {
+		return errors.Wrap(err, "create self test directory")
+	}
+	defer os.RemoveAll(workDir)
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	report, err := packer.SelfTest(ctx, packer.NewPusherOpt{
+		Artifact:      packer.Artifact{OutputDir: workDir},
+		BackendConfig: backendConfig,
+		Timeout:       c.Duration("backend-timeout"),
+	})
+	if err != nil {
+		return err
+	}
+	for _, step := range report.Steps {
+		entry := logrus.WithField("status", step.Status).WithField("duration", step.Duration)
+		switch step.Status {
+		case packer.SelfTestFail:
+			entry.Errorf("%s: %s", step.Name, step.Message)
+		case packer.SelfTestSkip:
+			entry.Warnf("%s: %s", step.Name, step.Message)
+		default:
+			entry.Infof("%s: %s", step.Name, step.Message)
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal self test report")
+	}
+	fmt.Println(string(data))
+	if !report.Passed {
+		return utils.WithExitCode(utils.ExitCodeValidation, errors.New("storage backend self test failed, see the failed steps"))
+	}
+	return nil
+}
+
+// signalContext returns the context canceled on Ctrl-C or SIGTERM, so that
+// the running builders are killed and the temporary files are removed.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func setupLogFormat(c *cli.Context) error {
+	switch format := c.String("log-format"); format {
+	case "text":
+		logrus.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+	case "json":
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return invalidOption(fmt.Errorf("--log-format should be one of %v", []string{"text", "json"}))
+	}
+	return nil
+}
+
+// backendPriceList is loaded before running the command, so that an invalid
+// price list is reported before any backend request is sent.
+var backendPriceList *backend.PriceList
+
+func setupBackendAudit(c *cli.Context) error {
+	if path := c.String("backend-price-list"); path != "" {
+		priceList, err := backend.LoadPriceList(path)
+		if err != nil {
+			return invalidOption(err)
+		}
+		backendPriceList = priceList
+	}
+	return nil
+}
+
+// printBackendAudit prints the audited backend requests with the estimated
+// cost, it's called even if the command fails.
+func printBackendAudit(c *cli.Context) error {
+	if !c.Bool("backend-audit") && backendPriceList == nil {
+		return nil
+	}
+	if summary := backend.DefaultAuditor.Summary(backendPriceList); summary != "" {
+		fmt.Fprint(os.Stderr, summary)
 	}
+	return nil
 }
 
 func setupLogLevel(c *cli.Context) {
@@ -9,10 +9,15 @@ import (
 	"encoding/json"
 	"flag"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/urfave/cli/v2"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
 func TestIsPossibleValue(t *testing.T) {
@@ -174,6 +179,28 @@ func TestGetBackendConfig(t *testing.T) {
 	require.Contains(t, err.Error(), "--backend-config conflicts with --backend-config-file")
 	require.Empty(t, backendType)
 	require.Empty(t, backendConfig)
+
+	t.Setenv("NYDUS_BUCKET", "env-bucket")
+	t.Setenv("NYDUS_ENDPOINT", "region.oss.com")
+	templateJSON := `{"bucket_name": "${NYDUS_BUCKET}", "endpoint": "${NYDUS_ENDPOINT}"}`
+	flagSet = flag.NewFlagSet("test6", flag.PanicOnError)
+	flagSet.String("prefixbackend-type", "oss", "")
+	flagSet.String("prefixbackend-config", templateJSON, "")
+	sets := cli.NewStringSlice("NYDUS_BUCKET=set-bucket")
+	flagSet.Var(sets, "backend-config-set", "")
+	ctx = cli.NewContext(app, flagSet, nil)
+	backendType, backendConfig, err = getBackendConfig(ctx, "prefix", true)
+	require.NoError(t, err)
+	require.Equal(t, "oss", backendType)
+	require.Equal(t, `{"bucket_name": "set-bucket", "endpoint": "region.oss.com"}`, backendConfig)
+
+	flagSet = flag.NewFlagSet("test7", flag.PanicOnError)
+	flagSet.String("prefixbackend-type", "oss", "")
+	flagSet.String("prefixbackend-config", `{"bucket_name": "${NYDUS_UNDEFINED}"}`, "")
+	ctx = cli.NewContext(app, flagSet, nil)
+	_, _, err = getBackendConfig(ctx, "prefix", true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undefined variables in backend config: NYDUS_UNDEFINED")
 }
 
 func TestGetTargetReference(t *testing.T) {
@@ -289,6 +316,10 @@ func TestGetPrefetchPatterns(t *testing.T) {
 				Name:  "prefetch-patterns",
 				Value: false,
 			},
+			&cli.StringFlag{
+				Name:  "prefetch-file",
+				Value: "",
+			},
 		},
 	}
 	ctx := cli.NewContext(app, nil, nil)
@@ -319,4 +350,47 @@ func TestGetPrefetchPatterns(t *testing.T) {
 	patterns, err = getPrefetchPatterns(ctx)
 	require.NoError(t, err)
 	require.Equal(t, "/", patterns)
+
+	prefetchFile := filepath.Join(t.TempDir(), "prefetch.txt")
+	require.NoError(t, os.WriteFile(prefetchFile, []byte("# comment\n/usr/bin/nginx\n/usr/lib/*.so\n"), 0644))
+	flagSet = flag.NewFlagSet("test4", flag.PanicOnError)
+	flagSet.String("prefetch-file", prefetchFile, "")
+	ctx = cli.NewContext(app, flagSet, nil)
+	patterns, err = getPrefetchPatterns(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/nginx\n/usr/lib", patterns)
+
+	flagSet = flag.NewFlagSet("test5", flag.PanicOnError)
+	flagSet.String("prefetch-file", prefetchFile, "")
+	flagSet.String("prefetch-dir", "/etc/passwd", "")
+	ctx = cli.NewContext(app, flagSet, nil)
+	_, err = getPrefetchPatterns(ctx)
+	require.ErrorContains(t, err, "--prefetch-file conflicts with")
+}
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, utils.ExitCodeValidation, exitCode(invalidOption(errors.New("--source or --batch is required"))))
+	require.Equal(t, utils.ExitCodeValidation, exitCode(errors.New(`Required flag "target" not set`)))
+	require.Equal(t, utils.ExitCodeFailure, exitCode(errors.New("unknown")))
+}
+
+func TestSetupLogFormat(t *testing.T) {
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "log-format", Value: "text"},
+		},
+	}
+	set := flag.NewFlagSet("test", 0)
+	set.String("log-format", "json", "")
+	ctx := cli.NewContext(app, set, nil)
+	require.NoError(t, setupLogFormat(ctx))
+	require.IsType(t, &logrus.JSONFormatter{}, logrus.StandardLogger().Formatter)
+
+	require.NoError(t, set.Set("log-format", "yaml"))
+	err := setupLogFormat(ctx)
+	require.Error(t, err)
+	require.Equal(t, utils.ExitCodeValidation, exitCode(err))
+
+	require.NoError(t, set.Set("log-format", "text"))
+	require.NoError(t, setupLogFormat(ctx))
 }
@@ -0,0 +1,57 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/packer"
+)
+
+func main() {
+	backendConfig, err := packer.ParseBackendConfigString("s3", `{
+		"endpoint": "localhost:9000",
+		"scheme": "http",
+		"region": "us-east-1",
+		"bucket_name": "nydus",
+		"meta_prefix": "meta/",
+		"blob_prefix": "blob/"
+	}`)
+	if err != nil {
+		panic(err)
+	}
+
+	p, err := packer.New(packer.Opt{
+		NydusImagePath: "/path/to/nydus-image",
+		OutputDir:      "/path/to/output",
+		BackendConfig:  backendConfig,
+		Logger:         logrus.WithField("component", "packer"),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	ctx := context.Background()
+	res, err := p.Pack(ctx, packer.PackRequest{
+		SourceDir:    "/path/to/source",
+		ImageName:    "image.meta",
+		PushToRemote: true,
+	})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("meta: %s, blob: %s\n", res.Meta, res.Blob)
+
+	// Pull the bootstrap back, for example on another node.
+	if _, err := p.Pull(ctx, packer.PullRequest{
+		Meta:       "image.meta",
+		MetaDigest: res.MetaDigest,
+	}); err != nil {
+		panic(err)
+	}
+}
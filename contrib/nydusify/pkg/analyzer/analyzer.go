@@ -0,0 +1,251 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package analyzer reports the chunk level overlap between multiple nydus
+// images, it estimates the savings of deduplicating them with a shared chunk
+// dictionary and recommends the images to generate the dictionary from.
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/parser"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// Opt defines the analyze options.
+type Opt struct {
+	// Sources are two or more nydus image references.
+	Sources        []string
+	SourceInsecure bool
+	ExpectedArch   string
+
+	WorkDir        string
+	NydusImagePath string
+	// Candidates is the maximum number of recommended chunk
+	// dictionary candidates.
+	Candidates uint
+}
+
+// ImageChunks is the data chunks referenced by the bootstrap of an image.
+type ImageChunks struct {
+	Reference string
+	Chunks    []tool.ChunkInfo
+}
+
+// ImageReport is the chunk statistics of an image, the chunks with the same
+// digest in the image are counted once, the sizes are uncompressed sizes.
+type ImageReport struct {
+	Reference    string `json:"reference"`
+	Chunks       int    `json:"chunks"`
+	Size         uint64 `json:"size"`
+	SharedChunks int    `json:"shared_chunks"`
+	SharedSize   uint64 `json:"shared_size"`
+}
+
+// Candidate is an image recommended to generate the chunk dictionary from,
+// Savings is the size deduplicated additionally by adding its chunks into
+// the dictionary after the previous candidates.
+type Candidate struct {
+	Reference string `json:"reference"`
+	Savings   uint64 `json:"savings"`
+}
+
+// Report is the chunk overlap report of images.
+type Report struct {
+	Images []ImageReport `json:"images"`
+	// TotalSize is the sum of image sizes.
+	TotalSize uint64 `json:"total_size"`
+	// UniqueSize is the size of distinct chunks across all images.
+	UniqueSize uint64 `json:"unique_size"`
+	// SharedChunks is the number of chunks referenced by more than one image.
+	SharedChunks int    `json:"shared_chunks"`
+	SharedSize   uint64 `json:"shared_size"`
+	// Savings is the size saved if all images are deduplicated with
+	// a shared chunk dictionary.
+	Savings      uint64      `json:"savings"`
+	SavingsRatio float64     `json:"savings_ratio"`
+	Candidates   []Candidate `json:"candidates"`
+}
+
+type chunkRef struct {
+	size   uint64
+	images []int
+}
+
+// Analyze calculates the chunk overlap of images, at most maxCandidates
+// images are recommended as the chunk dictionary candidates.
+func Analyze(images []ImageChunks, maxCandidates uint) *Report {
+	chunks := map[string]*chunkRef{}
+	imageChunks := make([][]string, len(images))
+	for idx, image := range images {
+		seen := map[string]bool{}
+		for _, chunk := range image.Chunks {
+			if seen[chunk.ChunkID] {
+				continue
+			}
+			seen[chunk.ChunkID] = true
+			ref, ok := chunks[chunk.ChunkID]
+			if !ok {
+				ref = &chunkRef{size: uint64(chunk.UncompressedSize)}
+				chunks[chunk.ChunkID] = ref
+			}
+			ref.images = append(ref.images, idx)
+			imageChunks[idx] = append(imageChunks[idx], chunk.ChunkID)
+		}
+	}
+
+	report := &Report{
+		Images:     make([]ImageReport, len(images)),
+		Candidates: []Candidate{},
+	}
+	for idx, image := range images {
+		imageReport := ImageReport{Reference: image.Reference}
+		for _, id := range imageChunks[idx] {
+			ref := chunks[id]
+			imageReport.Chunks++
+			imageReport.Size += ref.size
+			if len(ref.images) > 1 {
+				imageReport.SharedChunks++
+				imageReport.SharedSize += ref.size
+			}
+		}
+		report.Images[idx] = imageReport
+		report.TotalSize += imageReport.Size
+	}
+	for _, ref := range chunks {
+		report.UniqueSize += ref.size
+		if len(ref.images) > 1 {
+			report.SharedChunks++
+			report.SharedSize += ref.size
+		}
+	}
+	report.Savings = report.TotalSize - report.UniqueSize
+	if report.TotalSize > 0 {
+		report.SavingsRatio = float64(report.Savings) / float64(report.TotalSize)
+	}
+
+	// Pick the candidates greedily, the image covering the most savings
+	// of not yet covered shared chunks is picked in each round.
+	covered := map[string]bool{}
+	picked := map[int]bool{}
+	for uint(len(report.Candidates)) < maxCandidates {
+		best, bestSavings := -1, uint64(0)
+		for idx := range images {
+			if picked[idx] {
+				continue
+			}
+			var savings uint64
+			for _, id := range imageChunks[idx] {
+				ref := chunks[id]
+				if !covered[id] && len(ref.images) > 1 {
+					savings += ref.size * uint64(len(ref.images)-1)
+				}
+			}
+			if savings > bestSavings {
+				best, bestSavings = idx, savings
+			}
+		}
+		if best < 0 {
+			break
+		}
+		picked[best] = true
+		for _, id := range imageChunks[best] {
+			covered[id] = true
+		}
+		report.Candidates = append(report.Candidates, Candidate{
+			Reference: images[best].Reference,
+			Savings:   bestSavings,
+		})
+	}
+
+	return report
+}
+
+// Run pulls the bootstraps of source images and analyzes the chunk overlap
+// of them, the bootstraps are removed on return.
+func Run(ctx context.Context, opt Opt) (*Report, error) {
+	if len(opt.Sources) < 2 {
+		return nil, fmt.Errorf("at least two images are required to analyze")
+	}
+
+	if err := os.MkdirAll(opt.WorkDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create work directory")
+	}
+	workDir, err := os.MkdirTemp(opt.WorkDir, "nydusify-analyze-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create temp directory")
+	}
+	defer os.RemoveAll(workDir)
+
+	inspector := tool.NewInspector(opt.NydusImagePath)
+	images := []ImageChunks{}
+	for idx, source := range opt.Sources {
+		bootstrapPath := filepath.Join(workDir, fmt.Sprintf("bootstrap-%d", idx))
+		if err := pullBootstrap(ctx, opt, source, bootstrapPath); err != nil {
+			return nil, errors.Wrapf(err, "pull bootstrap of image %s", source)
+		}
+		chunks, err := inspector.Inspect(tool.InspectOption{
+			Operation: tool.GetChunks,
+			Bootstrap: bootstrapPath,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "get chunks of image %s", source)
+		}
+		logrus.Infof("got %d chunks of image %s", len(chunks.(tool.ChunkInfoList)), source)
+		images = append(images, ImageChunks{
+			Reference: source,
+			Chunks:    chunks.(tool.ChunkInfoList),
+		})
+	}
+
+	report := Analyze(images, opt.Candidates)
+	sort.SliceStable(report.Images, func(i, j int) bool {
+		return report.Images[i].SharedSize > report.Images[j].SharedSize
+	})
+
+	return report, nil
+}
+
+func pullBootstrap(ctx context.Context, opt Opt, source, target string) error {
+	remoter, err := provider.DefaultRemote(source, opt.SourceInsecure)
+	if err != nil {
+		return errors.Wrap(err, "create remote")
+	}
+	sourceParser, err := parser.New(remoter, opt.ExpectedArch)
+	if err != nil {
+		return errors.Wrap(err, "create parser")
+	}
+
+	parsed, err := sourceParser.Parse(ctx)
+	if err != nil {
+		if !utils.RetryWithHTTP(err) {
+			return errors.Wrap(err, "parse image")
+		}
+		remoter.MaybeWithHTTP(err)
+		if parsed, err = sourceParser.Parse(ctx); err != nil {
+			return errors.Wrap(err, "parse image")
+		}
+	}
+	if parsed.NydusImage == nil {
+		return fmt.Errorf("not a nydus image")
+	}
+
+	reader, err := sourceParser.PullNydusBootstrap(ctx, parsed.NydusImage)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return utils.UnpackFile(reader, utils.BootstrapFileNameInLayer, target)
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+)
+
+func chunks(ids ...string) []tool.ChunkInfo {
+	infos := []tool.ChunkInfo{}
+	for _, id := range ids {
+		infos = append(infos, tool.ChunkInfo{ChunkID: id, UncompressedSize: 100})
+	}
+	return infos
+}
+
+func TestAnalyze(t *testing.T) {
+	images := []ImageChunks{
+		{Reference: "a", Chunks: chunks("1", "2", "3", "3")},
+		{Reference: "b", Chunks: chunks("1", "2", "4")},
+		{Reference: "c", Chunks: chunks("1", "5")},
+		{Reference: "d", Chunks: chunks("6")},
+	}
+
+	report := Analyze(images, 3)
+	require.Equal(t, []ImageReport{
+		{Reference: "a", Chunks: 3, Size: 300, SharedChunks: 2, SharedSize: 200},
+		{Reference: "b", Chunks: 3, Size: 300, SharedChunks: 2, SharedSize: 200},
+		{Reference: "c", Chunks: 2, Size: 200, SharedChunks: 1, SharedSize: 100},
+		{Reference: "d", Chunks: 1, Size: 100, SharedChunks: 0, SharedSize: 0},
+	}, report.Images)
+	require.Equal(t, uint64(900), report.TotalSize)
+	require.Equal(t, uint64(600), report.UniqueSize)
+	require.Equal(t, 2, report.SharedChunks)
+	require.Equal(t, uint64(200), report.SharedSize)
+	require.Equal(t, uint64(300), report.Savings)
+	require.InDelta(t, 1.0/3, report.SavingsRatio, 0.0001)
+
+	// Image a covers all the shared chunks, no more savings from others.
+	require.Equal(t, []Candidate{{Reference: "a", Savings: 300}}, report.Candidates)
+
+	report = Analyze(images, 0)
+	require.Empty(t, report.Candidates)
+}
+
+func TestAnalyzeNoOverlap(t *testing.T) {
+	report := Analyze([]ImageChunks{
+		{Reference: "a", Chunks: chunks("1")},
+		{Reference: "b", Chunks: chunks("2")},
+	}, 1)
+	require.Equal(t, uint64(0), report.Savings)
+	require.Equal(t, 0.0, report.SavingsRatio)
+	require.Empty(t, report.Candidates)
+}
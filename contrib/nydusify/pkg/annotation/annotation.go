@@ -0,0 +1,122 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package annotation transforms the annotations of converted image, the
+// annotations inherited from source image are stripped or rewritten by the
+// policy, and the extra annotations are added by user.
+package annotation
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The actions of policy rules.
+const (
+	// ActionStrip removes the annotations matching the key pattern.
+	ActionStrip = "strip"
+	// ActionRewrite replaces the value of existing annotation.
+	ActionRewrite = "rewrite"
+)
+
+// Rule is a rule of annotation policy, parsed from "strip:KEY" or
+// "rewrite:KEY=VALUE".
+type Rule struct {
+	Action string
+	// Key is the pattern of path.Match for ActionStrip, for example
+	// "org.opencontainers.image.*", and the exact key for ActionRewrite.
+	Key   string
+	Value string
+}
+
+// Policy transforms the annotations by the rules in order.
+type Policy struct {
+	Rules []Rule
+}
+
+// ParseRule parses the rule in the format of "strip:KEY" or
+// "rewrite:KEY=VALUE".
+func ParseRule(spec string) (Rule, error) {
+	action, arg, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid annotation rule %q, should be in the format of 'strip:KEY' or 'rewrite:KEY=VALUE'", spec)
+	}
+	switch action {
+	case ActionStrip:
+		if arg == "" {
+			return Rule{}, fmt.Errorf("empty key in annotation rule %q", spec)
+		}
+		if _, err := path.Match(arg, ""); err != nil {
+			return Rule{}, errors.Wrapf(err, "invalid key pattern in annotation rule %q", spec)
+		}
+		return Rule{Action: action, Key: arg}, nil
+	case ActionRewrite:
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return Rule{}, fmt.Errorf("invalid annotation rule %q, should be in the format of 'rewrite:KEY=VALUE'", spec)
+		}
+		return Rule{Action: action, Key: key, Value: value}, nil
+	}
+	return Rule{}, fmt.Errorf("unknown action %q in annotation rule %q, possible values: %s, %s", action, spec, ActionStrip, ActionRewrite)
+}
+
+// ParsePolicy parses the rules of policy, it returns nil if no rule.
+func ParsePolicy(specs []string) (*Policy, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	policy := &Policy{}
+	for _, spec := range specs {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// ParseAnnotations parses the annotations in the format of "KEY=VALUE".
+func ParseAnnotations(specs []string) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid annotation %q, should be in the format of 'KEY=VALUE'", spec)
+		}
+		annotations[key] = value
+	}
+	return annotations, nil
+}
+
+// Apply returns the annotations transformed by the policy, the input is not
+// modified. A nil policy keeps the annotations unchanged.
+func (policy *Policy) Apply(annotations map[string]string) map[string]string {
+	result := make(map[string]string, len(annotations))
+	for key, value := range annotations {
+		result[key] = value
+	}
+	if policy == nil {
+		return result
+	}
+
+	for _, rule := range policy.Rules {
+		switch rule.Action {
+		case ActionStrip:
+			for key := range result {
+				if matched, _ := path.Match(rule.Key, key); matched {
+					delete(result, key)
+				}
+			}
+		case ActionRewrite:
+			if _, ok := result[rule.Key]; ok {
+				result[rule.Key] = rule.Value
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package annotation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("strip:org.opencontainers.image.*")
+	require.NoError(t, err)
+	require.Equal(t, Rule{Action: ActionStrip, Key: "org.opencontainers.image.*"}, rule)
+
+	rule, err = ParseRule("rewrite:org.opencontainers.image.created=1970-01-01T00:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, Rule{Action: ActionRewrite, Key: "org.opencontainers.image.created", Value: "1970-01-01T00:00:00Z"}, rule)
+
+	for spec, message := range map[string]string{
+		"org.opencontainers.image.created": "should be in the format of",
+		"strip:":                           "empty key",
+		"strip:[a":                         "invalid key pattern",
+		"rewrite:key":                      "rewrite:KEY=VALUE",
+		"add:key=value":                    "unknown action",
+	} {
+		_, err := ParseRule(spec)
+		require.ErrorContains(t, err, message, spec)
+	}
+}
+
+func TestPolicyApply(t *testing.T) {
+	policy, err := ParsePolicy([]string{
+		"strip:org.opencontainers.image.*",
+		"rewrite:com.example.build=redacted",
+		"rewrite:com.example.missing=value",
+	})
+	require.NoError(t, err)
+
+	annotations := map[string]string{
+		"org.opencontainers.image.created":  "2024-01-01T00:00:00Z",
+		"org.opencontainers.image.revision": "abc",
+		"com.example.build":                 "secret",
+		"com.example.team":                  "infra",
+	}
+	require.Equal(t, map[string]string{
+		"com.example.build": "redacted",
+		"com.example.team":  "infra",
+	}, policy.Apply(annotations))
+	// The input is not modified.
+	require.Len(t, annotations, 4)
+
+	var nilPolicy *Policy
+	require.Equal(t, annotations, nilPolicy.Apply(annotations))
+
+	policy, err = ParsePolicy(nil)
+	require.NoError(t, err)
+	require.Nil(t, policy)
+}
+
+func TestParseAnnotations(t *testing.T) {
+	annotations, err := ParseAnnotations([]string{"com.example.team=infra", "com.example.empty="})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"com.example.team": "infra", "com.example.empty": ""}, annotations)
+
+	_, err = ParseAnnotations([]string{"=value"})
+	require.ErrorContains(t, err, "KEY=VALUE")
+}
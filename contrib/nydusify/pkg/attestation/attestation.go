@@ -0,0 +1,249 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package attestation generates the SLSA provenance of image conversion and
+// attaches it, or the SBOM document, to the converted image as an OCI
+// referrer artifact, so that the artifact metadata policies also cover the
+// converted Nydus images.
+package attestation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+const (
+	// MediaTypeInToto is the artifact type and layer media type of the
+	// in-toto statement.
+	MediaTypeInToto = "application/vnd.in-toto+json"
+	// MediaTypeSPDX and MediaTypeCycloneDX are the artifact types of SBOM
+	// documents in JSON format.
+	MediaTypeSPDX      = "application/spdx+json"
+	MediaTypeCycloneDX = "application/vnd.cyclonedx+json"
+
+	StatementType           = "https://in-toto.io/Statement/v1"
+	PredicateTypeProvenance = "https://slsa.dev/provenance/v1"
+	// BuildType identifies the conversion of nydusify in the provenance.
+	BuildType = "https://github.com/dragonflyoss/nydus/contrib/nydusify/convert@v1"
+	BuilderID = "https://github.com/dragonflyoss/nydus/contrib/nydusify"
+)
+
+// ResourceDescriptor is an artifact referenced by the statement.
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Statement is the in-toto statement wrapping the predicate.
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     interface{}          `json:"predicate"`
+}
+
+// Provenance is the SLSA provenance v1 predicate.
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+type BuildDefinition struct {
+	BuildType            string                 `json:"buildType"`
+	ExternalParameters   map[string]interface{} `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor   `json:"resolvedDependencies"`
+}
+
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+type BuildMetadata struct {
+	StartedOn  time.Time `json:"startedOn"`
+	FinishedOn time.Time `json:"finishedOn"`
+}
+
+type RunDetails struct {
+	Builder  Builder       `json:"builder"`
+	Metadata BuildMetadata `json:"metadata"`
+}
+
+// ProvenanceOpt describes the conversion recorded in the provenance.
+type ProvenanceOpt struct {
+	Source       string
+	SourceDigest digest.Digest
+	Target       string
+	TargetDigest digest.Digest
+	// ToolVersion is the version of nydusify.
+	ToolVersion string
+	// Parameters are the conversion options.
+	Parameters map[string]interface{}
+	StartedOn  time.Time
+	FinishedOn time.Time
+}
+
+func digestSet(dgst digest.Digest) map[string]string {
+	return map[string]string{dgst.Algorithm().String(): dgst.Encoded()}
+}
+
+// NewProvenance generates the in-toto statement of SLSA provenance, the
+// target image is the subject and the source image is the dependency.
+func NewProvenance(opt ProvenanceOpt) ([]byte, error) {
+	if err := opt.SourceDigest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid source digest")
+	}
+	if err := opt.TargetDigest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid target digest")
+	}
+	parameters := map[string]interface{}{
+		"source": opt.Source,
+		"target": opt.Target,
+	}
+	for key, value := range opt.Parameters {
+		parameters[key] = value
+	}
+	builder := Builder{ID: BuilderID}
+	if opt.ToolVersion != "" {
+		builder.Version = map[string]string{"nydusify": opt.ToolVersion}
+	}
+
+	statement := Statement{
+		Type: StatementType,
+		Subject: []ResourceDescriptor{{
+			Name:   opt.Target,
+			Digest: digestSet(opt.TargetDigest),
+		}},
+		PredicateType: PredicateTypeProvenance,
+		Predicate: Provenance{
+			BuildDefinition: BuildDefinition{
+				BuildType:          BuildType,
+				ExternalParameters: parameters,
+				ResolvedDependencies: []ResourceDescriptor{{
+					URI:    opt.Source,
+					Digest: digestSet(opt.SourceDigest),
+				}},
+			},
+			RunDetails: RunDetails{
+				Builder: builder,
+				Metadata: BuildMetadata{
+					StartedOn:  opt.StartedOn.UTC(),
+					FinishedOn: opt.FinishedOn.UTC(),
+				},
+			},
+		},
+	}
+
+	return json.Marshal(statement)
+}
+
+// DetectSBOMType returns the artifact type of the SBOM document, only the
+// SPDX and CycloneDX documents in JSON format are supported.
+func DetectSBOMType(data []byte) (string, error) {
+	var doc struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return "", errors.Wrap(err, "unmarshal SBOM document")
+	}
+	switch {
+	case doc.SPDXVersion != "":
+		return MediaTypeSPDX, nil
+	case doc.BOMFormat == "CycloneDX":
+		return MediaTypeCycloneDX, nil
+	default:
+		return "", fmt.Errorf("unknown SBOM format, only SPDX and CycloneDX in JSON format are supported")
+	}
+}
+
+// newManifest returns the referrer artifact manifest with the data as its
+// only layer.
+func newManifest(subject ocispec.Descriptor, artifactType string, layer ocispec.Descriptor, created time.Time) ([]byte, error) {
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Config:       ocispec.DescriptorEmptyJSON,
+		Layers:       []ocispec.Descriptor{layer},
+		Subject: &ocispec.Descriptor{
+			MediaType: subject.MediaType,
+			Digest:    subject.Digest,
+			Size:      subject.Size,
+		},
+		Annotations: map[string]string{
+			ocispec.AnnotationCreated: created.UTC().Format(time.RFC3339),
+		},
+	}
+	return json.Marshal(manifest)
+}
+
+func push(ctx context.Context, remoter *remote.Remote, desc ocispec.Descriptor, byDigest bool, data []byte) error {
+	err := remoter.Push(ctx, desc, byDigest, bytes.NewReader(data))
+	if err != nil && utils.RetryWithHTTP(err) {
+		remoter.MaybeWithHTTP(err)
+		err = remoter.Push(ctx, desc, byDigest, bytes.NewReader(data))
+	}
+	return err
+}
+
+// Attach pushes the data as an OCI artifact referring the subject image in
+// the repository of target, the registry should support the referrers API
+// of OCI distribution spec v1.1 to discover it.
+func Attach(ctx context.Context, target string, insecure bool, subject ocispec.Descriptor, artifactType string, data []byte) (*ocispec.Descriptor, error) {
+	named, err := reference.ParseNormalizedNamed(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse target reference")
+	}
+
+	layer := ocispec.Descriptor{
+		MediaType: artifactType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	manifest, err := newManifest(subject, artifactType, layer, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal artifact manifest")
+	}
+	desc := ocispec.Descriptor{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: artifactType,
+		Digest:       digest.FromBytes(manifest),
+		Size:         int64(len(manifest)),
+	}
+
+	// The artifact is untagged, the manifest is pushed by its digest.
+	remoter, err := provider.DefaultRemote(fmt.Sprintf("%s@%s", named.Name(), desc.Digest), insecure)
+	if err != nil {
+		return nil, errors.Wrap(err, "create remote")
+	}
+	config := ocispec.DescriptorEmptyJSON
+	if err := push(ctx, remoter, config, true, config.Data); err != nil {
+		return nil, errors.Wrap(err, "push artifact config")
+	}
+	if err := push(ctx, remoter, layer, true, data); err != nil {
+		return nil, errors.Wrap(err, "push artifact layer")
+	}
+	if err := push(ctx, remoter, desc, false, manifest); err != nil {
+		return nil, errors.Wrap(err, "push artifact manifest")
+	}
+
+	return &desc, nil
+}
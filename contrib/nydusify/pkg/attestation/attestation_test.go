@@ -0,0 +1,100 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvenance(t *testing.T) {
+	sourceDigest := digest.FromString("source")
+	targetDigest := digest.FromString("target")
+	startedOn := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	data, err := NewProvenance(ProvenanceOpt{
+		Source:       "docker.io/library/nginx:latest",
+		SourceDigest: sourceDigest,
+		Target:       "localhost:5000/nginx:latest-nydus",
+		TargetDigest: targetDigest,
+		ToolVersion:  "v2.3.0",
+		Parameters:   map[string]interface{}{"fs_version": "6"},
+		StartedOn:    startedOn,
+		FinishedOn:   startedOn.Add(time.Minute),
+	})
+	require.NoError(t, err)
+
+	var statement struct {
+		Type          string               `json:"_type"`
+		Subject       []ResourceDescriptor `json:"subject"`
+		PredicateType string               `json:"predicateType"`
+		Predicate     Provenance           `json:"predicate"`
+	}
+	require.NoError(t, json.Unmarshal(data, &statement))
+	require.Equal(t, StatementType, statement.Type)
+	require.Equal(t, PredicateTypeProvenance, statement.PredicateType)
+	require.Equal(t, []ResourceDescriptor{{
+		Name:   "localhost:5000/nginx:latest-nydus",
+		Digest: map[string]string{"sha256": targetDigest.Encoded()},
+	}}, statement.Subject)
+	require.Equal(t, []ResourceDescriptor{{
+		URI:    "docker.io/library/nginx:latest",
+		Digest: map[string]string{"sha256": sourceDigest.Encoded()},
+	}}, statement.Predicate.BuildDefinition.ResolvedDependencies)
+	require.Equal(t, "6", statement.Predicate.BuildDefinition.ExternalParameters["fs_version"])
+	require.Equal(t, "docker.io/library/nginx:latest", statement.Predicate.BuildDefinition.ExternalParameters["source"])
+	require.Equal(t, "v2.3.0", statement.Predicate.RunDetails.Builder.Version["nydusify"])
+	require.True(t, startedOn.Equal(statement.Predicate.RunDetails.Metadata.StartedOn))
+
+	_, err = NewProvenance(ProvenanceOpt{SourceDigest: sourceDigest})
+	require.Error(t, err)
+}
+
+func TestDetectSBOMType(t *testing.T) {
+	artifactType, err := DetectSBOMType([]byte(`{"spdxVersion": "SPDX-2.3"}`))
+	require.NoError(t, err)
+	require.Equal(t, MediaTypeSPDX, artifactType)
+
+	artifactType, err = DetectSBOMType([]byte(`{"bomFormat": "CycloneDX", "specVersion": "1.5"}`))
+	require.NoError(t, err)
+	require.Equal(t, MediaTypeCycloneDX, artifactType)
+
+	_, err = DetectSBOMType([]byte(`{}`))
+	require.Error(t, err)
+	_, err = DetectSBOMType([]byte(`not json`))
+	require.Error(t, err)
+}
+
+func TestNewManifest(t *testing.T) {
+	subject := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageIndex,
+		Digest:    digest.FromString("index"),
+		Size:      100,
+		Annotations: map[string]string{
+			"key": "value",
+		},
+	}
+	layer := ocispec.Descriptor{
+		MediaType: MediaTypeInToto,
+		Digest:    digest.FromString("statement"),
+		Size:      9,
+	}
+	data, err := newManifest(subject, MediaTypeInToto, layer, time.Now())
+	require.NoError(t, err)
+
+	var manifest ocispec.Manifest
+	require.NoError(t, json.Unmarshal(data, &manifest))
+	require.Equal(t, MediaTypeInToto, manifest.ArtifactType)
+	require.Equal(t, ocispec.DescriptorEmptyJSON.Digest, manifest.Config.Digest)
+	require.Equal(t, []ocispec.Descriptor{layer}, manifest.Layers)
+	require.NotNil(t, manifest.Subject)
+	require.Equal(t, subject.Digest, manifest.Subject.Digest)
+	require.Empty(t, manifest.Subject.Annotations)
+}
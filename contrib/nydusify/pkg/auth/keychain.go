@@ -0,0 +1,117 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package auth resolves registry credentials for both source pulls and
+// target pushes, so that nydusify doesn't require plaintext auth.
+package auth
+
+import (
+	"os"
+	"strings"
+
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/types"
+	"github.com/pkg/errors"
+)
+
+// EnvAuthConfig is the environment variable which holds the content of a
+// docker config file, for example: `{"auths": {"localhost:5000": {"auth": "..."}}}`,
+// `{"credHelpers": {"xxx.dkr.ecr.us-east-1.amazonaws.com": "ecr-login"}}`.
+// It's useful in CI systems which provide tokens from environment.
+const EnvAuthConfig = "DOCKER_AUTH_CONFIG"
+
+const (
+	dockerHubHost       = "registry-1.docker.io"
+	dockerHubConfigHost = "https://index.docker.io/v1/"
+)
+
+// PassKeyChain is the credential of a registry host.
+type PassKeyChain struct {
+	Username string
+	Password string
+	// IdentityToken is used as refresh token to obtain bearer tokens
+	// from registry, mostly returned by the credential helpers.
+	IdentityToken string
+}
+
+// Secret returns the username and secret used by containerd docker
+// authorizer, which treats the secret as refresh token if username
+// is empty.
+func (kc *PassKeyChain) Secret() (string, string) {
+	if kc.IdentityToken != "" {
+		return "", kc.IdentityToken
+	}
+	return kc.Username, kc.Password
+}
+
+// Empty returns true if no credential is available.
+func (kc *PassKeyChain) Empty() bool {
+	return kc.Username == "" && kc.Password == "" && kc.IdentityToken == ""
+}
+
+func fromAuthConfig(authConfig types.AuthConfig) *PassKeyChain {
+	return &PassKeyChain{
+		Username:      authConfig.Username,
+		Password:      authConfig.Password,
+		IdentityToken: authConfig.IdentityToken,
+	}
+}
+
+func lookup(config *configfile.ConfigFile, host string) (*PassKeyChain, error) {
+	// GetAuthConfig consults the credential helpers (`credHelpers` and
+	// `credsStore`) configured in the config file before the plain `auths`.
+	authConfig, err := config.GetAuthConfig(host)
+	if err != nil {
+		return nil, err
+	}
+	return fromAuthConfig(authConfig), nil
+}
+
+// GetKeyChain finds the credential of registry host from below sources
+// in order, an empty keychain is returned if not found:
+// 1. docker config content in `$DOCKER_AUTH_CONFIG` environment variable;
+// 2. docker config file `$DOCKER_CONFIG/config.json`, `$DOCKER_CONFIG` defaults to `~/.docker`.
+func GetKeyChain(host string) (*PassKeyChain, error) {
+	// The host of docker hub image will be converted to `registry-1.docker.io` in:
+	// github.com/containerd/containerd/remotes/docker/registry.go
+	// But we need use the key `https://index.docker.io/v1/` to find auth from docker config.
+	if host == dockerHubHost || host == "docker.io" {
+		host = dockerHubConfigHost
+	}
+
+	if content := os.Getenv(EnvAuthConfig); strings.TrimSpace(content) != "" {
+		config := configfile.New("")
+		if err := config.LoadFromReader(strings.NewReader(content)); err != nil {
+			return nil, errors.Wrapf(err, "parse docker config from $%s", EnvAuthConfig)
+		}
+		kc, err := lookup(config, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get auth config from $%s", EnvAuthConfig)
+		}
+		if !kc.Empty() {
+			return kc, nil
+		}
+	}
+
+	config := dockerconfig.LoadDefaultConfigFile(os.Stderr)
+	kc, err := lookup(config, host)
+	if err != nil {
+		return nil, errors.Wrap(err, "get docker registry auth config")
+	}
+
+	return kc, nil
+}
+
+// CredFunc accepts host url parameter and returns with username,
+// secret and error, it can be used as containerd docker authorizer
+// credential function.
+func CredFunc(host string) (string, string, error) {
+	kc, err := GetKeyChain(host)
+	if err != nil {
+		return "", "", err
+	}
+	username, secret := kc.Secret()
+	return username, secret, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package auth
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var configDir string
+
+// The docker config directory is only resolved once in process,
+// so all the tests share a same `$DOCKER_CONFIG` directory.
+func TestMain(m *testing.M) {
+	var err error
+	if configDir, err = os.MkdirTemp("", "nydusify-docker-config-"); err != nil {
+		panic(err)
+	}
+	os.Setenv("DOCKER_CONFIG", configDir)
+	code := m.Run()
+	os.RemoveAll(configDir)
+	os.Exit(code)
+}
+
+func encodeAuth(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func TestGetKeyChainFromEnv(t *testing.T) {
+	t.Setenv(EnvAuthConfig, `{
+		"auths": {
+			"localhost:5000": {"auth": "`+encodeAuth("user", "pass")+`"},
+			"https://index.docker.io/v1/": {"auth": "`+encodeAuth("hub", "secret")+`"},
+			"token.example.com": {"identitytoken": "refresh-token"}
+		}
+	}`)
+
+	kc, err := GetKeyChain("localhost:5000")
+	require.NoError(t, err)
+	require.Equal(t, "user", kc.Username)
+	require.Equal(t, "pass", kc.Password)
+
+	username, secret, err := CredFunc("registry-1.docker.io")
+	require.NoError(t, err)
+	require.Equal(t, "hub", username)
+	require.Equal(t, "secret", secret)
+
+	username, secret, err = CredFunc("token.example.com")
+	require.NoError(t, err)
+	require.Empty(t, username)
+	require.Equal(t, "refresh-token", secret)
+
+	kc, err = GetKeyChain("unknown.example.com")
+	require.NoError(t, err)
+	require.True(t, kc.Empty())
+
+	// Failure situation
+	t.Setenv(EnvAuthConfig, "{invalid")
+	_, err = GetKeyChain("localhost:5000")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), EnvAuthConfig)
+}
+
+func TestGetKeyChainFromConfigFile(t *testing.T) {
+	t.Setenv(EnvAuthConfig, `{"auths": {"other.example.com": {"auth": "`+encodeAuth("env", "pass")+`"}}}`)
+
+	err := os.WriteFile(filepath.Join(configDir, "config.json"), []byte(`{
+		"auths": {
+			"localhost:5000": {"auth": "`+encodeAuth("file", "pass")+`"}
+		}
+	}`), 0600)
+	require.NoError(t, err)
+	defer os.Remove(filepath.Join(configDir, "config.json"))
+
+	// Fallback to config file if not found in environment
+	kc, err := GetKeyChain("localhost:5000")
+	require.NoError(t, err)
+	require.Equal(t, "file", kc.Username)
+	require.Equal(t, "pass", kc.Password)
+}
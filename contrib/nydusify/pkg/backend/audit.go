@@ -0,0 +1,256 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// Operation classes of the audited backend requests, which are usually
+// billed differently by object storage providers.
+const (
+	OperationHead = "head"
+	OperationGet  = "get"
+	OperationPut  = "put"
+	// OperationPart is the upload of a part in multipart upload.
+	OperationPart = "part"
+	// OperationOther includes initiating, completing or aborting multipart
+	// uploads, listing and deleting objects.
+	OperationOther = "other"
+)
+
+// OperationStats is the number of requests and transferred bytes of an
+// operation class, the bytes are the request body for uploads and the
+// response body for downloads.
+type OperationStats struct {
+	Requests int64 `json:"requests"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type operationCounter struct {
+	requests int64
+	bytes    int64
+}
+
+// Auditor counts the requests sent by the storage backends per provider
+// (backend type) and operation class.
+type Auditor struct {
+	mutex    sync.Mutex
+	counters map[string]map[string]*operationCounter
+}
+
+// DefaultAuditor audits the requests of all OSS, S3 and http-proxy backends
+// created in the process, like the HTTP transports they are shared by all
+// backend instances.
+var DefaultAuditor = NewAuditor()
+
+func NewAuditor() *Auditor {
+	return &Auditor{
+		counters: map[string]map[string]*operationCounter{},
+	}
+}
+
+func (auditor *Auditor) counter(provider, operation string) *operationCounter {
+	auditor.mutex.Lock()
+	defer auditor.mutex.Unlock()
+
+	operations, ok := auditor.counters[provider]
+	if !ok {
+		operations = map[string]*operationCounter{}
+		auditor.counters[provider] = operations
+	}
+	counter, ok := operations[operation]
+	if !ok {
+		counter = &operationCounter{}
+		operations[operation] = counter
+	}
+	return counter
+}
+
+// Stats returns the snapshot of counters keyed by provider and operation class.
+func (auditor *Auditor) Stats() map[string]map[string]OperationStats {
+	auditor.mutex.Lock()
+	defer auditor.mutex.Unlock()
+
+	stats := map[string]map[string]OperationStats{}
+	for provider, operations := range auditor.counters {
+		stats[provider] = map[string]OperationStats{}
+		for operation, counter := range operations {
+			stats[provider][operation] = OperationStats{
+				Requests: atomic.LoadInt64(&counter.requests),
+				Bytes:    atomic.LoadInt64(&counter.bytes),
+			}
+		}
+	}
+	return stats
+}
+
+// Transport wraps the HTTP transport of backend to count its requests.
+func (auditor *Auditor) Transport(provider string, base http.RoundTripper) http.RoundTripper {
+	return &auditTransport{
+		base:     base,
+		provider: provider,
+		auditor:  auditor,
+	}
+}
+
+// classifyRequest returns the operation class of request, the multipart
+// part uploads are identified by the `partNumber` query of OSS and S3.
+func classifyRequest(req *http.Request) string {
+	switch req.Method {
+	case http.MethodHead:
+		return OperationHead
+	case http.MethodGet:
+		query := req.URL.Query()
+		// Listing objects or parts is billed as a PUT-class request
+		// by most providers, rather than a GET.
+		if query.Has("uploadId") || query.Has("list-type") || query.Has("prefix") {
+			return OperationOther
+		}
+		return OperationGet
+	case http.MethodPut:
+		if req.URL.Query().Has("partNumber") {
+			return OperationPart
+		}
+		return OperationPut
+	default:
+		return OperationOther
+	}
+}
+
+type auditTransport struct {
+	base     http.RoundTripper
+	provider string
+	auditor  *Auditor
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := classifyRequest(req)
+	counter := t.auditor.counter(t.provider, operation)
+	atomic.AddInt64(&counter.requests, 1)
+	if req.ContentLength > 0 {
+		atomic.AddInt64(&counter.bytes, req.ContentLength)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if operation == OperationGet && resp.Body != nil {
+		resp.Body = &countingReader{ReadCloser: resp.Body, counter: counter}
+	}
+	return resp, nil
+}
+
+// countingReader counts the bytes actually read from the response, which
+// may be less than the content length if the download is aborted.
+type countingReader struct {
+	io.ReadCloser
+	counter *operationCounter
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	atomic.AddInt64(&reader.counter.bytes, int64(n))
+	return n, err
+}
+
+// Pricing is the price list of a storage provider.
+type Pricing struct {
+	// Requests are the prices per 10,000 requests keyed by operation class.
+	Requests map[string]float64 `json:"requests"`
+	// Transfer are the prices per GiB transferred keyed by operation class,
+	// e.g. the internet egress of `get`.
+	Transfer map[string]float64 `json:"transfer"`
+}
+
+// PriceList is the pricing of storage providers keyed by backend type, such
+// as `oss` and `s3`.
+type PriceList struct {
+	Currency  string             `json:"currency"`
+	Providers map[string]Pricing `json:"providers"`
+}
+
+// LoadPriceList loads the price list from the JSON file.
+func LoadPriceList(path string) (*PriceList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read price list")
+	}
+	var priceList PriceList
+	if err := json.Unmarshal(data, &priceList); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal price list %s", path)
+	}
+	return &priceList, nil
+}
+
+// Estimate returns the estimated cost of the requests, the providers or
+// operation classes without prices are free.
+func (priceList *PriceList) Estimate(provider string, operation string, stats OperationStats) float64 {
+	if priceList == nil {
+		return 0
+	}
+	pricing, ok := priceList.Providers[provider]
+	if !ok {
+		return 0
+	}
+	return float64(stats.Requests)/10000*pricing.Requests[operation] +
+		float64(stats.Bytes)/(1<<30)*pricing.Transfer[operation]
+}
+
+// Summary formats the audited requests with the estimated cost if the price
+// list is specified, it returns an empty string if no request is audited.
+func (auditor *Auditor) Summary(priceList *PriceList) string {
+	stats := auditor.Stats()
+	if len(stats) == 0 {
+		return ""
+	}
+
+	providers := make([]string, 0, len(stats))
+	for provider := range stats {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	var builder strings.Builder
+	var total float64
+	fmt.Fprintf(&builder, "%-12s %-6s %10s %14s", "PROVIDER", "OP", "REQUESTS", "BYTES")
+	if priceList != nil {
+		fmt.Fprintf(&builder, " %12s", "COST")
+	}
+	builder.WriteString("\n")
+	for _, provider := range providers {
+		operations := make([]string, 0, len(stats[provider]))
+		for operation := range stats[provider] {
+			operations = append(operations, operation)
+		}
+		sort.Strings(operations)
+		for _, operation := range operations {
+			opStats := stats[provider][operation]
+			fmt.Fprintf(&builder, "%-12s %-6s %10d %14d", provider, operation, opStats.Requests, opStats.Bytes)
+			if priceList != nil {
+				cost := priceList.Estimate(provider, operation, opStats)
+				total += cost
+				fmt.Fprintf(&builder, " %12.4f", cost)
+			}
+			builder.WriteString("\n")
+		}
+	}
+	if priceList != nil {
+		fmt.Fprintf(&builder, "estimated cost: %.4f %s\n", total, priceList.Currency)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,97 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyRequest(t *testing.T) {
+	for _, tc := range []struct {
+		method    string
+		url       string
+		operation string
+	}{
+		{http.MethodHead, "http://bucket/blob", OperationHead},
+		{http.MethodGet, "http://bucket/blob", OperationGet},
+		{http.MethodGet, "http://bucket/blob?uploadId=1", OperationOther},
+		{http.MethodGet, "http://bucket/?list-type=2&prefix=nydus", OperationOther},
+		{http.MethodPut, "http://bucket/blob", OperationPut},
+		{http.MethodPut, "http://bucket/blob?partNumber=1&uploadId=1", OperationPart},
+		{http.MethodPost, "http://bucket/blob?uploads", OperationOther},
+		{http.MethodDelete, "http://bucket/blob?uploadId=1", OperationOther},
+	} {
+		req := httptest.NewRequest(tc.method, tc.url, nil)
+		require.Equal(t, tc.operation, classifyRequest(req), "%s %s", tc.method, tc.url)
+	}
+}
+
+func TestAuditor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(io.Discard, req.Body)
+		if req.Method == http.MethodGet {
+			w.Write([]byte("nydus"))
+		}
+	}))
+	defer server.Close()
+
+	auditor := NewAuditor()
+	client := &http.Client{Transport: auditor.Transport("oss", http.DefaultTransport)}
+
+	resp, err := client.Head(server.URL + "/blob")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = client.Get(server.URL + "/blob")
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, "nydus", string(data))
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/blob?partNumber=1&uploadId=1", bytes.NewReader(make([]byte, 1024)))
+		require.NoError(t, err)
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Equal(t, map[string]map[string]OperationStats{
+		"oss": {
+			OperationHead: {Requests: 1},
+			OperationGet:  {Requests: 1, Bytes: 5},
+			OperationPart: {Requests: 2, Bytes: 2048},
+		},
+	}, auditor.Stats())
+
+	summary := auditor.Summary(nil)
+	require.Contains(t, summary, "oss")
+	require.NotContains(t, summary, "estimated cost")
+
+	priceList := &PriceList{
+		Currency: "USD",
+		Providers: map[string]Pricing{
+			"oss": {
+				Requests: map[string]float64{OperationPart: 5000},
+				Transfer: map[string]float64{OperationGet: 1 << 30},
+			},
+		},
+	}
+	// 2 part uploads cost 2/10000*5000 and 5 bytes downloaded cost 5/(1<<30)*(1<<30).
+	require.Equal(t, float64(1), priceList.Estimate("oss", OperationPart, OperationStats{Requests: 2, Bytes: 2048}))
+	require.Equal(t, float64(5), priceList.Estimate("oss", OperationGet, OperationStats{Requests: 1, Bytes: 5}))
+	require.Equal(t, float64(0), priceList.Estimate("s3", OperationGet, OperationStats{Requests: 1, Bytes: 5}))
+	require.True(t, strings.HasSuffix(auditor.Summary(priceList), "estimated cost: 6.0000 USD\n"))
+
+	require.Empty(t, NewAuditor().Summary(priceList))
+}
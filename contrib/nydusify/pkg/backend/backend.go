@@ -6,6 +6,7 @@ package backend
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -19,15 +20,38 @@ import (
 // 1. registry: complying to OCI distribution specification, push blob file
 // to registry and use the registry as a storage.
 // 2. oss: A object storage backend, which uses its SDK to transfer blob file.
+// 3. http-proxy: A read-only HTTP(S) server serving the blobs, such as a CDN.
 type Backend interface {
 	// TODO: Hopefully, we can pass `Layer` struct in, thus to be able to cook both
 	// file handle and file path.
+	// All the operations are aborted when the context is done, so that the
+	// caller is able to cancel or bound a stuck transfer.
 	Upload(ctx context.Context, blobID, blobPath string, blobSize int64, forcePush bool) (*ocispec.Descriptor, error)
-	Finalize(cancel bool) error
-	Check(blobID string) (bool, error)
+	Finalize(ctx context.Context, cancel bool) error
+	Check(ctx context.Context, blobID string) (bool, error)
 	Type() Type
-	Reader(blobID string) (io.ReadCloser, error)
-	Size(blobID string) (int64, error)
+	Reader(ctx context.Context, blobID string) (io.ReadCloser, error)
+	Size(ctx context.Context, blobID string) (int64, error)
+}
+
+// Deleter is implemented by the backends able to delete blobs, which is used
+// to clean up the probes, it's not required by image conversion.
+type Deleter interface {
+	Delete(ctx context.Context, blobID string) error
+}
+
+// ErrDeleteUnsupported is returned by Delete if the backend doesn't support
+// deleting blobs.
+var ErrDeleteUnsupported = errors.New("deleting blobs is not supported by backend")
+
+// Delete deletes the blob from backend if it implements Deleter, deleting a
+// blob not existing is not an error.
+func Delete(ctx context.Context, backend Backend, blobID string) error {
+	deleter, ok := backend.(Deleter)
+	if !ok {
+		return ErrDeleteUnsupported
+	}
+	return deleter.Delete(ctx, blobID)
 }
 
 // TODO: Directly forward blob data to storage backend
@@ -38,6 +62,7 @@ const (
 	OssBackend Type = iota
 	RegistryBackend
 	S3backend
+	HTTPProxyBackendType
 )
 
 func blobDesc(size int64, blobID string) ocispec.Descriptor {
@@ -67,11 +92,21 @@ func blobDesc(size int64, blobID string) ocispec.Descriptor {
 func NewBackend(bt string, config []byte, remote *remote.Remote) (Backend, error) {
 	switch bt {
 	case "oss":
-		return newOSSBackend(config)
+		be, err := newOSSBackend(config)
+		if err != nil {
+			return nil, err
+		}
+		return WithSplit(be, be.splitSize), nil
 	case "registry":
 		return newRegistryBackend(config, remote)
 	case "s3":
-		return newS3Backend(config)
+		be, err := newS3Backend(config)
+		if err != nil {
+			return nil, err
+		}
+		return WithSplit(be, be.splitSize), nil
+	case "http-proxy":
+		return newHTTPProxyBackend(config)
 	default:
 		return nil, fmt.Errorf("unsupported backend type %s", bt)
 	}
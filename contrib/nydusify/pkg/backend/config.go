@@ -0,0 +1,277 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+)
+
+// Config describes a storage backend. The JSON schema is the same as the
+// `device.backend.config` of nydusd configuration, so that one config is able
+// to be used both to upload blobs by nydusify and to read them by nydusd.
+type Config interface {
+	// Type returns the backend type, which is also the value of
+	// `device.backend.type` of nydusd configuration.
+	Type() string
+	// Validate checks the required fields of config.
+	Validate() error
+	// Location identifies where the blobs are stored, the blob with same
+	// location and blob ID is the same object in storage, it's the key
+	// prefix of the blob existence cache.
+	Location() string
+}
+
+// OSSConfig is the config of Aliyun OSS backend.
+type OSSConfig struct {
+	Endpoint        string `json:"endpoint"`
+	BucketName      string `json:"bucket_name"`
+	AccessKeyID     string `json:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret"`
+	ObjectPrefix    string `json:"object_prefix"`
+	// Transport tunes the HTTP connection pool shared by OSS backends.
+	Transport *remote.TransportConfig `json:"transport,omitempty"`
+	// ConnectTimeout is in seconds, the endpoint failing to connect in time
+	// is skipped for the Endpoints.
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	// Endpoints are tried in order after Endpoint if it's unreachable, for
+	// example the public endpoint after the internal VPC endpoint. They are
+	// ignored by nydusd.
+	Endpoints []OSSEndpoint `json:"endpoints,omitempty"`
+
+	// StorageClass, Tags and Metadata are applied to the uploaded objects,
+	// so that lifecycle rules and cost attribution are able to select the
+	// nydus blobs. They are ignored by nydusd.
+	StorageClass string            `json:"storage_class,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	// SplitSize splits the blobs larger than it into multiple objects, which
+	// are only readable by nydusify, not by nydusd.
+	SplitSize int64 `json:"split_size,omitempty"`
+}
+
+// OSSEndpoint is a failover endpoint of OSS backend.
+type OSSEndpoint struct {
+	Endpoint string `json:"endpoint"`
+	// ConnectTimeout is in seconds, it defaults to the connect_timeout of
+	// OSS backend.
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+}
+
+// ossStorageClasses are the storage classes supported by OSS.
+var ossStorageClasses = []string{"Standard", "IA", "Archive", "ColdArchive", "DeepColdArchive"}
+
+// ossMaxTags is the max number of tags of an OSS object.
+const ossMaxTags = 10
+
+func (cfg *OSSConfig) Type() string {
+	return "oss"
+}
+
+func (cfg *OSSConfig) Location() string {
+	return fmt.Sprintf("oss://%s/%s/%s", cfg.Endpoint, cfg.BucketName, cfg.ObjectPrefix)
+}
+
+func (cfg *OSSConfig) Validate() error {
+	if cfg.Endpoint == "" || cfg.BucketName == "" {
+		return fmt.Errorf("invalid OSS configuration: missing 'endpoint' or 'bucket'")
+	}
+	if cfg.StorageClass != "" && !slices.Contains(ossStorageClasses, cfg.StorageClass) {
+		return fmt.Errorf("invalid OSS configuration: 'storage_class' should be one of %v", ossStorageClasses)
+	}
+	if len(cfg.Tags) > ossMaxTags {
+		return fmt.Errorf("invalid OSS configuration: at most %d 'tags' are allowed", ossMaxTags)
+	}
+	if cfg.SplitSize != 0 && cfg.SplitSize < minSplitSize {
+		return fmt.Errorf("invalid OSS configuration: 'split_size' should be at least %d", minSplitSize)
+	}
+	if cfg.ConnectTimeout < 0 {
+		return fmt.Errorf("invalid OSS configuration: 'connect_timeout' should not be negative")
+	}
+	for _, endpoint := range cfg.Endpoints {
+		if endpoint.Endpoint == "" || endpoint.ConnectTimeout < 0 {
+			return fmt.Errorf("invalid OSS configuration: 'endpoints' should have 'endpoint' and non-negative 'connect_timeout'")
+		}
+	}
+	return nil
+}
+
+// S3Config is the config of S3 compatible backend.
+type S3Config struct {
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	AccessKeySecret string `json:"access_key_secret,omitempty"`
+	Endpoint        string `json:"endpoint,omitempty"`
+	Scheme          string `json:"scheme,omitempty"`
+	BucketName      string `json:"bucket_name,omitempty"`
+	Region          string `json:"region,omitempty"`
+	ObjectPrefix    string `json:"object_prefix,omitempty"`
+	// Transport tunes the HTTP connection pool shared by S3 backends.
+	Transport *remote.TransportConfig `json:"transport,omitempty"`
+	// SplitSize splits the blobs larger than it into multiple objects, which
+	// are only readable by nydusify, not by nydusd.
+	SplitSize int64 `json:"split_size,omitempty"`
+}
+
+func (cfg *S3Config) Type() string {
+	return "s3"
+}
+
+func (cfg *S3Config) Location() string {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "s3.amazonaws.com"
+	}
+	return fmt.Sprintf("s3://%s/%s/%s", endpoint, cfg.BucketName, cfg.ObjectPrefix)
+}
+
+func (cfg *S3Config) Validate() error {
+	if cfg.BucketName == "" || cfg.Region == "" {
+		return fmt.Errorf("invalid S3 configuration: missing 'bucket_name' or 'region'")
+	}
+	if cfg.SplitSize != 0 && cfg.SplitSize < minSplitSize {
+		return fmt.Errorf("invalid S3 configuration: 'split_size' should be at least %d", minSplitSize)
+	}
+	return nil
+}
+
+// RegistryConfig is the config of registry backend, which is only read by
+// nydusd, nydusify pushes blobs to registry with the remote of image.
+type RegistryConfig struct {
+	Scheme     string             `json:"scheme"`
+	Host       string             `json:"host"`
+	Repo       string             `json:"repo"`
+	Auth       string             `json:"auth,omitempty"`
+	SkipVerify bool               `json:"skip_verify,omitempty"`
+	Proxy      BackendProxyConfig `json:"proxy"`
+}
+
+type BackendProxyConfig struct {
+	URL      string `json:"url"`
+	Fallback bool   `json:"fallback"`
+	PingURL  string `json:"ping_url"`
+}
+
+func (cfg *RegistryConfig) Type() string {
+	return "registry"
+}
+
+func (cfg *RegistryConfig) Location() string {
+	return fmt.Sprintf("registry://%s/%s/", cfg.Host, cfg.Repo)
+}
+
+func (cfg *RegistryConfig) Validate() error {
+	if cfg.Host == "" || cfg.Repo == "" {
+		return fmt.Errorf("invalid registry configuration: missing 'host' or 'repo'")
+	}
+	return nil
+}
+
+// HTTPProxyConfig is the config of read-only HTTP(S) backend, which is the
+// `http-proxy` backend of nydusd, for example a CDN serving the blobs at
+// `<addr><path>/<blob_id>`.
+type HTTPProxyConfig struct {
+	Addr       string `json:"addr"`
+	Path       string `json:"path,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	// Timeout and ConnectTimeout are in seconds, Timeout limits the time
+	// waiting for response headers.
+	Timeout        int `json:"timeout,omitempty"`
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	// Headers are sent with the requests of nydusify, for example the
+	// `Authorization` header, they are not supported by nydusd.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (cfg *HTTPProxyConfig) Type() string {
+	return "http-proxy"
+}
+
+func (cfg *HTTPProxyConfig) Location() string {
+	return strings.TrimSuffix(cfg.blobURL(""), "/") + "/"
+}
+
+func (cfg *HTTPProxyConfig) Validate() error {
+	if !strings.HasPrefix(cfg.Addr, "http://") && !strings.HasPrefix(cfg.Addr, "https://") {
+		return fmt.Errorf("invalid http-proxy configuration: 'addr' should be an HTTP(S) URL")
+	}
+	return nil
+}
+
+// blobURL returns the URL of blob, which is the same as nydusd.
+func (cfg *HTTPProxyConfig) blobURL(blobID string) string {
+	return strings.TrimSuffix(cfg.Addr, "/") + path.Join("/", cfg.Path, blobID)
+}
+
+// NewRegistryConfig creates the registry backend config for the image
+// reference, the auth is read from the docker config.
+func NewRegistryConfig(parsed reference.Named, insecure bool) (RegistryConfig, error) {
+	proxyURL := os.Getenv("HTTP_PROXY")
+	if proxyURL == "" {
+		proxyURL = os.Getenv("HTTPS_PROXY")
+	}
+
+	backendConfig := RegistryConfig{
+		Scheme:     "https",
+		Host:       reference.Domain(parsed),
+		Repo:       reference.Path(parsed),
+		SkipVerify: insecure,
+		Proxy: BackendProxyConfig{
+			URL:      proxyURL,
+			Fallback: true,
+		},
+	}
+
+	kc, err := auth.GetKeyChain(backendConfig.Host)
+	if err != nil {
+		return backendConfig, errors.Wrap(err, "get docker registry auth config")
+	}
+	if kc.Username != "" && kc.Password != "" {
+		backendConfig.Auth = base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%s", kc.Username, kc.Password)))
+	} else if kc.IdentityToken != "" {
+		logrus.Warnf("identity token of registry %s is not supported by nydusd registry backend", backendConfig.Host)
+	}
+
+	return backendConfig, nil
+}
+
+// ParseConfig parses and validates the backend config of the backend type,
+// possible values: oss, s3, registry, http-proxy.
+func ParseConfig(bt string, rawConfig []byte) (Config, error) {
+	var cfg Config
+	var parseErr string
+	switch bt {
+	case "oss":
+		cfg, parseErr = &OSSConfig{}, "Parse OSS storage backend configuration"
+	case "s3":
+		cfg, parseErr = &S3Config{}, "parse S3 storage backend configuration"
+	case "registry":
+		cfg, parseErr = &RegistryConfig{}, "parse registry storage backend configuration"
+	case "http-proxy":
+		cfg, parseErr = &HTTPProxyConfig{}, "parse http-proxy storage backend configuration"
+	default:
+		return nil, fmt.Errorf("unsupported backend type %s", bt)
+	}
+
+	if err := json.Unmarshal(rawConfig, cfg); err != nil {
+		return nil, errors.Wrap(err, parseErr)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
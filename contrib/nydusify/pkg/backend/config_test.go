@@ -0,0 +1,96 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("oss", []byte(`{"endpoint": "region.oss.com", "bucket_name": "test", "object_prefix": "blob"}`))
+	require.NoError(t, err)
+	require.Equal(t, "oss", cfg.Type())
+	require.Equal(t, &OSSConfig{Endpoint: "region.oss.com", BucketName: "test", ObjectPrefix: "blob"}, cfg)
+
+	_, err = ParseConfig("oss", []byte(`{"bucket_name": "test"}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid OSS configuration: missing 'endpoint' or 'bucket'")
+
+	cfg, err = ParseConfig("oss", []byte(`{"endpoint": "region.oss.com", "bucket_name": "test", "storage_class": "IA", "tags": {"image": "nginx"}, "metadata": {"build-id": "1"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "IA", cfg.(*OSSConfig).StorageClass)
+	require.Len(t, ossUploadOptions(cfg.(*OSSConfig)), 3)
+
+	_, err = ParseConfig("oss", []byte(`{"endpoint": "region.oss.com", "bucket_name": "test", "storage_class": "Cold"}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'storage_class' should be one of")
+
+	cfg, err = ParseConfig("oss", []byte(`{"endpoint": "region-internal.oss.com", "bucket_name": "test", "connect_timeout": 3, "endpoints": [{"endpoint": "https://region.oss.com", "connect_timeout": 10}, {"endpoint": "region.backup.com"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []failoverEndpoint{
+		{scheme: "http", host: "region-internal.oss.com", connectTimeout: 3 * time.Second},
+		{scheme: "https", host: "region.oss.com", connectTimeout: 10 * time.Second},
+		{scheme: "http", host: "region.backup.com", connectTimeout: 3 * time.Second},
+	}, ossEndpoints(cfg.(*OSSConfig)))
+
+	_, err = ParseConfig("oss", []byte(`{"endpoint": "region.oss.com", "bucket_name": "test", "endpoints": [{"connect_timeout": 3}]}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'endpoints' should have 'endpoint'")
+
+	cfg, err = ParseConfig("s3", []byte(`{"bucket_name": "test", "region": "region1"}`))
+	require.NoError(t, err)
+	require.Equal(t, "s3", cfg.Type())
+
+	_, err = ParseConfig("s3", []byte(`{"bucket_name": "test"}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid S3 configuration: missing 'bucket_name' or 'region'")
+
+	cfg, err = ParseConfig("registry", []byte(`{"scheme": "https", "host": "docker.io", "repo": "library/busybox"}`))
+	require.NoError(t, err)
+	require.Equal(t, "registry", cfg.Type())
+
+	_, err = ParseConfig("registry", []byte(`{"host": "docker.io"}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid registry configuration: missing 'host' or 'repo'")
+
+	_, err = ParseConfig("s3", []byte(`{`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "parse S3 storage backend configuration")
+
+	_, err = ParseConfig("localfs", []byte(`{}`))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported backend type localfs")
+}
+
+func TestNewRegistryConfig(t *testing.T) {
+	t.Setenv("HTTP_PROXY", "http://proxy:8080")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	parsed, err := reference.ParseNormalizedNamed("localhost:5000/library/busybox:latest")
+	require.NoError(t, err)
+	cfg, err := NewRegistryConfig(parsed, true)
+	require.NoError(t, err)
+	require.Equal(t, RegistryConfig{
+		Scheme:     "https",
+		Host:       "localhost:5000",
+		Repo:       "library/busybox",
+		SkipVerify: true,
+		Proxy: BackendProxyConfig{
+			URL:      "http://proxy:8080",
+			Fallback: true,
+		},
+	}, cfg)
+
+	// The generated config is accepted by the shared schema.
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	_, err = ParseConfig(cfg.Type(), data)
+	require.NoError(t, err)
+}
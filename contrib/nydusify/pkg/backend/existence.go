@@ -0,0 +1,239 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// existenceEntry records a blob known to exist in storage backend.
+type existenceEntry struct {
+	// URLs are the remote URLs returned by the upload of blob.
+	URLs    []string  `json:"urls,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// ExistenceCache records the blobs known to exist in storage backends, keyed
+// by the backend location and blob ID, so that the same blobs are not checked
+// or uploaded repeatedly. The cache is shared by the backends in process, and
+// optionally persisted to a file to be shared across processes.
+type ExistenceCache struct {
+	ttl  time.Duration
+	path string
+	now  func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]existenceEntry
+}
+
+// NewExistenceCache creates the cache, a recorded blob is trusted to exist
+// within ttl. The cache is loaded from the file at path if specified, the
+// expired entries are dropped.
+func NewExistenceCache(ttl time.Duration, path string) (*ExistenceCache, error) {
+	if ttl <= 0 {
+		return nil, errors.Errorf("invalid TTL %s of blob existence cache", ttl)
+	}
+	cache := &ExistenceCache{
+		ttl:     ttl,
+		path:    path,
+		now:     time.Now,
+		entries: map[string]existenceEntry{},
+	}
+	if path == "" {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cache, nil
+		}
+		return nil, errors.Wrapf(err, "read blob existence cache %s", path)
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		// A broken cache only costs the backend requests, rebuild it.
+		logrus.WithError(err).Warnf("ignore invalid blob existence cache %s", path)
+		cache.entries = map[string]existenceEntry{}
+	}
+	cache.expire()
+
+	return cache, nil
+}
+
+func (cache *ExistenceCache) expire() {
+	now := cache.now()
+	for key, entry := range cache.entries {
+		if !now.Before(entry.Expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
+
+// Get returns the URLs of blob if it's known to exist.
+func (cache *ExistenceCache) Get(key string) ([]string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !cache.now().Before(entry.Expires) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	return entry.URLs, true
+}
+
+// Add records the blob exists.
+func (cache *ExistenceCache) Add(key string, urls []string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries[key] = existenceEntry{
+		URLs:    urls,
+		Expires: cache.now().Add(cache.ttl),
+	}
+}
+
+// Remove invalidates the record of blob.
+func (cache *ExistenceCache) Remove(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	delete(cache.entries, key)
+}
+
+// Save persists the unexpired entries to the cache file, it does nothing if
+// the cache is process-local.
+func (cache *ExistenceCache) Save() error {
+	if cache.path == "" {
+		return nil
+	}
+
+	cache.mutex.Lock()
+	cache.expire()
+	data, err := json.Marshal(cache.entries)
+	cache.mutex.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "marshal blob existence cache")
+	}
+
+	dir := filepath.Dir(cache.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "create directory %s", dir)
+	}
+	file, err := os.CreateTemp(dir, filepath.Base(cache.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "create temp file")
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "write blob existence cache %s", cache.path)
+	}
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "write blob existence cache %s", cache.path)
+	}
+	if err := os.Rename(file.Name(), cache.path); err != nil {
+		return errors.Wrapf(err, "write blob existence cache %s", cache.path)
+	}
+
+	return nil
+}
+
+// cachedBackend consults the existence cache before checking or uploading
+// blobs, the uploaded blobs are recorded only after the upload is finalized.
+type cachedBackend struct {
+	Backend
+	location string
+	cache    *ExistenceCache
+
+	mutex   sync.Mutex
+	pending map[string][]string
+}
+
+// WithExistenceCache wraps the backend created from the config with the
+// existence cache.
+func WithExistenceCache(backend Backend, cfg Config, cache *ExistenceCache) Backend {
+	return &cachedBackend{
+		Backend:  backend,
+		location: cfg.Location(),
+		cache:    cache,
+		pending:  map[string][]string{},
+	}
+}
+
+func (b *cachedBackend) Upload(ctx context.Context, blobID, blobPath string, size int64, forcePush bool) (*ocispec.Descriptor, error) {
+	key := b.location + blobID
+	if !forcePush {
+		// The URLs are unknown if the blob is recorded by Check.
+		if urls, ok := b.cache.Get(key); ok && len(urls) > 0 {
+			logrus.Infof("skip upload because blob exists in cache: %s", blobID)
+			desc := blobDesc(size, blobID)
+			desc.URLs = urls
+			return &desc, nil
+		}
+	}
+
+	desc, err := b.Backend.Upload(ctx, blobID, blobPath, size, forcePush)
+	if err != nil {
+		b.cache.Remove(key)
+		return nil, err
+	}
+
+	b.mutex.Lock()
+	b.pending[key] = desc.URLs
+	b.mutex.Unlock()
+
+	return desc, nil
+}
+
+func (b *cachedBackend) Finalize(ctx context.Context, cancel bool) error {
+	err := b.Backend.Finalize(ctx, cancel)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for key, urls := range b.pending {
+		if cancel || err != nil {
+			b.cache.Remove(key)
+		} else {
+			b.cache.Add(key, urls)
+		}
+	}
+	b.pending = map[string][]string{}
+
+	return err
+}
+
+func (b *cachedBackend) Delete(ctx context.Context, blobID string) error {
+	b.cache.Remove(b.location + blobID)
+	return Delete(ctx, b.Backend, blobID)
+}
+
+func (b *cachedBackend) Check(ctx context.Context, blobID string) (bool, error) {
+	key := b.location + blobID
+	if _, ok := b.cache.Get(key); ok {
+		return true, nil
+	}
+
+	exist, err := b.Backend.Check(ctx, blobID)
+	if err != nil || !exist {
+		b.cache.Remove(key)
+		return exist, err
+	}
+	b.cache.Add(key, nil)
+
+	return true, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// countingBackend counts the backend requests, the upload fails if err is set.
+type countingBackend struct {
+	uploads int
+	checks  int
+	err     error
+}
+
+func (b *countingBackend) Upload(_ context.Context, blobID, _ string, size int64, _ bool) (*ocispec.Descriptor, error) {
+	b.uploads++
+	if b.err != nil {
+		return nil, b.err
+	}
+	desc := blobDesc(size, blobID)
+	desc.URLs = []string{"oss://bucket/" + blobID}
+	return &desc, nil
+}
+
+func (b *countingBackend) Finalize(_ context.Context, _ bool) error {
+	return nil
+}
+
+func (b *countingBackend) Check(_ context.Context, _ string) (bool, error) {
+	b.checks++
+	return true, b.err
+}
+
+func (b *countingBackend) Type() Type {
+	return OssBackend
+}
+
+func (b *countingBackend) Reader(_ context.Context, _ string) (io.ReadCloser, error) {
+	panic("not implemented")
+}
+
+func (b *countingBackend) Size(_ context.Context, _ string) (int64, error) {
+	panic("not implemented")
+}
+
+func TestExistenceCache(t *testing.T) {
+	ctx := context.Background()
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	cache, err := NewExistenceCache(time.Hour, cachePath)
+	require.NoError(t, err)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	be := &countingBackend{}
+	cfg := &OSSConfig{Endpoint: "region.oss.com", BucketName: "bucket"}
+	cached := WithExistenceCache(be, cfg, cache)
+
+	// The upload is recorded after finalized.
+	_, err = cached.Upload(ctx, "blob1", "", 0, false)
+	require.NoError(t, err)
+	require.NoError(t, cached.Finalize(ctx, true))
+	_, err = cached.Upload(ctx, "blob1", "", 0, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, be.uploads)
+	require.NoError(t, cached.Finalize(ctx, false))
+
+	desc, err := cached.Upload(ctx, "blob1", "", 0, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"oss://bucket/blob1"}, desc.URLs)
+	require.Equal(t, 2, be.uploads)
+	exist, err := cached.Check(ctx, "blob1")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, 0, be.checks)
+
+	// The blob with same ID in another location is not cached.
+	other := WithExistenceCache(be, &OSSConfig{Endpoint: "region.oss.com", BucketName: "other"}, cache)
+	_, err = other.Check(ctx, "blob1")
+	require.NoError(t, err)
+	require.Equal(t, 1, be.checks)
+
+	// The record is shared across processes.
+	require.NoError(t, cache.Save())
+	loaded, err := NewExistenceCache(time.Hour, cachePath)
+	require.NoError(t, err)
+	urls, ok := loaded.Get(cfg.Location() + "blob1")
+	require.True(t, ok)
+	require.Equal(t, []string{"oss://bucket/blob1"}, urls)
+
+	// The record is invalidated by the upload failure.
+	be.err = errors.New("upload failed")
+	_, err = cached.Upload(ctx, "blob1", "", 0, true)
+	require.Error(t, err)
+	_, ok = cache.Get(cfg.Location() + "blob1")
+	require.False(t, ok)
+
+	// The record expires after TTL.
+	cache.Add(cfg.Location()+"blob2", nil)
+	now = now.Add(time.Hour)
+	_, ok = cache.Get(cfg.Location() + "blob2")
+	require.False(t, ok)
+
+	_, err = NewExistenceCache(0, "")
+	require.Error(t, err)
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// variablePattern matches the `${NAME}` and `${NAME:-default}` variables, and
+// the escaped `$${` in backend config.
+var variablePattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandConfig substitutes the `${NAME}` variables in the backend config with
+// the values returned by lookup, `${NAME:-default}` uses the default value if
+// the variable is not defined, and `$${` is written as a literal `${`. The
+// values are escaped as JSON string content, so that they can be quoted in
+// the config. An undefined variable without default value is an error, to
+// avoid uploading blobs to an unexpected location.
+func ExpandConfig(config string, lookup func(name string) (string, bool)) (string, error) {
+	var missing []string
+	expanded := variablePattern.ReplaceAllStringFunc(config, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := variablePattern.FindStringSubmatch(match)
+		value, ok := lookup(groups[1])
+		if !ok {
+			if groups[2] == "" {
+				missing = append(missing, groups[1])
+				return match
+			}
+			value = groups[3]
+		}
+		return escapeJSONString(value)
+	})
+	if len(missing) > 0 {
+		return "", errors.Errorf("undefined variables in backend config: %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+func escapeJSONString(value string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string never fails.
+	_ = encoder.Encode(value)
+	quoted := strings.TrimSuffix(buf.String(), "\n")
+	return quoted[1 : len(quoted)-1]
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandConfig(t *testing.T) {
+	vars := map[string]string{
+		"ENV":    "prod",
+		"SECRET": `a"b\c`,
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	config := `{
+		"bucket_name": "nydus-${ENV}",
+		"endpoint": "${ENDPOINT:-region.aliyuncs.com}",
+		"access_key_id": "$${ENV}",
+		"access_key_secret": "${SECRET}",
+		"object_prefix": "$ENV/${not-variable}"
+	}`
+	expanded, err := ExpandConfig(config, lookup)
+	require.NoError(t, err)
+
+	var cfg map[string]string
+	require.NoError(t, json.Unmarshal([]byte(expanded), &cfg))
+	require.Equal(t, map[string]string{
+		"bucket_name":       "nydus-prod",
+		"endpoint":          "region.aliyuncs.com",
+		"access_key_id":     "${ENV}",
+		"access_key_secret": `a"b\c`,
+		"object_prefix":     "$ENV/${not-variable}",
+	}, cfg)
+
+	_, err = ExpandConfig(`{"bucket_name": "${BUCKET}-${REGION}", "endpoint": "${ENDPOINT:-}"}`, lookup)
+	require.ErrorContains(t, err, "undefined variables in backend config: BUCKET, REGION")
+
+	expanded, err = ExpandConfig(`{"endpoint": "${ENDPOINT:-}"}`, lookup)
+	require.NoError(t, err)
+	require.Equal(t, `{"endpoint": ""}`, expanded)
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// endpointCooldown is the duration an unreachable endpoint is skipped, after
+// which it's tried again by the next request.
+const endpointCooldown = 30 * time.Second
+
+// failoverEndpoint is an endpoint of object storage, the requests are sent to
+// it by replacing the host of primary endpoint.
+type failoverEndpoint struct {
+	scheme         string
+	host           string
+	connectTimeout time.Duration
+}
+
+// parseEndpoint splits the scheme and host of endpoint, the scheme defaults
+// to http as OSS SDK.
+func parseEndpoint(endpoint string, connectTimeout int) failoverEndpoint {
+	scheme := "http"
+	if index := strings.Index(endpoint, "://"); index >= 0 {
+		scheme, endpoint = endpoint[:index], endpoint[index+3:]
+	}
+	return failoverEndpoint{
+		scheme:         scheme,
+		host:           strings.TrimSuffix(endpoint, "/"),
+		connectTimeout: time.Duration(connectTimeout) * time.Second,
+	}
+}
+
+// failoverTransport sends the requests built for the primary endpoint to the
+// first reachable endpoint in order, an endpoint failing to connect is skipped
+// for endpointCooldown, so that one config works both inside a VPC with the
+// internal endpoint and outside with the public endpoint.
+type failoverTransport struct {
+	base      http.RoundTripper
+	endpoints []failoverEndpoint
+	now       func() time.Time
+
+	mutex     sync.Mutex
+	downUntil []time.Time
+	// healthy marks the endpoints having responded since last failure.
+	healthy []bool
+}
+
+func newFailoverTransport(base http.RoundTripper, endpoints []failoverEndpoint) *failoverTransport {
+	return &failoverTransport{
+		base:      base,
+		endpoints: endpoints,
+		now:       time.Now,
+		downUntil: make([]time.Time, len(endpoints)),
+		healthy:   make([]bool, len(endpoints)),
+	}
+}
+
+// order returns the indexes of endpoints to try, the available ones are
+// tried first in configured order, then the ones in cooldown as last resort.
+func (t *failoverTransport) order() []int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	var available, down []int
+	for index := range t.endpoints {
+		if now.Before(t.downUntil[index]) {
+			down = append(down, index)
+		} else {
+			available = append(available, index)
+		}
+	}
+	return append(available, down...)
+}
+
+func (t *failoverTransport) markDown(index int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.downUntil[index] = t.now().Add(endpointCooldown)
+	t.healthy[index] = false
+}
+
+func (t *failoverTransport) markUp(index int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.downUntil[index] = time.Time{}
+	t.healthy[index] = true
+}
+
+func (t *failoverTransport) isHealthy(index int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.healthy[index]
+}
+
+// rewriteHost replaces the primary endpoint in host, which is either the
+// endpoint itself or `<bucket>.<endpoint>`.
+func rewriteHost(host, primary, endpoint string) string {
+	if host == primary {
+		return endpoint
+	}
+	if strings.HasSuffix(host, "."+primary) {
+		return strings.TrimSuffix(host, primary) + endpoint
+	}
+	return host
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The request body can't be sent again without GetBody, so such request
+	// is only sent to the endpoint proven reachable by a bodyless probe.
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	sent := false
+
+	order := t.order()
+	for attempt, index := range order {
+		endpoint := t.endpoints[index]
+		var resp *http.Response
+		var err error
+		if !replayable && !t.isHealthy(index) {
+			err = t.probe(req, endpoint)
+		}
+		if err == nil {
+			resp, err = t.roundTrip(req, endpoint, sent)
+			sent = true
+			if err == nil {
+				t.markUp(index)
+				return resp, nil
+			}
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+
+		t.markDown(index)
+		if attempt == len(order)-1 || (sent && !replayable) {
+			return nil, err
+		}
+		logrus.WithError(err).Warnf("endpoint %s is unreachable, fail over to %s", endpoint.host, t.endpoints[order[attempt+1]].host)
+	}
+	return nil, fmt.Errorf("no endpoint available")
+}
+
+// probe checks if the endpoint is reachable by sending a HEAD request without
+// body, any response from the endpoint is fine.
+func (t *failoverTransport) probe(req *http.Request, endpoint failoverEndpoint) error {
+	probe := req.Clone(req.Context())
+	probe.Method = http.MethodHead
+	probe.Body = nil
+	probe.GetBody = nil
+	probe.ContentLength = 0
+	probe.Header.Del("Content-Length")
+	probe.Header.Del("Content-Md5")
+
+	resp, err := t.roundTrip(probe, endpoint, false)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *failoverTransport) roundTrip(req *http.Request, endpoint failoverEndpoint, resend bool) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	var timedOut atomic.Bool
+	if endpoint.connectTimeout > 0 {
+		timer := time.AfterFunc(endpoint.connectTimeout, func() {
+			timedOut.Store(true)
+			cancel()
+		})
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(httptrace.GotConnInfo) {
+				timer.Stop()
+			},
+		})
+	}
+
+	primary := t.endpoints[0]
+	cloned := req.Clone(ctx)
+	cloned.URL.Host = rewriteHost(req.URL.Host, primary.host, endpoint.host)
+	if cloned.URL.Host != req.URL.Host {
+		cloned.URL.Scheme = endpoint.scheme
+	}
+	cloned.Host = ""
+	if resend && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		cloned.Body = body
+	}
+
+	resp, err := t.base.RoundTrip(cloned)
+	if err != nil {
+		cancel()
+		if timedOut.Load() {
+			return nil, fmt.Errorf("connect to %s timed out after %s", endpoint.host, endpoint.connectTimeout)
+		}
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the request context after the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
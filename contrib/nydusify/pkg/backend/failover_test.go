@@ -0,0 +1,139 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteHost(t *testing.T) {
+	require.Equal(t, "bucket.oss.com", rewriteHost("bucket.oss-internal.com", "oss-internal.com", "oss.com"))
+	require.Equal(t, "oss.com", rewriteHost("oss-internal.com", "oss-internal.com", "oss.com"))
+	require.Equal(t, "other.com", rewriteHost("other.com", "oss-internal.com", "oss.com"))
+
+	endpoint := parseEndpoint("https://oss.com/", 3)
+	require.Equal(t, failoverEndpoint{scheme: "https", host: "oss.com", connectTimeout: 3 * time.Second}, endpoint)
+	require.Equal(t, "http", parseEndpoint("oss.com", 0).scheme)
+}
+
+// hostRecorder records the hosts of requests sent by the transport.
+type hostRecorder struct {
+	base  http.RoundTripper
+	mutex sync.Mutex
+	hosts []string
+}
+
+func (r *hostRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mutex.Lock()
+	r.hosts = append(r.hosts, req.URL.Host)
+	r.mutex.Unlock()
+	// The unroutable endpoint never connects.
+	if req.URL.Host == "unroutable" {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return r.base.RoundTrip(req)
+}
+
+func (r *hostRecorder) reset() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	hosts := r.hosts
+	r.hosts = nil
+	return hosts
+}
+
+func TestFailoverTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte(r.Method+" "), body...))
+	}))
+	defer server.Close()
+	available := strings.TrimPrefix(server.URL, "http://")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed := listener.Addr().String()
+	listener.Close()
+
+	recorder := &hostRecorder{base: http.DefaultTransport}
+	transport := newFailoverTransport(recorder, []failoverEndpoint{
+		parseEndpoint(closed, 0),
+		parseEndpoint(available, 0),
+	})
+	now := time.Now()
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func() string {
+		resp, err := client.Get("http://" + closed + "/object")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	require.Equal(t, "GET ", get())
+	require.Equal(t, []string{closed, available}, recorder.reset())
+
+	// The unreachable endpoint is skipped until the cooldown expires.
+	require.Equal(t, "GET ", get())
+	require.Equal(t, []string{available}, recorder.reset())
+	now = now.Add(endpointCooldown)
+	require.Equal(t, "GET ", get())
+	require.Equal(t, []string{closed, available}, recorder.reset())
+
+	// The request body is sent again to the failover endpoint.
+	now = now.Add(endpointCooldown)
+	resp, err := client.Post("http://"+closed+"/object", "text/plain", strings.NewReader("data"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "POST data", string(body))
+	recorder.reset()
+
+	// The request body without GetBody is only sent to the endpoint which
+	// is probed reachable after the cooldown expires.
+	now = now.Add(endpointCooldown)
+	req, err := http.NewRequest(http.MethodPut, "http://"+closed+"/object", io.NopCloser(strings.NewReader("data")))
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "PUT data", string(body))
+	require.Equal(t, []string{closed, available}, recorder.reset())
+
+	// The probe is skipped for the reachable endpoint.
+	req, err = http.NewRequest(http.MethodPut, "http://"+closed+"/object", io.NopCloser(strings.NewReader("data")))
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, []string{available}, recorder.reset())
+
+	// The endpoint failing to connect in time is skipped.
+	transport = newFailoverTransport(recorder, []failoverEndpoint{
+		parseEndpoint("unroutable", 1),
+		parseEndpoint(available, 1),
+	})
+	client = &http.Client{Transport: transport}
+	resp, err = client.Get("http://unroutable/object")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, []string{"unroutable", available}, recorder.reset())
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+)
+
+// HTTPProxyBackend reads the blobs from an HTTP(S) server, it's read-only.
+type HTTPProxyBackend struct {
+	config *HTTPProxyConfig
+	client *http.Client
+}
+
+func newHTTPProxyBackend(rawConfig []byte) (*HTTPProxyBackend, error) {
+	parsed, err := ParseConfig("http-proxy", rawConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := parsed.(*HTTPProxyConfig)
+
+	transportConfig := remote.DefaultTransportConfig
+	transportConfig.ConnectTimeout = config.ConnectTimeout
+	transportConfig.ResponseHeaderTimeout = config.Timeout
+
+	return &HTTPProxyBackend{
+		config: config,
+		client: &http.Client{
+			Transport: remote.NewRetryTransport(DefaultAuditor.Transport("http-proxy", remote.SharedTransport(transportConfig, config.SkipVerify))),
+		},
+	}, nil
+}
+
+func (b *HTTPProxyBackend) Upload(_ context.Context, _, _ string, _ int64, _ bool) (*ocispec.Descriptor, error) {
+	return nil, errors.New("http-proxy backend is read-only")
+}
+
+func (b *HTTPProxyBackend) Finalize(_ context.Context, _ bool) error {
+	return nil
+}
+
+func (b *HTTPProxyBackend) do(ctx context.Context, method, blobID string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.config.blobURL(blobID), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+	for key, value := range b.config.Headers {
+		req.Header.Set(key, value)
+	}
+	return b.client.Do(req)
+}
+
+func (b *HTTPProxyBackend) head(ctx context.Context, blobID string) (*http.Response, error) {
+	resp, err := b.do(ctx, http.MethodHead, blobID)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (b *HTTPProxyBackend) Check(ctx context.Context, blobID string) (bool, error) {
+	resp, err := b.head(ctx, blobID)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return true, nil
+	default:
+		return false, fmt.Errorf("check blob %s: unexpected status %s", blobID, resp.Status)
+	}
+}
+
+func (b *HTTPProxyBackend) Type() Type {
+	return HTTPProxyBackendType
+}
+
+func (b *HTTPProxyBackend) Reader(ctx context.Context, blobID string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, blobID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("read blob %s: unexpected status %s", blobID, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+func (b *HTTPProxyBackend) Size(ctx context.Context, blobID string) (int64, error) {
+	resp, err := b.head(ctx, blobID)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("get size of blob %s: unexpected status %s", blobID, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return 0, fmt.Errorf("get size of blob %s: missing content length", blobID)
+	}
+	return resp.ContentLength, nil
+}
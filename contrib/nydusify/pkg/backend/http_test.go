@@ -0,0 +1,72 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProxyBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Path != "/blobs/blob1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "5")
+		if req.Method == http.MethodGet {
+			w.Write([]byte("nydus"))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	config := fmt.Sprintf(`{"addr": "%s", "path": "/blobs", "headers": {"Authorization": "Bearer token"}}`, server.URL)
+	be, err := NewBackend("http-proxy", []byte(config), nil)
+	require.NoError(t, err)
+	require.Equal(t, HTTPProxyBackendType, be.Type())
+
+	exist, err := be.Check(ctx, "blob1")
+	require.NoError(t, err)
+	require.True(t, exist)
+	exist, err = be.Check(ctx, "blob2")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	size, err := be.Size(ctx, "blob1")
+	require.NoError(t, err)
+	require.Equal(t, int64(5), size)
+
+	reader, err := be.Reader(ctx, "blob1")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, "nydus", string(data))
+
+	_, err = be.Upload(ctx, "blob1", "", 0, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "read-only")
+
+	be, err = NewBackend("http-proxy", []byte(fmt.Sprintf(`{"addr": "%s", "path": "/blobs"}`, server.URL)), nil)
+	require.NoError(t, err)
+	_, err = be.Check(ctx, "blob1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+
+	_, err = NewBackend("http-proxy", []byte(`{"addr": "/path/to/unix.sock"}`), nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'addr' should be an HTTP(S) URL")
+}
@@ -6,12 +6,12 @@ package backend
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"hash/crc64"
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -21,6 +21,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
 )
 
 const (
@@ -33,6 +35,8 @@ type multipartStatus struct {
 	imur          *oss.InitiateMultipartUploadResult
 	parts         []oss.UploadPart
 	blobObjectKey string
+	blobPath      string
+	blobSize      int64
 	crc64Chan     chan uint64
 	crc64ErrChan  chan error
 }
@@ -42,44 +46,89 @@ type OSSBackend struct {
 	// to make it a path-like object.
 	objectPrefix string
 	bucket       *oss.Bucket
-	ms           []multipartStatus
-	msMutex      sync.Mutex
+	// uploadOptions set the storage class, tags and metadata of objects.
+	uploadOptions []oss.Option
+	// splitSize splits the large blobs into multiple objects.
+	splitSize int64
+	ms        []multipartStatus
+	msMutex   sync.Mutex
 }
 
 func newOSSBackend(rawConfig []byte) (*OSSBackend, error) {
-	var configMap map[string]string
-	if err := json.Unmarshal(rawConfig, &configMap); err != nil {
-		return nil, errors.Wrap(err, "Parse OSS storage backend configuration")
+	parsed, err := ParseConfig("oss", rawConfig)
+	if err != nil {
+		return nil, err
 	}
+	config := parsed.(*OSSConfig)
 
-	endpoint := configMap["endpoint"]
-	bucketName := configMap["bucket_name"]
-
-	// Below items are not mandatory
-	accessKeyID := configMap["access_key_id"]
-	accessKeySecret := configMap["access_key_secret"]
-	objectPrefix := configMap["object_prefix"]
-
-	if endpoint == "" || bucketName == "" {
-		return nil, fmt.Errorf("invalid OSS configuration: missing 'endpoint' or 'bucket'")
+	transportConfig := remote.DefaultTransportConfig
+	if config.Transport != nil {
+		transportConfig = *config.Transport
 	}
-
-	client, err := oss.New(endpoint, accessKeyID, accessKeySecret)
+	transport := DefaultAuditor.Transport("oss", remote.SharedTransport(transportConfig, false))
+	if len(config.Endpoints) > 0 || config.ConnectTimeout > 0 {
+		transport = newFailoverTransport(transport, ossEndpoints(config))
+	}
+	client, err := oss.New(
+		config.Endpoint, config.AccessKeyID, config.AccessKeySecret,
+		oss.HTTPClient(&http.Client{Transport: transport}),
+	)
 	if err != nil {
 		return nil, errors.Wrap(err, "Create client")
 	}
 
-	bucket, err := client.Bucket(bucketName)
+	bucket, err := client.Bucket(config.BucketName)
 	if err != nil {
 		return nil, errors.Wrap(err, "Create bucket")
 	}
 
 	return &OSSBackend{
-		objectPrefix: objectPrefix,
-		bucket:       bucket,
+		objectPrefix:  config.ObjectPrefix,
+		bucket:        bucket,
+		uploadOptions: ossUploadOptions(config),
+		splitSize:     config.SplitSize,
 	}, nil
 }
 
+// ossEndpoints returns the primary endpoint followed by the failover ones.
+func ossEndpoints(config *OSSConfig) []failoverEndpoint {
+	endpoints := []failoverEndpoint{parseEndpoint(config.Endpoint, config.ConnectTimeout)}
+	for _, endpoint := range config.Endpoints {
+		connectTimeout := endpoint.ConnectTimeout
+		if connectTimeout == 0 {
+			connectTimeout = config.ConnectTimeout
+		}
+		endpoints = append(endpoints, parseEndpoint(endpoint.Endpoint, connectTimeout))
+	}
+	return endpoints
+}
+
+func ossUploadOptions(config *OSSConfig) []oss.Option {
+	var options []oss.Option
+	if config.StorageClass != "" {
+		options = append(options, oss.ObjectStorageClass(oss.StorageClassType(config.StorageClass)))
+	}
+	if len(config.Tags) > 0 {
+		tagging := oss.Tagging{}
+		for key, value := range config.Tags {
+			tagging.Tags = append(tagging.Tags, oss.Tag{Key: key, Value: value})
+		}
+		sort.Slice(tagging.Tags, func(i, j int) bool {
+			return tagging.Tags[i].Key < tagging.Tags[j].Key
+		})
+		options = append(options, oss.SetTagging(tagging))
+	}
+	keys := make([]string, 0, len(config.Metadata))
+	for key := range config.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		options = append(options, oss.Meta(key, config.Metadata[key]))
+	}
+	return options
+}
+
 func calcCrc64ECMA(path string) (uint64, error) {
 	buf := make([]byte, 4*1024)
 	table := crc64.MakeTable(crc64.ECMA)
@@ -109,14 +158,14 @@ func calcCrc64ECMA(path string) (uint64, error) {
 
 // Upload blob as image layer to oss backend and verify
 // integrity by calculate CRC64.
-func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int64, forcePush bool) (*ocispec.Descriptor, error) {
+func (b *OSSBackend) Upload(ctx context.Context, blobID, blobPath string, size int64, forcePush bool) (*ocispec.Descriptor, error) {
 	blobObjectKey := b.objectPrefix + blobID
 
 	desc := blobDesc(size, blobID)
 	desc.URLs = append(desc.URLs, b.remoteID(blobID))
 
 	if !forcePush {
-		if exist, err := b.bucket.IsObjectExist(blobObjectKey); err != nil {
+		if exist, err := b.bucket.IsObjectExist(blobObjectKey, oss.WithContext(ctx)); err != nil {
 			return nil, errors.Wrap(err, "check object existence")
 		} else if exist {
 			logrus.Infof("skip upload because blob exists: %s", blobID)
@@ -124,6 +173,13 @@ func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int
 		}
 	}
 
+	// The size of local blob is expected for the uploaded object, the
+	// size argument may be unknown by the caller.
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "stat blob file")
+	}
+
 	start := time.Now()
 	crc64Chan := make(chan uint64, 1)
 	crc64ErrChan := make(chan error, 1)
@@ -143,17 +199,18 @@ func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int
 		return nil, errors.Wrap(err, "split file by part size")
 	}
 
-	imur, err := b.bucket.InitiateMultipartUpload(blobObjectKey)
+	options := append([]oss.Option{oss.WithContext(ctx)}, b.uploadOptions...)
+	imur, err := b.bucket.InitiateMultipartUpload(blobObjectKey, options...)
 	if err != nil {
 		return nil, errors.Wrap(err, "initiate multipart upload")
 	}
 
-	eg := new(errgroup.Group)
+	eg, egCtx := errgroup.WithContext(ctx)
 	partsChan := make(chan oss.UploadPart, len(chunks))
 	for _, chunk := range chunks {
 		ck := chunk
 		eg.Go(func() error {
-			p, err := b.bucket.UploadPartFromFile(imur, blobPath, ck.Offset, ck.Size, ck.Number)
+			p, err := b.bucket.UploadPartFromFile(imur, blobPath, ck.Offset, ck.Size, ck.Number, oss.WithContext(egCtx))
 			if err != nil {
 				return errors.Wrap(err, "upload part from file")
 			}
@@ -164,7 +221,8 @@ func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int
 
 	if err := eg.Wait(); err != nil {
 		close(partsChan)
-		if err := b.bucket.AbortMultipartUpload(imur); err != nil {
+		// Abort the upload even if the context is canceled.
+		if err := b.bucket.AbortMultipartUpload(imur, oss.WithContext(context.WithoutCancel(ctx))); err != nil {
 			return nil, errors.Wrap(err, "abort multipart upload")
 		}
 		return nil, errors.Wrap(err, "upload parts")
@@ -180,6 +238,8 @@ func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int
 		imur:          &imur,
 		parts:         parts,
 		blobObjectKey: blobObjectKey,
+		blobPath:      blobPath,
+		blobSize:      info.Size(),
 		crc64Chan:     crc64Chan,
 		crc64ErrChan:  crc64ErrChan,
 	}
@@ -192,7 +252,7 @@ func (b *OSSBackend) Upload(_ context.Context, blobID, blobPath string, size int
 	return &desc, nil
 }
 
-func (b *OSSBackend) Finalize(cancel bool) error {
+func (b *OSSBackend) Finalize(ctx context.Context, cancel bool) error {
 	b.msMutex.Lock()
 	defer b.msMutex.Unlock()
 
@@ -204,7 +264,7 @@ func (b *OSSBackend) Finalize(cancel bool) error {
 			// upload, and should call the `AbortMultipartUpload` method to
 			// prevent blob residue as much as possible once any error happens
 			// during conversion process.
-			if err := b.bucket.AbortMultipartUpload(*ms.imur); err != nil {
+			if err := b.bucket.AbortMultipartUpload(*ms.imur, oss.WithContext(context.WithoutCancel(ctx))); err != nil {
 				logrus.WithError(err).Warn("abort multipart upload")
 			} else {
 				logrus.Warnf("blob upload has been aborted: %s", ms.blobObjectKey)
@@ -212,17 +272,24 @@ func (b *OSSBackend) Finalize(cancel bool) error {
 			continue
 		}
 
-		_, err := b.bucket.CompleteMultipartUpload(*ms.imur, ms.parts)
+		_, err := b.bucket.CompleteMultipartUpload(*ms.imur, ms.parts, oss.WithContext(ctx))
 		if err != nil {
 			return errors.Wrap(err, "complete multipart upload")
 		}
 
-		props, err := b.bucket.GetObjectDetailedMeta(ms.blobObjectKey)
+		props, err := b.bucket.GetObjectDetailedMeta(ms.blobObjectKey, oss.WithContext(ctx))
 		if err != nil {
 			return errors.Wrapf(err, "get object meta")
 		}
+		if remoteSize, err := strconv.ParseInt(props.Get("Content-Length"), 10, 64); err == nil {
+			if err := verifySize(remoteSize, ms.blobSize); err != nil {
+				return errors.Wrapf(err, "verify uploaded blob %s", ms.blobObjectKey)
+			}
+		}
 
-		// Try to validate blob object integrity if any crc64 value is returned.
+		// Try to validate blob object integrity if any crc64 value is returned,
+		// otherwise read back the head and tail of blob object to validate.
+		crc64Verified := false
 		if value, ok := props[http.CanonicalHeaderKey("x-oss-hash-crc64ecma")]; ok {
 			if len(value) == 1 {
 				uploadedCrc, err := strconv.ParseUint(value[0], 10, 64)
@@ -238,36 +305,51 @@ func (b *OSSBackend) Finalize(cancel bool) error {
 				if crc64Val := <-ms.crc64Chan; uploadedCrc != crc64Val {
 					return errors.Errorf("crc64 mismatch, uploaded=%d, expected=%d", uploadedCrc, crc64Val)
 				}
-
+				crc64Verified = true
 			} else {
 				logrus.Warnf("too many values, skip crc64 integrity check.")
 			}
 		} else {
 			logrus.Warnf("no crc64 in header, skip crc64 integrity check.")
 		}
+		if !crc64Verified {
+			if err := verifyUpload(ctx, ms.blobPath, b.readRange(ms.blobObjectKey)); err != nil {
+				return errors.Wrapf(err, "verify uploaded blob %s", ms.blobObjectKey)
+			}
+		}
 	}
 
 	return nil
 }
 
-func (b *OSSBackend) Check(blobID string) (bool, error) {
+func (b *OSSBackend) readRange(objectKey string) rangeReader {
+	return func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		return b.bucket.GetObject(objectKey, oss.Range(offset, offset+length-1), oss.WithContext(ctx))
+	}
+}
+
+func (b *OSSBackend) Check(ctx context.Context, blobID string) (bool, error) {
 	blobID = b.objectPrefix + blobID
-	return b.bucket.IsObjectExist(blobID)
+	return b.bucket.IsObjectExist(blobID, oss.WithContext(ctx))
+}
+
+func (b *OSSBackend) Delete(ctx context.Context, blobID string) error {
+	return b.bucket.DeleteObject(b.objectPrefix+blobID, oss.WithContext(ctx))
 }
 
 func (b *OSSBackend) Type() Type {
 	return OssBackend
 }
 
-func (b *OSSBackend) Reader(blobID string) (io.ReadCloser, error) {
+func (b *OSSBackend) Reader(ctx context.Context, blobID string) (io.ReadCloser, error) {
 	blobID = b.objectPrefix + blobID
-	rc, err := b.bucket.GetObject(blobID)
+	rc, err := b.bucket.GetObject(blobID, oss.WithContext(ctx))
 	return rc, err
 }
 
-func (b *OSSBackend) Size(blobID string) (int64, error) {
+func (b *OSSBackend) Size(ctx context.Context, blobID string) (int64, error) {
 	blobID = b.objectPrefix + blobID
-	headers, err := b.bucket.GetObjectMeta(blobID)
+	headers, err := b.bucket.GetObjectMeta(blobID, oss.WithContext(ctx))
 	if err != nil {
 		return 0, errors.Wrap(err, "get object size")
 	}
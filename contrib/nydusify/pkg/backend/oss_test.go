@@ -134,4 +134,19 @@ func TestNewOSSBackend(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Parse OSS storage backend configuration")
 	require.Nil(t, backend)
+
+	ossConfigJSON7 := `
+	{
+		"bucket_name": "test",
+		"endpoint": "region.oss.com",
+		"object_prefix": "blob",
+		"transport": {
+			"max_idle_conns_per_host": 64,
+			"idle_conn_timeout": 120
+		}
+	}`
+	require.True(t, json.Valid([]byte(ossConfigJSON7)))
+	backend, err = newOSSBackend([]byte(ossConfigJSON7))
+	require.NoError(t, err)
+	require.Equal(t, "test", backend.bucket.BucketName)
 }
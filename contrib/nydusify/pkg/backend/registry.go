@@ -32,14 +32,42 @@ func (r *Registry) Upload(
 		return nil, errors.Wrap(err, "Push blob layer")
 	}
 
+	if err := verifyUpload(ctx, blobPath, r.readRange(desc)); err != nil {
+		return nil, errors.Wrapf(err, "verify pushed blob %s", desc.Digest)
+	}
+
 	return &desc, nil
 }
 
-func (r *Registry) Finalize(_ bool) error {
+// readRange reads the blob from registry by range request if supported,
+// otherwise the data before offset is discarded.
+func (r *Registry) readRange(desc ocispec.Descriptor) rangeReader {
+	return func(ctx context.Context, offset, _ int64) (io.ReadCloser, error) {
+		reader, err := r.remote.Pull(ctx, desc, true)
+		if err != nil {
+			return nil, err
+		}
+		if offset == 0 {
+			return reader, nil
+		}
+		if seeker, ok := reader.(io.Seeker); ok {
+			if _, err := seeker.Seek(offset, io.SeekStart); err == nil {
+				return reader, nil
+			}
+		}
+		if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return reader, nil
+	}
+}
+
+func (r *Registry) Finalize(_ context.Context, _ bool) error {
 	return nil
 }
 
-func (r *Registry) Check(_ string) (bool, error) {
+func (r *Registry) Check(_ context.Context, _ string) (bool, error) {
 	return true, nil
 }
 
@@ -47,11 +75,11 @@ func (r *Registry) Type() Type {
 	return RegistryBackend
 }
 
-func (r *Registry) Reader(_ string) (io.ReadCloser, error) {
+func (r *Registry) Reader(_ context.Context, _ string) (io.ReadCloser, error) {
 	panic("not implemented")
 }
 
-func (r *Registry) Size(_ string) (int64, error) {
+func (r *Registry) Size(_ context.Context, _ string) (int64, error) {
 	panic("not implemented")
 }
 
@@ -6,7 +6,6 @@ package backend
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,6 +24,8 @@ import (
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
 )
 
 type S3Backend struct {
@@ -36,23 +37,16 @@ type S3Backend struct {
 	bucketName         string
 	endpointWithScheme string
 	client             *s3.Client
-}
-
-type S3Config struct {
-	AccessKeyID     string `json:"access_key_id,omitempty"`
-	AccessKeySecret string `json:"access_key_secret,omitempty"`
-	Endpoint        string `json:"endpoint,omitempty"`
-	Scheme          string `json:"scheme,omitempty"`
-	BucketName      string `json:"bucket_name,omitempty"`
-	Region          string `json:"region,omitempty"`
-	ObjectPrefix    string `json:"object_prefix,omitempty"`
+	// splitSize splits the large blobs into multiple objects.
+	splitSize int64
 }
 
 func newS3Backend(rawConfig []byte) (*S3Backend, error) {
-	cfg := &S3Config{}
-	if err := json.Unmarshal(rawConfig, cfg); err != nil {
-		return nil, errors.Wrap(err, "parse S3 storage backend configuration")
+	parsed, err := ParseConfig("s3", rawConfig)
+	if err != nil {
+		return nil, err
 	}
+	cfg := parsed.(*S3Config)
 	if cfg.Endpoint == "" {
 		cfg.Endpoint = "s3.amazonaws.com"
 	}
@@ -61,16 +55,19 @@ func newS3Backend(rawConfig []byte) (*S3Backend, error) {
 	}
 	endpointWithScheme := fmt.Sprintf("%s://%s", cfg.Scheme, cfg.Endpoint)
 
-	if cfg.BucketName == "" || cfg.Region == "" {
-		return nil, fmt.Errorf("invalid S3 configuration: missing 'bucket_name' or 'region'")
-	}
-
 	s3AWSConfig, err := awscfg.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return nil, errors.Wrap(err, "load default AWS config")
 	}
 
+	transportConfig := remote.DefaultTransportConfig
+	if cfg.Transport != nil {
+		transportConfig = *cfg.Transport
+	}
+	transport := DefaultAuditor.Transport("s3", remote.SharedTransport(transportConfig, false))
+
 	client := s3.NewFromConfig(s3AWSConfig, func(o *s3.Options) {
+		o.HTTPClient = &http.Client{Transport: transport}
 		o.BaseEndpoint = &endpointWithScheme
 		o.Region = cfg.Region
 		o.UsePathStyle = true
@@ -85,6 +82,7 @@ func newS3Backend(rawConfig []byte) (*S3Backend, error) {
 		bucketName:         cfg.BucketName,
 		endpointWithScheme: endpointWithScheme,
 		client:             client,
+		splitSize:          cfg.SplitSize,
 	}, nil
 }
 
@@ -110,6 +108,12 @@ func (b *S3Backend) Upload(ctx context.Context, blobID, blobPath string, size in
 		return nil, errors.Wrap(err, "open blob file")
 	}
 	defer blobFile.Close()
+	// The size of local blob is expected for the uploaded object, the
+	// size argument may be unknown by the caller.
+	info, err := blobFile.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat blob file")
+	}
 
 	uploader := manager.NewUploader(b.client, func(u *manager.Uploader) {
 		u.PartSize = multipartChunkSize
@@ -124,17 +128,44 @@ func (b *S3Backend) Upload(ctx context.Context, blobID, blobPath string, size in
 		return nil, errors.Wrap(err, "upload blob to s3 backend")
 	}
 
+	// The parts are verified by CRC32 checksum on uploading, read back the
+	// object to make sure it's completed as expected.
+	head, err := b.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &b.bucketName,
+		Key:    &blobObjectKey,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get uploaded object meta")
+	}
+	if head.ContentLength != nil {
+		if err := verifySize(*head.ContentLength, info.Size()); err != nil {
+			return nil, errors.Wrapf(err, "verify uploaded blob %s", blobObjectKey)
+		}
+	}
+	if err := verifyUpload(ctx, blobPath, b.readRange(blobObjectKey)); err != nil {
+		return nil, errors.Wrapf(err, "verify uploaded blob %s", blobObjectKey)
+	}
+
 	logrus.Debugf("uploaded blob %s to s3 backend, costs %s", blobObjectKey, time.Since(start))
 
 	return &desc, nil
 }
 
-func (b *S3Backend) Finalize(_ bool) error {
+func (b *S3Backend) Finalize(_ context.Context, _ bool) error {
 	return nil
 }
 
-func (b *S3Backend) Check(blobID string) (bool, error) {
-	return b.existObject(context.TODO(), b.blobObjectKey(blobID))
+func (b *S3Backend) Check(ctx context.Context, blobID string) (bool, error) {
+	return b.existObject(ctx, b.blobObjectKey(blobID))
+}
+
+func (b *S3Backend) Delete(ctx context.Context, blobID string) error {
+	objectKey := b.blobObjectKey(blobID)
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &b.bucketName,
+		Key:    &objectKey,
+	})
+	return err
 }
 
 func (b *S3Backend) Type() Type {
@@ -160,18 +191,35 @@ func (b *S3Backend) blobObjectKey(blobID string) string {
 	return b.objectPrefix + blobID
 }
 
-func (b *S3Backend) Reader(blobID string) (io.ReadCloser, error) {
+func (b *S3Backend) Reader(ctx context.Context, blobID string) (io.ReadCloser, error) {
 	objectKey := b.blobObjectKey(blobID)
-	output, err := b.client.GetObject(context.TODO(), &s3.GetObjectInput{
+	output, err := b.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: &b.bucketName,
 		Key:    &objectKey,
 	})
-	return output.Body, err
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+func (b *S3Backend) readRange(objectKey string) rangeReader {
+	return func(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+		output, err := b.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: &b.bucketName,
+			Key:    &objectKey,
+			Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return output.Body, nil
+	}
 }
 
-func (b *S3Backend) Size(blobID string) (int64, error) {
+func (b *S3Backend) Size(ctx context.Context, blobID string) (int64, error) {
 	objectKey := b.blobObjectKey(blobID)
-	output, err := b.client.GetObjectAttributes(context.TODO(), &s3.GetObjectAttributesInput{
+	output, err := b.client.GetObjectAttributes(ctx, &s3.GetObjectAttributesInput{
 		Bucket: &b.bucketName,
 		Key:    &objectKey,
 	})
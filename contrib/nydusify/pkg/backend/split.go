@@ -0,0 +1,372 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// minSplitSize is the min part size of split blobs, which avoids splitting a
+// blob into too many objects by mistake, for example a size in MiB.
+const minSplitSize = 1 << 20
+
+// splitConcurrency is the number of parts uploaded concurrently.
+const splitConcurrency = 4
+
+// splitManifestSuffix is the suffix of manifest object of a split blob.
+const splitManifestSuffix = ".parts"
+
+// SplitPart is an object storing a range of split blob.
+type SplitPart struct {
+	// BlobID is the object name of part in backend.
+	BlobID string        `json:"blob_id"`
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// SplitManifest stitches the parts of a blob split across objects, it's
+// stored as the `<blob_id>.parts` object in backend.
+type SplitManifest struct {
+	BlobID   string      `json:"blob_id"`
+	Size     int64       `json:"size"`
+	PartSize int64       `json:"part_size"`
+	Parts    []SplitPart `json:"parts"`
+}
+
+func (manifest *SplitManifest) validate(blobID string) error {
+	if manifest.BlobID != blobID {
+		return fmt.Errorf("split manifest is for blob %s", manifest.BlobID)
+	}
+	var size int64
+	for _, part := range manifest.Parts {
+		if err := part.Digest.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid digest of part %s", part.BlobID)
+		}
+		size += part.Size
+	}
+	if size != manifest.Size {
+		return fmt.Errorf("size of parts %d doesn't match blob size %d", size, manifest.Size)
+	}
+	return nil
+}
+
+func splitManifestID(blobID string) string {
+	return blobID + splitManifestSuffix
+}
+
+func splitPartID(blobID string, index int) string {
+	return fmt.Sprintf("%s.part-%05d", blobID, index)
+}
+
+// splitBackend splits the blobs larger than partSize into multiple objects,
+// for the object stores with per-object size limit, the parts are uploaded
+// concurrently and stitched by a manifest object.
+type splitBackend struct {
+	Backend
+	partSize int64
+
+	// files are the temporary part and manifest files, which are read by the
+	// backend until the uploads are finalized.
+	files   []string
+	filesMu sync.Mutex
+}
+
+// WithSplit wraps the backend to split the blobs larger than partSize, the
+// backend is returned as is if partSize is not positive.
+func WithSplit(be Backend, partSize int64) Backend {
+	if partSize <= 0 {
+		return be
+	}
+	return &splitBackend{Backend: be, partSize: partSize}
+}
+
+// tempFile creates a temporary file in the directory of blob, which is
+// removed after the uploads are finalized.
+func (b *splitBackend) tempFile(blobPath, pattern string) (*os.File, error) {
+	file, err := os.CreateTemp(filepath.Dir(blobPath), pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "create temporary file")
+	}
+	b.filesMu.Lock()
+	b.files = append(b.files, file.Name())
+	b.filesMu.Unlock()
+	return file, nil
+}
+
+// writePart copies a range of blob to the part file and returns the digest.
+func (b *splitBackend) writePart(blob *os.File, offset, size int64, partPath string) (digest.Digest, error) {
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", errors.Wrap(err, "open part file")
+	}
+	defer file.Close()
+
+	digester := digest.SHA256.Digester()
+	reader := io.NewSectionReader(blob, offset, size)
+	if _, err := io.Copy(io.MultiWriter(file, digester.Hash()), reader); err != nil {
+		return "", errors.Wrap(err, "write part file")
+	}
+	return digester.Digest(), nil
+}
+
+func (b *splitBackend) Upload(ctx context.Context, blobID, blobPath string, size int64, forcePush bool) (*ocispec.Descriptor, error) {
+	info, err := os.Stat(blobPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "stat blob file")
+	}
+	if info.Size() <= b.partSize {
+		return b.Backend.Upload(ctx, blobID, blobPath, size, forcePush)
+	}
+
+	manifestID := splitManifestID(blobID)
+	if !forcePush {
+		exist, err := b.Backend.Check(ctx, manifestID)
+		if err != nil {
+			return nil, errors.Wrap(err, "check split manifest")
+		}
+		if exist {
+			logrus.Infof("skip upload of split blob %s because it already exists", blobID)
+			desc := blobDesc(size, blobID)
+			return &desc, nil
+		}
+	}
+
+	blob, err := os.Open(blobPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "open blob file")
+	}
+	defer blob.Close()
+
+	manifest := SplitManifest{
+		BlobID:   blobID,
+		Size:     info.Size(),
+		PartSize: b.partSize,
+	}
+	count := int((info.Size() + b.partSize - 1) / b.partSize)
+	manifest.Parts = make([]SplitPart, count)
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(splitConcurrency)
+	for index := 0; index < count; index++ {
+		index := index
+		eg.Go(func() error {
+			offset := int64(index) * b.partSize
+			partSize := min(b.partSize, info.Size()-offset)
+			partID := splitPartID(blobID, index)
+
+			file, err := b.tempFile(blobPath, "split-part-*")
+			if err != nil {
+				return err
+			}
+			file.Close()
+			partDigest, err := b.writePart(blob, offset, partSize, file.Name())
+			if err != nil {
+				return errors.Wrapf(err, "split part %s", partID)
+			}
+			if _, err := b.Backend.Upload(egCtx, partID, file.Name(), partSize, forcePush); err != nil {
+				return errors.Wrapf(err, "upload part %s", partID)
+			}
+			manifest.Parts[index] = SplitPart{BlobID: partID, Size: partSize, Digest: partDigest}
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	// The manifest is uploaded after all parts, so that an existing manifest
+	// means the blob is complete.
+	manifestFile, err := b.tempFile(blobPath, "split-manifest-*")
+	if err != nil {
+		return nil, err
+	}
+	defer manifestFile.Close()
+	if err := json.NewEncoder(manifestFile).Encode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "write split manifest")
+	}
+	manifestInfo, err := manifestFile.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat split manifest")
+	}
+	manifestDesc, err := b.Backend.Upload(ctx, manifestID, manifestFile.Name(), manifestInfo.Size(), true)
+	if err != nil {
+		return nil, errors.Wrap(err, "upload split manifest")
+	}
+
+	logrus.Infof("uploaded blob %s split into %d parts", blobID, count)
+	desc := blobDesc(size, blobID)
+	desc.URLs = manifestDesc.URLs
+	return &desc, nil
+}
+
+func (b *splitBackend) Finalize(ctx context.Context, cancel bool) error {
+	err := b.Backend.Finalize(ctx, cancel)
+
+	b.filesMu.Lock()
+	defer b.filesMu.Unlock()
+	for _, file := range b.files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			logrus.WithError(err).Warnf("remove temporary file %s", file)
+		}
+	}
+	b.files = nil
+
+	return err
+}
+
+func (b *splitBackend) Check(ctx context.Context, blobID string) (bool, error) {
+	exist, err := b.Backend.Check(ctx, blobID)
+	if err != nil || exist {
+		return exist, err
+	}
+	return b.Backend.Check(ctx, splitManifestID(blobID))
+}
+
+// Delete deletes the blob, and the manifest and parts if it's split.
+func (b *splitBackend) Delete(ctx context.Context, blobID string) error {
+	if err := Delete(ctx, b.Backend, blobID); err != nil {
+		return err
+	}
+	manifestID := splitManifestID(blobID)
+	exist, err := b.Backend.Check(ctx, manifestID)
+	if err != nil || !exist {
+		return err
+	}
+	manifest, err := b.readManifest(ctx, blobID)
+	if err != nil {
+		return err
+	}
+	// The manifest is deleted first, so that the blob is incomplete once
+	// the deletion starts.
+	if err := Delete(ctx, b.Backend, manifestID); err != nil {
+		return err
+	}
+	for _, part := range manifest.Parts {
+		if err := Delete(ctx, b.Backend, part.BlobID); err != nil {
+			return errors.Wrapf(err, "delete part %s", part.BlobID)
+		}
+	}
+	return nil
+}
+
+// manifest reads the split manifest of blob, it returns nil if the blob is
+// stored as a single object.
+func (b *splitBackend) manifest(ctx context.Context, blobID string) (*SplitManifest, error) {
+	exist, err := b.Backend.Check(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		return nil, nil
+	}
+	return b.readManifest(ctx, blobID)
+}
+
+func (b *splitBackend) readManifest(ctx context.Context, blobID string) (*SplitManifest, error) {
+	reader, err := b.Backend.Reader(ctx, splitManifestID(blobID))
+	if err != nil {
+		return nil, errors.Wrap(err, "read split manifest")
+	}
+	defer reader.Close()
+
+	var manifest SplitManifest
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "decode split manifest")
+	}
+	if err := manifest.validate(blobID); err != nil {
+		return nil, errors.Wrap(err, "invalid split manifest")
+	}
+	return &manifest, nil
+}
+
+func (b *splitBackend) Size(ctx context.Context, blobID string) (int64, error) {
+	manifest, err := b.manifest(ctx, blobID)
+	if err != nil {
+		return 0, err
+	}
+	if manifest == nil {
+		return b.Backend.Size(ctx, blobID)
+	}
+	return manifest.Size, nil
+}
+
+func (b *splitBackend) Reader(ctx context.Context, blobID string) (io.ReadCloser, error) {
+	manifest, err := b.manifest(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return b.Backend.Reader(ctx, blobID)
+	}
+	return &splitReader{ctx: ctx, backend: b.Backend, parts: manifest.Parts}, nil
+}
+
+// splitReader reads the parts in order as a whole blob, each part is opened
+// lazily and verified by its size and digest when it's read to the end.
+type splitReader struct {
+	ctx     context.Context
+	backend Backend
+	parts   []SplitPart
+
+	current  io.ReadCloser
+	read     int64
+	verifier digest.Verifier
+}
+
+func (r *splitReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			reader, err := r.backend.Reader(r.ctx, r.parts[0].BlobID)
+			if err != nil {
+				return 0, errors.Wrapf(err, "read part %s", r.parts[0].BlobID)
+			}
+			r.current = reader
+			r.read = 0
+			r.verifier = r.parts[0].Digest.Verifier()
+		}
+
+		n, err := r.current.Read(p)
+		r.read += int64(n)
+		r.verifier.Write(p[:n])
+		if err == io.EOF {
+			part := r.parts[0]
+			r.current.Close()
+			r.current = nil
+			r.parts = r.parts[1:]
+			if r.read != part.Size {
+				return n, fmt.Errorf("part %s size %d doesn't match %d", part.BlobID, r.read, part.Size)
+			}
+			if !r.verifier.Verified() {
+				return n, fmt.Errorf("part %s doesn't match digest %s", part.BlobID, part.Digest)
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (r *splitReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
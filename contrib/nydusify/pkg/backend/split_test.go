@@ -0,0 +1,181 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryBackend stores the objects in memory.
+type memoryBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *memoryBackend) Upload(_ context.Context, blobID, blobPath string, size int64, _ bool) (*ocispec.Descriptor, error) {
+	data, err := os.ReadFile(blobPath)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	b.objects[blobID] = data
+	b.mu.Unlock()
+	desc := blobDesc(size, blobID)
+	desc.URLs = []string{"oss://bucket/" + blobID}
+	return &desc, nil
+}
+
+func (b *memoryBackend) Finalize(_ context.Context, _ bool) error {
+	return nil
+}
+
+func (b *memoryBackend) Check(_ context.Context, blobID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.objects[blobID]
+	return ok, nil
+}
+
+func (b *memoryBackend) Type() Type {
+	return OssBackend
+}
+
+func (b *memoryBackend) Reader(_ context.Context, blobID string) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[blobID]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *memoryBackend) Size(_ context.Context, blobID string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.objects[blobID])), nil
+}
+
+func (b *memoryBackend) Delete(_ context.Context, blobID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, blobID)
+	return nil
+}
+
+func TestSplitBackend(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte("0123456789abcdefghij")
+	blobPath := filepath.Join(dir, "blob")
+	require.NoError(t, os.WriteFile(blobPath, data, 0644))
+	smallPath := filepath.Join(dir, "small")
+	require.NoError(t, os.WriteFile(smallPath, data[:8], 0644))
+
+	mem := &memoryBackend{objects: map[string][]byte{}}
+	require.Equal(t, mem, WithSplit(mem, 0))
+	be := WithSplit(mem, 8)
+
+	desc, err := be.Upload(ctx, "small", smallPath, 8, false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"oss://bucket/small"}, desc.URLs)
+
+	desc, err = be.Upload(ctx, "blob", blobPath, int64(len(data)), false)
+	require.NoError(t, err)
+	require.Equal(t, []string{"oss://bucket/blob.parts"}, desc.URLs)
+	require.Equal(t, int64(len(data)), desc.Size)
+	require.Equal(t, data[:8], mem.objects["blob.part-00000"])
+	require.Equal(t, data[8:16], mem.objects["blob.part-00001"])
+	require.Equal(t, data[16:], mem.objects["blob.part-00002"])
+	require.NotContains(t, mem.objects, "blob")
+
+	require.NoError(t, be.Finalize(ctx, false))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	for _, blobID := range []string{"blob", "small"} {
+		exist, err := be.Check(ctx, blobID)
+		require.NoError(t, err)
+		require.True(t, exist)
+	}
+	exist, err := be.Check(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	size, err := be.Size(ctx, "blob")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), size)
+
+	reader, err := be.Reader(ctx, "blob")
+	require.NoError(t, err)
+	read, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+	require.NoError(t, reader.Close())
+
+	// The existing split blob is skipped.
+	delete(mem.objects, "blob.part-00000")
+	_, err = be.Upload(ctx, "blob", blobPath, int64(len(data)), false)
+	require.NoError(t, err)
+	require.NotContains(t, mem.objects, "blob.part-00000")
+
+	_, err = be.Upload(ctx, "blob", blobPath, int64(len(data)), true)
+	require.NoError(t, err)
+	require.NoError(t, be.Finalize(ctx, false))
+
+	// The corrupted part is detected by digest.
+	mem.objects["blob.part-00001"] = []byte("76543210")
+	reader, err = be.Reader(ctx, "blob")
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.ErrorContains(t, err, "part blob.part-00001 doesn't match digest")
+	require.NoError(t, reader.Close())
+
+	mem.objects["blob.part-00001"] = data[8:12]
+	reader, err = be.Reader(ctx, "blob")
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.ErrorContains(t, err, "part blob.part-00001 size 4 doesn't match 8")
+}
+
+func TestSplitBackendDelete(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := []byte("0123456789abcdefghij")
+	blobPath := filepath.Join(dir, "blob")
+	require.NoError(t, os.WriteFile(blobPath, data, 0644))
+	smallPath := filepath.Join(dir, "small")
+	require.NoError(t, os.WriteFile(smallPath, data[:8], 0644))
+
+	mem := &memoryBackend{objects: map[string][]byte{}}
+	be := WithSplit(mem, 8)
+	_, err := be.Upload(ctx, "blob", blobPath, int64(len(data)), false)
+	require.NoError(t, err)
+	_, err = be.Upload(ctx, "small", smallPath, 8, false)
+	require.NoError(t, err)
+	require.NoError(t, be.Finalize(ctx, false))
+	require.Len(t, mem.objects, 5)
+
+	require.NoError(t, Delete(ctx, be, "blob"))
+	require.NoError(t, Delete(ctx, be, "missing"))
+	require.Len(t, mem.objects, 1)
+	exist, err := be.Check(ctx, "blob")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// The backends not implementing Deleter are reported.
+	err = Delete(ctx, WithSplit(struct{ Backend }{mem}, 8), "small")
+	require.ErrorIs(t, err, ErrDeleteUnsupported)
+}
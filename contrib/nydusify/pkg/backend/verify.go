@@ -0,0 +1,81 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// verifyRangeSize is the size of the head and the tail of blob read back
+// from storage backend to verify the uploaded object.
+const verifyRangeSize = 1024 * 1024
+
+// rangeReader reads the length bytes from the offset of uploaded object.
+type rangeReader func(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+
+// verifyUpload reads back the head and the tail of uploaded object and
+// compares them with the local blob file, so that a corrupted or truncated
+// upload fails the push instead of being found by the container reading the
+// chunk. The storage backend is expected to verify the content digest if
+// available, it's a cheap check for the backends not returning the digest.
+func verifyUpload(ctx context.Context, blobPath string, read rangeReader) error {
+	file, err := os.Open(blobPath)
+	if err != nil {
+		return errors.Wrap(err, "open blob file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat blob file")
+	}
+	size := info.Size()
+
+	type blobRange struct{ offset, length int64 }
+	ranges := []blobRange{{0, min(size, verifyRangeSize)}}
+	if size > verifyRangeSize {
+		offset := max(size-verifyRangeSize, verifyRangeSize)
+		ranges = append(ranges, blobRange{offset, size - offset})
+	}
+	for _, r := range ranges {
+		if r.length == 0 {
+			continue
+		}
+		expected := make([]byte, r.length)
+		if _, err := file.ReadAt(expected, r.offset); err != nil {
+			return errors.Wrapf(err, "read blob file at %d", r.offset)
+		}
+		actual, err := func() ([]byte, error) {
+			reader, err := read(ctx, r.offset, r.length)
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return io.ReadAll(io.LimitReader(reader, r.length))
+		}()
+		if err != nil {
+			return errors.Wrapf(err, "read back uploaded blob at %d", r.offset)
+		}
+		if !bytes.Equal(expected, actual) {
+			return errors.Errorf("uploaded blob mismatches local blob in range %d-%d", r.offset, r.offset+r.length)
+		}
+	}
+	logrus.Debugf("verified uploaded blob %s", blobPath)
+
+	return nil
+}
+
+// verifySize compares the size of uploaded object with the local blob.
+func verifySize(remoteSize, size int64) error {
+	if remoteSize != size {
+		return errors.Errorf("size mismatch, uploaded=%d, expected=%d", remoteSize, size)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyUpload(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), verifyRangeSize/8)
+	blobPath := filepath.Join(t.TempDir(), "blob")
+	require.NoError(t, os.WriteFile(blobPath, data, 0644))
+
+	reader := func(uploaded []byte, requested *[]int64) rangeReader {
+		return func(_ context.Context, offset, length int64) (io.ReadCloser, error) {
+			*requested = append(*requested, offset, length)
+			end := min(offset+length, int64(len(uploaded)))
+			return io.NopCloser(bytes.NewReader(uploaded[offset:end])), nil
+		}
+	}
+
+	var requested []int64
+	require.NoError(t, verifyUpload(context.Background(), blobPath, reader(data, &requested)))
+	require.Equal(t, []int64{0, verifyRangeSize, verifyRangeSize, verifyRangeSize}, requested)
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-1] = 'x'
+	requested = nil
+	err := verifyUpload(context.Background(), blobPath, reader(corrupted, &requested))
+	require.ErrorContains(t, err, "uploaded blob mismatches local blob in range")
+
+	truncated := data[:len(data)-1]
+	err = verifyUpload(context.Background(), blobPath, reader(truncated, &requested))
+	require.ErrorContains(t, err, "uploaded blob mismatches local blob in range")
+
+	// The small blob is read back entirely.
+	require.NoError(t, os.WriteFile(blobPath, []byte("blob"), 0644))
+	requested = nil
+	require.NoError(t, verifyUpload(context.Background(), blobPath, reader([]byte("blob"), &requested)))
+	require.Equal(t, []int64{0, 4}, requested)
+
+	require.NoError(t, verifySize(4, 4))
+	require.ErrorContains(t, verifySize(3, 4), "size mismatch")
+}
@@ -0,0 +1,226 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package benchmark measures the cold start performance of nydus image, it
+// mounts the image with nydusd, reads the specified files from the cold
+// cache and reads them again from the warm cache.
+package benchmark
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/viewer"
+)
+
+// firstReadSize is the size of the first read to measure the latency of
+// first byte, which is the default max read size of fuse.
+const firstReadSize = 128 * 1024
+
+// Opt defines the benchmark options.
+type Opt struct {
+	viewer.Opt
+	// Files are the paths in image to read, all the regular files in image
+	// are read if empty.
+	Files []string
+}
+
+// FileResult is the result of reading a file from the cold cache.
+type FileResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// FirstReadLatency is the latency of opening the file and reading the
+	// first chunk of data.
+	FirstReadLatency time.Duration `json:"first_read_latency"`
+	// ReadElapsed is the time of reading the whole file.
+	ReadElapsed time.Duration `json:"read_elapsed"`
+}
+
+// ReadResult is the result of reading all the files in one round.
+type ReadResult struct {
+	Bytes   int64         `json:"bytes"`
+	Elapsed time.Duration `json:"elapsed"`
+	// Throughput is in bytes per second.
+	Throughput float64 `json:"throughput"`
+}
+
+// Result is the benchmark report, the durations are in nanoseconds.
+type Result struct {
+	Target        string `json:"target"`
+	NydusdVersion string `json:"nydusd_version,omitempty"`
+	// ReadyElapsed is the time from pulling bootstrap to the image mounted
+	// and ready to read.
+	ReadyElapsed time.Duration `json:"ready_elapsed"`
+	Files        []FileResult  `json:"files"`
+	ColdRead     ReadResult    `json:"cold_read"`
+	WarmRead     ReadResult    `json:"warm_read"`
+}
+
+// ParseFileList parses the file list, one path in image per line, empty
+// lines and lines starting with `#` are ignored.
+func ParseFileList(reader io.Reader) ([]string, error) {
+	var files []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, strings.TrimPrefix(filepath.Clean("/"+line), "/"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read file list")
+	}
+	return files, nil
+}
+
+// Run mounts the image and measures the file reads, the image is umounted
+// and work directory is removed on return.
+func Run(ctx context.Context, opt Opt) (*Result, error) {
+	fsViewer, err := viewer.New(opt.Opt)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Result{
+		Target:        opt.Target,
+		NydusdVersion: nydusdVersion(opt.NydusdPath),
+	}
+
+	start := time.Now()
+	if err := fsViewer.Prepare(ctx); err != nil {
+		return nil, errors.Wrap(err, "prepare image")
+	}
+	result.ReadyElapsed = time.Since(start)
+	logrus.Infof("image is ready in %s", result.ReadyElapsed)
+
+	defer func() {
+		if err := fsViewer.UmountImage(); err != nil {
+			logrus.WithError(err).Warn("umount image")
+		}
+		if err := os.RemoveAll(opt.WorkDir); err != nil {
+			logrus.WithError(err).Warn("clean up working directory")
+		}
+	}()
+
+	if err := measure(ctx, fsViewer.NydusdConfig.MountPath, opt.Files, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// measure reads the files under root from the cold cache, and then reads
+// them again from the warm cache.
+func measure(ctx context.Context, root string, files []string, result *Result) error {
+	if len(files) == 0 {
+		var err error
+		if files, err = regularFiles(root); err != nil {
+			return errors.Wrap(err, "list files in image")
+		}
+	}
+
+	start := time.Now()
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileResult, err := readFile(filepath.Join(root, file))
+		if err != nil {
+			return errors.Wrapf(err, "read file %s", file)
+		}
+		fileResult.Path = file
+		result.Files = append(result.Files, *fileResult)
+		result.ColdRead.Bytes += fileResult.Size
+	}
+	result.ColdRead.Elapsed = time.Since(start)
+	result.ColdRead.Throughput = throughput(result.ColdRead.Bytes, result.ColdRead.Elapsed)
+
+	start = time.Now()
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileResult, err := readFile(filepath.Join(root, file))
+		if err != nil {
+			return errors.Wrapf(err, "read file %s", file)
+		}
+		result.WarmRead.Bytes += fileResult.Size
+	}
+	result.WarmRead.Elapsed = time.Since(start)
+	result.WarmRead.Throughput = throughput(result.WarmRead.Bytes, result.WarmRead.Elapsed)
+
+	return nil
+}
+
+func readFile(path string) (*FileResult, error) {
+	start := time.Now()
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, firstReadSize)
+	n, err := file.Read(buf)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	result := FileResult{
+		FirstReadLatency: time.Since(start),
+	}
+
+	rest, err := io.CopyBuffer(io.Discard, file, buf)
+	if err != nil {
+		return nil, err
+	}
+	result.Size = int64(n) + rest
+	result.ReadElapsed = time.Since(start)
+
+	return &result, nil
+}
+
+// regularFiles returns the paths of regular files relative to root.
+func regularFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+func throughput(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
+
+func nydusdVersion(nydusdPath string) string {
+	output, err := exec.Command(nydusdPath, "--version").Output()
+	if err != nil {
+		logrus.WithError(err).Warn("get nydusd version")
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package benchmark
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasure(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr/bin/app"), make([]byte, firstReadSize+100), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "empty"), nil, 0644))
+	require.NoError(t, os.Symlink("usr/bin/app", filepath.Join(root, "link")))
+
+	var result Result
+	require.NoError(t, measure(context.Background(), root, nil, &result))
+	require.Len(t, result.Files, 2)
+	require.Equal(t, "empty", result.Files[0].Path)
+	require.Equal(t, int64(0), result.Files[0].Size)
+	require.Equal(t, "usr/bin/app", result.Files[1].Path)
+	require.Equal(t, int64(firstReadSize+100), result.Files[1].Size)
+	require.Equal(t, int64(firstReadSize+100), result.ColdRead.Bytes)
+	require.Equal(t, result.ColdRead.Bytes, result.WarmRead.Bytes)
+	require.Positive(t, result.ColdRead.Throughput)
+
+	result = Result{}
+	require.NoError(t, measure(context.Background(), root, []string{"link"}, &result))
+	require.Len(t, result.Files, 1)
+	require.Equal(t, int64(firstReadSize+100), result.Files[0].Size)
+
+	err := measure(context.Background(), root, []string{"missing"}, &Result{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "read file missing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, measure(ctx, root, nil, &Result{}), context.Canceled)
+}
+
+func TestParseFileList(t *testing.T) {
+	files, err := ParseFileList(strings.NewReader("# entrypoint\n/usr/bin/app\n\n  etc/passwd  \n/../lib/libc.so\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"usr/bin/app", "etc/passwd", "lib/libc.so"}, files)
+}
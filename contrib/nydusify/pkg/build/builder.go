@@ -5,6 +5,7 @@
 package build
 
 import (
+	"context"
 	"io"
 	"os"
 	"os/exec"
@@ -29,6 +30,9 @@ type BuilderOption struct {
 	Compressor   string
 	ChunkSize    string
 	FsVersion    string
+	// SourceType is the type of RootfsPath, for example `tar-rafs` for a
+	// tar file, default to a directory.
+	SourceType string
 }
 
 type CompactOption struct {
@@ -62,10 +66,10 @@ func NewBuilder(binaryPath string) *Builder {
 	}
 }
 
-func (builder *Builder) run(args []string, prefetchPatterns string) error {
+func (builder *Builder) run(ctx context.Context, args []string, prefetchPatterns string) error {
 	logrus.Debugf("\tCommand: %s %s", builder.binaryPath, strings.Join(args[:], " "))
 
-	cmd := exec.Command(builder.binaryPath, args...)
+	cmd := exec.CommandContext(ctx, builder.binaryPath, args...)
 	cmd.Stdout = builder.stdout
 	cmd.Stderr = builder.stderr
 	cmd.Stdin = strings.NewReader(prefetchPatterns)
@@ -94,11 +98,17 @@ func (builder *Builder) Compact(option CompactOption) error {
 	if option.ChunkDict != "" {
 		args = append(args, "--chunk-dict", option.ChunkDict)
 	}
-	return builder.run(args, "")
+	return builder.run(context.Background(), args, "")
 }
 
 // Run exec nydus-image CLI to build layer
 func (builder *Builder) Run(option BuilderOption) error {
+	return builder.RunContext(context.Background(), option)
+}
+
+// RunContext is the same as Run, but the nydus-image process is killed when
+// the context is done.
+func (builder *Builder) RunContext(ctx context.Context, option BuilderOption) error {
 	var args []string
 	if option.ParentBootstrapPath == "" {
 		args = []string{
@@ -146,9 +156,13 @@ func (builder *Builder) Run(option BuilderOption) error {
 		args = append(args, "--chunk-size", option.ChunkSize)
 	}
 
+	if option.SourceType != "" {
+		args = append(args, "--type", option.SourceType)
+	}
+
 	args = append(args, option.RootfsPath)
 
-	return builder.run(args, option.PrefetchPatterns)
+	return builder.run(ctx, args, option.PrefetchPatterns)
 }
 
 // Generate calls `nydus-image chunkdict generate` to get chunkdict
@@ -168,5 +182,5 @@ func (builder *Builder) Generate(option GenerateOption) error {
 	}
 	args = append(args, option.BootstrapPaths...)
 
-	return builder.run(args, "")
+	return builder.run(context.Background(), args, "")
 }
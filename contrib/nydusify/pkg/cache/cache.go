@@ -508,7 +508,7 @@ func (cache *Cache) Check(ctx context.Context, layerChainID digest.Digest) (*Rec
 				return nil, nil, nil, errors.Wrap(err, "Check blob layer")
 			}
 		} else {
-			exist, err = cache.opt.Backend.Check(record.NydusBlobDesc.Digest.Hex())
+			exist, err = cache.opt.Backend.Check(ctx, record.NydusBlobDesc.Digest.Hex())
 			if err != nil {
 				return nil, nil, nil, errors.Wrap(err, "Check blob on backend")
 			} else if !exist {
@@ -17,6 +17,7 @@ import (
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/parser"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/signature"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
@@ -34,6 +35,21 @@ type Opt struct {
 	BackendType    string
 	BackendConfig  string
 	ExpectedArch   string
+	// Signer verifies the signature of Nydus image if specified.
+	Signer *signature.Signer
+
+	// Perf enables the performance smoke test, the check fails if the
+	// performance regresses beyond PerfTolerance of PerfBaseline.
+	Perf            bool
+	PerfBaseline    *rule.PerfResult
+	PerfTolerance   float64
+	PerfRandomReads int
+
+	// SnapshotID compares the source image with the snapshot mounted by
+	// the running nydus-snapshotter serving the system controller API on
+	// SnapshotterSock, instead of mounting the target image by nydusd.
+	SnapshotID      string
+	SnapshotterSock string
 }
 
 // Checker validates Nydus image manifest, bootstrap and mounts filesystem
@@ -138,12 +154,34 @@ func (checker *Checker) check(ctx context.Context) error {
 		}
 	}
 
+	// The live snapshot is mounted by the nydusd of snapshotter.
+	if checker.SnapshotID == "" && targetParsed.NydusImage != nil {
+		if err := tool.CheckRequirements(checker.NydusdPath, targetParsed.NydusAnnotations()); err != nil {
+			return utils.WithExitCode(utils.ExitCodeValidation, errors.Wrap(err, "check image requirements"))
+		}
+	}
+
 	var sourceRemote *remote.Remote
 	if checker.sourceParser != nil {
 		sourceRemote = checker.sourceParser.Remote
 	}
 
+	var liveMountPath string
+	if checker.SnapshotID != "" {
+		var reference string
+		liveMountPath, reference, err = tool.SnapshotMountpoint(ctx, checker.SnapshotterSock, checker.SnapshotID)
+		if err != nil {
+			return errors.Wrap(err, "get mountpoint of snapshot")
+		}
+		logrus.Infof("Found snapshot %s of image %q mounted at %s", checker.SnapshotID, reference, liveMountPath)
+	}
+
 	rules := []rule.Rule{
+		&rule.SignatureRule{
+			Signer:         checker.Signer,
+			Target:         checker.Target,
+			TargetInsecure: checker.TargetInsecure,
+		},
 		&rule.ManifestRule{
 			SourceParsed:  sourceParsed,
 			TargetParsed:  targetParsed,
@@ -167,6 +205,7 @@ func (checker *Checker) check(ctx context.Context) error {
 			Target:          checker.Target,
 			TargetInsecure:  checker.TargetInsecure,
 			PlainHTTP:       checker.targetParser.Remote.IsWithHTTP(),
+			TargetMountPath: liveMountPath,
 			NydusdConfig: tool.NydusdConfig{
 				EnablePrefetch: true,
 				NydusdPath:     checker.NydusdPath,
@@ -183,9 +222,37 @@ func (checker *Checker) check(ctx context.Context) error {
 		},
 	}
 
+	if checker.Perf {
+		rules = append(rules, &rule.PerformanceRule{
+			Target:         checker.Target,
+			TargetInsecure: checker.TargetInsecure,
+			PlainHTTP:      checker.targetParser.Remote.IsWithHTTP(),
+			Baseline:       checker.PerfBaseline,
+			Tolerance:      checker.PerfTolerance,
+			RandomReads:    checker.PerfRandomReads,
+			OutputPath:     filepath.Join(checker.WorkDir, "perf_result.json"),
+			NydusdConfig: tool.NydusdConfig{
+				NydusdPath:    checker.NydusdPath,
+				BackendType:   checker.BackendType,
+				BackendConfig: checker.BackendConfig,
+				BootstrapPath: filepath.Join(checker.WorkDir, "nydus_bootstrap"),
+				ConfigPath:    filepath.Join(checker.WorkDir, "fs/perf_nydusd_config.json"),
+				BlobCacheDir:  filepath.Join(checker.WorkDir, "fs/perf_blobs"),
+				MountPath:     filepath.Join(checker.WorkDir, "fs/perf_mounted"),
+				APISockPath:   filepath.Join(checker.WorkDir, "fs/perf_api.sock"),
+				Mode:          mode,
+			},
+		})
+	}
+
 	for _, rule := range rules {
 		if err := rule.Validate(); err != nil {
-			return errors.Wrapf(err, "validate rule %s", rule.Name())
+			err = errors.Wrapf(err, "validate rule %s", rule.Name())
+			// Keep the exit code of network or builder failures in rule.
+			if utils.ExitCode(err) == utils.ExitCodeFailure {
+				return utils.WithExitCode(utils.ExitCodeValidation, err)
+			}
+			return err
 		}
 	}
 
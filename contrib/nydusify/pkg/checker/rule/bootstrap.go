@@ -9,11 +9,13 @@ import (
 	"fmt"
 	"os"
 
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/parser"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
 // BootstrapRule validates bootstrap in Nydus image
@@ -26,7 +28,8 @@ type BootstrapRule struct {
 }
 
 type bootstrapDebug struct {
-	Blobs []string `json:"blobs"`
+	Blobs     []string `json:"blobs"`
+	FsVersion string   `json:"fs_version"`
 }
 
 func (rule *BootstrapRule) Name() string {
@@ -46,6 +49,21 @@ func (rule *BootstrapRule) Validate() error {
 		return errors.Wrap(err, "invalid nydus bootstrap format")
 	}
 
+	// Parse blob list and fs version from output of bootstrap check
+	var bootstrap bootstrapDebug
+	bootstrapBytes, err := os.ReadFile(rule.DebugOutputPath)
+	if err != nil {
+		return errors.Wrap(err, "read bootstrap debug json")
+	}
+	if err := json.Unmarshal(bootstrapBytes, &bootstrap); err != nil {
+		return errors.Wrap(err, "unmarshal bootstrap output JSON")
+	}
+
+	layers := rule.Parsed.NydusImage.Manifest.Layers
+	if err := validateFsVersion(layers[len(layers)-1], bootstrap.FsVersion); err != nil {
+		return err
+	}
+
 	// For registry garbage collection, nydus puts the blobs to
 	// the layers in manifest, so here only need to check blob
 	// list consistency for registry backend.
@@ -55,7 +73,6 @@ func (rule *BootstrapRule) Validate() error {
 
 	// Parse blob list from blob layers in Nydus manifest
 	blobListInLayer := map[string]bool{}
-	layers := rule.Parsed.NydusImage.Manifest.Layers
 	for i, layer := range layers {
 		if i != len(layers)-1 {
 			blobListInLayer[layer.Digest.Hex()] = true
@@ -63,14 +80,6 @@ func (rule *BootstrapRule) Validate() error {
 	}
 
 	// Parse blob list from blob table of bootstrap
-	var bootstrap bootstrapDebug
-	bootstrapBytes, err := os.ReadFile(rule.DebugOutputPath)
-	if err != nil {
-		return errors.Wrap(err, "read bootstrap debug json")
-	}
-	if err := json.Unmarshal(bootstrapBytes, &bootstrap); err != nil {
-		return errors.Wrap(err, "unmarshal bootstrap output JSON")
-	}
 	blobListInBootstrap := map[string]bool{}
 	lostInLayer := false
 	for _, blobID := range bootstrap.Blobs {
@@ -94,3 +103,21 @@ func (rule *BootstrapRule) Validate() error {
 		blobListInLayer,
 	)
 }
+
+// validateFsVersion ensures the fs version annotation of bootstrap layer
+// matches the RAFS version of bootstrap. The snapshotter treats the image
+// without the annotation as RAFS v5, so it's required by RAFS v6 image to
+// be mounted in kernel EROFS mode.
+func validateFsVersion(bootstrapLayer ocispec.Descriptor, fsVersion string) error {
+	annotated, ok := bootstrapLayer.Annotations[utils.LayerAnnotationNydusFsVersion]
+	if !ok {
+		if fsVersion == "6" {
+			return fmt.Errorf("missing annotation %s of RAFS v6 bootstrap layer", utils.LayerAnnotationNydusFsVersion)
+		}
+		return nil
+	}
+	if fsVersion != "" && annotated != fsVersion {
+		return fmt.Errorf("fs version %s in annotation %s mismatches with RAFS v%s bootstrap", annotated, utils.LayerAnnotationNydusFsVersion, fsVersion)
+	}
+	return nil
+}
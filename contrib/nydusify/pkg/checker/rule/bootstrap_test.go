@@ -0,0 +1,32 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+func TestValidateFsVersion(t *testing.T) {
+	layer := ocispec.Descriptor{
+		Annotations: map[string]string{
+			utils.LayerAnnotationNydusBootstrap: "true",
+		},
+	}
+	require.NoError(t, validateFsVersion(layer, "5"))
+	err := validateFsVersion(layer, "6")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing annotation")
+
+	layer.Annotations[utils.LayerAnnotationNydusFsVersion] = "6"
+	require.NoError(t, validateFsVersion(layer, "6"))
+	err = validateFsVersion(layer, "5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "mismatches with RAFS v5 bootstrap")
+}
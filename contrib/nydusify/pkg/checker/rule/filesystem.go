@@ -12,10 +12,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
-	"syscall"
 
 	"github.com/distribution/reference"
 
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/parser"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
@@ -41,6 +41,10 @@ type FilesystemRule struct {
 	Target          string
 	TargetInsecure  bool
 	PlainHTTP       bool
+	// TargetMountPath is the live mountpoint of Nydus image mounted by the
+	// running snapshotter, the image is compared in place instead of being
+	// mounted by nydusd, and the file data is always compared.
+	TargetMountPath string
 }
 
 // Node records file metadata and file data hash.
@@ -56,14 +60,6 @@ type Node struct {
 	Hash    []byte
 }
 
-type RegistryBackendConfig struct {
-	Scheme     string `json:"scheme"`
-	Host       string `json:"host"`
-	Repo       string `json:"repo"`
-	Auth       string `json:"auth,omitempty"`
-	SkipVerify bool   `json:"skip_verify,omitempty"`
-}
-
 func (node *Node) String() string {
 	return fmt.Sprintf(
 		"Path: %s, Size: %d, Mode: %d, Rdev: %d, Symink: %s, UID: %d, GID: %d, "+
@@ -125,8 +121,8 @@ func (rule *FilesystemRule) walk(rootfs string) (map[string]Node, error) {
 			symlink = rootfsPath
 		}
 
-		var stat syscall.Stat_t
-		if err := syscall.Lstat(path, &stat); err != nil {
+		rdev, uid, gid, err := lstat(path)
+		if err != nil {
 			return errors.Wrapf(err, "lstat %s", path)
 		}
 
@@ -138,7 +134,7 @@ func (rule *FilesystemRule) walk(rootfs string) (map[string]Node, error) {
 		// Calculate file data hash if the `backend-type` option be specified,
 		// this will cause that nydusd read data from backend, it's network load
 		var hash []byte
-		if rule.NydusdConfig.BackendType != "" && info.Mode().IsRegular() {
+		if (rule.NydusdConfig.BackendType != "" || rule.TargetMountPath != "") && info.Mode().IsRegular() {
 			hash, err = utils.HashFile(path)
 			if err != nil {
 				return err
@@ -149,10 +145,10 @@ func (rule *FilesystemRule) walk(rootfs string) (map[string]Node, error) {
 			Path:    rootfsPath,
 			Size:    size,
 			Mode:    mode,
-			Rdev:    stat.Rdev,
+			Rdev:    rdev,
 			Symlink: symlink,
-			UID:     stat.Uid,
-			GID:     stat.Gid,
+			UID:     uid,
+			GID:     gid,
 			Xattrs:  xattrs,
 			Hash:    hash,
 		}
@@ -220,35 +216,41 @@ func (rule *FilesystemRule) mountSourceImage() (*tool.Image, error) {
 }
 
 func (rule *FilesystemRule) mountNydusImage() (*tool.Nydusd, error) {
-	logrus.Infof("Mounting Nydus image to %s", rule.NydusdConfig.MountPath)
+	return mountNydusImage(&rule.NydusdConfig, rule.Target, rule.TargetInsecure, rule.PlainHTTP)
+}
+
+// mountNydusImage mounts the target image by nydusd, the backend config is
+// generated from the target reference if not specified.
+func mountNydusImage(config *tool.NydusdConfig, target string, insecure, plainHTTP bool) (*tool.Nydusd, error) {
+	logrus.Infof("Mounting Nydus image to %s", config.MountPath)
 
-	if err := os.MkdirAll(rule.NydusdConfig.BlobCacheDir, 0755); err != nil {
+	if err := os.MkdirAll(config.BlobCacheDir, 0755); err != nil {
 		return nil, errors.Wrap(err, "create blob cache directory for Nydusd")
 	}
 
-	if err := os.MkdirAll(rule.NydusdConfig.MountPath, 0755); err != nil {
+	if err := os.MkdirAll(config.MountPath, 0755); err != nil {
 		return nil, errors.Wrap(err, "create mountpoint directory of Nydus image")
 	}
 
-	parsed, err := reference.ParseNormalizedNamed(rule.Target)
+	parsed, err := reference.ParseNormalizedNamed(target)
 	if err != nil {
 		return nil, err
 	}
 
-	if rule.NydusdConfig.BackendType == "" {
-		rule.NydusdConfig.BackendType = "registry"
+	if config.BackendType == "" {
+		config.BackendType = "registry"
 
-		if rule.NydusdConfig.BackendConfig == "" {
-			backendConfig, err := utils.NewRegistryBackendConfig(parsed, rule.TargetInsecure)
+		if config.BackendConfig == "" {
+			backendConfig, err := backend.NewRegistryConfig(parsed, insecure)
 			if err != nil {
 				return nil, errors.Wrap(err, "failed to parse backend configuration")
 			}
 
-			if rule.TargetInsecure {
+			if insecure {
 				backendConfig.SkipVerify = true
 			}
 
-			if rule.PlainHTTP {
+			if plainHTTP {
 				backendConfig.Scheme = "http"
 			}
 
@@ -256,11 +258,11 @@ func (rule *FilesystemRule) mountNydusImage() (*tool.Nydusd, error) {
 			if err != nil {
 				return nil, errors.Wrap(err, "parse registry backend config")
 			}
-			rule.NydusdConfig.BackendConfig = string(bytes)
+			config.BackendConfig = string(bytes)
 		}
 	}
 
-	nydusd, err := tool.NewNydusd(rule.NydusdConfig)
+	nydusd, err := tool.NewNydusd(*config)
 	if err != nil {
 		return nil, errors.Wrap(err, "create Nydusd daemon")
 	}
@@ -285,7 +287,11 @@ func (rule *FilesystemRule) verify() error {
 		walkErr <- err
 	}()
 
-	nydusNodes, err := rule.walk(rule.NydusdConfig.MountPath)
+	mountPath := rule.NydusdConfig.MountPath
+	if rule.TargetMountPath != "" {
+		mountPath = rule.TargetMountPath
+	}
+	nydusNodes, err := rule.walk(mountPath)
 	if err != nil {
 		return errors.Wrap(err, "walk rootfs of Nydus image")
 	}
@@ -318,6 +324,9 @@ func (rule *FilesystemRule) Validate() error {
 	if rule.Source == "" {
 		return nil
 	}
+	if err := utils.RequireLinux("comparing filesystem with source image"); err != nil {
+		return err
+	}
 
 	// Cleanup temporary directories
 	defer func() {
@@ -338,6 +347,11 @@ func (rule *FilesystemRule) Validate() error {
 	}
 	defer image.Umount()
 
+	if rule.TargetMountPath != "" {
+		logrus.Infof("Comparing with Nydus image mounted by snapshotter at %s", rule.TargetMountPath)
+		return rule.verify()
+	}
+
 	nydusd, err := rule.mountNydusImage()
 	if err != nil {
 		return err
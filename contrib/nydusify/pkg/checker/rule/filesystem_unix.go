@@ -0,0 +1,18 @@
+//go:build !windows
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import "syscall"
+
+// lstat returns the device number and the owner of file.
+func lstat(path string) (rdev uint64, uid, gid uint32, err error) {
+	var stat syscall.Stat_t
+	if err := syscall.Lstat(path, &stat); err != nil {
+		return 0, 0, 0, err
+	}
+	return uint64(stat.Rdev), stat.Uid, stat.Gid, nil
+}
@@ -0,0 +1,13 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import "github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+
+// lstat is unavailable since the files of Windows have no device number
+// and owner in Unix style.
+func lstat(_ string) (rdev uint64, uid, gid uint32, err error) {
+	return 0, 0, 0, utils.Unsupported("comparing file attributes")
+}
@@ -70,6 +70,11 @@ func (rule *ManifestRule) Validate() error {
 			if layer.Annotations[utils.LayerAnnotationNydusBootstrap] != "true" {
 				return errors.New("invalid bootstrap layer in nydus image manifest")
 			}
+			if version, ok := layer.Annotations[utils.LayerAnnotationNydusFsVersion]; ok {
+				if _, err := utils.ParseFsVersion(version); err != nil {
+					return errors.Wrap(err, "invalid fs version annotation of bootstrap layer")
+				}
+			}
 		} else {
 			if layer.MediaType != utils.MediaTypeNydusBlob ||
 				layer.Annotations[utils.LayerAnnotationNydusBlob] != "true" {
@@ -167,4 +167,11 @@ func TestManifestRuleValidate_TargetLayer(t *testing.T) {
 		},
 	}
 	require.NoError(t, rule.Validate())
+
+	rule.TargetParsed.NydusImage.Manifest.Layers[1].Annotations[utils.LayerAnnotationNydusFsVersion] = "7"
+	require.Error(t, rule.Validate())
+	require.Contains(t, rule.Validate().Error(), "invalid fs version annotation of bootstrap layer")
+
+	rule.TargetParsed.NydusImage.Manifest.Layers[1].Annotations[utils.LayerAnnotationNydusFsVersion] = "6"
+	require.NoError(t, rule.Validate())
 }
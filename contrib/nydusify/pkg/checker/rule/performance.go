@@ -0,0 +1,218 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+)
+
+const (
+	// perfRandomReadSize is the size of each random read.
+	perfRandomReadSize = 4096
+	// perfRandomReads is the default number of random reads.
+	perfRandomReads = 1000
+)
+
+// PerfResult is the measured performance of Nydus image, the metrics with
+// zero value are not checked when used as the baseline.
+type PerfResult struct {
+	// StatOps is the number of stat operations per second walking rootfs.
+	StatOps float64 `json:"stat_ops"`
+	// SeqReadThroughput is the bytes per second reading regular files.
+	SeqReadThroughput float64 `json:"seq_read_throughput"`
+	// RandReadIOPS is the number of 4KiB random reads per second.
+	RandReadIOPS float64 `json:"rand_read_iops"`
+}
+
+// PerformanceRule mounts Nydus image with an empty blob cache and measures
+// the metadata operations, random read and sequential read, the check fails
+// if any one metric regresses beyond tolerance of the baseline.
+type PerformanceRule struct {
+	NydusdConfig   tool.NydusdConfig
+	Target         string
+	TargetInsecure bool
+	PlainHTTP      bool
+
+	// Baseline is the expected performance, only the result is logged if nil.
+	Baseline *PerfResult
+	// Tolerance is the allowed ratio of regression, for example 0.2 allows
+	// the metrics 20% lower than the baseline.
+	Tolerance float64
+	// RandomReads is the number of random reads, default to 1000.
+	RandomReads int
+	// OutputPath is the file to save the result, which is able to be used as
+	// the baseline of subsequent checks.
+	OutputPath string
+}
+
+func (rule *PerformanceRule) Name() string {
+	return "Performance"
+}
+
+func (rule *PerformanceRule) Validate() error {
+	logrus.Infof("Checking performance of Nydus image")
+
+	defer func() {
+		if err := os.RemoveAll(rule.NydusdConfig.MountPath); err != nil {
+			logrus.WithError(err).Warnf("cleanup nydus image directory %s", rule.NydusdConfig.MountPath)
+		}
+		if err := os.RemoveAll(rule.NydusdConfig.BlobCacheDir); err != nil {
+			logrus.WithError(err).Warnf("cleanup nydus blob cache directory %s", rule.NydusdConfig.BlobCacheDir)
+		}
+	}()
+
+	nydusd, err := mountNydusImage(&rule.NydusdConfig, rule.Target, rule.TargetInsecure, rule.PlainHTTP)
+	if err != nil {
+		return err
+	}
+	defer nydusd.Umount(false)
+
+	randomReads := rule.RandomReads
+	if randomReads <= 0 {
+		randomReads = perfRandomReads
+	}
+	result, err := measurePerf(rule.NydusdConfig.MountPath, randomReads)
+	if err != nil {
+		return errors.Wrap(err, "measure performance")
+	}
+	logrus.Infof("Performance of Nydus image: %.0f stat ops/s, %.2f MiB/s sequential read, %.0f random read IOPS",
+		result.StatOps, result.SeqReadThroughput/1024/1024, result.RandReadIOPS)
+
+	if rule.OutputPath != "" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "marshal performance result")
+		}
+		if err := os.WriteFile(rule.OutputPath, data, 0644); err != nil {
+			return errors.Wrapf(err, "write performance result to %s", rule.OutputPath)
+		}
+	}
+
+	if rule.Baseline != nil {
+		return result.Compare(*rule.Baseline, rule.Tolerance)
+	}
+
+	return nil
+}
+
+// Compare checks the result against the baseline, it returns error listing
+// the metrics lower than (1 - tolerance) of the baseline.
+func (result *PerfResult) Compare(baseline PerfResult, tolerance float64) error {
+	var regressions []string
+	check := func(name string, measured, expected float64) {
+		if expected <= 0 {
+			return
+		}
+		if threshold := expected * (1 - tolerance); measured < threshold {
+			regressions = append(regressions, fmt.Sprintf("%s %.2f is lower than threshold %.2f", name, measured, threshold))
+		}
+	}
+	check("stat_ops", result.StatOps, baseline.StatOps)
+	check("seq_read_throughput", result.SeqReadThroughput, baseline.SeqReadThroughput)
+	check("rand_read_iops", result.RandReadIOPS, baseline.RandReadIOPS)
+	if len(regressions) > 0 {
+		return fmt.Errorf("performance regression: %s", strings.Join(regressions, ", "))
+	}
+	return nil
+}
+
+type perfFile struct {
+	path string
+	size int64
+}
+
+// measurePerf walks the rootfs to measure stat operations, and then reads
+// the random offsets of regular files, and reads all the regular files
+// sequentially at last.
+func measurePerf(root string, randomReads int) (*PerfResult, error) {
+	var result PerfResult
+
+	var files []perfFile
+	stats := 0
+	start := time.Now()
+	if err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stats++
+		if info.Mode().IsRegular() && info.Size() > 0 {
+			files = append(files, perfFile{path: path, size: info.Size()})
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "walk rootfs")
+	}
+	result.StatOps = perSecond(float64(stats), time.Since(start))
+
+	if len(files) == 0 {
+		return &result, nil
+	}
+
+	// Use a fixed seed so that the same offsets are read in each check.
+	random := rand.New(rand.NewSource(1))
+	buf := make([]byte, perfRandomReadSize)
+	start = time.Now()
+	for i := 0; i < randomReads; i++ {
+		file := files[random.Intn(len(files))]
+		if err := readAt(file.path, buf, random.Int63n(file.size)); err != nil {
+			return nil, errors.Wrapf(err, "random read %s", file.path)
+		}
+	}
+	result.RandReadIOPS = perSecond(float64(randomReads), time.Since(start))
+
+	var bytes int64
+	buf = make([]byte, 1024*1024)
+	start = time.Now()
+	for _, file := range files {
+		n, err := readAll(file.path, buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "sequential read %s", file.path)
+		}
+		bytes += n
+	}
+	result.SeqReadThroughput = perSecond(float64(bytes), time.Since(start))
+
+	return &result, nil
+}
+
+func readAt(path string, buf []byte, offset int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func readAll(path string, buf []byte) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.CopyBuffer(io.Discard, file, buf)
+}
+
+func perSecond(count float64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return count / elapsed.Seconds()
+}
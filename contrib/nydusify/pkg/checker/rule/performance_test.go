@@ -0,0 +1,43 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasurePerf(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "dir/file"), make([]byte, 10000), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "empty"), nil, 0644))
+
+	result, err := measurePerf(root, 10)
+	require.NoError(t, err)
+	require.Greater(t, result.StatOps, float64(0))
+	require.Greater(t, result.SeqReadThroughput, float64(0))
+	require.Greater(t, result.RandReadIOPS, float64(0))
+
+	// No data to read in the empty rootfs.
+	result, err = measurePerf(t.TempDir(), 10)
+	require.NoError(t, err)
+	require.Zero(t, result.SeqReadThroughput)
+	require.Zero(t, result.RandReadIOPS)
+}
+
+func TestPerfResultCompare(t *testing.T) {
+	result := PerfResult{StatOps: 900, SeqReadThroughput: 700, RandReadIOPS: 100}
+
+	require.NoError(t, result.Compare(PerfResult{StatOps: 1000, SeqReadThroughput: 800}, 0.2))
+
+	err := result.Compare(PerfResult{StatOps: 1000, SeqReadThroughput: 1000, RandReadIOPS: 100}, 0.2)
+	require.ErrorContains(t, err, "seq_read_throughput 700.00 is lower than threshold 800.00")
+	require.NotContains(t, err.Error(), "stat_ops")
+	require.NotContains(t, err.Error(), "rand_read_iops")
+}
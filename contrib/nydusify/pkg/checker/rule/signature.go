@@ -0,0 +1,36 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package rule
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/signature"
+)
+
+// SignatureRule verifies the signature of Nydus image
+type SignatureRule struct {
+	Signer         *signature.Signer
+	Target         string
+	TargetInsecure bool
+}
+
+func (rule *SignatureRule) Name() string {
+	return "Signature"
+}
+
+func (rule *SignatureRule) Validate() error {
+	// Skip signature verification if no signer be specified
+	if rule.Signer == nil {
+		return nil
+	}
+
+	logrus.Infof("Checking Nydus image signature")
+
+	_, err := rule.Signer.Verify(context.Background(), rule.Target, rule.TargetInsecure)
+	return err
+}
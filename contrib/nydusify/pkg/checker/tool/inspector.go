@@ -14,6 +14,8 @@ import (
 
 const (
 	GetBlobs = iota
+	GetChunks
+	GetFiles
 )
 
 type InspectOption struct {
@@ -27,6 +29,10 @@ type BlobInfo struct {
 	DecompressedSize uint64 `json:"decompressed_size"`
 	ReadaheadOffset  uint32 `json:"readahead_offset"`
 	ReadaheadSize    uint32 `json:"readahead_size"`
+	Compressor       string `json:"compressor"`
+	Digester         string `json:"digester"`
+	ChunkCount       uint32 `json:"chunk_count"`
+	Features         uint32 `json:"features"`
 }
 
 func (info *BlobInfo) String() string {
@@ -41,6 +47,30 @@ func (infos BlobInfoList) String() string {
 	return string(jsonBytes)
 }
 
+// ChunkInfo is the data chunk referenced by the filesystem.
+type ChunkInfo struct {
+	BlobID             string `json:"blob_id"`
+	BlobIndex          uint32 `json:"blob_index"`
+	ChunkID            string `json:"chunk_id"`
+	CompressedOffset   uint64 `json:"compressed_offset"`
+	CompressedSize     uint32 `json:"compressed_size"`
+	UncompressedOffset uint64 `json:"uncompressed_offset"`
+	UncompressedSize   uint32 `json:"uncompressed_size"`
+	Compressed         bool   `json:"compressed"`
+	Batch              bool   `json:"batch"`
+	Encrypted          bool   `json:"encrypted"`
+}
+
+type ChunkInfoList []ChunkInfo
+
+// FileInfo is the file or directory in the filesystem.
+type FileInfo struct {
+	Inode uint64 `json:"inode"`
+	Path  string `json:"path"`
+}
+
+type FileInfoList []FileInfo
+
 type Inspector struct {
 	binaryPath string
 }
@@ -71,6 +101,37 @@ func (p *Inspector) Inspect(option InspectOption) (interface{}, error) {
 			return nil, err
 		}
 		return blobs, nil
+	case GetChunks:
+		args = append(args, "chunks")
+		cmd := exec.Command(p.binaryPath, args...)
+		// The chunk list may be large, don't mix the logs in stderr.
+		msg, err := cmd.Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return nil, errors.Wrap(err, string(exitErr.Stderr))
+			}
+			return nil, err
+		}
+		var chunks ChunkInfoList
+		if err = json.Unmarshal(msg, &chunks); err != nil {
+			return nil, err
+		}
+		return chunks, nil
+	case GetFiles:
+		args = append(args, "files")
+		cmd := exec.Command(p.binaryPath, args...)
+		msg, err := cmd.Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return nil, errors.Wrap(err, string(exitErr.Stderr))
+			}
+			return nil, err
+		}
+		var files FileInfoList
+		if err = json.Unmarshal(msg, &files); err != nil {
+			return nil, err
+		}
+		return files, nil
 	}
 	return nil, fmt.Errorf("not support method %d", option.Operation)
 }
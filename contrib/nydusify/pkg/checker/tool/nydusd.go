@@ -14,10 +14,15 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
 type NydusdConfig struct {
@@ -28,6 +33,9 @@ type NydusdConfig struct {
 	BackendType    string
 	BackendConfig  string
 	BlobCacheDir   string
+	// BlobDir is the directory of local blob files read by the localfs
+	// backend if BackendType is empty.
+	BlobDir        string
 	APISockPath    string
 	MountPath      string
 	Mode           string
@@ -76,10 +84,24 @@ func makeConfig(conf NydusdConfig) error {
 	if conf.BackendType == "" {
 		conf.BackendType = "localfs"
 		conf.BackendConfig = `{"dir": "/fake"}`
+		if conf.BlobDir != "" {
+			dir, err := json.Marshal(map[string]string{"dir": conf.BlobDir})
+			if err != nil {
+				return errors.Wrap(err, "marshal localfs backend configuration")
+			}
+			conf.BackendConfig = string(dir)
+		}
 	} else {
 		if conf.BackendConfig == "" {
 			return errors.Errorf("empty backend configuration string")
 		}
+		cfg, err := backend.ParseConfig(conf.BackendType, []byte(conf.BackendConfig))
+		if err != nil {
+			return errors.Wrap(err, "invalid backend configuration for Nydusd")
+		}
+		if httpCfg, ok := cfg.(*backend.HTTPProxyConfig); ok && len(httpCfg.Headers) > 0 {
+			logrus.Warn("the headers of http-proxy backend are not sent by nydusd")
+		}
 	}
 	if err := tpl.Execute(&ret, conf); err != nil {
 		return errors.New("failed to prepare configuration file for Nydusd")
@@ -148,6 +170,27 @@ func checkReady(ctx context.Context, sock string) (<-chan bool, error) {
 	return ready, nil
 }
 
+// CheckRequirements checks the nydusd satisfies the runtime requirements
+// recorded in the image annotations, so that the image requiring a newer
+// nydusd fails fast instead of failing to mount.
+func CheckRequirements(nydusdPath string, annotations map[string]string) error {
+	req := utils.RequirementsFromAnnotations(annotations)
+	if req == nil {
+		return nil
+	}
+	output, err := exec.Command(nydusdPath, "--version").Output()
+	if err != nil {
+		logrus.WithError(err).Warn("get nydusd version, skip checking image requirements")
+		return nil
+	}
+	// The first line is like `Version: v2.2.0`.
+	fields := strings.Fields(strings.SplitN(strings.TrimSpace(string(output)), "\n", 2)[0])
+	if len(fields) == 0 {
+		return nil
+	}
+	return req.Check(fields[len(fields)-1])
+}
+
 func NewNydusd(conf NydusdConfig) (*Nydusd, error) {
 	if err := makeConfig(conf); err != nil {
 		return nil, errors.Wrapf(err, "failed to create configuration file for Nydusd")
@@ -0,0 +1,88 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSnapshotterSystemSock is the default socket of the system
+// controller API served by nydus-snapshotter.
+const DefaultSnapshotterSystemSock = "/run/containerd-nydus/system.sock"
+
+// SnapshotterInstance is a RAFS instance mounted by nydusd for a snapshot.
+type SnapshotterInstance struct {
+	SnapshotID  string `json:"snapshot_id"`
+	SnapshotDir string `json:"snapshot_dir"`
+	Mountpoint  string `json:"mountpoint"`
+	ImageID     string `json:"image_id"`
+}
+
+// SnapshotterDaemon is a nydusd daemon managed by nydus-snapshotter, as
+// listed by the system controller API.
+type SnapshotterDaemon struct {
+	ID  string `json:"id"`
+	Pid int    `json:"pid"`
+	// Reference is the number of RAFS instances referring the daemon.
+	Reference  int                            `json:"reference"`
+	Mountpoint string                         `json:"mountpoint"`
+	Instances  map[string]SnapshotterInstance `json:"instances"`
+}
+
+// ListSnapshotterDaemons lists the nydusd daemons from the system controller
+// API of running nydus-snapshotter.
+func ListSnapshotterDaemons(ctx context.Context, sock string) ([]SnapshotterDaemon, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				dialer := &net.Dialer{Timeout: 5 * time.Second}
+				return dialer.DialContext(ctx, "unix", sock)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://unix/api/v1/daemons", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request snapshotter system controller %s", sock)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d from snapshotter system controller", resp.StatusCode)
+	}
+
+	var daemons []SnapshotterDaemon
+	if err := json.NewDecoder(resp.Body).Decode(&daemons); err != nil {
+		return nil, errors.Wrap(err, "decode daemons of snapshotter")
+	}
+	return daemons, nil
+}
+
+// SnapshotMountpoint returns the mountpoint of the RAFS instance serving the
+// snapshot in running nydus-snapshotter, and the image reference of the
+// instance.
+func SnapshotMountpoint(ctx context.Context, sock, snapshotID string) (string, string, error) {
+	daemons, err := ListSnapshotterDaemons(ctx, sock)
+	if err != nil {
+		return "", "", err
+	}
+	for _, daemon := range daemons {
+		if instance, ok := daemon.Instances[snapshotID]; ok && instance.Mountpoint != "" {
+			return instance.Mountpoint, instance.ImageID, nil
+		}
+	}
+	return "", "", fmt.Errorf("snapshot %s is not mounted by any nydusd of snapshotter", snapshotID)
+}
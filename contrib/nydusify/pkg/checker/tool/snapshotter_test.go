@@ -0,0 +1,50 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tool
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotMountpoint(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "system.sock")
+	listener, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/daemons", r.URL.Path)
+		w.Write([]byte(`[{
+			"id": "d1",
+			"pid": 100,
+			"api_socket": "/run/containerd-nydus/socket/d1/api.sock",
+			"reference": 1,
+			"mountpoint": "/var/lib/containerd-nydus/mnt",
+			"startup_cpu_utilization": 0.5,
+			"memory_rss_kb": 10240,
+			"read_data_kb": 512,
+			"instances": {
+				"42": {"snapshot_id": "42", "snapshot_dir": "/var/lib/containerd-nydus/snapshots/42", "mountpoint": "/var/lib/containerd-nydus/mnt/42", "image_id": "localhost:5000/nginx:latest-nydus"}
+			}
+		}]`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	mountpoint, reference, err := SnapshotMountpoint(context.Background(), sock, "42")
+	require.NoError(t, err)
+	require.Equal(t, "/var/lib/containerd-nydus/mnt/42", mountpoint)
+	require.Equal(t, "localhost:5000/nginx:latest-nydus", reference)
+
+	_, _, err = SnapshotMountpoint(context.Background(), sock, "43")
+	require.ErrorContains(t, err, "snapshot 43 is not mounted")
+
+	_, _, err = SnapshotMountpoint(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), "42")
+	require.ErrorContains(t, err, "request snapshotter system controller")
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/containerd/containerd/namespaces"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/build"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/parser"
@@ -181,7 +182,7 @@ func hosts(generator *Generator) remote.HostFunc {
 
 	maps[generator.Target] = generator.TargetInsecure
 	return func(ref string) (remote.CredentialFunc, bool, error) {
-		return remote.NewDockerConfigCredFunc(), maps[ref], nil
+		return auth.CredFunc, maps[ref], nil
 	}
 }
 
@@ -319,11 +320,11 @@ func pushBlobFromBackend(
 				var rc io.ReadCloser
 
 				if bkd != nil {
-					rc, err = bkd.Reader(blobID)
+					rc, err = bkd.Reader(ctx, blobID)
 					if err != nil {
 						return errors.Wrap(err, "get blob reader")
 					}
-					blobSize, err = bkd.Size(blobID)
+					blobSize, err = bkd.Size(ctx, blobID)
 					if err != nil {
 						return errors.Wrap(err, "get blob size")
 					}
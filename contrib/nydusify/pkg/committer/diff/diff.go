@@ -1,3 +1,5 @@
+//go:build linux
+
 // Ported from buildkit project, copyright The buildkit Authors.
 // https://github.com/moby/buildkit
 
@@ -0,0 +1,20 @@
+//go:build !linux
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package diff
+
+import (
+	"context"
+	"io"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// Diff is unavailable since the changes of container are read from the
+// overlayfs upper directory.
+func Diff(_ context.Context, _ func(path string), _ []string, _ []string, _ io.Writer, _, _ string) error {
+	return utils.Unsupported("committing container changes from overlayfs")
+}
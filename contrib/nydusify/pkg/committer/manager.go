@@ -110,15 +110,17 @@ func (m *Manager) Inspect(ctx context.Context, containerID string) (*InspectResu
 	}
 
 	snapshot := client.SnapshotService("nydus")
-	lowerDirs := ""
-	upperDir := ""
 	mount, err := snapshot.Mounts(ctx, containerInfo.SnapshotKey)
 	if err != nil {
 		return nil, errors.Wrapf(err, "get snapshot mount")
 	}
-	// snapshot Mount Options[0] "workdir=$workdir", Options[1] "upperdir=$upperdir", Options[2] "lowerdir=$lowerdir".
-	lowerDirs = strings.TrimPrefix(mount[0].Options[2], "lowerdir=")
-	upperDir = strings.TrimPrefix(mount[0].Options[1], "upperdir=")
+	if len(mount) == 0 {
+		return nil, errors.Errorf("no mount found for snapshot %s", containerInfo.SnapshotKey)
+	}
+	lowerDirs, upperDir, err := parseOverlayDirs(mount[0].Options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse snapshot mount of container %s", containerID)
+	}
 
 	return &InspectResult{
 		LowerDirs: lowerDirs,
@@ -128,3 +130,24 @@ func (m *Manager) Inspect(ctx context.Context, containerID string) (*InspectResu
 		Pid:       pid,
 	}, nil
 }
+
+// parseOverlayDirs finds the lowerdir and upperdir from overlay mount options,
+// the snapshot usually returns options like "workdir=$workdir", "upperdir=$upperdir",
+// "lowerdir=$lowerdir", but the order and extra options are not guaranteed.
+func parseOverlayDirs(options []string) (string, string, error) {
+	var lowerDirs, upperDir string
+	for _, option := range options {
+		if strings.HasPrefix(option, "lowerdir=") {
+			lowerDirs = strings.TrimPrefix(option, "lowerdir=")
+		} else if strings.HasPrefix(option, "upperdir=") {
+			upperDir = strings.TrimPrefix(option, "upperdir=")
+		}
+	}
+	if upperDir == "" {
+		return "", "", errors.New("not found upperdir in overlay mount options, the container may not be writable")
+	}
+	if lowerDirs == "" {
+		return "", "", errors.New("not found lowerdir in overlay mount options")
+	}
+	return lowerDirs, upperDir, nil
+}
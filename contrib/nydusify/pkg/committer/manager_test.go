@@ -0,0 +1,41 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package committer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOverlayDirs(t *testing.T) {
+	lowerDirs, upperDir, err := parseOverlayDirs([]string{
+		"workdir=/snapshots/2/work",
+		"upperdir=/snapshots/2/fs",
+		"lowerdir=/snapshots/1/mnt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/snapshots/1/mnt", lowerDirs)
+	require.Equal(t, "/snapshots/2/fs", upperDir)
+
+	lowerDirs, upperDir, err = parseOverlayDirs([]string{
+		"lowerdir=/snapshots/1/mnt:/snapshots/0/mnt",
+		"index=off",
+		"upperdir=/snapshots/2/fs",
+		"workdir=/snapshots/2/work",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "/snapshots/1/mnt:/snapshots/0/mnt", lowerDirs)
+	require.Equal(t, "/snapshots/2/fs", upperDir)
+
+	// Failure situation
+	_, _, err = parseOverlayDirs([]string{"lowerdir=/snapshots/1/mnt"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found upperdir")
+
+	_, _, err = parseOverlayDirs([]string{"upperdir=/snapshots/2/fs"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found lowerdir")
+}
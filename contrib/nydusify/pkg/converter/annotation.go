@@ -0,0 +1,139 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/goharbor/acceleration-service/pkg/content"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/annotation"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// annotationProvider wraps the provider to transform the annotations of
+// target image before pushing it, the annotation policy is applied to the
+// index and every manifest, then the annotations are added to the manifest
+// (or index for multi-platform image).
+type annotationProvider struct {
+	content.Provider
+	// target is the normalized target reference.
+	target      string
+	annotations map[string]string
+	policy      *annotation.Policy
+}
+
+// prefetchAnnotations returns the annotation storing the prefetch list in
+// target image, so that the snapshotter is able to prefetch the files
+// without extra configuration.
+func prefetchAnnotations(patterns string) map[string]string {
+	files := []string{}
+	for _, file := range strings.Split(patterns, "\n") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return map[string]string{
+		utils.ManifestNydusPrefetchFiles: strings.Join(files, "\n"),
+	}
+}
+
+func newAnnotationProvider(opt Opt, pvd content.Provider, annotations map[string]string) (*annotationProvider, error) {
+	target, err := docker.ParseDockerRef(opt.Target)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse target reference")
+	}
+	return &annotationProvider{
+		Provider:    pvd,
+		target:      target.String(),
+		annotations: annotations,
+		policy:      opt.AnnotationPolicy,
+	}, nil
+}
+
+func (ap *annotationProvider) Push(ctx context.Context, desc ocispec.Descriptor, ref string) error {
+	if ref == ap.target {
+		annotated, err := ap.annotate(ctx, desc)
+		if err != nil {
+			return errors.Wrap(err, "annotate target image")
+		}
+		desc = *annotated
+	}
+	return ap.Provider.Push(ctx, desc, ref)
+}
+
+func (ap *annotationProvider) annotate(ctx context.Context, desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+	if ap.policy != nil && images.IsIndexType(desc.MediaType) {
+		rewritten, err := walkImage(ctx, ap.ContentStore(), platforms.All, desc, func(ctx context.Context, manifest ocispec.Descriptor, _ string) (*ocispec.Descriptor, error) {
+			return ap.transform(ctx, manifest, nil)
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "transform annotations of manifests")
+		}
+		desc = *rewritten
+	}
+
+	transformed, err := ap.transform(ctx, desc, ap.annotations)
+	if err != nil {
+		return nil, err
+	}
+	if transformed == nil {
+		return &desc, nil
+	}
+	return transformed, nil
+}
+
+// transform applies the policy to the annotations of manifest or index,
+// and adds the extra annotations. It returns nil if nothing is changed.
+func (ap *annotationProvider) transform(ctx context.Context, desc ocispec.Descriptor, extra map[string]string) (*ocispec.Descriptor, error) {
+	cs := ap.ContentStore()
+
+	// Keep the unknown fields of manifest or index.
+	var obj map[string]json.RawMessage
+	if err := readJSON(ctx, cs, desc, &obj); err != nil {
+		return nil, errors.Wrap(err, "read target image")
+	}
+	annotations := map[string]string{}
+	if raw, ok := obj["annotations"]; ok {
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			return nil, errors.Wrap(err, "unmarshal annotations")
+		}
+	}
+	transformed := ap.policy.Apply(annotations)
+	for key, value := range annotations {
+		if newValue, ok := transformed[key]; !ok {
+			logrus.Infof("strip annotation %s of %s", key, desc.Digest)
+		} else if newValue != value {
+			logrus.Infof("rewrite annotation %s of %s", key, desc.Digest)
+		}
+	}
+	for key, value := range extra {
+		transformed[key] = value
+	}
+	if maps.Equal(annotations, transformed) {
+		return nil, nil
+	}
+
+	if len(transformed) == 0 {
+		delete(obj, "annotations")
+	} else {
+		raw, err := json.Marshal(transformed)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal annotations")
+		}
+		obj["annotations"] = raw
+	}
+
+	return writeJSON(ctx, cs, desc, obj)
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/annotation"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+func TestAnnotationProvider(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := provider.New(t.TempDir(), hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+	cs := pvd.ContentStore()
+
+	manifestBytes, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ocispec.MediaTypeImageManifest,
+		"subject":       map[string]interface{}{"digest": "sha256:unknown"},
+		"annotations":   map[string]string{"existing": "value"},
+	})
+	require.NoError(t, err)
+	manifest := writeTestBlob(t, cs, ocispec.MediaTypeImageManifest, manifestBytes)
+
+	ap, err := newAnnotationProvider(Opt{Target: "localhost/target:latest"}, pvd, prefetchAnnotations("/usr/bin\n\n/etc/nginx\n"))
+	require.NoError(t, err)
+	require.Equal(t, "localhost/target:latest", ap.target)
+
+	annotated, err := ap.annotate(ctx, manifest)
+	require.NoError(t, err)
+	require.Equal(t, ocispec.MediaTypeImageManifest, annotated.MediaType)
+
+	var newManifest struct {
+		Subject     map[string]string `json:"subject"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	require.NoError(t, readJSON(ctx, cs, *annotated, &newManifest))
+	require.Equal(t, "sha256:unknown", newManifest.Subject["digest"])
+	require.Equal(t, map[string]string{
+		"existing":                       "value",
+		utils.ManifestNydusPrefetchFiles: "/usr/bin\n/etc/nginx",
+	}, newManifest.Annotations)
+
+	// The inherited annotations are transformed by policy before adding
+	// the extra annotations.
+	policy, err := annotation.ParsePolicy([]string{"strip:exist*", "rewrite:team=redacted"})
+	require.NoError(t, err)
+	ap, err = newAnnotationProvider(Opt{Target: "localhost/target:latest", AnnotationPolicy: policy}, pvd, map[string]string{"existing": "added"})
+	require.NoError(t, err)
+	annotated, err = ap.annotate(ctx, manifest)
+	require.NoError(t, err)
+	newManifest.Annotations = nil
+	require.NoError(t, readJSON(ctx, cs, *annotated, &newManifest))
+	require.Equal(t, map[string]string{"existing": "added"}, newManifest.Annotations)
+
+	// The index and its manifests are transformed.
+	indexBytes, err := json.Marshal(ocispec.Index{
+		MediaType:   ocispec.MediaTypeImageIndex,
+		Manifests:   []ocispec.Descriptor{manifest},
+		Annotations: map[string]string{"existing": "value", "team": "infra"},
+	})
+	require.NoError(t, err)
+	index := writeTestBlob(t, cs, ocispec.MediaTypeImageIndex, indexBytes)
+	ap, err = newAnnotationProvider(Opt{Target: "localhost/target:latest", AnnotationPolicy: policy}, pvd, nil)
+	require.NoError(t, err)
+	annotated, err = ap.annotate(ctx, index)
+	require.NoError(t, err)
+	var newIndex ocispec.Index
+	require.NoError(t, readJSON(ctx, cs, *annotated, &newIndex))
+	require.Equal(t, map[string]string{"team": "redacted"}, newIndex.Annotations)
+	var indexManifest ocispec.Manifest
+	require.NoError(t, readJSON(ctx, cs, newIndex.Manifests[0], &indexManifest))
+	require.Empty(t, indexManifest.Annotations)
+}
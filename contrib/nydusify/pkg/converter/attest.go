@@ -0,0 +1,102 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/attestation"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+)
+
+// provenanceParameters returns the conversion options recorded in the
+// provenance, the credentials like backend config are excluded.
+func provenanceParameters(opt Opt) map[string]interface{} {
+	targetFormat := opt.TargetFormat
+	if targetFormat == "" {
+		targetFormat = TargetFormatNydus
+	}
+	parameters := map[string]interface{}{
+		"target_format": targetFormat,
+		"platforms":     opt.Platforms,
+		"all_platforms": opt.AllPlatforms,
+	}
+	if targetFormat != TargetFormatNydus {
+		return parameters
+	}
+	parameters["fs_version"] = opt.FsVersion
+	parameters["compressor"] = opt.Compressor
+	parameters["chunk_size"] = opt.ChunkSize
+	parameters["batch_size"] = opt.BatchSize
+	parameters["fs_align_chunk"] = opt.FsAlignChunk
+	parameters["merge_platform"] = opt.MergePlatform
+	parameters["oci_ref"] = opt.OCIRef
+	parameters["with_referrer"] = opt.WithReferrer
+	parameters["backend_type"] = opt.BackendType
+	parameters["chunk_dict"] = opt.ChunkDictRef
+	parameters["prefetch_patterns"] = opt.PrefetchPatterns
+	return parameters
+}
+
+// attach attaches the provenance and the SBOM to the pushed target image
+// as OCI referrers.
+func attach(ctx context.Context, opt Opt, pvd *provider.Provider, prov *Provenance, startedOn time.Time) error {
+	if prov == nil {
+		return fmt.Errorf("provenance of target image is unavailable")
+	}
+	target, err := normalizeReference(opt.Target)
+	if err != nil {
+		return err
+	}
+	subject, err := pvd.PushedImage(target)
+	if err != nil {
+		return errors.Wrap(err, "get target image")
+	}
+
+	if opt.AttachProvenance {
+		data, err := attestation.NewProvenance(attestation.ProvenanceOpt{
+			Source:       prov.Source,
+			SourceDigest: prov.SourceDigest,
+			Target:       prov.Target,
+			TargetDigest: prov.TargetDigest,
+			ToolVersion:  opt.ToolVersion,
+			Parameters:   provenanceParameters(opt),
+			StartedOn:    startedOn,
+			FinishedOn:   time.Now(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "generate provenance")
+		}
+		desc, err := attestation.Attach(ctx, opt.Target, opt.TargetInsecure, *subject, attestation.MediaTypeInToto, data)
+		if err != nil {
+			return errors.Wrap(err, "attach provenance")
+		}
+		logrus.Infof("attached provenance %s to image %s", desc.Digest, opt.Target)
+	}
+
+	if opt.SBOMPath != "" {
+		data, err := os.ReadFile(opt.SBOMPath)
+		if err != nil {
+			return errors.Wrap(err, "read SBOM")
+		}
+		artifactType, err := attestation.DetectSBOMType(data)
+		if err != nil {
+			return err
+		}
+		desc, err := attestation.Attach(ctx, opt.Target, opt.TargetInsecure, *subject, artifactType, data)
+		if err != nil {
+			return errors.Wrap(err, "attach SBOM")
+		}
+		logrus.Infof("attached SBOM %s to image %s", desc.Digest, opt.Target)
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/namespaces"
+	"github.com/goharbor/acceleration-service/pkg/platformutil"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+)
+
+const (
+	BatchStatusSucceeded = "succeeded"
+	BatchStatusFailed    = "failed"
+	BatchStatusSkipped   = "skipped"
+)
+
+// BatchItem is an image to be converted in batch mode.
+type BatchItem struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	CacheRef string `json:"cache_ref,omitempty"`
+}
+
+// BatchRecord records the conversion status of an image.
+type BatchRecord struct {
+	BatchItem
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	Duration   string      `json:"duration,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// BatchReport is the summary of batch conversion, it's also persisted
+// as status file to resume the batch conversion after failure.
+type BatchReport struct {
+	Records   []BatchRecord `json:"records"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+}
+
+type BatchOpt struct {
+	// Concurrency is the maximum number of images converted in parallel.
+	Concurrency uint
+	// StatusPath is the file to track per-image conversion status, the
+	// images succeeded or skipped in previous runs will be skipped.
+	StatusPath string
+}
+
+// ParseBatchList parses the image list in batch mode, each line is formatted
+// as `<source> [<target>]`, empty lines and lines starting with `#` are ignored.
+// The target is left empty if not specified.
+func ParseBatchList(reader io.Reader, filter *regexp.Regexp) ([]BatchItem, error) {
+	items := []BatchItem{}
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid line %d: %q, should be `<source> [<target>]`", lineNum, line)
+		}
+		if filter != nil && !filter.MatchString(fields[0]) {
+			logrus.Debugf("filter out source image %s", fields[0])
+			continue
+		}
+		item := BatchItem{Source: fields[0]}
+		if len(fields) == 2 {
+			item.Target = fields[1]
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read image list")
+	}
+	return items, nil
+}
+
+func loadBatchStatus(path string) (map[string]BatchRecord, error) {
+	records := map[string]BatchRecord{}
+	if path == "" {
+		return records, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return records, nil
+		}
+		return nil, errors.Wrap(err, "read batch status file")
+	}
+	var report BatchReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal batch status file %s", path)
+	}
+	for _, record := range report.Records {
+		records[record.Source+" "+record.Target] = record
+	}
+	return records, nil
+}
+
+// converted returns true if the image has been converted by the previous
+// runs, the images skipped by the previous run were converted before it.
+func converted(previous map[string]BatchRecord, item BatchItem) bool {
+	record, ok := previous[item.Source+" "+item.Target]
+	return ok && (record.Status == BatchStatusSucceeded || record.Status == BatchStatusSkipped)
+}
+
+func dumpBatchStatus(path string, report *BatchReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal batch status")
+	}
+	// Write to a temporary file then rename it, to avoid leaving a
+	// corrupted status file if nydusify is interrupted.
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.Wrap(err, "write batch status file")
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func batchHosts(opt Opt, items []BatchItem) remote.HostFunc {
+	maps := map[string]bool{
+		opt.ChunkDictRef: opt.ChunkDictInsecure,
+		opt.CacheRef:     opt.CacheInsecure,
+	}
+	for _, item := range items {
+		maps[item.Source] = opt.SourceInsecure
+		maps[item.Target] = opt.TargetInsecure
+		if item.CacheRef != "" {
+			maps[item.CacheRef] = opt.CacheInsecure
+		}
+	}
+	return func(ref string) (remote.CredentialFunc, bool, error) {
+		return auth.CredFunc, maps[ref], nil
+	}
+}
+
+// BatchConvert converts images in one process, the content store of the
+// provider is shared to reuse the pulled layers between images. A failed
+// image doesn't interrupt the others, an error is returned if any image
+// failed after all the images are handled.
+func BatchConvert(ctx context.Context, opt Opt, items []BatchItem, batchOpt BatchOpt) (*BatchReport, error) {
+	ctx = namespaces.WithNamespace(ctx, "nydusify")
+	platformMC, err := platformutil.ParsePlatforms(opt.AllPlatforms, opt.Platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.Target == "" {
+			return nil, fmt.Errorf("target image reference is empty for source %s", item.Source)
+		}
+	}
+
+	previous, err := loadBatchStatus(batchOpt.StatusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The converted images are skipped in disk space estimation.
+	sources := []string{}
+	for _, item := range items {
+		if !converted(previous, item) {
+			sources = append(sources, item.Source)
+		}
+	}
+	ws, pvd, err := newWorkspace(ctx, &opt, func(contentDir string) (*provider.Provider, error) {
+		return newProvider(opt, contentDir, batchHosts(opt, items), platformMC, sources)
+	}, platformMC, sources, batchOpt.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Cleanup()
+
+	concurrency := batchOpt.Concurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+
+	report := &BatchReport{Records: make([]BatchRecord, len(items))}
+	var mutex sync.Mutex
+	update := func(idx int, record BatchRecord) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		report.Records[idx] = record
+		if batchOpt.StatusPath != "" {
+			if err := dumpBatchStatus(batchOpt.StatusPath, report); err != nil {
+				logrus.WithError(err).Warnf("update batch status file %s", batchOpt.StatusPath)
+			}
+		}
+	}
+
+	eg := errgroup.Group{}
+	eg.SetLimit(int(concurrency))
+	for idx := range items {
+		idx, item := idx, items[idx]
+		if converted(previous, item) {
+			logrus.Infof("[%d/%d] skip image %s which has been converted", idx+1, len(items), item.Source)
+			record := previous[item.Source+" "+item.Target]
+			record.Status = BatchStatusSkipped
+			update(idx, record)
+			continue
+		}
+		eg.Go(func() error {
+			itemOpt := opt
+			itemOpt.Source = item.Source
+			itemOpt.Target = item.Target
+			itemOpt.CacheRef = item.CacheRef
+			// Metrics of each image are recorded in the batch report.
+			itemOpt.OutputJSON = ""
+
+			logrus.Infof("[%d/%d] converting image %s to %s", idx+1, len(items), item.Source, item.Target)
+			start := time.Now()
+			record := BatchRecord{BatchItem: item, Status: BatchStatusSucceeded}
+			prov, err := convert(ctx, itemOpt, pvd, platformMC)
+			if err != nil {
+				logrus.WithError(err).Errorf("[%d/%d] failed to convert image %s", idx+1, len(items), item.Source)
+				record.Status = BatchStatusFailed
+				record.Error = err.Error()
+			} else {
+				record.Provenance = prov
+				logrus.Infof("[%d/%d] converted image %s to %s", idx+1, len(items), item.Source, item.Target)
+			}
+			record.Duration = time.Since(start).String()
+			update(idx, record)
+			return nil
+		})
+	}
+	eg.Wait()
+
+	for _, record := range report.Records {
+		switch record.Status {
+		case BatchStatusSucceeded:
+			report.Succeeded++
+		case BatchStatusFailed:
+			report.Failed++
+		case BatchStatusSkipped:
+			report.Skipped++
+		}
+	}
+	if batchOpt.StatusPath != "" {
+		if err := dumpBatchStatus(batchOpt.StatusPath, report); err != nil {
+			return report, err
+		}
+	}
+	if opt.OutputJSON != "" {
+		if err := os.MkdirAll(filepath.Dir(opt.OutputJSON), 0755); err == nil {
+			if err := dumpBatchStatus(opt.OutputJSON, report); err != nil {
+				logrus.WithError(err).Warnf("dump batch report to %s", opt.OutputJSON)
+			}
+		}
+	}
+
+	logrus.Infof("Batch conversion finished, succeeded: %d, failed: %d, skipped: %d", report.Succeeded, report.Failed, report.Skipped)
+	if report.Failed > 0 {
+		return report, fmt.Errorf("failed to convert %d of %d images", report.Failed, len(items))
+	}
+
+	return report, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchList(t *testing.T) {
+	list := `
+# images to convert
+docker.io/library/nginx:latest
+docker.io/library/busybox:latest  localhost:5000/busybox:nydus
+  ghcr.io/dragonflyoss/image:v1
+`
+	items, err := ParseBatchList(strings.NewReader(list), nil)
+	require.NoError(t, err)
+	require.Equal(t, []BatchItem{
+		{Source: "docker.io/library/nginx:latest"},
+		{Source: "docker.io/library/busybox:latest", Target: "localhost:5000/busybox:nydus"},
+		{Source: "ghcr.io/dragonflyoss/image:v1"},
+	}, items)
+
+	items, err = ParseBatchList(strings.NewReader(list), regexp.MustCompile(`^docker\.io/`))
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	_, err = ParseBatchList(strings.NewReader("a b c"), nil)
+	require.Error(t, err)
+}
+
+func TestBatchStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+
+	records, err := loadBatchStatus(path)
+	require.NoError(t, err)
+	require.Empty(t, records)
+
+	report := &BatchReport{
+		Records: []BatchRecord{
+			{BatchItem: BatchItem{Source: "a", Target: "a-nydus"}, Status: BatchStatusSucceeded},
+			{BatchItem: BatchItem{Source: "b", Target: "b-nydus"}, Status: BatchStatusFailed, Error: "failed"},
+		},
+	}
+	require.NoError(t, dumpBatchStatus(path, report))
+
+	records, err = loadBatchStatus(path)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, BatchStatusSucceeded, records["a a-nydus"].Status)
+	require.Equal(t, "failed", records["b b-nydus"].Error)
+}
+
+func TestBatchConvertResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	items := []BatchItem{
+		{Source: "localhost:5000/a:latest", Target: "localhost:5000/a:nydus"},
+		{Source: "localhost:5000/b:latest", Target: "localhost:5000/b:nydus"},
+	}
+	report := &BatchReport{Records: []BatchRecord{
+		{BatchItem: items[0], Status: BatchStatusSucceeded},
+		{BatchItem: items[1], Status: BatchStatusSucceeded},
+	}}
+	require.NoError(t, dumpBatchStatus(path, report))
+
+	// The converted images are still skipped by the second resume.
+	opt := Opt{WorkDir: t.TempDir(), SkipSpaceCheck: true}
+	for i := 0; i < 2; i++ {
+		report, err := BatchConvert(context.Background(), opt, items, BatchOpt{StatusPath: path})
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Skipped)
+		require.Zero(t, report.Succeeded)
+		require.Zero(t, report.Failed)
+	}
+}
@@ -0,0 +1,345 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	nydusConverter "github.com/containerd/nydus-snapshotter/pkg/converter"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// convertRefPrefix is the ingest reference prefix of the nydus blob built
+// from a source layer by nydus-snapshotter, followed by the layer digest.
+const convertRefPrefix = "convert-nydus-from-"
+
+// Checkpoint persists the progress of converting an image under the work
+// directory, along with the content store holding the pulled source layers
+// and the built blobs, so that an interrupted conversion is resumed from the
+// completed layers instead of from scratch.
+type Checkpoint struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// SourceDigest is the digest of source image resolved by the latest
+	// attempt, a warning is logged if the source image is changed.
+	SourceDigest digest.Digest `json:"source_digest,omitempty"`
+	// PulledLayers are the source layers downloaded into the content store.
+	PulledLayers []digest.Digest `json:"pulled"`
+	// PushedLayers are the layers pushed to the target repository.
+	PushedLayers []digest.Digest `json:"pushed"`
+	// ConvertedLayers maps the source layers to the nydus blobs built from
+	// them into the content store, which are reused instead of rebuilt.
+	ConvertedLayers map[digest.Digest]digest.Digest `json:"converted,omitempty"`
+	// BuildConfig is the digest of build options, the converted layers are
+	// discarded if the options are changed since the checkpoint.
+	BuildConfig digest.Digest `json:"build_config,omitempty"`
+
+	dir    string
+	mutex  sync.Mutex
+	pulled map[digest.Digest]bool
+	pushed map[digest.Digest]bool
+}
+
+// checkpointDir returns the directory of checkpoint, which is unique for
+// each pair of source and target under the work directory.
+func checkpointDir(workDir, source, target string) string {
+	key := digest.FromString(source + "\n" + target).Encoded()[:16]
+	return filepath.Join(workDir, fmt.Sprintf("nydusify-checkpoint-%s", key))
+}
+
+// LoadCheckpoint loads the checkpoint of converting source to target from
+// the work directory, a new one is created if not found.
+func LoadCheckpoint(workDir, source, target string) (*Checkpoint, error) {
+	source, err := normalizeReference(source)
+	if err != nil {
+		return nil, err
+	}
+	target, err = normalizeReference(target)
+	if err != nil {
+		return nil, err
+	}
+
+	ckpt := &Checkpoint{
+		Source: source,
+		Target: target,
+		dir:    checkpointDir(workDir, source, target),
+		pulled: map[digest.Digest]bool{},
+		pushed: map[digest.Digest]bool{},
+	}
+	data, err := os.ReadFile(filepath.Join(ckpt.dir, checkpointFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ckpt, os.MkdirAll(ckpt.dir, 0755)
+		}
+		return nil, errors.Wrap(err, "read checkpoint")
+	}
+	if err := json.Unmarshal(data, ckpt); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal checkpoint %s", ckpt.dir)
+	}
+	for _, dgst := range ckpt.PulledLayers {
+		ckpt.pulled[dgst] = true
+	}
+	for _, dgst := range ckpt.PushedLayers {
+		ckpt.pushed[dgst] = true
+	}
+	logrus.Infof("resume conversion from checkpoint %s: %d layers pulled, %d layers converted, %d layers pushed", ckpt.dir, len(ckpt.pulled), len(ckpt.ConvertedLayers), len(ckpt.pushed))
+
+	return ckpt, nil
+}
+
+// Dir returns the directory of checkpoint, which is used as the content
+// directory of provider.
+func (ckpt *Checkpoint) Dir() string {
+	return ckpt.dir
+}
+
+// Remove removes the checkpoint and the content store after the conversion
+// is finished.
+func (ckpt *Checkpoint) Remove() error {
+	return os.RemoveAll(ckpt.dir)
+}
+
+func (ckpt *Checkpoint) Resolved(ref string, desc ocispec.Descriptor) {
+	if ref != ckpt.Source {
+		return
+	}
+
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	if ckpt.SourceDigest == desc.Digest {
+		return
+	}
+	if ckpt.SourceDigest != "" {
+		// The pushed layers are addressed by content, so they are
+		// still valid for the changed source image.
+		logrus.Warnf("source image is changed from %s to %s since the checkpoint", ckpt.SourceDigest, desc.Digest)
+	}
+	ckpt.SourceDigest = desc.Digest
+	ckpt.save()
+}
+
+func (ckpt *Checkpoint) Pulled(ref string, desc ocispec.Descriptor) {
+	if ref != ckpt.Source {
+		return
+	}
+
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	if ckpt.pulled[desc.Digest] {
+		return
+	}
+	ckpt.pulled[desc.Digest] = true
+	ckpt.save()
+}
+
+func (ckpt *Checkpoint) Pushed(ref string, desc ocispec.Descriptor) {
+	if ref != ckpt.Target {
+		return
+	}
+
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	if ckpt.pushed[desc.Digest] {
+		return
+	}
+	ckpt.pushed[desc.Digest] = true
+	ckpt.save()
+}
+
+func (ckpt *Checkpoint) IsPushed(ref string, desc ocispec.Descriptor) bool {
+	if ref != ckpt.Target {
+		return false
+	}
+
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	return ckpt.pushed[desc.Digest]
+}
+
+// SetBuildConfig records the digest of build options, the layers converted
+// with the different options are built again.
+func (ckpt *Checkpoint) SetBuildConfig(config digest.Digest) {
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	if ckpt.BuildConfig == config {
+		return
+	}
+	if ckpt.BuildConfig != "" && len(ckpt.ConvertedLayers) > 0 {
+		logrus.Warnf("build options are changed since the checkpoint, %d converted layers are built again", len(ckpt.ConvertedLayers))
+		ckpt.ConvertedLayers = nil
+	}
+	ckpt.BuildConfig = config
+	ckpt.save()
+}
+
+// Converted records the nydus blob built from the source layer.
+func (ckpt *Checkpoint) Converted(source, blob digest.Digest) {
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	if ckpt.ConvertedLayers[source] == blob {
+		return
+	}
+	if ckpt.ConvertedLayers == nil {
+		ckpt.ConvertedLayers = map[digest.Digest]digest.Digest{}
+	}
+	ckpt.ConvertedLayers[source] = blob
+	ckpt.save()
+}
+
+func (ckpt *Checkpoint) convertedBlob(source digest.Digest) (digest.Digest, bool) {
+	ckpt.mutex.Lock()
+	defer ckpt.mutex.Unlock()
+	blob, ok := ckpt.ConvertedLayers[source]
+	return blob, ok
+}
+
+// ContentStore wraps the content store of provider to record the nydus blobs
+// built by the conversion.
+func (ckpt *Checkpoint) ContentStore(store content.Store) content.Store {
+	return &checkpointStore{Store: store, ckpt: ckpt}
+}
+
+// buildConfigDigest returns the digest of the options affecting the built
+// blobs, the work directory is excluded as it's a new temp directory for
+// each attempt.
+func buildConfigDigest(opt Opt) (digest.Digest, error) {
+	cfg := getConfig(opt)
+	delete(cfg, "work_dir")
+	cfg["target_format"] = opt.TargetFormat
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal build options")
+	}
+	return digest.FromBytes(data), nil
+}
+
+// checkpointStore records the nydus blobs committed into the content store,
+// and labels the source layers converted by the previous attempts with the
+// target digest, so that the nydus-snapshotter converter reuses the built
+// blobs as the layers found in the remote cache.
+type checkpointStore struct {
+	content.Store
+	ckpt *Checkpoint
+}
+
+func (store *checkpointStore) Info(ctx context.Context, dgst digest.Digest) (content.Info, error) {
+	info, err := store.Store.Info(ctx, dgst)
+	if err != nil || info.Labels[nydusConverter.LayerAnnotationNydusTargetDigest] != "" {
+		return info, err
+	}
+	blob, ok := store.ckpt.convertedBlob(dgst)
+	if !ok {
+		return info, nil
+	}
+	if _, err := store.Store.Info(ctx, blob); err != nil {
+		// The blob is built again if it's lost from the content store.
+		return info, nil
+	}
+
+	logrus.Infof("reuse nydus blob %s converted from layer %s by previous attempt", blob, dgst)
+	labels := maps.Clone(info.Labels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[nydusConverter.LayerAnnotationNydusTargetDigest] = blob.String()
+	info.Labels = labels
+	return info, nil
+}
+
+func (store *checkpointStore) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	writer, err := store.Store.Writer(ctx, opts...)
+	if err != nil || !strings.HasPrefix(wOpts.Ref, convertRefPrefix) {
+		return writer, err
+	}
+	source, err := digest.Parse(strings.TrimPrefix(wOpts.Ref, convertRefPrefix))
+	if err != nil {
+		return writer, nil
+	}
+	return &checkpointWriter{Writer: writer, ckpt: store.ckpt, source: source}, nil
+}
+
+// checkpointWriter records the nydus blob built from the source layer once
+// it's committed.
+type checkpointWriter struct {
+	content.Writer
+	ckpt   *Checkpoint
+	source digest.Digest
+}
+
+func (writer *checkpointWriter) Commit(ctx context.Context, size int64, expected digest.Digest, opts ...content.Opt) error {
+	blob := expected
+	if blob == "" {
+		blob = writer.Digest()
+	}
+	err := writer.Writer.Commit(ctx, size, expected, opts...)
+	if err == nil || errdefs.IsAlreadyExists(err) {
+		writer.ckpt.Converted(writer.source, blob)
+	}
+	return err
+}
+
+func sortedDigests(digests map[digest.Digest]bool) []digest.Digest {
+	sorted := make([]digest.Digest, 0, len(digests))
+	for dgst := range digests {
+		sorted = append(sorted, dgst)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// save writes the checkpoint file atomically, the failure only loses the
+// progress, so it's logged instead of failing the conversion.
+func (ckpt *Checkpoint) save() {
+	ckpt.PulledLayers = sortedDigests(ckpt.pulled)
+	ckpt.PushedLayers = sortedDigests(ckpt.pushed)
+	data, err := json.MarshalIndent(ckpt, "", "  ")
+	if err != nil {
+		logrus.WithError(err).Warn("marshal checkpoint")
+		return
+	}
+
+	path := filepath.Join(ckpt.dir, checkpointFileName)
+	file, err := os.CreateTemp(ckpt.dir, checkpointFileName+".*.tmp")
+	if err != nil {
+		logrus.WithError(err).Warn("create checkpoint file")
+		return
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		logrus.WithError(err).Warnf("write checkpoint %s", path)
+		return
+	}
+	if err := file.Close(); err != nil {
+		logrus.WithError(err).Warnf("write checkpoint %s", path)
+		return
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		logrus.WithError(err).Warnf("write checkpoint %s", path)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	nydusConverter "github.com/containerd/nydus-snapshotter/pkg/converter"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+)
+
+func TestCheckpoint(t *testing.T) {
+	workDir := t.TempDir()
+	source := "docker.io/library/nginx:latest"
+	target := "localhost:5000/nginx:latest-nydus"
+
+	ckpt, err := LoadCheckpoint(workDir, "nginx:latest", "localhost:5000/nginx:latest-nydus")
+	require.NoError(t, err)
+	require.DirExists(t, ckpt.Dir())
+	require.Equal(t, source, ckpt.Source)
+
+	image := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest")}
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer")}
+	blob := ocispec.Descriptor{MediaType: "application/vnd.oci.image.layer.nydus.blob.v1", Digest: digest.FromString("blob")}
+	ckpt.Resolved(source, image)
+	ckpt.Pulled(source, layer)
+	// The chunk dict image is not recorded.
+	ckpt.Pulled("docker.io/library/dict:latest", ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("dict")})
+	ckpt.Pushed(target, blob)
+	require.True(t, ckpt.IsPushed(target, blob))
+	require.False(t, ckpt.IsPushed(target, layer))
+	require.False(t, ckpt.IsPushed("localhost:5000/other:latest", blob))
+
+	// The progress is resumed by the next attempt.
+	resumed, err := LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	require.Equal(t, ckpt.Dir(), resumed.Dir())
+	require.Equal(t, image.Digest, resumed.SourceDigest)
+	require.Equal(t, []digest.Digest{layer.Digest}, resumed.PulledLayers)
+	require.Equal(t, []digest.Digest{blob.Digest}, resumed.PushedLayers)
+	require.True(t, resumed.IsPushed(target, blob))
+
+	// The checkpoint of another target is independent.
+	other, err := LoadCheckpoint(workDir, source, "localhost:5000/other:latest")
+	require.NoError(t, err)
+	require.NotEqual(t, ckpt.Dir(), other.Dir())
+	require.False(t, other.IsPushed("localhost:5000/other:latest", blob))
+
+	require.NoError(t, resumed.Remove())
+	_, err = os.Stat(filepath.Join(ckpt.Dir(), checkpointFileName))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestCheckpointSourceChanged(t *testing.T) {
+	workDir := t.TempDir()
+	source := "docker.io/library/nginx:latest"
+	target := "localhost:5000/nginx:latest-nydus"
+
+	image := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest")}
+	layer := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageLayerGzip, Digest: digest.FromString("layer")}
+	blob := ocispec.Descriptor{MediaType: "application/vnd.oci.image.layer.nydus.blob.v1", Digest: digest.FromString("blob")}
+
+	// The source digest is recorded before the interrupted attempt pulls
+	// all the layers.
+	ckpt, err := LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	ckpt.Resolved(source, image)
+	ckpt.Pulled(source, layer)
+	ckpt.Pushed(target, blob)
+
+	// The source image is changed before the next attempt.
+	resumed, err := LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	require.Equal(t, image.Digest, resumed.SourceDigest)
+	changed := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString("index")}
+	resumed.Resolved(source, changed)
+	require.Equal(t, changed.Digest, resumed.SourceDigest)
+	require.True(t, resumed.IsPushed(target, blob))
+
+	resumed, err = LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	require.Equal(t, changed.Digest, resumed.SourceDigest)
+	require.Equal(t, []digest.Digest{layer.Digest}, resumed.PulledLayers)
+	require.Equal(t, []digest.Digest{blob.Digest}, resumed.PushedLayers)
+}
+
+func TestCheckpointConvertedLayer(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+	workDir := t.TempDir()
+	source := "docker.io/library/nginx:latest"
+	target := "localhost:5000/nginx:latest-nydus"
+	buildConfig, err := buildConfigDigest(Opt{WorkDir: workDir, FsVersion: "6"})
+	require.NoError(t, err)
+
+	ckpt, err := LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	ckpt.SetBuildConfig(buildConfig)
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := provider.New(ckpt.Dir(), hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+
+	// The builder doesn't exist, so the layer fails to be built.
+	cs := ckpt.ContentStore(pvd.ContentStore())
+	layer := writeTestBlob(t, cs, ocispec.MediaTypeImageLayerGzip, []byte("layer"))
+	convert := nydusConverter.LayerConvertFunc(nydusConverter.PackOption{
+		BuilderPath: filepath.Join(workDir, "nydus-image"),
+	})
+	_, err = convert(ctx, cs, layer)
+	require.Error(t, err)
+
+	// The nydus blob built by the interrupted attempt is recorded.
+	data := []byte("blob")
+	blob := ocispec.Descriptor{MediaType: nydusConverter.MediaTypeNydusBlob, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	require.NoError(t, content.WriteBlob(ctx, cs, convertRefPrefix+layer.Digest.String(), bytes.NewReader(data), blob))
+	require.Equal(t, map[digest.Digest]digest.Digest{layer.Digest: blob.Digest}, ckpt.ConvertedLayers)
+
+	// The layer converted by previous attempt isn't built again.
+	resumed, err := LoadCheckpoint(workDir, source, target)
+	require.NoError(t, err)
+	resumed.SetBuildConfig(buildConfig)
+	converted, err := convert(ctx, resumed.ContentStore(pvd.ContentStore()), layer)
+	require.NoError(t, err)
+	require.Equal(t, blob.Digest, converted.Digest)
+	require.Equal(t, blob.Size, converted.Size)
+
+	// The layer is built again with the changed build options.
+	changed, err := buildConfigDigest(Opt{WorkDir: t.TempDir(), FsVersion: "5"})
+	require.NoError(t, err)
+	require.NotEqual(t, buildConfig, changed)
+	resumed.SetBuildConfig(changed)
+	require.Empty(t, resumed.ConvertedLayers)
+	_, err = convert(ctx, resumed.ContentStore(pvd.ContentStore()), layer)
+	require.Error(t, err)
+}
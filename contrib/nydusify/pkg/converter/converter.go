@@ -6,28 +6,60 @@ package converter
 
 import (
 	"context"
-	"os"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/annotation"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/signature"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/goharbor/acceleration-service/pkg/content"
 	"github.com/goharbor/acceleration-service/pkg/converter"
 	"github.com/goharbor/acceleration-service/pkg/platformutil"
+	"github.com/goharbor/acceleration-service/pkg/remote"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	TargetFormatNydus   = "nydus"
+	TargetFormatEstargz = "estargz"
 )
 
 type Opt struct {
-	WorkDir           string
+	WorkDir string
+	// TempDirs are the extra directories to spread the temp directories
+	// across volumes, the directory with the most available space is used.
+	TempDirs []string
+	// SkipSpaceCheck disables checking the available disk space of work
+	// directories before conversion.
+	SkipSpaceCheck    bool
 	ContainerdAddress string
 	NydusImagePath    string
 
 	Source       string
 	Target       string
 	ChunkDictRef string
+	// TargetFormat is the format of target image, possible values: 'nydus',
+	// 'estargz', default to 'nydus'. The nydus specific options are ignored
+	// for the estargz format.
+	TargetFormat string
 
 	SourceInsecure    bool
 	TargetInsecure    bool
 	ChunkDictInsecure bool
 
+	// PullConcurrency limits the concurrent layer downloads of source image,
+	// PullRetries is the number of attempts to resume an interrupted layer
+	// download with HTTP range request.
+	PullConcurrency uint
+	PullRetries     uint
+
 	CacheRef        string
 	CacheInsecure   bool
 	CacheVersion    string
@@ -47,11 +79,72 @@ type Opt struct {
 	PrefetchPatterns string
 	OCIRef           bool
 	WithReferrer     bool
+	// ForeignLayerPolicy handles the non-distributable layers of source
+	// image, possible values: 'convert', 'skip', 'fail', default to 'convert'.
+	ForeignLayerPolicy string
+	// AnnotatePrefetch stores the prefetch patterns in the annotation of
+	// target image, which is read by the snapshotter at runtime.
+	AnnotatePrefetch bool
+	// Annotations are added to the manifest (or index) of target image,
+	// after the annotations inherited from source image are transformed by
+	// AnnotationPolicy.
+	Annotations      map[string]string
+	AnnotationPolicy *annotation.Policy
+	// AuditWhiteout logs how the whiteouts and opaque directories of source
+	// layers are translated, and warns the suspicious ones.
+	AuditWhiteout bool
+	// PathRules drops or moves the entries of source layers before
+	// conversion, the affected entries are recorded in the report.
+	PathRules *PathRules
 
 	AllPlatforms bool
 	Platforms    string
 
 	OutputJSON string
+
+	// Signer signs the target image after pushing if SignTarget is enabled,
+	// and verifies the source image before conversion if VerifySource is enabled.
+	Signer       *signature.Signer
+	SignTarget   bool
+	VerifySource bool
+
+	// Hooks are invoked at the pre-layer, post-layer and pre-push stages
+	// of conversion, see package hook for the details.
+	Hooks []hook.ConvertHook
+
+	// TrustPolicy restricts the source images allowed to be converted,
+	// no restriction if it's nil.
+	TrustPolicy *TrustPolicy
+
+	// AttachProvenance attaches the SLSA provenance of conversion to the
+	// target image as an OCI referrer after pushing, SBOMPath is the SBOM
+	// document attached in the same way, e.g. generated from source image.
+	AttachProvenance bool
+	SBOMPath         string
+	// ToolVersion is the nydusify version recorded in the provenance.
+	ToolVersion string
+
+	// Checkpoint keeps the pulled layers and the converted blobs, and
+	// records the pushed layers under the work directory, so that an
+	// interrupted conversion is resumed by running the same command again.
+	Checkpoint bool
+}
+
+// newProvider creates the provider of conversion, the pulled source images
+// are checked by the trust policy.
+func newProvider(opt Opt, contentDir string, hosts remote.HostFunc, platformMC platforms.MatchComparer, sources []string) (*provider.Provider, error) {
+	pvd, err := provider.New(contentDir, hosts, opt.CacheMaxRecords, opt.CacheVersion, platformMC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if opt.TrustPolicy != nil {
+		verifier, err := opt.TrustPolicy.imageVerifier(sources)
+		if err != nil {
+			return nil, err
+		}
+		pvd.SetImageVerifier(verifier)
+	}
+	return pvd, nil
 }
 
 func Convert(ctx context.Context, opt Opt) error {
@@ -61,40 +154,202 @@ func Convert(ctx context.Context, opt Opt) error {
 		return err
 	}
 
-	if _, err := os.Stat(opt.WorkDir); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			if err := os.MkdirAll(opt.WorkDir, 0755); err != nil {
-				return errors.Wrap(err, "prepare work directory")
+	pvdFunc := func(contentDir string) (*provider.Provider, error) {
+		return newProvider(opt, contentDir, hosts(opt), platformMC, []string{opt.Source})
+	}
+	var ckpt *Checkpoint
+	if opt.Checkpoint {
+		if ckpt, err = LoadCheckpoint(opt.WorkDir, opt.Source, opt.Target); err != nil {
+			return errors.Wrap(err, "load checkpoint")
+		}
+		// The content store is kept in the checkpoint directory instead
+		// of the temp directory removed on failure.
+		pvdFunc = func(string) (*provider.Provider, error) {
+			pvd, err := newProvider(opt, ckpt.Dir(), hosts(opt), platformMC, []string{opt.Source})
+			if err != nil {
+				return nil, err
+			}
+			pvd.SetProgress(ckpt)
+			// The blobs pushed to the storage backend are built again,
+			// as they may be interrupted before the pushing is done.
+			if opt.BackendType == "" {
+				pvd.SetContentStore(ckpt.ContentStore(pvd.ContentStore()))
 			}
-			// We should only clean up when the work directory not exists
-			// before, otherwise it may delete user data by mistake.
-			defer os.RemoveAll(opt.WorkDir)
-		} else {
-			return errors.Wrap(err, "stat work directory")
+			return pvd, nil
+		}
+		buildConfig, err := buildConfigDigest(opt)
+		if err != nil {
+			return err
+		}
+		ckpt.SetBuildConfig(buildConfig)
+	}
+
+	ws, pvd, err := newWorkspace(ctx, &opt, pvdFunc, platformMC, []string{opt.Source}, 1)
+	if err != nil {
+		return err
+	}
+	defer ws.Cleanup()
+
+	if _, err = convert(ctx, opt, pvd, platformMC); err != nil {
+		return err
+	}
+	if ckpt != nil {
+		if err := ckpt.Remove(); err != nil {
+			logrus.WithError(err).Warnf("remove checkpoint %s", ckpt.Dir())
 		}
 	}
-	tmpDir, err := os.MkdirTemp(opt.WorkDir, "nydusify-")
+	return nil
+}
+
+// provenance returns the digests of the pulled source image and the pushed
+// target image.
+func provenance(ctx context.Context, opt Opt, pvd *provider.Provider) (*Provenance, error) {
+	source, err := normalizeReference(opt.Source)
 	if err != nil {
-		return errors.Wrap(err, "create temp directory")
+		return nil, err
 	}
-	pvd, err := provider.New(tmpDir, hosts(opt), opt.CacheMaxRecords, opt.CacheVersion, platformMC, 0)
+	target, err := normalizeReference(opt.Target)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	sourceDesc, err := pvd.Image(ctx, source)
+	if err != nil {
+		return nil, errors.Wrap(err, "get source image")
+	}
+	targetDesc, err := pvd.PushedImage(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "get target image")
+	}
+	return &Provenance{
+		Source:       opt.Source,
+		SourceDigest: sourceDesc.Digest,
+		Target:       opt.Target,
+		TargetDigest: targetDesc.Digest,
+	}, nil
+}
+
+func convert(ctx context.Context, opt Opt, pvd *provider.Provider, platformMC platforms.MatchComparer) (*Provenance, error) {
+	startedOn := time.Now()
+
+	if opt.TrustPolicy != nil {
+		if err := opt.TrustPolicy.CheckSource(opt.Source); err != nil {
+			return nil, utils.WithExitCode(utils.ExitCodeValidation, err)
+		}
+	}
+
+	if opt.VerifySource && opt.Signer != nil {
+		dgst, err := opt.Signer.Verify(ctx, opt.Source, opt.SourceInsecure)
+		if err != nil {
+			return nil, errors.Wrap(err, "verify source image")
+		}
+		// Pull the verified manifest instead of resolving the tag again,
+		// which may be moved after the verification.
+		source, err := normalizeReference(opt.Source)
+		if err != nil {
+			return nil, err
+		}
+		pvd.Pin(source, dgst)
+	}
+
+	if opt.ForeignLayerPolicy != "" && !slices.Contains(ForeignLayerPolicies, opt.ForeignLayerPolicy) {
+		return nil, utils.WithExitCode(utils.ExitCodeValidation, fmt.Errorf("invalid foreign layer policy %q, possible values: %v", opt.ForeignLayerPolicy, ForeignLayerPolicies))
+	}
+
+	targetFormat := opt.TargetFormat
+	if targetFormat == "" {
+		targetFormat = TargetFormatNydus
+	}
+	fsOption := utils.FsOption{
+		FsVersion:  opt.FsVersion,
+		Compressor: opt.Compressor,
+		ChunkSize:  opt.ChunkSize,
+		BatchSize:  opt.BatchSize,
+	}
+	if targetFormat == TargetFormatNydus {
+		if err := fsOption.Validate(); err != nil {
+			return nil, utils.WithExitCode(utils.ExitCodeValidation, errors.Wrap(err, "invalid build option"))
+		}
+		if opt.OCIRef && opt.FsVersion == "5" {
+			return nil, utils.WithExitCode(utils.ExitCodeValidation, errors.New("OCI reference image requires fs version 6"))
+		}
+		if opt.OCIRef && opt.PathRules != nil {
+			return nil, utils.WithExitCode(utils.ExitCodeValidation, errors.New("OCI reference image is unable to be built from the layers rewritten by path rules"))
+		}
+	}
+
+	if opt.PullConcurrency > 0 {
+		pvd.SetPullConcurrency(int(opt.PullConcurrency))
+	}
+	pvd.SetPullRetries(int(opt.PullRetries))
+
+	lp, err := newLayerProvider(opt, pvd, platformMC)
+	if err != nil {
+		return nil, err
+	}
+	var cvtProvider content.Provider = lp
+	if len(opt.Hooks) > 0 {
+		hp, err := newHookProvider(opt, lp, platformMC)
+		if err != nil {
+			return nil, err
+		}
+		cvtProvider = hp
+	}
+	annotations := map[string]string{}
+	if targetFormat == TargetFormatNydus {
+		// Record the runtime requirements of image, so that the runtime is
+		// able to reject the image unsupported by the local nydusd.
+		maps.Copy(annotations, fsOption.Requirements(opt.OCIRef).Annotations())
+	}
+	maps.Copy(annotations, opt.Annotations)
+	if opt.AnnotatePrefetch && targetFormat == TargetFormatNydus {
+		maps.Copy(annotations, prefetchAnnotations(opt.PrefetchPatterns))
+	}
+	if len(annotations) > 0 || opt.AnnotationPolicy != nil {
+		ap, err := newAnnotationProvider(opt, cvtProvider, annotations)
+		if err != nil {
+			return nil, err
+		}
+		cvtProvider = ap
 	}
-	defer os.RemoveAll(tmpDir)
 
 	cvt, err := converter.New(
-		converter.WithProvider(pvd),
-		converter.WithDriver("nydus", getConfig(opt)),
+		converter.WithProvider(cvtProvider),
+		converter.WithDriver(targetFormat, getConfig(opt)),
 		converter.WithPlatform(platformMC),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	metric, err := cvt.Convert(ctx, opt.Source, opt.Target, opt.CacheRef)
+	var prov *Provenance
+	if err == nil {
+		var provErr error
+		if prov, provErr = provenance(ctx, opt, pvd); provErr != nil {
+			logrus.WithError(provErr).Warn("get provenance of converted image")
+		}
+	}
 	if opt.OutputJSON != "" {
-		dumpMetric(metric, opt.OutputJSON)
+		dumpMetric(metric, prov, lp.records, opt.OutputJSON)
 	}
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	if opt.AttachProvenance || opt.SBOMPath != "" {
+		if err := attach(ctx, opt, pvd, prov, startedOn); err != nil {
+			return nil, errors.Wrap(err, "attach attestations to target image")
+		}
+	}
+
+	if opt.SignTarget && opt.Signer != nil {
+		if prov == nil {
+			return nil, errors.New("sign target image: digest of pushed target image is unknown")
+		}
+		if err := opt.Signer.Sign(ctx, opt.Target, prov.TargetDigest, opt.TargetInsecure); err != nil {
+			return nil, errors.Wrap(err, "sign target image")
+		}
+	}
+
+	return prov, nil
 }
@@ -0,0 +1,355 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
+)
+
+// hookProvider wraps the provider to invoke the convert hooks, the pre-layer
+// hooks are invoked after pulling the source image, the post-layer and
+// pre-push hooks are invoked before pushing the target image.
+type hookProvider struct {
+	sourceProvider
+	hooks      []hook.ConvertHook
+	platformMC platforms.MatchComparer
+
+	// source and target are the normalized references.
+	source string
+	target string
+	// sourceRef and targetRef are the references passed to hooks.
+	sourceRef string
+	targetRef string
+	// image is the source image rewritten by pre-layer hooks.
+	image *ocispec.Descriptor
+}
+
+func newHookProvider(opt Opt, pvd sourceProvider, platformMC platforms.MatchComparer) (*hookProvider, error) {
+	source, err := docker.ParseDockerRef(opt.Source)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source reference")
+	}
+	target, err := docker.ParseDockerRef(opt.Target)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse target reference")
+	}
+	return &hookProvider{
+		sourceProvider: pvd,
+		hooks:          opt.Hooks,
+		platformMC:     platformMC,
+		source:         source.String(),
+		target:         target.String(),
+		sourceRef:      opt.Source,
+		targetRef:      opt.Target,
+	}, nil
+}
+
+func (hp *hookProvider) Pull(ctx context.Context, ref string) error {
+	if err := hp.sourceProvider.Pull(ctx, ref); err != nil {
+		return err
+	}
+	// The provider also pulls the chunk dict image.
+	if ref != hp.source {
+		return nil
+	}
+
+	image, err := hp.sourceProvider.Image(ctx, ref)
+	if err != nil {
+		return err
+	}
+	rewritten, err := hp.walk(ctx, *image, hp.preLayer)
+	if err != nil {
+		return errors.Wrap(err, "run pre-layer hooks")
+	}
+	hp.image = rewritten
+
+	return nil
+}
+
+func (hp *hookProvider) Image(ctx context.Context, ref string) (*ocispec.Descriptor, error) {
+	if ref == hp.source && hp.image != nil {
+		return hp.image, nil
+	}
+	return hp.sourceProvider.Image(ctx, ref)
+}
+
+func (hp *hookProvider) Push(ctx context.Context, desc ocispec.Descriptor, ref string) error {
+	if ref == hp.target {
+		if _, err := hp.walk(ctx, desc, hp.postLayer); err != nil {
+			return errors.Wrap(err, "run post-layer hooks")
+		}
+		if _, err := hp.run(ctx, &hook.Event{
+			Stage:    hook.StagePrePush,
+			Manifest: hp.descriptor(desc),
+		}); err != nil {
+			return errors.Wrap(err, "run pre-push hooks")
+		}
+	}
+	return hp.sourceProvider.Push(ctx, desc, ref)
+}
+
+// run invokes the hooks in order, the event is updated by the results,
+// so that the subsequent hook sees the layer replaced by previous hook.
+func (hp *hookProvider) run(ctx context.Context, event *hook.Event) (*hook.Result, error) {
+	event.SourceRef = hp.sourceRef
+	event.TargetRef = hp.targetRef
+	merged := &hook.Result{}
+	for _, h := range hp.hooks {
+		result, err := h.Run(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil && result.LayerPath != "" && event.Stage == hook.StagePreLayer {
+			// The next hook gets the replaced layer.
+			desc, err := layerDescriptor(event.Layer.MediaType, result.LayerPath)
+			if err != nil {
+				return nil, err
+			}
+			merged.LayerPath = result.LayerPath
+			event.Layer = &hook.Descriptor{
+				MediaType: desc.MediaType,
+				Digest:    desc.Digest.String(),
+				Size:      desc.Size,
+				Path:      result.LayerPath,
+			}
+		}
+	}
+	return merged, nil
+}
+
+func (hp *hookProvider) descriptor(desc ocispec.Descriptor) *hook.Descriptor {
+	path := hp.BlobPath(desc.Digest)
+	if _, err := os.Stat(path); err != nil {
+		path = ""
+	}
+	return &hook.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    desc.Digest.String(),
+		Size:      desc.Size,
+		Path:      path,
+	}
+}
+
+type manifestFunc func(ctx context.Context, desc ocispec.Descriptor, platform string) (*ocispec.Descriptor, error)
+
+// walk calls fn on each image manifest matched the platform, fn returns the
+// new manifest descriptor if the manifest is rewritten. walk returns the new
+// image descriptor if any manifest is rewritten, otherwise the original one.
+func (hp *hookProvider) walk(ctx context.Context, desc ocispec.Descriptor, fn manifestFunc) (*ocispec.Descriptor, error) {
+	return walkImage(ctx, hp.ContentStore(), hp.platformMC, desc, fn)
+}
+
+func walkImage(ctx context.Context, cs content.Store, platformMC platforms.MatchComparer, desc ocispec.Descriptor, fn manifestFunc) (*ocispec.Descriptor, error) {
+	if images.IsManifestType(desc.MediaType) {
+		rewritten, err := fn(ctx, desc, "")
+		if err != nil {
+			return nil, err
+		}
+		if rewritten != nil {
+			return rewritten, nil
+		}
+		return &desc, nil
+	}
+
+	if !images.IsIndexType(desc.MediaType) {
+		return nil, fmt.Errorf("unsupported image media type %s", desc.MediaType)
+	}
+
+	var index ocispec.Index
+	if err := readJSON(ctx, cs, desc, &index); err != nil {
+		return nil, errors.Wrap(err, "read image index")
+	}
+	changed := false
+	for idx, manifest := range index.Manifests {
+		platform := ""
+		if manifest.Platform != nil {
+			if !platformMC.Match(*manifest.Platform) {
+				continue
+			}
+			platform = platforms.Format(*manifest.Platform)
+		}
+		rewritten, err := fn(ctx, manifest, platform)
+		if err != nil {
+			return nil, err
+		}
+		if rewritten != nil {
+			index.Manifests[idx] = *rewritten
+			changed = true
+		}
+	}
+	if !changed {
+		return &desc, nil
+	}
+
+	return writeJSON(ctx, cs, desc, index)
+}
+
+func (hp *hookProvider) preLayer(ctx context.Context, desc ocispec.Descriptor, platform string) (*ocispec.Descriptor, error) {
+	cs := hp.ContentStore()
+
+	var manifest ocispec.Manifest
+	if err := readJSON(ctx, cs, desc, &manifest); err != nil {
+		return nil, errors.Wrap(err, "read image manifest")
+	}
+	var config map[string]json.RawMessage
+	if err := readJSON(ctx, cs, manifest.Config, &config); err != nil {
+		return nil, errors.Wrap(err, "read image config")
+	}
+	var rootFS ocispec.RootFS
+	if err := json.Unmarshal(config["rootfs"], &rootFS); err != nil {
+		return nil, errors.Wrap(err, "unmarshal rootfs of image config")
+	}
+	if len(rootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("unmatched layers between manifest and config: %d != %d", len(manifest.Layers), len(rootFS.DiffIDs))
+	}
+
+	changed := false
+	for idx, layer := range manifest.Layers {
+		result, err := hp.run(ctx, &hook.Event{
+			Stage:    hook.StagePreLayer,
+			Manifest: hp.descriptor(desc),
+			Platform: platform,
+			Layer:    hp.descriptor(layer),
+			Index:    idx,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "layer %s", layer.Digest)
+		}
+		if result.LayerPath == "" {
+			continue
+		}
+
+		replaced, err := ingestLayer(ctx, cs, layer, result.LayerPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "replace layer %s", layer.Digest)
+		}
+		logrus.Infof("replaced layer %s with %s by pre-layer hook", layer.Digest, replaced.Digest)
+		manifest.Layers[idx] = *replaced
+		// The digest of uncompressed tar is the diff id.
+		rootFS.DiffIDs[idx] = replaced.Digest
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	rootFSBytes, err := json.Marshal(rootFS)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal rootfs of image config")
+	}
+	config["rootfs"] = rootFSBytes
+	configDesc, err := writeJSON(ctx, cs, manifest.Config, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "write image config")
+	}
+	manifest.Config = *configDesc
+
+	return writeJSON(ctx, cs, desc, manifest)
+}
+
+func (hp *hookProvider) postLayer(ctx context.Context, desc ocispec.Descriptor, platform string) (*ocispec.Descriptor, error) {
+	var manifest ocispec.Manifest
+	if err := readJSON(ctx, hp.ContentStore(), desc, &manifest); err != nil {
+		return nil, errors.Wrap(err, "read image manifest")
+	}
+	for idx, layer := range manifest.Layers {
+		if _, err := hp.run(ctx, &hook.Event{
+			Stage:    hook.StagePostLayer,
+			Manifest: hp.descriptor(desc),
+			Platform: platform,
+			Layer:    hp.descriptor(layer),
+			Index:    idx,
+		}); err != nil {
+			return nil, errors.Wrapf(err, "layer %s", layer.Digest)
+		}
+	}
+	return nil, nil
+}
+
+// layerDescriptor calculates the descriptor of the uncompressed tar file
+// replacing the layer of origin media type.
+func layerDescriptor(originMediaType, path string) (*ocispec.Descriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open layer file")
+	}
+	defer file.Close()
+
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(digester.Hash(), file)
+	if err != nil {
+		return nil, errors.Wrap(err, "calculate layer digest")
+	}
+
+	mediaType := ocispec.MediaTypeImageLayer
+	if images.IsDockerType(originMediaType) {
+		mediaType = images.MediaTypeDockerSchema2Layer
+	}
+	return &ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digester.Digest(),
+		Size:      size,
+	}, nil
+}
+
+// ingestLayer writes the uncompressed tar file into content store,
+// returns the descriptor of the new layer.
+func ingestLayer(ctx context.Context, cs content.Store, origin ocispec.Descriptor, path string) (*ocispec.Descriptor, error) {
+	desc, err := layerDescriptor(origin.MediaType, path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open layer file")
+	}
+	defer file.Close()
+	if err := content.WriteBlob(ctx, cs, desc.Digest.String(), file, *desc); err != nil {
+		return nil, errors.Wrap(err, "write layer blob")
+	}
+
+	return desc, nil
+}
+
+func readJSON(ctx context.Context, cs content.Store, desc ocispec.Descriptor, target interface{}) error {
+	data, err := content.ReadBlob(ctx, cs, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+// writeJSON writes the object into content store, the media type and
+// annotations of the origin descriptor are retained.
+func writeJSON(ctx context.Context, cs content.Store, origin ocispec.Descriptor, obj interface{}) (*ocispec.Descriptor, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	desc := origin
+	desc.Digest = digest.FromBytes(data)
+	desc.Size = int64(len(data))
+	if err := content.WriteBlob(ctx, cs, desc.Digest.String(), bytes.NewReader(data), desc); err != nil {
+		return nil, err
+	}
+	return &desc, nil
+}
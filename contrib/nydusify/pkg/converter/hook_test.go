@@ -0,0 +1,181 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
+)
+
+type funcHook func(ctx context.Context, event *hook.Event) (*hook.Result, error)
+
+func (fn funcHook) Run(ctx context.Context, event *hook.Event) (*hook.Result, error) {
+	return fn(ctx, event)
+}
+
+func writeTestBlob(t *testing.T, cs content.Store, mediaType string, data []byte) ocispec.Descriptor {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	require.NoError(t, content.WriteBlob(namespaces.WithNamespace(context.Background(), "nydusify"), cs, desc.Digest.String(), bytes.NewReader(data), desc))
+	return desc
+}
+
+// writeTestImage writes an image manifest of two gzip layers into the
+// content store of provider.
+func writeTestImage(t *testing.T, pvd *provider.Provider) (ocispec.Descriptor, []ocispec.Descriptor) {
+	cs := pvd.ContentStore()
+	layers := []ocispec.Descriptor{
+		writeTestBlob(t, cs, ocispec.MediaTypeImageLayerGzip, []byte("layer-0")),
+		writeTestBlob(t, cs, ocispec.MediaTypeImageLayerGzip, []byte("layer-1")),
+	}
+	configBytes, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs": ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromString("diff-0"), digest.FromString("diff-1")},
+		},
+	})
+	require.NoError(t, err)
+	config := writeTestBlob(t, cs, ocispec.MediaTypeImageConfig, configBytes)
+	manifestBytes, err := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    layers,
+	})
+	require.NoError(t, err)
+	return writeTestBlob(t, cs, ocispec.MediaTypeImageManifest, manifestBytes), layers
+}
+
+func newTestProvider(t *testing.T, workDir string) *provider.Provider {
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := provider.New(workDir, hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+	return pvd
+}
+
+func TestHookProviderPreLayer(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+	workDir := t.TempDir()
+	pvd := newTestProvider(t, workDir)
+	cs := pvd.ContentStore()
+	manifest, layers := writeTestImage(t, pvd)
+
+	// Replace the 2nd layer with a new tar file.
+	replacedPath := filepath.Join(workDir, "replaced.tar")
+	require.NoError(t, os.WriteFile(replacedPath, []byte("stripped"), 0644))
+	events := []hook.Event{}
+	hp, err := newHookProvider(Opt{
+		Source: "localhost/source:latest",
+		Target: "localhost/target:latest",
+		Hooks: []hook.ConvertHook{funcHook(func(_ context.Context, event *hook.Event) (*hook.Result, error) {
+			events = append(events, *event)
+			if event.Stage == hook.StagePreLayer && event.Index == 1 {
+				return &hook.Result{LayerPath: replacedPath}, nil
+			}
+			return nil, nil
+		})},
+	}, pvd, platforms.All)
+	require.NoError(t, err)
+
+	rewritten, err := hp.walk(ctx, manifest, hp.preLayer)
+	require.NoError(t, err)
+	require.NotEqual(t, manifest.Digest, rewritten.Digest)
+	require.Len(t, events, 2)
+	require.Equal(t, layers[0].Digest.String(), events[0].Layer.Digest)
+	require.Equal(t, pvd.BlobPath(layers[0].Digest), events[0].Layer.Path)
+	require.Equal(t, "localhost/source:latest", events[0].SourceRef)
+
+	var newManifest ocispec.Manifest
+	require.NoError(t, readJSON(ctx, cs, *rewritten, &newManifest))
+	require.Equal(t, layers[0], newManifest.Layers[0])
+	require.Equal(t, digest.FromString("stripped"), newManifest.Layers[1].Digest)
+	require.Equal(t, ocispec.MediaTypeImageLayer, newManifest.Layers[1].MediaType)
+
+	var newConfig struct {
+		OS     string         `json:"os"`
+		RootFS ocispec.RootFS `json:"rootfs"`
+	}
+	require.NoError(t, readJSON(ctx, cs, newManifest.Config, &newConfig))
+	require.Equal(t, "linux", newConfig.OS)
+	require.Equal(t, []digest.Digest{digest.FromString("diff-0"), digest.FromString("stripped")}, newConfig.RootFS.DiffIDs)
+
+	// The source image is unchanged if no layer is replaced.
+	events = events[:0]
+	unchanged, err := hp.walk(ctx, manifest, hp.postLayer)
+	require.NoError(t, err)
+	require.Equal(t, manifest, *unchanged)
+	require.Len(t, events, 2)
+	require.Equal(t, hook.StagePostLayer, events[1].Stage)
+}
+
+func TestHookProviderPreLayerChain(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+	workDir := t.TempDir()
+	pvd := newTestProvider(t, workDir)
+	cs := pvd.ContentStore()
+	manifest, _ := writeTestImage(t, pvd)
+
+	// The 1st hook replaces the 2nd layer, and the 2nd hook replaces the
+	// layer replaced by the 1st hook.
+	firstPath := filepath.Join(workDir, "first.tar")
+	require.NoError(t, os.WriteFile(firstPath, []byte("first"), 0644))
+	secondPath := filepath.Join(workDir, "second.tar")
+	require.NoError(t, os.WriteFile(secondPath, []byte("second"), 0644))
+	layers := []hook.Descriptor{}
+	hp, err := newHookProvider(Opt{
+		Source: "localhost/source:latest",
+		Target: "localhost/target:latest",
+		Hooks: []hook.ConvertHook{
+			funcHook(func(_ context.Context, event *hook.Event) (*hook.Result, error) {
+				if event.Index == 1 {
+					return &hook.Result{LayerPath: firstPath}, nil
+				}
+				return nil, nil
+			}),
+			funcHook(func(_ context.Context, event *hook.Event) (*hook.Result, error) {
+				if event.Index == 1 {
+					layers = append(layers, *event.Layer)
+					return &hook.Result{LayerPath: secondPath}, nil
+				}
+				return nil, nil
+			}),
+		},
+	}, pvd, platforms.All)
+	require.NoError(t, err)
+
+	rewritten, err := hp.walk(ctx, manifest, hp.preLayer)
+	require.NoError(t, err)
+	require.Equal(t, []hook.Descriptor{{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromString("first").String(),
+		Size:      int64(len("first")),
+		Path:      firstPath,
+	}}, layers)
+
+	var newManifest ocispec.Manifest
+	require.NoError(t, readJSON(ctx, cs, *rewritten, &newManifest))
+	require.Equal(t, digest.FromString("second"), newManifest.Layers[1].Digest)
+}
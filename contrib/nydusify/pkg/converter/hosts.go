@@ -6,6 +6,8 @@ package converter
 
 import (
 	"github.com/goharbor/acceleration-service/pkg/remote"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
 )
 
 func hosts(opt Opt) remote.HostFunc {
@@ -16,6 +18,6 @@ func hosts(opt Opt) remote.HostFunc {
 		opt.CacheRef:     opt.CacheInsecure,
 	}
 	return func(ref string) (remote.CredentialFunc, bool, error) {
-		return remote.NewDockerConfigCredFunc(), maps[ref], nil
+		return auth.CredFunc, maps[ref], nil
 	}
 }
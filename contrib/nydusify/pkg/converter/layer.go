@@ -0,0 +1,258 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/goharbor/acceleration-service/pkg/content"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// The policies of the non-distributable (foreign) layers in source image,
+// for example the Windows base layers served from their URLs.
+const (
+	// ForeignLayerPolicyConvert fetches the layers from their URLs and
+	// converts them as the other layers, the target layers are distributable.
+	ForeignLayerPolicyConvert = "convert"
+	// ForeignLayerPolicySkip drops the layers from the source image without
+	// fetching them, the skipped digests are annotated in target manifest.
+	ForeignLayerPolicySkip = "skip"
+	// ForeignLayerPolicyFail refuses to convert the image.
+	ForeignLayerPolicyFail = "fail"
+)
+
+// ForeignLayerPolicies are the possible values of Opt.ForeignLayerPolicy.
+var ForeignLayerPolicies = []string{ForeignLayerPolicyConvert, ForeignLayerPolicySkip, ForeignLayerPolicyFail}
+
+// annotationZstdChunkedManifest marks the zstd:chunked layer, the layer is a
+// valid zstd stream with the TOC appended in skippable frames.
+const annotationZstdChunkedManifest = "io.github.containers.zstd-chunked.manifest-checksum"
+
+// sourceProvider is the provider of source image, the pulled blobs are
+// stored as local files.
+type sourceProvider interface {
+	content.Provider
+	BlobPath(dgst digest.Digest) string
+}
+
+// layerProvider wraps the provider to check the layers after pulling the
+// source image, the non-distributable layers are handled by the policy, the
+// entries of layers are dropped or moved by the path rules, and the layers
+// unable to be converted are rejected before conversion.
+type layerProvider struct {
+	*provider.Provider
+	policy        string
+	ociRef        bool
+	auditWhiteout bool
+	pathRules     *PathRules
+	platformMC    platforms.MatchComparer
+
+	// source is the normalized source reference.
+	source string
+	// image is the source image rewritten by the policy.
+	image *ocispec.Descriptor
+	// records are the entries dropped or moved by the path rules.
+	records []PathRecord
+}
+
+func newLayerProvider(opt Opt, pvd *provider.Provider, platformMC platforms.MatchComparer) (*layerProvider, error) {
+	policy := opt.ForeignLayerPolicy
+	if policy == "" {
+		policy = ForeignLayerPolicyConvert
+	}
+	source, err := docker.ParseDockerRef(opt.Source)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse source reference")
+	}
+	if policy != ForeignLayerPolicyConvert {
+		pvd.SkipNonDistributable()
+	}
+	return &layerProvider{
+		Provider:      pvd,
+		policy:        policy,
+		ociRef:        opt.OCIRef,
+		auditWhiteout: opt.AuditWhiteout,
+		pathRules:     opt.PathRules,
+		platformMC:    platformMC,
+		source:        source.String(),
+	}, nil
+}
+
+func (lp *layerProvider) Pull(ctx context.Context, ref string) error {
+	if err := lp.Provider.Pull(ctx, ref); err != nil {
+		return err
+	}
+	if ref != lp.source {
+		return nil
+	}
+
+	image, err := lp.Provider.Image(ctx, ref)
+	if err != nil {
+		return err
+	}
+	rewritten, err := walkImage(ctx, lp.ContentStore(), lp.platformMC, *image, lp.checkLayers)
+	if err != nil {
+		return errors.Wrap(err, "check source layers")
+	}
+	lp.image = rewritten
+
+	return nil
+}
+
+func (lp *layerProvider) Image(ctx context.Context, ref string) (*ocispec.Descriptor, error) {
+	if ref == lp.source && lp.image != nil {
+		return lp.image, nil
+	}
+	return lp.Provider.Image(ctx, ref)
+}
+
+func isZstdLayer(desc ocispec.Descriptor) bool {
+	return strings.HasSuffix(desc.MediaType, "+zstd") || desc.Annotations[annotationZstdChunkedManifest] != ""
+}
+
+func (lp *layerProvider) checkLayers(ctx context.Context, desc ocispec.Descriptor, platform string) (*ocispec.Descriptor, error) {
+	cs := lp.ContentStore()
+
+	var manifest ocispec.Manifest
+	if err := readJSON(ctx, cs, desc, &manifest); err != nil {
+		return nil, errors.Wrap(err, "read image manifest")
+	}
+
+	var layers []ocispec.Descriptor
+	var skippedDigests []string
+	skipped := map[int]bool{}
+	// replaced are the diff ids of the layers rewritten by the path rules.
+	replaced := map[int]digest.Digest{}
+	for idx, layer := range manifest.Layers {
+		if images.IsNonDistributable(layer.MediaType) {
+			switch lp.policy {
+			case ForeignLayerPolicyFail:
+				return nil, utils.WithExitCode(utils.ExitCodeValidation, fmt.Errorf("non-distributable layer %s is refused by foreign layer policy", layer.Digest))
+			case ForeignLayerPolicySkip:
+				logrus.Warnf("skip non-distributable layer %s of platform %q", layer.Digest, platform)
+				skipped[idx] = true
+				skippedDigests = append(skippedDigests, layer.Digest.String())
+				continue
+			}
+		}
+		if isZstdLayer(layer) {
+			// The zran index of OCI reference image is only built from gzip.
+			if lp.ociRef {
+				return nil, utils.WithExitCode(utils.ExitCodeValidation, fmt.Errorf("zstd layer %s is unable to be referenced by OCI reference image, convert it without --oci-ref", layer.Digest))
+			}
+			logrus.Infof("convert zstd layer %s from the decompressed tar", layer.Digest)
+		}
+		if lp.pathRules != nil {
+			filtered, records, err := filterLayer(ctx, cs, layer, lp.pathRules)
+			if err != nil {
+				return nil, errors.Wrapf(err, "apply path rules to layer %s", layer.Digest)
+			}
+			if filtered != nil {
+				logrus.Infof("replaced layer %s with %s by path rules, %d entries excluded or rewritten", layer.Digest, filtered.Digest, len(records))
+				for i := range records {
+					records[i].Platform = platform
+				}
+				lp.records = append(lp.records, records...)
+				// The digest of uncompressed tar is the diff id.
+				replaced[idx] = filtered.Digest
+				layer = *filtered
+			}
+		}
+		layers = append(layers, layer)
+	}
+	if lp.auditWhiteout {
+		if _, err := auditWhiteouts(ctx, cs, layers, platform); err != nil {
+			return nil, errors.Wrap(err, "audit whiteouts")
+		}
+	}
+	if len(skipped) == 0 && len(replaced) == 0 {
+		return nil, nil
+	}
+	if len(layers) == 0 {
+		return nil, utils.WithExitCode(utils.ExitCodeValidation, errors.New("all the layers are skipped by foreign layer policy"))
+	}
+
+	var config map[string]json.RawMessage
+	if err := readJSON(ctx, cs, manifest.Config, &config); err != nil {
+		return nil, errors.Wrap(err, "read image config")
+	}
+	var rootFS ocispec.RootFS
+	if err := json.Unmarshal(config["rootfs"], &rootFS); err != nil {
+		return nil, errors.Wrap(err, "unmarshal rootfs of image config")
+	}
+	if len(rootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, fmt.Errorf("unmatched layers between manifest and config: %d != %d", len(manifest.Layers), len(rootFS.DiffIDs))
+	}
+	var diffIDs []digest.Digest
+	for idx, diffID := range rootFS.DiffIDs {
+		if skipped[idx] {
+			continue
+		}
+		if replacedID, ok := replaced[idx]; ok {
+			diffID = replacedID
+		}
+		diffIDs = append(diffIDs, diffID)
+	}
+	rootFS.DiffIDs = diffIDs
+	rootFSBytes, err := json.Marshal(rootFS)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal rootfs of image config")
+	}
+	config["rootfs"] = rootFSBytes
+
+	// The non-empty history entries are mapped to the layers in order.
+	if raw, ok := config["history"]; ok {
+		var history []ocispec.History
+		if err := json.Unmarshal(raw, &history); err != nil {
+			return nil, errors.Wrap(err, "unmarshal history of image config")
+		}
+		var kept []ocispec.History
+		layerIdx := 0
+		for _, entry := range history {
+			if !entry.EmptyLayer {
+				skip := skipped[layerIdx]
+				layerIdx++
+				if skip {
+					continue
+				}
+			}
+			kept = append(kept, entry)
+		}
+		historyBytes, err := json.Marshal(kept)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal history of image config")
+		}
+		config["history"] = historyBytes
+	}
+
+	configDesc, err := writeJSON(ctx, cs, manifest.Config, config)
+	if err != nil {
+		return nil, errors.Wrap(err, "write image config")
+	}
+	manifest.Config = *configDesc
+
+	manifest.Layers = layers
+	if len(skipped) > 0 {
+		if manifest.Annotations == nil {
+			manifest.Annotations = map[string]string{}
+		}
+		manifest.Annotations[utils.ManifestNydusSkippedLayers] = strings.Join(skippedDigests, ",")
+	}
+
+	return writeJSON(ctx, cs, desc, manifest)
+}
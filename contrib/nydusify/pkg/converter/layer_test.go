@@ -0,0 +1,97 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+func TestLayerProviderCheckLayers(t *testing.T) {
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := provider.New(t.TempDir(), hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+	cs := pvd.ContentStore()
+
+	layers := []ocispec.Descriptor{
+		writeTestBlob(t, cs, images.MediaTypeDockerSchema2LayerForeignGzip, []byte("foreign")),
+		writeTestBlob(t, cs, ocispec.MediaTypeImageLayerZstd, []byte("layer-1")),
+	}
+	configBytes, err := json.Marshal(map[string]interface{}{
+		"os": "windows",
+		"rootfs": ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{digest.FromString("diff-0"), digest.FromString("diff-1")},
+		},
+		"history": []ocispec.History{
+			{CreatedBy: "base"},
+			{CreatedBy: "env", EmptyLayer: true},
+			{CreatedBy: "copy"},
+		},
+	})
+	require.NoError(t, err)
+	config := writeTestBlob(t, cs, ocispec.MediaTypeImageConfig, configBytes)
+	manifestBytes, err := json.Marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+		Layers:    layers,
+	})
+	require.NoError(t, err)
+	manifest := writeTestBlob(t, cs, ocispec.MediaTypeImageManifest, manifestBytes)
+
+	check := func(opt Opt) (*ocispec.Descriptor, error) {
+		opt.Source = "localhost/source:latest"
+		lp, err := newLayerProvider(opt, pvd, platforms.All)
+		require.NoError(t, err)
+		return walkImage(ctx, cs, platforms.All, manifest, lp.checkLayers)
+	}
+
+	// The foreign layer is fetched and converted by default.
+	unchanged, err := check(Opt{})
+	require.NoError(t, err)
+	require.Equal(t, manifest, *unchanged)
+
+	_, err = check(Opt{ForeignLayerPolicy: ForeignLayerPolicyFail})
+	require.ErrorContains(t, err, "non-distributable layer")
+	require.Equal(t, utils.ExitCodeValidation, utils.ExitCode(err))
+
+	_, err = check(Opt{OCIRef: true})
+	require.ErrorContains(t, err, "zstd layer")
+	require.Equal(t, utils.ExitCodeValidation, utils.ExitCode(err))
+
+	rewritten, err := check(Opt{ForeignLayerPolicy: ForeignLayerPolicySkip})
+	require.NoError(t, err)
+	var newManifest ocispec.Manifest
+	require.NoError(t, readJSON(ctx, cs, *rewritten, &newManifest))
+	require.Equal(t, []ocispec.Descriptor{layers[1]}, newManifest.Layers)
+	require.Equal(t, layers[0].Digest.String(), newManifest.Annotations[utils.ManifestNydusSkippedLayers])
+
+	var newConfig struct {
+		OS      string            `json:"os"`
+		RootFS  ocispec.RootFS    `json:"rootfs"`
+		History []ocispec.History `json:"history"`
+	}
+	require.NoError(t, readJSON(ctx, cs, newManifest.Config, &newConfig))
+	require.Equal(t, "windows", newConfig.OS)
+	require.Equal(t, []digest.Digest{digest.FromString("diff-1")}, newConfig.RootFS.DiffIDs)
+	require.Len(t, newConfig.History, 2)
+	require.Equal(t, "env", newConfig.History[0].CreatedBy)
+	require.Equal(t, "copy", newConfig.History[1].CreatedBy)
+}
@@ -12,7 +12,17 @@ import (
 	"github.com/pkg/errors"
 )
 
-func dumpMetric(metric *converter.Metric, path string) error {
+// Report is saved to Opt.OutputJSON after conversion, the provenance is
+// omitted if the conversion failed.
+type Report struct {
+	*converter.Metric
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// PathRules are the entries of source layers dropped or moved by
+	// Opt.PathRules.
+	PathRules []PathRecord `json:"path_rules,omitempty"`
+}
+
+func dumpMetric(metric *converter.Metric, prov *Provenance, records []PathRecord, path string) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return errors.Wrap(err, "Create file for metric")
@@ -20,7 +30,7 @@ func dumpMetric(metric *converter.Metric, path string) error {
 	defer file.Close()
 
 	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(metric); err != nil {
+	if err := encoder.Encode(Report{Metric: metric, Provenance: prov, PathRules: records}); err != nil {
 		return errors.Wrap(err, "Encode JSON from metric")
 	}
 	return nil
@@ -0,0 +1,253 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// The actions of path rules recorded in the conversion report.
+const (
+	PathActionExclude = "exclude"
+	PathActionRewrite = "rewrite"
+)
+
+// PathRewrite moves the entry From and the entries under it to To.
+type PathRewrite struct {
+	From string
+	To   string
+}
+
+// PathRules drops or moves the entries of source layers before conversion,
+// for example to remove the caches, docs or secrets from the target image.
+type PathRules struct {
+	// Exclude are the patterns of path.Match, an entry is dropped if the
+	// pattern matches the path of entry or any parent directory of it, the
+	// pattern without slash is matched against the base name.
+	Exclude []string
+	// Rewrite are applied in order, the first matched rule is used.
+	Rewrite []PathRewrite
+}
+
+// PathRecord records an entry of source layer dropped or moved by the path
+// rules, Target is the new path of the moved entry.
+type PathRecord struct {
+	Platform string        `json:"platform,omitempty"`
+	Layer    digest.Digest `json:"layer"`
+	Action   string        `json:"action"`
+	Entry    string        `json:"entry"`
+	Target   string        `json:"target,omitempty"`
+}
+
+// ParsePathRules parses the exclude patterns and the rewrite rules in the
+// format of FROM=TO, the paths are relative to the root of image.
+func ParsePathRules(excludes, rewrites []string) (*PathRules, error) {
+	rules := &PathRules{}
+	for _, pattern := range excludes {
+		pattern = cleanTarPath(pattern)
+		if pattern == "" {
+			return nil, errors.New("exclude path pattern should not be the root")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid exclude path pattern %q", pattern)
+		}
+		rules.Exclude = append(rules.Exclude, pattern)
+	}
+	for _, rewrite := range rewrites {
+		from, to, ok := strings.Cut(rewrite, "=")
+		from, to = cleanTarPath(from), cleanTarPath(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid rewrite path rule %q, should be in the format of FROM=TO", rewrite)
+		}
+		rules.Rewrite = append(rules.Rewrite, PathRewrite{From: from, To: to})
+	}
+	if len(rules.Exclude) == 0 && len(rules.Rewrite) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+func (rules *PathRules) excluded(name string) bool {
+	for ; name != "" && name != "."; name = path.Dir(name) {
+		for _, pattern := range rules.Exclude {
+			target := name
+			if !strings.Contains(pattern, "/") {
+				target = path.Base(name)
+			}
+			if matched, _ := path.Match(pattern, target); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (rules *PathRules) rewrite(name string) (string, bool) {
+	for _, rule := range rules.Rewrite {
+		if name == rule.From {
+			return rule.To, true
+		}
+		if strings.HasPrefix(name, rule.From+"/") {
+			return rule.To + strings.TrimPrefix(name, rule.From), true
+		}
+	}
+	return name, false
+}
+
+// targetPath returns the path affected by the entry, that is the removed
+// path of whiteout, and the directory of opaque whiteout, the rules are
+// matched against it, so that the whiteouts are moved with their targets.
+func targetPath(entry string) string {
+	dir, base := path.Split(entry)
+	dir = strings.TrimSuffix(dir, "/")
+	switch {
+	case base == whiteoutOpaqueDir:
+		return dir
+	case strings.HasPrefix(base, whiteoutMetaPrefix):
+		return entry
+	case strings.HasPrefix(base, whiteoutPrefix):
+		return path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+	}
+	return entry
+}
+
+// withTarget returns the entry with the affected path replaced by target.
+func withTarget(entry, target string) string {
+	base := path.Base(entry)
+	switch {
+	case base == whiteoutOpaqueDir:
+		return path.Join(target, whiteoutOpaqueDir)
+	case strings.HasPrefix(base, whiteoutMetaPrefix):
+		return target
+	case strings.HasPrefix(base, whiteoutPrefix):
+		return path.Join(path.Dir(target), whiteoutPrefix+path.Base(target))
+	}
+	return target
+}
+
+// filter copies the layer tar with the rules applied, the hardlinks to the
+// excluded entries are also excluded.
+func (rules *PathRules) filter(reader io.Reader, writer io.Writer) ([]PathRecord, error) {
+	var records []PathRecord
+	excluded := map[string]bool{}
+
+	tr := tar.NewReader(reader)
+	tw := tar.NewWriter(writer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "read layer tar")
+		}
+
+		entry := cleanTarPath(hdr.Name)
+		target := targetPath(entry)
+		linkname := cleanTarPath(hdr.Linkname)
+		if rules.excluded(target) || (hdr.Typeflag == tar.TypeLink && excluded[linkname]) {
+			excluded[entry] = true
+			records = append(records, PathRecord{Action: PathActionExclude, Entry: entry})
+			continue
+		}
+		if rewritten, ok := rules.rewrite(target); ok {
+			newEntry := withTarget(entry, rewritten)
+			records = append(records, PathRecord{Action: PathActionRewrite, Entry: entry, Target: newEntry})
+			hdr.Name = newEntry
+			if hdr.Typeflag == tar.TypeDir {
+				hdr.Name += "/"
+			}
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			if rewritten, ok := rules.rewrite(linkname); ok {
+				hdr.Linkname = rewritten
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return nil, errors.Wrapf(err, "write tar header of %s", hdr.Name)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return nil, errors.Wrapf(err, "write %s", hdr.Name)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "close layer tar")
+	}
+
+	return records, nil
+}
+
+// filterLayer applies the rules to the layer, and writes the uncompressed
+// tar into content store. It returns nil descriptor if no entry of layer is
+// matched by the rules.
+func filterLayer(ctx context.Context, cs content.Store, layer ocispec.Descriptor, rules *PathRules) (*ocispec.Descriptor, []PathRecord, error) {
+	ra, err := cs.ReaderAt(ctx, layer)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get layer reader")
+	}
+	defer ra.Close()
+	reader, err := compression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "decompress layer")
+	}
+	defer reader.Close()
+
+	ref := "path-rules-" + layer.Digest.String()
+	writer, err := content.OpenWriter(ctx, cs, content.WithRef(ref))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "open content writer")
+	}
+	defer writer.Close()
+	// Drop the data left by the interrupted attempt.
+	if err := writer.Truncate(0); err != nil {
+		return nil, nil, errors.Wrap(err, "truncate content writer")
+	}
+
+	records, err := rules.filter(reader, writer)
+	if err != nil || len(records) == 0 {
+		writer.Close()
+		if abortErr := cs.Abort(ctx, ref); abortErr != nil {
+			logrus.WithError(abortErr).Warnf("abort content writer %s", ref)
+		}
+		return nil, nil, err
+	}
+
+	status, err := writer.Status()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "get content writer status")
+	}
+	mediaType := ocispec.MediaTypeImageLayer
+	if images.IsDockerType(layer.MediaType) {
+		mediaType = images.MediaTypeDockerSchema2Layer
+	}
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    writer.Digest(),
+		Size:      status.Offset,
+	}
+	if err := writer.Commit(ctx, desc.Size, desc.Digest); err != nil && !errdefs.IsAlreadyExists(err) {
+		return nil, nil, errors.Wrap(err, "commit layer blob")
+	}
+	for idx := range records {
+		records[idx].Layer = layer.Digest
+	}
+
+	return &desc, records, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePathRules(t *testing.T) {
+	rules, err := ParsePathRules(nil, nil)
+	require.NoError(t, err)
+	require.Nil(t, rules)
+
+	rules, err = ParsePathRules([]string{"/var/cache/*", "*.pem"}, []string{"/opt/app/=app"})
+	require.NoError(t, err)
+	require.Equal(t, &PathRules{
+		Exclude: []string{"var/cache/*", "*.pem"},
+		Rewrite: []PathRewrite{{From: "opt/app", To: "app"}},
+	}, rules)
+
+	_, err = ParsePathRules([]string{"/"}, nil)
+	require.ErrorContains(t, err, "should not be the root")
+	_, err = ParsePathRules([]string{"[a"}, nil)
+	require.ErrorContains(t, err, "invalid exclude path pattern")
+	_, err = ParsePathRules(nil, []string{"opt/app"})
+	require.ErrorContains(t, err, "FROM=TO")
+	_, err = ParsePathRules(nil, []string{"opt/app=/"})
+	require.ErrorContains(t, err, "FROM=TO")
+}
+
+func TestPathRulesFilter(t *testing.T) {
+	rules, err := ParsePathRules([]string{"var/cache", "*.pem"}, []string{"opt/app=app"})
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "etc/passwd", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "etc/ssl/key.pem", Typeflag: tar.TypeReg, Mode: 0600},
+		{Name: "etc/ssl/key.link", Typeflag: tar.TypeLink, Linkname: "etc/ssl/key.pem"},
+		{Name: "var/cache/apt/pkgcache.bin", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "var/.wh.cache", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "./opt/app/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "opt/app/bin", Typeflag: tar.TypeReg, Mode: 0755},
+		{Name: "opt/app/bin.link", Typeflag: tar.TypeLink, Linkname: "opt/app/bin"},
+		{Name: "opt/app/.wh..wh..opq", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "opt/.wh.app", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+	}
+	require.NoError(t, tw.Close())
+
+	output := &bytes.Buffer{}
+	records, err := rules.filter(buf, output)
+	require.NoError(t, err)
+	require.Equal(t, []PathRecord{
+		{Action: PathActionExclude, Entry: "etc/ssl/key.pem"},
+		{Action: PathActionExclude, Entry: "etc/ssl/key.link"},
+		{Action: PathActionExclude, Entry: "var/cache/apt/pkgcache.bin"},
+		{Action: PathActionExclude, Entry: "var/.wh.cache"},
+		{Action: PathActionRewrite, Entry: "opt/app", Target: "app"},
+		{Action: PathActionRewrite, Entry: "opt/app/bin", Target: "app/bin"},
+		{Action: PathActionRewrite, Entry: "opt/app/bin.link", Target: "app/bin.link"},
+		{Action: PathActionRewrite, Entry: "opt/app/.wh..wh..opq", Target: "app/.wh..wh..opq"},
+		{Action: PathActionRewrite, Entry: "opt/.wh.app", Target: ".wh.app"},
+	}, records)
+
+	entries := map[string]string{}
+	tr := tar.NewReader(output)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		entries[hdr.Name] = hdr.Linkname
+	}
+	require.Equal(t, map[string]string{
+		"etc/":             "",
+		"etc/passwd":       "",
+		"app/":             "",
+		"app/bin":          "",
+		"app/bin.link":     "app/bin",
+		"app/.wh..wh..opq": "",
+		".wh.app":          "",
+	}, entries)
+}
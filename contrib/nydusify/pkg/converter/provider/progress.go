@@ -0,0 +1,80 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// Progress records the layers pulled and pushed by provider, so that an
+// interrupted conversion is able to be resumed.
+type Progress interface {
+	// Resolved is called after the image is resolved, before any layer of
+	// it is pulled.
+	Resolved(ref string, desc ocispec.Descriptor)
+	// Pulled is called after a layer is pulled.
+	Pulled(ref string, desc ocispec.Descriptor)
+	// Pushed is called after a layer is pushed to the reference.
+	Pushed(ref string, desc ocispec.Descriptor)
+	// IsPushed returns true if the layer is known to be pushed to the
+	// reference, the layer is skipped without checking the registry.
+	IsPushed(ref string, desc ocispec.Descriptor) bool
+}
+
+// SetProgress sets the recorder of pull and push progress.
+func (pvd *Provider) SetProgress(progress Progress) {
+	pvd.progress = progress
+}
+
+// recordResolver records the descriptor of resolved image by the reference
+// of image, which is resolved by digest if the image is pinned.
+type recordResolver struct {
+	remotes.Resolver
+	ref      string
+	progress Progress
+}
+
+func (resolver *recordResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	name, desc, err := resolver.Resolver.Resolve(ctx, ref)
+	if err == nil {
+		resolver.progress.Resolved(resolver.ref, desc)
+	}
+	return name, desc, err
+}
+
+// recordPulled records the pulled layers.
+func (pvd *Provider) recordPulled(ref string, handler images.Handler) images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		children, err := handler.Handle(ctx, desc)
+		if err == nil && images.IsLayerType(desc.MediaType) {
+			pvd.progress.Pulled(ref, desc)
+		}
+		return children, err
+	})
+}
+
+// recordPushed records the pushed layers, and skips the layers pushed by
+// the previous attempts.
+func (pvd *Provider) recordPushed(ref string, handler images.Handler) images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if !images.IsLayerType(desc.MediaType) {
+			return handler.Handle(ctx, desc)
+		}
+		if pvd.progress.IsPushed(ref, desc) {
+			logrus.Infof("skip pushing layer %s pushed by previous attempt", desc.Digest)
+			return nil, nil
+		}
+		children, err := handler.Handle(ctx, desc)
+		if err == nil {
+			pvd.progress.Pushed(ref, desc)
+		}
+		return children, err
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver struct {
+	remotes.Resolver
+	desc ocispec.Descriptor
+}
+
+func (resolver *fakeResolver) Resolve(_ context.Context, ref string) (string, ocispec.Descriptor, error) {
+	return ref, resolver.desc, nil
+}
+
+type fakeProgress struct {
+	Progress
+	resolved map[string]ocispec.Descriptor
+}
+
+func (progress *fakeProgress) Resolved(ref string, desc ocispec.Descriptor) {
+	progress.resolved[ref] = desc
+}
+
+func TestRecordResolver(t *testing.T) {
+	image := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString("index")}
+	progress := &fakeProgress{resolved: map[string]ocispec.Descriptor{}}
+	ref := "docker.io/library/nginx:latest"
+	resolver := &recordResolver{Resolver: &fakeResolver{desc: image}, ref: ref, progress: progress}
+
+	// The pinned image is recorded by its original reference.
+	_, desc, err := resolver.Resolve(context.Background(), "docker.io/library/nginx@"+image.Digest.String())
+	require.NoError(t, err)
+	require.Equal(t, image, desc)
+	require.Equal(t, map[string]ocispec.Descriptor{ref: image}, progress.resolved)
+}
@@ -6,24 +6,27 @@ package provider
 
 import (
 	"context"
-	"crypto/tls"
-	"net"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
-	"time"
 
 	"github.com/containerd/containerd"
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
+	"github.com/distribution/reference"
 	"github.com/goharbor/acceleration-service/pkg/cache"
 	accelcontent "github.com/goharbor/acceleration-service/pkg/content"
 	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	nydusremote "github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
 )
 
 var LayerConcurrentLimit = 5
@@ -33,11 +36,33 @@ type Provider struct {
 	usePlainHTTP bool
 	images       map[string]*ocispec.Descriptor
 	store        content.Store
+	contentDir   string
 	hosts        remote.HostFunc
 	platformMC   platforms.MatchComparer
 	cacheSize    int
 	cacheVersion string
 	chunkSize    int64
+	// authorizers caches the authorizer of each registry host, to reuse
+	// the bearer tokens between the pulls and pushes.
+	authorizers map[string]docker.Authorizer
+	// skipNonDistributable skips fetching the non-distributable layers,
+	// which are usually served from their URLs instead of registry.
+	skipNonDistributable bool
+	// pullConcurrency limits the concurrent layer downloads, default to
+	// LayerConcurrentLimit.
+	pullConcurrency int
+	// pullRetries is the number of attempts to resume the interrupted
+	// layer downloads.
+	pullRetries int
+	// verifyImage checks the pulled image before it's used, the pull
+	// fails if it returns an error.
+	verifyImage func(ref string, desc ocispec.Descriptor) error
+	// pushed records the images pushed by reference.
+	pushed map[string]*ocispec.Descriptor
+	// pinned records the manifest digests to pull the images by reference.
+	pinned map[string]digest.Digest
+	// progress records the pulled and pushed layers if set.
+	progress Progress
 }
 
 func New(root string, hosts remote.HostFunc, cacheSize uint, cacheVersion string, platformMC platforms.MatchComparer, chunkSize int64) (*Provider, error) {
@@ -52,45 +77,28 @@ func New(root string, hosts remote.HostFunc, cacheSize uint, cacheVersion string
 
 	return &Provider{
 		images:       make(map[string]*ocispec.Descriptor),
+		pushed:       make(map[string]*ocispec.Descriptor),
+		pinned:       make(map[string]digest.Digest),
 		store:        store,
+		contentDir:   contentDir,
 		hosts:        hosts,
 		cacheSize:    int(cacheSize),
 		platformMC:   platformMC,
 		cacheVersion: cacheVersion,
 		chunkSize:    chunkSize,
+		authorizers:  make(map[string]docker.Authorizer),
 	}, nil
 }
 
 func newDefaultClient(skipTLSVerify bool) *http.Client {
 	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          10,
-			IdleConnTimeout:       30 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 5 * time.Second,
-			DisableKeepAlives:     true,
-			TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: skipTLSVerify,
-			},
-		},
-	}
-}
-
-func newResolver(insecure, plainHTTP bool, credFunc remote.CredentialFunc, chunkSize int64) remotes.Resolver {
+		Transport: nydusremote.NewRetryTransport(nydusremote.SharedTransport(nydusremote.DefaultTransportConfig, skipTLSVerify)),
+	}
+}
+
+func newResolver(insecure, plainHTTP bool, authorizer docker.Authorizer, chunkSize int64) remotes.Resolver {
 	registryHosts := docker.ConfigureDefaultRegistries(
-		docker.WithAuthorizer(
-			docker.NewDockerAuthorizer(
-				docker.WithAuthClient(newDefaultClient(insecure)),
-				docker.WithAuthCreds(credFunc),
-			),
-		),
+		docker.WithAuthorizer(authorizer),
 		docker.WithClient(newDefaultClient(insecure)),
 		docker.WithPlainHTTP(func(_ string) (bool, error) {
 			return plainHTTP, nil
@@ -107,12 +115,84 @@ func (pvd *Provider) UsePlainHTTP() {
 	pvd.usePlainHTTP = true
 }
 
+// SkipNonDistributable skips fetching the non-distributable layers of the
+// pulled images, the layers are still referenced by the manifests.
+func (pvd *Provider) SkipNonDistributable() {
+	pvd.skipNonDistributable = true
+}
+
+// SetPullConcurrency sets the number of layers downloaded concurrently.
+func (pvd *Provider) SetPullConcurrency(concurrency int) {
+	pvd.pullConcurrency = concurrency
+}
+
+// SetPullRetries sets the number of attempts to resume the interrupted
+// layer downloads.
+func (pvd *Provider) SetPullRetries(retries int) {
+	pvd.pullRetries = retries
+}
+
+// SetImageVerifier sets the function to check the image resolved by pull,
+// for example the digest of source image pinned by the user.
+func (pvd *Provider) SetImageVerifier(verify func(ref string, desc ocispec.Descriptor) error) {
+	pvd.verifyImage = verify
+}
+
+// Pin pins the image reference to the manifest digest, so that the image is
+// pulled by the digest instead of resolving the reference again, e.g. the
+// digest whose signature has been verified.
+func (pvd *Provider) Pin(ref string, dgst digest.Digest) {
+	pvd.mutex.Lock()
+	defer pvd.mutex.Unlock()
+	pvd.pinned[ref] = dgst
+}
+
+// pullReference returns the reference to pull the image, which is pinned
+// to the digest if specified.
+func (pvd *Provider) pullReference(ref string) (string, error) {
+	pvd.mutex.Lock()
+	dgst, ok := pvd.pinned[ref]
+	pvd.mutex.Unlock()
+	if !ok {
+		return ref, nil
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("parse reference %s: %w", ref, err)
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), dgst)
+	if err != nil {
+		return "", fmt.Errorf("pin reference %s: %w", ref, err)
+	}
+	return pinned.String(), nil
+}
+
+func (pvd *Provider) authorizer(ref string, insecure bool, credFunc remote.CredentialFunc) docker.Authorizer {
+	key := fmt.Sprintf("%s/%t", ref, insecure)
+	if named, err := reference.ParseNormalizedNamed(ref); err == nil {
+		key = fmt.Sprintf("%s/%t", reference.Domain(named), insecure)
+	}
+
+	pvd.mutex.Lock()
+	defer pvd.mutex.Unlock()
+	if authorizer, ok := pvd.authorizers[key]; ok {
+		return authorizer
+	}
+	authorizer := docker.NewDockerAuthorizer(
+		docker.WithAuthClient(newDefaultClient(insecure)),
+		docker.WithAuthCreds(credFunc),
+	)
+	pvd.authorizers[key] = authorizer
+	return authorizer
+}
+
 func (pvd *Provider) Resolver(ref string) (remotes.Resolver, error) {
 	credFunc, insecure, err := pvd.hosts(ref)
 	if err != nil {
 		return nil, err
 	}
-	return newResolver(insecure, pvd.usePlainHTTP, credFunc, pvd.chunkSize), nil
+	authorizer := pvd.authorizer(ref, insecure, credFunc)
+	return newResolver(insecure, pvd.usePlainHTTP, authorizer, pvd.chunkSize), nil
 }
 
 func (pvd *Provider) Pull(ctx context.Context, ref string) error {
@@ -120,17 +200,41 @@ func (pvd *Provider) Pull(ctx context.Context, ref string) error {
 	if err != nil {
 		return err
 	}
+	pullRef, err := pvd.pullReference(ref)
+	if err != nil {
+		return err
+	}
+	if pvd.progress != nil {
+		resolver = &recordResolver{Resolver: resolver, ref: ref, progress: pvd.progress}
+	}
 	rc := &containerd.RemoteContext{
 		Resolver:               resolver,
 		PlatformMatcher:        pvd.platformMC,
 		MaxConcurrentDownloads: LayerConcurrentLimit,
 	}
+	if pvd.pullConcurrency > 0 {
+		rc.MaxConcurrentDownloads = pvd.pullConcurrency
+	}
+	rc.HandlerWrapper = func(handler images.Handler) images.Handler {
+		handler = pvd.resumeLayers(handler)
+		if pvd.skipNonDistributable {
+			handler = skipNonDistributable(handler)
+		}
+		if pvd.progress != nil {
+			handler = pvd.recordPulled(ref, handler)
+		}
+		return handler
+	}
 
-	img, err := fetch(ctx, pvd.store, rc, ref, 0)
+	img, err := fetch(ctx, pvd.store, rc, pullRef, 0)
 	if err != nil {
 		return err
 	}
-
+	if pvd.verifyImage != nil {
+		if err := pvd.verifyImage(ref, img.Target); err != nil {
+			return err
+		}
+	}
 	pvd.mutex.Lock()
 	defer pvd.mutex.Unlock()
 	pvd.images[ref] = &img.Target
@@ -148,8 +252,31 @@ func (pvd *Provider) Push(ctx context.Context, desc ocispec.Descriptor, ref stri
 		PlatformMatcher:             pvd.platformMC,
 		MaxConcurrentUploadedLayers: LayerConcurrentLimit,
 	}
+	if pvd.progress != nil {
+		rc.HandlerWrapper = func(handler images.Handler) images.Handler {
+			return pvd.recordPushed(ref, handler)
+		}
+	}
+
+	if err := push(ctx, pvd.store, rc, desc, ref); err != nil {
+		return err
+	}
+
+	pvd.mutex.Lock()
+	defer pvd.mutex.Unlock()
+	pvd.pushed[ref] = &desc
+
+	return nil
+}
 
-	return push(ctx, pvd.store, rc, desc, ref)
+// PushedImage returns the descriptor of the image pushed to the reference.
+func (pvd *Provider) PushedImage(ref string) (*ocispec.Descriptor, error) {
+	pvd.mutex.Lock()
+	defer pvd.mutex.Unlock()
+	if desc, ok := pvd.pushed[ref]; ok {
+		return desc, nil
+	}
+	return nil, errdefs.ErrNotFound
 }
 
 func (pvd *Provider) Image(_ context.Context, ref string) (*ocispec.Descriptor, error) {
@@ -165,6 +292,12 @@ func (pvd *Provider) ContentStore() content.Store {
 	return pvd.store
 }
 
+// BlobPath returns the local file path of the blob in content store,
+// the file may not exist if the blob hasn't been fetched.
+func (pvd *Provider) BlobPath(dgst digest.Digest) string {
+	return filepath.Join(pvd.contentDir, "blobs", dgst.Algorithm().String(), dgst.Encoded())
+}
+
 func (pvd *Provider) SetContentStore(store content.Store) {
 	pvd.store = store
 }
@@ -0,0 +1,64 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// resumeBackoff is the base delay between the attempts of resuming layer
+// download, it's increased linearly by the attempts.
+var resumeBackoff = time.Second
+
+// skipNonDistributable skips fetching the non-distributable layers.
+func skipNonDistributable(handler images.Handler) images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if images.IsNonDistributable(desc.MediaType) {
+			return nil, nil
+		}
+		return handler.Handle(ctx, desc)
+	})
+}
+
+// resumeLayers retries the interrupted layer downloads. The downloaded data
+// is kept in the ingest of content store, the retry resumes from the offset
+// of ingest with an HTTP range request, and the digest of layer is verified
+// on commit. The ingest is discarded if the digest mismatches, so that the
+// next attempt downloads the layer from scratch.
+func (pvd *Provider) resumeLayers(handler images.Handler) images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		children, err := handler.Handle(ctx, desc)
+		if !images.IsLayerType(desc.MediaType) {
+			return children, err
+		}
+		for attempt := 1; err != nil && attempt <= pvd.pullRetries; attempt++ {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if errdefs.IsFailedPrecondition(err) {
+				logrus.WithError(err).Warnf("discard the downloaded data of layer %s", desc.Digest)
+				if abortErr := pvd.store.Abort(ctx, remotes.MakeRefKey(ctx, desc)); abortErr != nil && !errdefs.IsNotFound(abortErr) {
+					return nil, errors.Wrapf(abortErr, "discard layer %s", desc.Digest)
+				}
+			}
+			logrus.WithError(err).Warnf("resume downloading layer %s, attempt %d/%d", desc.Digest, attempt, pvd.pullRetries)
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(time.Duration(attempt) * resumeBackoff):
+			}
+			children, err = handler.Handle(ctx, desc)
+		}
+		return children, err
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/goharbor/acceleration-service/pkg/remote"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeLayers(t *testing.T) {
+	resumeBackoff = time.Millisecond
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := New(t.TempDir(), hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+	pvd.SetPullRetries(2)
+
+	calls := 0
+	failures := 0
+	handler := pvd.resumeLayers(images.HandlerFunc(func(_ context.Context, _ ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		calls++
+		if calls <= failures {
+			return nil, fmt.Errorf("unexpected commit digest: %w", errdefs.ErrFailedPrecondition)
+		}
+		return nil, nil
+	}))
+	layer := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayerGzip,
+		Digest:    digest.FromString("layer"),
+	}
+	ctx := namespaces.WithNamespace(context.Background(), "nydusify")
+
+	// The layer download is resumed until success.
+	failures = 2
+	_, err = handler.Handle(ctx, layer)
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+
+	// Give up after the retries are exhausted.
+	calls, failures = 0, 5
+	_, err = handler.Handle(ctx, layer)
+	require.ErrorIs(t, err, errdefs.ErrFailedPrecondition)
+	require.Equal(t, 3, calls)
+
+	// The manifests are not retried.
+	calls, failures = 0, 1
+	_, err = handler.Handle(ctx, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestPullReference(t *testing.T) {
+	hosts := func(string) (remote.CredentialFunc, bool, error) {
+		return nil, false, nil
+	}
+	pvd, err := New(t.TempDir(), hosts, 0, "", platforms.All, 0)
+	require.NoError(t, err)
+
+	ref := "docker.io/library/nginx:latest"
+	pullRef, err := pvd.pullReference(ref)
+	require.NoError(t, err)
+	require.Equal(t, ref, pullRef)
+
+	dgst := digest.FromString("manifest")
+	pvd.Pin(ref, dgst)
+	pullRef, err = pvd.pullReference(ref)
+	require.NoError(t, err)
+	require.Equal(t, "docker.io/library/nginx@"+dgst.String(), pullRef)
+}
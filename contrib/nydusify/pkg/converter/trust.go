@@ -0,0 +1,152 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// TrustPolicy restricts the source images allowed to be converted, the
+// references are compared in the normalized form, e.g. `docker.io/library/nginx:latest`.
+type TrustPolicy struct {
+	// AllowedSources are the prefixes of allowed source references, all
+	// sources are allowed if it's empty. DeniedSources take precedence.
+	AllowedSources []string
+	DeniedSources  []string
+	// Digests pins the source references to the digests of their manifest
+	// (or index), it's usually parsed from a lockfile by ParseLockfile. The
+	// sources not pinned are rejected if it's not empty.
+	Digests map[string]digest.Digest
+}
+
+// Provenance maps the source image to the converted image, it's recorded in
+// the output report for supply chain tracking.
+type Provenance struct {
+	Source       string        `json:"source"`
+	SourceDigest digest.Digest `json:"source_digest"`
+	Target       string        `json:"target"`
+	TargetDigest digest.Digest `json:"target_digest"`
+}
+
+func normalizeReference(ref string) (string, error) {
+	named, err := docker.ParseDockerRef(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse reference %s", ref)
+	}
+	return named.String(), nil
+}
+
+// ParseLockfile parses the digests of source images, each line is formatted
+// as `<source> <digest>`, empty lines and lines starting with `#` are ignored.
+func ParseLockfile(reader io.Reader) (map[string]digest.Digest, error) {
+	digests := map[string]digest.Digest{}
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid line %d: %q, should be `<source> <digest>`", lineNum, line)
+		}
+		source, err := normalizeReference(fields[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid line %d", lineNum)
+		}
+		dgst, err := digest.Parse(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid digest in line %d", lineNum)
+		}
+		digests[source] = dgst
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read lockfile")
+	}
+	return digests, nil
+}
+
+// CheckSource checks the source reference against the allowed and denied
+// prefixes and the pinned digests.
+func (policy *TrustPolicy) CheckSource(ref string) error {
+	source, err := normalizeReference(ref)
+	if err != nil {
+		return err
+	}
+	for _, prefix := range policy.DeniedSources {
+		if strings.HasPrefix(source, prefix) {
+			return fmt.Errorf("source image %s is denied by %q", source, prefix)
+		}
+	}
+	if len(policy.AllowedSources) > 0 {
+		allowed := false
+		for _, prefix := range policy.AllowedSources {
+			if strings.HasPrefix(source, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("source image %s is not in the allowed sources %v", source, policy.AllowedSources)
+		}
+	}
+	if len(policy.Digests) > 0 {
+		if _, ok := policy.Digests[source]; !ok {
+			return fmt.Errorf("source image %s is not pinned in lockfile", source)
+		}
+	}
+	return nil
+}
+
+// CheckDigest checks the digest of pulled source image matches the pinned one.
+func (policy *TrustPolicy) CheckDigest(ref string, dgst digest.Digest) error {
+	if len(policy.Digests) == 0 {
+		return nil
+	}
+	source, err := normalizeReference(ref)
+	if err != nil {
+		return err
+	}
+	expected, ok := policy.Digests[source]
+	if !ok {
+		return fmt.Errorf("source image %s is not pinned in lockfile", source)
+	}
+	if expected != dgst {
+		return fmt.Errorf("digest of source image %s is %s, mismatched with %s pinned in lockfile", source, dgst, expected)
+	}
+	return nil
+}
+
+// imageVerifier returns the verifier of pulled images for provider, only
+// the source images are checked by the policy.
+func (policy *TrustPolicy) imageVerifier(sources []string) (func(ref string, desc ocispec.Descriptor) error, error) {
+	normalized := map[string]bool{}
+	for _, source := range sources {
+		ref, err := normalizeReference(source)
+		if err != nil {
+			return nil, err
+		}
+		normalized[ref] = true
+	}
+	return func(ref string, desc ocispec.Descriptor) error {
+		if source, err := normalizeReference(ref); err != nil || !normalized[source] {
+			return nil
+		}
+		if err := policy.CheckSource(ref); err != nil {
+			return utils.WithExitCode(utils.ExitCodeValidation, err)
+		}
+		return utils.WithExitCode(utils.ExitCodeValidation, policy.CheckDigest(ref, desc.Digest))
+	}, nil
+}
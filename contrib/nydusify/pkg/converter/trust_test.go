@@ -0,0 +1,68 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+func TestParseLockfile(t *testing.T) {
+	nginx := digest.FromString("nginx")
+	busybox := digest.FromString("busybox")
+	lockfile := `
+# pinned source images
+nginx:latest ` + nginx.String() + `
+  ghcr.io/dragonflyoss/busybox:v1   ` + busybox.String() + `
+`
+	digests, err := ParseLockfile(strings.NewReader(lockfile))
+	require.NoError(t, err)
+	require.Equal(t, map[string]digest.Digest{
+		"docker.io/library/nginx:latest":  nginx,
+		"ghcr.io/dragonflyoss/busybox:v1": busybox,
+	}, digests)
+
+	_, err = ParseLockfile(strings.NewReader("nginx:latest"))
+	require.Error(t, err)
+	_, err = ParseLockfile(strings.NewReader("nginx:latest sha256:invalid"))
+	require.Error(t, err)
+}
+
+func TestTrustPolicy(t *testing.T) {
+	policy := &TrustPolicy{
+		AllowedSources: []string{"docker.io/library/", "ghcr.io/dragonflyoss/"},
+		DeniedSources:  []string{"docker.io/library/busybox"},
+	}
+	require.NoError(t, policy.CheckSource("nginx:latest"))
+	require.NoError(t, policy.CheckSource("ghcr.io/dragonflyoss/image:v1"))
+	require.Error(t, policy.CheckSource("busybox:latest"))
+	require.Error(t, policy.CheckSource("quay.io/foo/bar:v1"))
+	// No digest is pinned.
+	require.NoError(t, policy.CheckDigest("nginx:latest", digest.FromString("any")))
+
+	pinned := digest.FromString("nginx")
+	policy = &TrustPolicy{
+		Digests: map[string]digest.Digest{"docker.io/library/nginx:latest": pinned},
+	}
+	require.NoError(t, policy.CheckSource("nginx"))
+	require.Error(t, policy.CheckSource("redis:latest"))
+	require.NoError(t, policy.CheckDigest("docker.io/library/nginx:latest", pinned))
+	require.Error(t, policy.CheckDigest("docker.io/library/nginx:latest", digest.FromString("other")))
+
+	verify, err := policy.imageVerifier([]string{"nginx:latest"})
+	require.NoError(t, err)
+	require.NoError(t, verify("docker.io/library/nginx:latest", ocispec.Descriptor{Digest: pinned}))
+	err = verify("docker.io/library/nginx:latest", ocispec.Descriptor{Digest: digest.FromString("other")})
+	require.Error(t, err)
+	require.Equal(t, utils.ExitCodeValidation, utils.ExitCode(err))
+	// The images other than sources, e.g. chunk dict image, are not checked.
+	require.NoError(t, verify("docker.io/library/redis:latest", ocispec.Descriptor{Digest: pinned}))
+}
@@ -0,0 +1,228 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/content"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// whiteoutPrefix marks the file removed from the lower layers.
+	// See https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaqueDir marks the directory hiding the lower entries.
+	whiteoutOpaqueDir = whiteoutPrefix + whiteoutPrefix + ".opq"
+	// whiteoutMetaPrefix is reserved by AUFS for the metadata files.
+	whiteoutMetaPrefix = whiteoutPrefix + whiteoutPrefix
+)
+
+// The kinds of whiteout entries.
+const (
+	whiteoutKindFile   = "whiteout"
+	whiteoutKindOpaque = "opaque"
+	whiteoutKindMeta   = "aufs-meta"
+)
+
+// whiteoutRecord describes how a whiteout entry of source layer is
+// translated into the nydus overlay semantics, Warning is set for the
+// suspicious patterns.
+type whiteoutRecord struct {
+	Layer int
+	Kind  string
+	// Entry is the path of whiteout file in layer tar.
+	Entry string
+	// Target is the path removed or hidden by the whiteout.
+	Target      string
+	Translation string
+	Warning     string
+}
+
+// whiteoutAuditor replays the layers in order, tracking the paths existing
+// in the lower layers to check the whiteouts against them.
+type whiteoutAuditor struct {
+	lower   map[string]struct{}
+	records []whiteoutRecord
+}
+
+func newWhiteoutAuditor() *whiteoutAuditor {
+	return &whiteoutAuditor{
+		lower: map[string]struct{}{},
+	}
+}
+
+func cleanTarPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func (auditor *whiteoutAuditor) exists(target string) bool {
+	_, ok := auditor.lower[target]
+	return ok
+}
+
+func (auditor *whiteoutAuditor) hasChildren(dir string) bool {
+	prefix := dir + "/"
+	for entry := range auditor.lower {
+		if dir == "" || strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove deletes the path and its children from the lower layers, the path
+// itself is retained if keepSelf is set.
+func (auditor *whiteoutAuditor) remove(target string, keepSelf bool) {
+	if !keepSelf {
+		delete(auditor.lower, target)
+	}
+	prefix := target + "/"
+	for entry := range auditor.lower {
+		if target == "" || strings.HasPrefix(entry, prefix) {
+			delete(auditor.lower, entry)
+		}
+	}
+}
+
+func (auditor *whiteoutAuditor) add(entry string) {
+	for entry != "" && entry != "." {
+		auditor.lower[entry] = struct{}{}
+		entry = path.Dir(entry)
+	}
+}
+
+// audit reads the layer tar, the whiteouts are checked against the lower
+// layers before the entries of layer are added.
+func (auditor *whiteoutAuditor) audit(layer int, reader io.Reader) error {
+	var entries []string
+	upper := map[string]struct{}{}
+	var records []whiteoutRecord
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "read layer tar")
+		}
+
+		entry := cleanTarPath(hdr.Name)
+		dir, base := path.Split(entry)
+		dir = strings.TrimSuffix(dir, "/")
+		switch {
+		case base == whiteoutOpaqueDir:
+			record := whiteoutRecord{
+				Layer:       layer,
+				Kind:        whiteoutKindOpaque,
+				Entry:       entry,
+				Target:      dir,
+				Translation: "hide the lower entries of directory",
+			}
+			if !auditor.hasChildren(dir) {
+				record.Warning = "no lower entries to hide"
+			}
+			records = append(records, record)
+		case strings.HasPrefix(base, whiteoutMetaPrefix):
+			records = append(records, whiteoutRecord{
+				Layer:       layer,
+				Kind:        whiteoutKindMeta,
+				Entry:       entry,
+				Translation: "ignored",
+				Warning:     "unsupported AUFS metadata",
+			})
+		case strings.HasPrefix(base, whiteoutPrefix):
+			target := path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+			record := whiteoutRecord{
+				Layer:       layer,
+				Kind:        whiteoutKindFile,
+				Entry:       entry,
+				Target:      target,
+				Translation: "remove from the lower layers",
+			}
+			if layer == 0 {
+				record.Warning = "whiteout in the bottom layer"
+			} else if !auditor.exists(target) {
+				record.Warning = "whiteout of non-existent path"
+			}
+			records = append(records, record)
+		default:
+			entries = append(entries, entry)
+			upper[entry] = struct{}{}
+		}
+	}
+
+	for idx := range records {
+		record := &records[idx]
+		switch record.Kind {
+		case whiteoutKindOpaque:
+			auditor.remove(record.Target, true)
+		case whiteoutKindFile:
+			if _, ok := upper[record.Target]; ok && record.Warning == "" {
+				record.Warning = "whiteout and entry of the same path in one layer"
+			}
+			auditor.remove(record.Target, false)
+		}
+	}
+	for _, entry := range entries {
+		auditor.add(entry)
+	}
+	auditor.records = append(auditor.records, records...)
+
+	return nil
+}
+
+// auditWhiteouts logs how every whiteout entry of the layers is translated,
+// it returns the number of suspicious entries.
+func auditWhiteouts(ctx context.Context, cs content.Store, layers []ocispec.Descriptor, platform string) (int, error) {
+	auditor := newWhiteoutAuditor()
+	for idx, layer := range layers {
+		if err := func() error {
+			ra, err := cs.ReaderAt(ctx, layer)
+			if err != nil {
+				return errors.Wrap(err, "get layer reader")
+			}
+			defer ra.Close()
+			reader, err := compression.DecompressStream(io.NewSectionReader(ra, 0, ra.Size()))
+			if err != nil {
+				return errors.Wrap(err, "decompress layer")
+			}
+			defer reader.Close()
+			return auditor.audit(idx, reader)
+		}(); err != nil {
+			return 0, errors.Wrapf(err, "layer %s", layer.Digest)
+		}
+	}
+
+	suspicious := 0
+	for _, record := range auditor.records {
+		logger := logrus.WithFields(logrus.Fields{
+			"platform": platform,
+			"layer":    layers[record.Layer].Digest,
+			"kind":     record.Kind,
+			"entry":    record.Entry,
+			"target":   record.Target,
+		})
+		if record.Warning != "" {
+			suspicious++
+			logger.Warnf("whiteout audit: %s, %s", record.Translation, record.Warning)
+		} else {
+			logger.Infof("whiteout audit: %s", record.Translation)
+		}
+	}
+	logrus.Infof("whiteout audit of platform %q: %d whiteouts, %d suspicious", platform, len(auditor.records), suspicious)
+
+	return suspicious, nil
+}
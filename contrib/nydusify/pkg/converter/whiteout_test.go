@@ -0,0 +1,63 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestTar(t *testing.T, names ...string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+		}))
+	}
+	require.NoError(t, tw.Close())
+	return buf
+}
+
+func TestWhiteoutAuditor(t *testing.T) {
+	auditor := newWhiteoutAuditor()
+	require.NoError(t, auditor.audit(0, makeTestTar(t, "etc/passwd", "usr/lib/a.so", "usr/lib/b.so", "var/cache/x", "./.wh.ghost")))
+	require.NoError(t, auditor.audit(1, makeTestTar(t,
+		"etc/.wh.passwd",
+		"etc/passwd",
+		"usr/lib/.wh..wh..opq",
+		"usr/lib/c.so",
+		"var/.wh.missing",
+		"opt/.wh..wh..opq",
+		".wh..wh.plnk",
+	)))
+	require.NoError(t, auditor.audit(2, makeTestTar(t, "usr/lib/.wh.a.so", "usr/lib/.wh.c.so")))
+
+	warnings := map[string]string{}
+	for _, record := range auditor.records {
+		warnings[record.Entry] = record.Warning
+	}
+	require.Equal(t, map[string]string{
+		".wh.ghost":            "whiteout in the bottom layer",
+		"etc/.wh.passwd":       "whiteout and entry of the same path in one layer",
+		"usr/lib/.wh..wh..opq": "",
+		"var/.wh.missing":      "whiteout of non-existent path",
+		"opt/.wh..wh..opq":     "no lower entries to hide",
+		".wh..wh.plnk":         "unsupported AUFS metadata",
+		// a.so is hidden by the opaque directory of layer 1.
+		"usr/lib/.wh.a.so": "whiteout of non-existent path",
+		"usr/lib/.wh.c.so": "",
+	}, warnings)
+
+	require.True(t, auditor.exists("etc/passwd"))
+	require.True(t, auditor.exists("usr/lib"))
+	require.False(t, auditor.exists("usr/lib/c.so"))
+	require.True(t, auditor.exists("var/cache/x"))
+}
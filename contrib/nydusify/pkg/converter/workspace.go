@@ -0,0 +1,150 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/workspace"
+)
+
+// buildSpaceFactor estimates the space taken by building the nydus blobs
+// of an image, which is about three times the compressed size of layers,
+// since the blobs are built from the uncompressed layers.
+const buildSpaceFactor = 3
+
+// newWorkspace creates the workspace on the work directory and the temp
+// directories, and checks the available disk space for converting the
+// images unless disabled. The work directory of the nydus driver is set to a
+// temp directory of workspace, so that it's removed on failure.
+func newWorkspace(ctx context.Context, opt *Opt, pvdFunc func(contentDir string) (*provider.Provider, error), platformMC platforms.MatchComparer, sources []string, concurrency uint) (*workspace.Workspace, *provider.Provider, error) {
+	ws, err := workspace.New(append([]string{opt.WorkDir}, opt.TempDirs...)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	contentDir, err := ws.MkdirTemp("nydusify-")
+	if err != nil {
+		ws.Cleanup()
+		return nil, nil, err
+	}
+	pvd, err := pvdFunc(contentDir)
+	if err != nil {
+		ws.Cleanup()
+		return nil, nil, err
+	}
+
+	if !opt.SkipSpaceCheck {
+		if required, err := estimateSpace(ctx, pvd, sources, platformMC, concurrency); err != nil {
+			logrus.WithError(err).Warn("skip checking disk space due to failure of estimating image size")
+		} else if err := ws.Preflight(required); err != nil {
+			ws.Cleanup()
+			return nil, nil, err
+		}
+	}
+
+	if opt.WorkDir, err = ws.MkdirTemp("nydusify-build-"); err != nil {
+		ws.Cleanup()
+		return nil, nil, err
+	}
+
+	return ws, pvd, nil
+}
+
+// estimateSpace estimates the disk space required by converting the source
+// images, the pulled layers are kept in the shared content store, and at most
+// concurrency images are built at the same time.
+func estimateSpace(ctx context.Context, pvd *provider.Provider, sources []string, platformMC platforms.MatchComparer, concurrency uint) (uint64, error) {
+	total, largest := uint64(0), uint64(0)
+	for _, source := range sources {
+		size, err := imageSize(ctx, pvd, source, platformMC)
+		if err != nil {
+			return 0, errors.Wrapf(err, "estimate size of image %s", source)
+		}
+		total += size
+		if size > largest {
+			largest = size
+		}
+	}
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if int(concurrency) > len(sources) {
+		concurrency = uint(len(sources))
+	}
+	return total + largest*buildSpaceFactor*uint64(concurrency), nil
+}
+
+// imageSize returns the compressed size of layers of the image matched the
+// platform.
+func imageSize(ctx context.Context, pvd *provider.Provider, ref string, platformMC platforms.MatchComparer) (uint64, error) {
+	resolver, err := pvd.Resolver(ref)
+	if err != nil {
+		return 0, err
+	}
+	name, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return 0, errors.Wrap(err, "resolve image")
+	}
+	fetcher, err := resolver.Fetcher(ctx, name)
+	if err != nil {
+		return 0, errors.Wrap(err, "create fetcher")
+	}
+	return layersSize(ctx, fetcher, desc, platformMC)
+}
+
+func layersSize(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor, platformMC platforms.MatchComparer) (uint64, error) {
+	reader, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return 0, errors.Wrapf(err, "fetch %s", desc.Digest)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, errors.Wrapf(err, "read %s", desc.Digest)
+	}
+
+	switch {
+	case images.IsIndexType(desc.MediaType):
+		var index ocispec.Index
+		if err := json.Unmarshal(data, &index); err != nil {
+			return 0, errors.Wrap(err, "unmarshal image index")
+		}
+		size := uint64(0)
+		for _, manifest := range index.Manifests {
+			if manifest.Platform != nil && !platformMC.Match(*manifest.Platform) {
+				continue
+			}
+			manifestSize, err := layersSize(ctx, fetcher, manifest, platformMC)
+			if err != nil {
+				return 0, err
+			}
+			size += manifestSize
+		}
+		return size, nil
+	case images.IsManifestType(desc.MediaType):
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return 0, errors.Wrap(err, "unmarshal image manifest")
+		}
+		size := uint64(0)
+		for _, layer := range manifest.Layers {
+			size += uint64(layer.Size)
+		}
+		return size, nil
+	default:
+		return 0, errors.Errorf("unsupported image media type %s", desc.MediaType)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/platforms"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+type mapFetcher map[digest.Digest][]byte
+
+func (f mapFetcher) Fetch(_ context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+	data, ok := f[desc.Digest]
+	if !ok {
+		return nil, errdefs.ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (f mapFetcher) add(t *testing.T, mediaType string, obj interface{}) ocispec.Descriptor {
+	data, err := json.Marshal(obj)
+	require.NoError(t, err)
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	f[desc.Digest] = data
+	return desc
+}
+
+func TestLayersSize(t *testing.T) {
+	fetcher := mapFetcher{}
+	amd64 := fetcher.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Layers: []ocispec.Descriptor{{Size: 100}, {Size: 200}},
+	})
+	amd64.Platform = &ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := fetcher.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Layers: []ocispec.Descriptor{{Size: 1000}},
+	})
+	arm64.Platform = &ocispec.Platform{OS: "linux", Architecture: "arm64"}
+	index := fetcher.add(t, ocispec.MediaTypeImageIndex, ocispec.Index{
+		Manifests: []ocispec.Descriptor{amd64, arm64},
+	})
+
+	ctx := context.Background()
+	size, err := layersSize(ctx, fetcher, amd64, platforms.All)
+	require.NoError(t, err)
+	require.Equal(t, uint64(300), size)
+
+	size, err = layersSize(ctx, fetcher, index, platforms.All)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1300), size)
+
+	size, err = layersSize(ctx, fetcher, index, platforms.Only(*arm64.Platform))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), size)
+
+	_, err = layersSize(ctx, fetcher, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("missing")}, platforms.All)
+	require.Error(t, err)
+}
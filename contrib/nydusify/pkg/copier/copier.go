@@ -20,6 +20,7 @@ import (
 	"github.com/containerd/containerd/platforms"
 	"github.com/containerd/containerd/reference/docker"
 	"github.com/containerd/nydus-snapshotter/pkg/converter"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter/provider"
@@ -71,7 +72,7 @@ func hosts(opt Opt) remote.HostFunc {
 		opt.Target: opt.TargetInsecure,
 	}
 	return func(ref string) (remote.CredentialFunc, bool, error) {
-		return remote.NewDockerConfigCredFunc(), maps[ref], nil
+		return auth.CredFunc, maps[ref], nil
 	}
 }
 
@@ -159,14 +160,14 @@ func pushBlobFromBackend(
 
 				blobID := blobIDs[idx]
 				blobDigest := digest.Digest("sha256:" + blobID)
-				blobSize, err := backend.Size(blobID)
+				blobSize, err := backend.Size(ctx, blobID)
 				if err != nil {
 					return errors.Wrap(err, "get blob size")
 				}
 				blobSizeStr := humanize.Bytes(uint64(blobSize))
 
 				logrus.WithField("digest", blobDigest).WithField("size", blobSizeStr).Infof("pushing blob from backend")
-				rc, err := backend.Reader(blobID)
+				rc, err := backend.Reader(ctx, blobID)
 				if err != nil {
 					return errors.Wrap(err, "get blob reader")
 				}
@@ -0,0 +1,284 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package doctor checks the prerequisites of nydusify in the environment,
+// such as the binaries, kernel features, registry and storage backend
+// connectivity and disk space, and reports whether it's ready before running
+// a long conversion.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/workspace"
+)
+
+// Status is the result of a check.
+type Status string
+
+const (
+	// StatusOK means the prerequisite is satisfied.
+	StatusOK Status = "ok"
+	// StatusWarn means the prerequisite of some features is not satisfied,
+	// for example FUSE is only required by mounting and checking.
+	StatusWarn Status = "warn"
+	// StatusFail means the environment is not ready.
+	StatusFail Status = "fail"
+	// StatusSkip means the check is not applicable, for example the kernel
+	// features on macOS.
+	StatusSkip Status = "skip"
+)
+
+// probeBlobID is checked in storage backend to verify the connectivity and
+// credentials, it's not expected to exist.
+const probeBlobID = "nydusify-doctor-probe"
+
+// The kernel interfaces checked on Linux, they are variables to be replaced
+// in tests.
+var (
+	fuseDevice       = "/dev/fuse"
+	cachefilesDevice = "/dev/cachefiles"
+	procFilesystems  = "/proc/filesystems"
+)
+
+// Opt defines the doctor options, the registry, backend and space checks
+// are skipped if not specified.
+type Opt struct {
+	NydusImagePath string
+	NydusdPath     string
+
+	// Images are the image references resolved to check the registry
+	// connectivity and credentials.
+	Images   []string
+	Insecure bool
+
+	BackendType   string
+	BackendConfig string
+
+	// WorkDirs are the directories storing the temporary files, each one
+	// should have RequiredSpace available.
+	WorkDirs      []string
+	RequiredSpace uint64
+
+	// Timeout bounds each network check, 0 means no limit.
+	Timeout time.Duration
+}
+
+// Check is the result of checking a prerequisite.
+type Check struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+}
+
+// Report is the readiness report of environment, it's ready if no check
+// fails.
+type Report struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+func (report *Report) add(name string, status Status, format string, args ...interface{}) {
+	report.Checks = append(report.Checks, Check{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+	if status == StatusFail {
+		report.Ready = false
+	}
+}
+
+// Run checks the prerequisites and returns the report, the failed checks are
+// recorded in the report instead of returned as error.
+func Run(ctx context.Context, opt Opt) *Report {
+	report := &Report{Ready: true}
+
+	checkBinary(report, "nydus-image", opt.NydusImagePath, StatusFail)
+	checkBinary(report, "nydusd", opt.NydusdPath, StatusWarn)
+	checkKernel(report)
+	for _, ref := range opt.Images {
+		checkRegistry(ctx, report, ref, opt.Insecure, opt.Timeout)
+	}
+	if opt.BackendType != "" {
+		checkBackend(ctx, report, opt.BackendType, opt.BackendConfig, opt.Timeout)
+	}
+	for _, dir := range opt.WorkDirs {
+		checkSpace(report, dir, opt.RequiredSpace)
+	}
+
+	return report
+}
+
+// binaryVersion returns the first line of `--version` output of binary.
+func binaryVersion(path string) (string, error) {
+	output, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]), nil
+}
+
+// checkBinary finds the binary and gets its version, the missing binary is
+// reported with the status.
+func checkBinary(report *Report, name, path string, missing Status) {
+	if path == "" {
+		path = name
+	}
+	found, err := exec.LookPath(path)
+	if err != nil {
+		report.add(name, missing, "%s not found: %v", path, err)
+		return
+	}
+	version, err := binaryVersion(found)
+	if err != nil {
+		report.add(name, StatusFail, "%s is not runnable: %v", found, err)
+		return
+	}
+	report.add(name, StatusOK, "%s: %s", found, version)
+}
+
+// checkKernel checks the kernel features used to mount nydus images, they
+// are only required by mounting and checking the images.
+func checkKernel(report *Report) {
+	if runtime.GOOS != "linux" {
+		report.add("fuse", StatusSkip, "not supported on %s", runtime.GOOS)
+		report.add("erofs", StatusSkip, "not supported on %s", runtime.GOOS)
+		report.add("fscache", StatusSkip, "not supported on %s", runtime.GOOS)
+		return
+	}
+
+	if _, err := os.Stat(fuseDevice); err != nil {
+		report.add("fuse", StatusWarn, "%s is not available, mounting and checking images by nydusd require FUSE: %v", fuseDevice, err)
+	} else {
+		report.add("fuse", StatusOK, "%s is available", fuseDevice)
+	}
+
+	filesystems, err := os.ReadFile(procFilesystems)
+	switch {
+	case err != nil:
+		report.add("erofs", StatusWarn, "failed to read %s: %v", procFilesystems, err)
+	case hasFilesystem(string(filesystems), "erofs"):
+		report.add("erofs", StatusOK, "erofs is supported by kernel")
+	default:
+		report.add("erofs", StatusWarn, "erofs is not supported by kernel or the module is not loaded, RAFS v6 images can only be mounted by FUSE")
+	}
+
+	if _, err := os.Stat(cachefilesDevice); err != nil {
+		report.add("fscache", StatusWarn, "%s is not available, the kernel fscache mode of snapshotter is not supported: %v", cachefilesDevice, err)
+	} else {
+		report.add("fscache", StatusOK, "%s is available", cachefilesDevice)
+	}
+}
+
+// hasFilesystem returns whether the filesystem type is listed in the content
+// of /proc/filesystems.
+func hasFilesystem(filesystems, name string) bool {
+	for _, line := range strings.Split(filesystems, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// failure describes the error with its classification, so that the
+// credential and network problems are distinguished in the report.
+func failure(err error) string {
+	switch utils.ExitCode(err) {
+	case utils.ExitCodeAuth:
+		return fmt.Sprintf("authentication failed: %v", err)
+	case utils.ExitCodeBackendUnreachable:
+		return fmt.Sprintf("unreachable: %v", err)
+	default:
+		return err.Error()
+	}
+}
+
+// checkRegistry resolves the image reference with the registry credentials.
+func checkRegistry(ctx context.Context, report *Report, ref string, insecure bool, timeout time.Duration) {
+	name := "registry:" + ref
+	remoter, err := provider.DefaultRemote(ref, insecure)
+	if err != nil {
+		report.add(name, StatusFail, "invalid image reference: %v", err)
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	desc, err := remoter.Resolve(ctx)
+	if err != nil && insecure && utils.RetryWithHTTP(err) {
+		remoter.MaybeWithHTTP(err)
+		desc, err = remoter.Resolve(ctx)
+	}
+	if err != nil {
+		report.add(name, StatusFail, "%s", failure(errors.Wrap(err, "resolve image")))
+		return
+	}
+	report.add(name, StatusOK, "resolved %s", desc.Digest)
+}
+
+// checkBackend checks a blob in storage backend, which verifies the
+// connectivity and the read permission of credentials.
+func checkBackend(ctx context.Context, report *Report, backendType, backendConfig string, timeout time.Duration) {
+	name := "backend:" + backendType
+	be, err := backend.NewBackend(backendType, []byte(backendConfig), nil)
+	if err != nil {
+		report.add(name, StatusFail, "invalid backend configuration: %v", err)
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+	if _, err := be.Check(ctx, probeBlobID); err != nil {
+		report.add(name, StatusFail, "%s", failure(errors.Wrap(err, "check blob")))
+		return
+	}
+	report.add(name, StatusOK, "storage backend is accessible")
+}
+
+// checkSpace checks the available space of work directory.
+func checkSpace(report *Report, dir string, required uint64) {
+	name := "space:" + dir
+	// The directory is created by the later conversion, check the existing
+	// parent directory instead.
+	existing := dir
+	for {
+		if _, err := os.Stat(existing); err == nil || filepath.Dir(existing) == existing {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	available, err := workspace.Available(existing)
+	if err != nil {
+		report.add(name, StatusFail, "%v", err)
+		return
+	}
+	if available < required {
+		report.add(name, StatusFail, "%s available, %s required", humanize.IBytes(available), humanize.IBytes(required))
+		return
+	}
+	report.add(name, StatusOK, "%s available", humanize.IBytes(available))
+}
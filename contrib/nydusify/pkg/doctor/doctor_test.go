@@ -0,0 +1,78 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package doctor
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasFilesystem(t *testing.T) {
+	filesystems := "nodev\tsysfs\nnodev\ttmpfs\n\text4\n\terofs\nnodev\tfuse\n"
+	require.True(t, hasFilesystem(filesystems, "erofs"))
+	require.True(t, hasFilesystem(filesystems, "fuse"))
+	require.False(t, hasFilesystem(filesystems, "xfs"))
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script is not runnable on windows")
+	}
+	dir := t.TempDir()
+	nydusImage := filepath.Join(dir, "nydus-image")
+	require.NoError(t, os.WriteFile(nydusImage, []byte("#!/bin/sh\necho 'Version: 2.3.0'\necho 'Git Commit: abc'\n"), 0755))
+
+	fuse := filepath.Join(dir, "fuse")
+	require.NoError(t, os.WriteFile(fuse, nil, 0644))
+	filesystems := filepath.Join(dir, "filesystems")
+	require.NoError(t, os.WriteFile(filesystems, []byte("nodev\tfuse\n\terofs\n"), 0644))
+	defer func(fuse, cachefiles, filesystems string) {
+		fuseDevice, cachefilesDevice, procFilesystems = fuse, cachefiles, filesystems
+	}(fuseDevice, cachefilesDevice, procFilesystems)
+	fuseDevice, cachefilesDevice, procFilesystems = fuse, filepath.Join(dir, "cachefiles"), filesystems
+
+	report := Run(context.Background(), Opt{
+		NydusImagePath: nydusImage,
+		NydusdPath:     filepath.Join(dir, "nydusd"),
+		WorkDirs:       []string{filepath.Join(dir, "work/tmp")},
+	})
+	require.True(t, report.Ready)
+	statuses := map[string]Status{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	require.Equal(t, StatusOK, statuses["nydus-image"])
+	require.Contains(t, report.Checks[0].Message, "Version: 2.3.0")
+	require.Equal(t, StatusWarn, statuses["nydusd"])
+	require.Equal(t, StatusOK, statuses["space:"+filepath.Join(dir, "work/tmp")])
+	if runtime.GOOS == "linux" {
+		require.Equal(t, StatusOK, statuses["fuse"])
+		require.Equal(t, StatusOK, statuses["erofs"])
+		require.Equal(t, StatusWarn, statuses["fscache"])
+	}
+	require.NoDirExists(t, filepath.Join(dir, "work"))
+
+	report = Run(context.Background(), Opt{
+		NydusImagePath: filepath.Join(dir, "missing"),
+		WorkDirs:       []string{dir},
+		RequiredSpace:  math.MaxUint64,
+		BackendType:    "unknown",
+		Images:         []string{"INVALID:reference"},
+	})
+	require.False(t, report.Ready)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	require.Equal(t, StatusFail, statuses["nydus-image"])
+	require.Equal(t, StatusFail, statuses["space:"+dir])
+	require.Equal(t, StatusFail, statuses["backend:unknown"])
+	require.Equal(t, StatusFail, statuses["registry:INVALID:reference"])
+}
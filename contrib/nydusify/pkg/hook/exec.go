@@ -0,0 +1,126 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The stages of image conversion that the convert hooks are invoked at.
+const (
+	// StagePreLayer is invoked for each source layer before it's converted,
+	// the hook is able to replace the layer with a new uncompressed tar file,
+	// for example to strip unwanted files from the layer.
+	StagePreLayer = "pre-layer"
+	// StagePostLayer is invoked for each target layer after the image is
+	// converted, for example to scan or index the built layers.
+	StagePostLayer = "post-layer"
+	// StagePrePush is invoked before pushing the target image, the push is
+	// aborted if the hook fails.
+	StagePrePush = "pre-push"
+)
+
+var Stages = []string{StagePreLayer, StagePostLayer, StagePrePush}
+
+type Descriptor struct {
+	MediaType string `json:"media_type"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	// Path is the local file path of the blob, it's empty if the blob isn't
+	// available locally. The hook should treat the file as read-only.
+	Path string `json:"path,omitempty"`
+}
+
+// Event is passed to the convert hook at each stage.
+type Event struct {
+	Stage     string `json:"stage"`
+	SourceRef string `json:"source_ref"`
+	TargetRef string `json:"target_ref"`
+	// Manifest is the image manifest containing the layer in layer stages,
+	// or the target image manifest (index) in pre-push stage.
+	Manifest *Descriptor `json:"manifest,omitempty"`
+	Platform string      `json:"platform,omitempty"`
+	// Layer and Index are only set in layer stages, Index is the index of the
+	// layer in image manifest.
+	Layer *Descriptor `json:"layer,omitempty"`
+	Index int         `json:"index"`
+}
+
+// Result is returned by the convert hook, all fields are optional.
+type Result struct {
+	// LayerPath is the path of an uncompressed tar file to replace the source
+	// layer, only takes effect in pre-layer stage.
+	LayerPath string `json:"layer_path,omitempty"`
+}
+
+// ConvertHook allows integrators to plug custom logic into image conversion,
+// it's invoked at every stage and should ignore the uninterested stages by
+// returning a nil result.
+type ConvertHook interface {
+	Run(ctx context.Context, event *Event) (*Result, error)
+}
+
+// ExecHook runs an executable at the specified stage, the event is written to
+// the stdin of the process in JSON, and the result is read from the stdout of
+// the process in JSON, an empty output means an empty result. The hook fails
+// if the process exits with non-zero code.
+type ExecHook struct {
+	Stage   string
+	Command string
+}
+
+// ParseExecHook parses the exec hook formatted as `<stage>=<command>`,
+// the command is executed by `sh -c`.
+func ParseExecHook(spec string) (*ExecHook, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, fmt.Errorf("invalid hook %s, should be formatted as <stage>=<command>", spec)
+	}
+	stage := strings.TrimSpace(parts[0])
+	for _, s := range Stages {
+		if stage == s {
+			return &ExecHook{Stage: stage, Command: parts[1]}, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid hook stage %s, possible values: %s", stage, strings.Join(Stages, ", "))
+}
+
+func (h *ExecHook) Run(ctx context.Context, event *Event) (*Result, error) {
+	if event.Stage != h.Stage {
+		return nil, nil
+	}
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal hook event")
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", h.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "NYDUS_HOOK_STAGE="+event.Stage)
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "run %s hook %s", h.Stage, h.Command)
+	}
+
+	result := Result{}
+	if output := bytes.TrimSpace(stdout.Bytes()); len(output) > 0 {
+		if err := json.Unmarshal(output, &result); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal result of %s hook %s", h.Stage, h.Command)
+		}
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExecHook(t *testing.T) {
+	h, err := ParseExecHook("pre-layer=/usr/bin/strip --keep=a=b")
+	require.NoError(t, err)
+	require.Equal(t, &ExecHook{Stage: StagePreLayer, Command: "/usr/bin/strip --keep=a=b"}, h)
+
+	_, err = ParseExecHook("pre-layer")
+	require.Error(t, err)
+	_, err = ParseExecHook("pre-layer= ")
+	require.Error(t, err)
+	_, err = ParseExecHook("post-push=/usr/bin/true")
+	require.Error(t, err)
+}
+
+func TestExecHook(t *testing.T) {
+	ctx := context.Background()
+	event := &Event{
+		Stage: StagePreLayer,
+		Layer: &Descriptor{Path: "/tmp/layer"},
+	}
+
+	// The event is passed by stdin, and the result is read from stdout.
+	h := &ExecHook{
+		Stage:   StagePreLayer,
+		Command: `grep -q '"path":"/tmp/layer"' && echo "{\"layer_path\": \"/tmp/$NYDUS_HOOK_STAGE.tar\"}"`,
+	}
+	result, err := h.Run(ctx, event)
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/pre-layer.tar", result.LayerPath)
+
+	// Ignore the uninterested stage.
+	h.Stage = StagePrePush
+	result, err = h.Run(ctx, event)
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	// Empty output is allowed.
+	h = &ExecHook{Stage: StagePreLayer, Command: "cat > /dev/null"}
+	result, err = h.Run(ctx, event)
+	require.NoError(t, err)
+	require.Equal(t, &Result{}, result)
+
+	h = &ExecHook{Stage: StagePreLayer, Command: "exit 1"}
+	_, err = h.Run(ctx, event)
+	require.Error(t, err)
+
+	h = &ExecHook{Stage: StagePreLayer, Command: "echo invalid"}
+	_, err = h.Run(ctx, event)
+	require.Error(t, err)
+}
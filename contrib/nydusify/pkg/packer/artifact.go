@@ -12,10 +12,13 @@ import (
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
+// Artifact locates the build artifacts in the output directory.
 type Artifact struct {
 	OutputDir string
 }
 
+// NewArtifact creates the output directory if not exists, the default
+// directory is used if outputDir is empty.
 func NewArtifact(outputDir string) (Artifact, error) {
 	res := Artifact{OutputDir: outputDir}
 	if err := res.ensureOutputDir(); err != nil {
@@ -24,14 +27,18 @@ func NewArtifact(outputDir string) (Artifact, error) {
 	return res, nil
 }
 
-func (a Artifact) bootstrapPath(imageName string) string {
+// BootstrapPath returns the path of bootstrap, the `.meta` suffix is added if
+// the image name has no extension.
+func (a Artifact) BootstrapPath(imageName string) string {
 	if filepath.Ext(imageName) != "" {
 		return filepath.Join(a.OutputDir, imageName)
 	}
 	return filepath.Join(a.OutputDir, imageName+".meta")
 }
 
-func (a Artifact) blobFilePath(imageName string, isDigest bool) string {
+// BlobFilePath returns the path of blob named by the image name, or by the
+// blob digest if isDigest is true.
+func (a Artifact) BlobFilePath(imageName string, isDigest bool) string {
 	if isDigest {
 		return filepath.Join(a.OutputDir, imageName)
 	} else if suffix := filepath.Ext(imageName); suffix != "" {
@@ -40,7 +47,8 @@ func (a Artifact) blobFilePath(imageName string, isDigest bool) string {
 	return filepath.Join(a.OutputDir, imageName+".blob")
 }
 
-func (a Artifact) outputJSONPath() string {
+// OutputJSONPath returns the path of build output of nydus-image.
+func (a Artifact) OutputJSONPath() string {
 	return filepath.Join(a.OutputDir, "output.json")
 }
 
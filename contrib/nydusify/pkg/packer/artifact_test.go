@@ -15,21 +15,21 @@ func TestArtifactPath(t *testing.T) {
 	artifact, err := NewArtifact("")
 	defer os.RemoveAll("./.nydus-build-output")
 	require.NoError(t, err)
-	require.Equal(t, ".nydus-build-output/test.meta", artifact.bootstrapPath("test.meta"))
-	require.Equal(t, ".nydus-build-output/test.m", artifact.bootstrapPath("test.m"))
-	require.Equal(t, ".nydus-build-output/test.meta", artifact.bootstrapPath("test"))
-	require.Equal(t, ".nydus-build-output/test.blob", artifact.blobFilePath("test.meta", false))
-	require.Equal(t, ".nydus-build-output/test.blob", artifact.blobFilePath("test.m", false))
-	require.Equal(t, ".nydus-build-output/test.blob", artifact.blobFilePath("test", false))
-	require.Equal(t, ".nydus-build-output/test", artifact.blobFilePath("test", true))
+	require.Equal(t, ".nydus-build-output/test.meta", artifact.BootstrapPath("test.meta"))
+	require.Equal(t, ".nydus-build-output/test.m", artifact.BootstrapPath("test.m"))
+	require.Equal(t, ".nydus-build-output/test.meta", artifact.BootstrapPath("test"))
+	require.Equal(t, ".nydus-build-output/test.blob", artifact.BlobFilePath("test.meta", false))
+	require.Equal(t, ".nydus-build-output/test.blob", artifact.BlobFilePath("test.m", false))
+	require.Equal(t, ".nydus-build-output/test.blob", artifact.BlobFilePath("test", false))
+	require.Equal(t, ".nydus-build-output/test", artifact.BlobFilePath("test", true))
 
 	artifact, err = NewArtifact("/tmp")
 	require.NoError(t, err)
-	require.Equal(t, "/tmp/test.meta", artifact.bootstrapPath("test.meta"))
-	require.Equal(t, "/tmp/test.m", artifact.bootstrapPath("test.m"))
-	require.Equal(t, "/tmp/test.meta", artifact.bootstrapPath("test"))
-	require.Equal(t, "/tmp/test.blob", artifact.blobFilePath("test.meta", false))
-	require.Equal(t, "/tmp/test.blob", artifact.blobFilePath("test.m", false))
-	require.Equal(t, "/tmp/test.blob", artifact.blobFilePath("test", false))
-	require.Equal(t, "/tmp/test", artifact.blobFilePath("test", true))
+	require.Equal(t, "/tmp/test.meta", artifact.BootstrapPath("test.meta"))
+	require.Equal(t, "/tmp/test.m", artifact.BootstrapPath("test.m"))
+	require.Equal(t, "/tmp/test.meta", artifact.BootstrapPath("test"))
+	require.Equal(t, "/tmp/test.blob", artifact.BlobFilePath("test.meta", false))
+	require.Equal(t, "/tmp/test.blob", artifact.BlobFilePath("test.m", false))
+	require.Equal(t, "/tmp/test.blob", artifact.BlobFilePath("test", false))
+	require.Equal(t, "/tmp/test", artifact.BlobFilePath("test", true))
 }
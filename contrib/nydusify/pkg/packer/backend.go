@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
 )
 
 type BackendConfig interface {
@@ -27,29 +28,45 @@ type OssBackendConfig struct {
 	BucketName      string `json:"bucket_name"`
 	MetaPrefix      string `json:"meta_prefix"`
 	BlobPrefix      string `json:"blob_prefix"`
+
+	Transport *remote.TransportConfig `json:"transport,omitempty"`
+
+	// StorageClass, Tags and Metadata are applied to both the uploaded
+	// bootstrap and blobs.
+	StorageClass string            `json:"storage_class,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
 }
 
 func (cfg *OssBackendConfig) rawMetaBackendCfg() []byte {
-	configMap := map[string]string{
-		"endpoint":          cfg.Endpoint,
-		"access_key_id":     cfg.AccessKeyID,
-		"access_key_secret": cfg.AccessKeySecret,
-		"bucket_name":       cfg.BucketName,
-		"object_prefix":     cfg.MetaPrefix,
+	ossConfig := backend.OSSConfig{
+		Endpoint:        cfg.Endpoint,
+		AccessKeyID:     cfg.AccessKeyID,
+		AccessKeySecret: cfg.AccessKeySecret,
+		BucketName:      cfg.BucketName,
+		ObjectPrefix:    cfg.MetaPrefix,
+		Transport:       cfg.Transport,
+		StorageClass:    cfg.StorageClass,
+		Tags:            cfg.Tags,
+		Metadata:        cfg.Metadata,
 	}
-	b, _ := json.Marshal(configMap)
+	b, _ := json.Marshal(ossConfig)
 	return b
 }
 
 func (cfg *OssBackendConfig) rawBlobBackendCfg() []byte {
-	configMap := map[string]string{
-		"endpoint":          cfg.Endpoint,
-		"access_key_id":     cfg.AccessKeyID,
-		"access_key_secret": cfg.AccessKeySecret,
-		"bucket_name":       cfg.BucketName,
-		"object_prefix":     cfg.BlobPrefix,
+	ossConfig := backend.OSSConfig{
+		Endpoint:        cfg.Endpoint,
+		AccessKeyID:     cfg.AccessKeyID,
+		AccessKeySecret: cfg.AccessKeySecret,
+		BucketName:      cfg.BucketName,
+		ObjectPrefix:    cfg.BlobPrefix,
+		Transport:       cfg.Transport,
+		StorageClass:    cfg.StorageClass,
+		Tags:            cfg.Tags,
+		Metadata:        cfg.Metadata,
 	}
-	b, _ := json.Marshal(configMap)
+	b, _ := json.Marshal(ossConfig)
 	return b
 }
 
@@ -66,6 +83,8 @@ type S3BackendConfig struct {
 	BucketName      string `json:"bucket_name"`
 	MetaPrefix      string `json:"meta_prefix"`
 	BlobPrefix      string `json:"blob_prefix"`
+
+	Transport *remote.TransportConfig `json:"transport,omitempty"`
 }
 
 func (cfg *S3BackendConfig) rawMetaBackendCfg() []byte {
@@ -77,6 +96,7 @@ func (cfg *S3BackendConfig) rawMetaBackendCfg() []byte {
 		BucketName:      cfg.BucketName,
 		Region:          cfg.Region,
 		ObjectPrefix:    cfg.MetaPrefix,
+		Transport:       cfg.Transport,
 	}
 	b, _ := json.Marshal(s3Config)
 	return b
@@ -91,6 +111,7 @@ func (cfg *S3BackendConfig) rawBlobBackendCfg() []byte {
 		BucketName:      cfg.BucketName,
 		Region:          cfg.Region,
 		ObjectPrefix:    cfg.BlobPrefix,
+		Transport:       cfg.Transport,
 	}
 	b, _ := json.Marshal(s3Config)
 	return b
@@ -99,3 +120,23 @@ func (cfg *S3BackendConfig) rawBlobBackendCfg() []byte {
 func (cfg *S3BackendConfig) backendType() string {
 	return "s3"
 }
+
+// RegistryBackendConfig pushes the bootstrap and blobs to registry as an OCI
+// artifact, the schema is the same as the registry backend config of nydusd.
+type RegistryBackendConfig struct {
+	backend.RegistryConfig
+}
+
+func (cfg *RegistryBackendConfig) rawMetaBackendCfg() []byte {
+	b, _ := json.Marshal(cfg.RegistryConfig)
+	return b
+}
+
+func (cfg *RegistryBackendConfig) rawBlobBackendCfg() []byte {
+	b, _ := json.Marshal(cfg.RegistryConfig)
+	return b
+}
+
+func (cfg *RegistryBackendConfig) backendType() string {
+	return "registry"
+}
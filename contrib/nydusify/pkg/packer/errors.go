@@ -0,0 +1,98 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"os"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies the failures of packer, so that the automation
+// wrapping the packer is able to decide whether to retry.
+type ErrorKind string
+
+const (
+	// ErrorKindBuilder is for the failures of nydus-image, retrying with the
+	// same source directory and options is not expected to succeed.
+	ErrorKindBuilder ErrorKind = "builder"
+	// ErrorKindBackendAuth is for the authentication or authorization
+	// failures of storage backend, the credentials need to be fixed.
+	ErrorKindBackendAuth ErrorKind = "backend_auth"
+	// ErrorKindArtifactMissing is for the missing bootstrap, blob or
+	// output.json in output directory.
+	ErrorKindArtifactMissing ErrorKind = "artifact_missing"
+	// ErrorKindInvalidOutput is for the output.json not written in the
+	// format expected.
+	ErrorKindInvalidOutput ErrorKind = "invalid_output"
+)
+
+// Error is a classified failure of packer with the hint to resolve it.
+type Error struct {
+	Kind ErrorKind
+	Hint string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (k ErrorKind) exitCode() int {
+	switch k {
+	case ErrorKindBuilder:
+		return utils.ExitCodeBuilder
+	case ErrorKindBackendAuth:
+		return utils.ExitCodeAuth
+	case ErrorKindArtifactMissing:
+		return utils.ExitCodeArtifactMissing
+	case ErrorKindInvalidOutput:
+		return utils.ExitCodeInvalidOutput
+	default:
+		return utils.ExitCodeFailure
+	}
+}
+
+// newError classifies the error with the hint, and attaches the exit code
+// of kind.
+func newError(kind ErrorKind, hint string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return utils.WithExitCode(kind.exitCode(), &Error{Kind: kind, Hint: hint, Err: err})
+}
+
+// artifactError classifies the failure of reading the build artifact, it's
+// a missing artifact if the file does not exist.
+func artifactError(err error, hint string) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return newError(ErrorKindArtifactMissing, hint, err)
+	}
+	return err
+}
+
+// backendError classifies the authentication failure of storage backend.
+func backendError(err error) error {
+	if utils.ExitCode(err) == utils.ExitCodeAuth {
+		return newError(ErrorKindBackendAuth, "check the credentials and permissions in backend config, the access key needs to read and write the bucket or repository", err)
+	}
+	return err
+}
+
+// checkArtifacts ensures the files to push exist in output directory.
+func checkArtifacts(paths ...string) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return artifactError(errors.Wrapf(err, "check build artifact %s", path),
+				"the bootstrap and blob are built into output directory by pack, check the output directory and image name, and the files are not removed before pushing")
+		}
+	}
+	return nil
+}
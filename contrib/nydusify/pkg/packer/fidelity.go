@@ -0,0 +1,273 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+// The policies of hardlinks, special files and sparse files in source
+// directory.
+const (
+	// HardlinkPreserve keeps the hardlinks linked in the image.
+	HardlinkPreserve = "preserve"
+	// HardlinkCopy stores each hardlink as a separated regular file.
+	HardlinkCopy = "copy"
+
+	// SpecialFileKeep keeps the sockets, fifos and device files.
+	SpecialFileKeep = "keep"
+	// SpecialFileSkip drops the sockets, fifos and device files.
+	SpecialFileSkip = "skip"
+	// SpecialFileFail refuses the source directory with special files.
+	SpecialFileFail = "fail"
+
+	// SparseDedup stores the holes of sparse files as zero chunks, which
+	// are deduplicated in the blob.
+	SparseDedup = "dedup"
+	// SparseFail refuses the source directory with sparse files.
+	SparseFail = "fail"
+)
+
+// maxReportedMismatches limits the mismatched files reported by verifying
+// the test mount.
+const maxReportedMismatches = 10
+
+// sourceStats summarizes the files needing special handling in source
+// directory.
+type sourceStats struct {
+	// Hardlinks is the number of extra links to the regular files.
+	Hardlinks int
+	// SpecialFiles are the paths of sockets, fifos and device files.
+	SpecialFiles []string
+	// Sockets is the number of sockets in SpecialFiles.
+	Sockets int
+	// SparseFiles are the paths of files with holes.
+	SparseFiles []string
+	// HoleBytes is the total size of holes in SparseFiles.
+	HoleBytes int64
+}
+
+// inodeStat is the comparable stat of a file in source directory or the test
+// mount of built image.
+type inodeStat struct {
+	Mode    fs.FileMode
+	Size    int64
+	UID     uint32
+	GID     uint32
+	Rdev    uint64
+	Nlink   uint64
+	Symlink string
+}
+
+func isSpecialFile(mode fs.FileMode) bool {
+	return mode&(fs.ModeSocket|fs.ModeNamedPipe|fs.ModeDevice|fs.ModeCharDevice) != 0
+}
+
+func validateFidelity(req *PackRequest) error {
+	if req.Hardlink == "" {
+		req.Hardlink = HardlinkPreserve
+	}
+	if req.SpecialFile == "" {
+		req.SpecialFile = SpecialFileKeep
+	}
+	if req.Sparse == "" {
+		req.Sparse = SparseDedup
+	}
+	switch {
+	case req.Hardlink != HardlinkPreserve && req.Hardlink != HardlinkCopy:
+		return errors.Errorf("invalid hardlink policy %q, possible values: %s, %s", req.Hardlink, HardlinkPreserve, HardlinkCopy)
+	case req.SpecialFile != SpecialFileKeep && req.SpecialFile != SpecialFileSkip && req.SpecialFile != SpecialFileFail:
+		return errors.Errorf("invalid special file policy %q, possible values: %s, %s, %s", req.SpecialFile, SpecialFileKeep, SpecialFileSkip, SpecialFileFail)
+	case req.Sparse != SparseDedup && req.Sparse != SparseFail:
+		return errors.Errorf("invalid sparse file policy %q, possible values: %s, %s", req.Sparse, SparseDedup, SparseFail)
+	case req.VerifyMount && (req.Parent != "" || req.ChunkDict != ""):
+		return errors.New("verifying mount is unable to read the blobs of parent bootstrap or chunk dict")
+	}
+	return nil
+}
+
+// scanSource walks the source directory to find the hardlinks, special files
+// and sparse files.
+func scanSource(sourceDir string) (*sourceStats, error) {
+	stats := &sourceStats{}
+	seen := map[fileID]bool{}
+	err := filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		switch {
+		case isSpecialFile(mode):
+			stats.SpecialFiles = append(stats.SpecialFiles, rel)
+			if mode&fs.ModeSocket != 0 {
+				stats.Sockets++
+			}
+		case mode.IsRegular():
+			if id, ok := hardlinkID(info); ok {
+				if seen[id] {
+					stats.Hardlinks++
+				}
+				seen[id] = true
+			}
+			if allocated, ok := allocatedSize(info); ok && allocated < info.Size() {
+				stats.SparseFiles = append(stats.SparseFiles, rel)
+				stats.HoleBytes += info.Size() - allocated
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to scan source directory %s", sourceDir)
+	}
+	return stats, nil
+}
+
+// checkSource applies the policies of request to the scanned files, and
+// returns whether the source directory needs to be written as tar stream to
+// copy the hardlinks or skip the special files.
+func checkSource(req *PackRequest, stats *sourceStats) (bool, error) {
+	if req.SpecialFile == SpecialFileFail && len(stats.SpecialFiles) > 0 {
+		return false, utils.WithExitCode(utils.ExitCodeValidation, errors.Errorf(
+			"found %d special files in source directory, for example %s", len(stats.SpecialFiles), stats.SpecialFiles[0]))
+	}
+	if req.Sparse == SparseFail && len(stats.SparseFiles) > 0 {
+		return false, utils.WithExitCode(utils.ExitCodeValidation, errors.Errorf(
+			"found %d sparse files in source directory, for example %s", len(stats.SparseFiles), stats.SparseFiles[0]))
+	}
+	withTar := req.Reproducible ||
+		(req.Hardlink == HardlinkCopy && stats.Hardlinks > 0) ||
+		(req.SpecialFile == SpecialFileSkip && len(stats.SpecialFiles) > 0)
+	if withTar && req.SpecialFile == SpecialFileKeep && stats.Sockets > 0 {
+		return false, utils.WithExitCode(utils.ExitCodeValidation, errors.Errorf(
+			"unable to keep %d sockets in tar stream of source directory, skip the special files instead", stats.Sockets))
+	}
+	return withTar, nil
+}
+
+// walkInodes collects the stats of files in the directory, the nlink of
+// regular files counts the links inside the directory only.
+func walkInodes(dir string, skipSpecialFiles bool) (map[string]inodeStat, error) {
+	inodes := map[string]inodeStat{}
+	links := map[fileID][]string{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if skipSpecialFiles && isSpecialFile(info.Mode()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		stat := fileStat(info)
+		stat.Mode = info.Mode()
+		switch {
+		case info.Mode().IsRegular():
+			stat.Size = info.Size()
+			stat.Nlink = 1
+			if id, ok := hardlinkID(info); ok {
+				links[id] = append(links[id], rel)
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			if stat.Symlink, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		inodes[rel] = stat
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, paths := range links {
+		for _, path := range paths {
+			stat := inodes[path]
+			stat.Nlink = uint64(len(paths))
+			inodes[path] = stat
+		}
+	}
+	return inodes, nil
+}
+
+// compareInodes compares the stats of files in the test mount with the
+// source directory, and returns the descriptions of mismatched files.
+func compareInodes(source, mounted map[string]inodeStat, copyHardlinks bool) []string {
+	paths := make([]string, 0, len(source))
+	for path := range source {
+		paths = append(paths, path)
+	}
+	for path := range mounted {
+		if _, ok := source[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	mismatches := []string{}
+	for _, path := range paths {
+		if path == "." {
+			// The root directory is not written to the tar stream.
+			continue
+		}
+		expected, ok := source[path]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: unexpected file", path))
+			continue
+		}
+		actual, ok := mounted[path]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: missing file", path))
+			continue
+		}
+		if copyHardlinks && expected.Mode.IsRegular() {
+			expected.Nlink = 1
+		}
+		if expected != actual {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %+v, got %+v", path, expected, actual))
+		}
+	}
+	return mismatches
+}
+
+// verifyInodes compares the test mount of built image with the source
+// directory.
+func verifyInodes(sourceDir, mountDir string, req *PackRequest) error {
+	skip := req.SpecialFile == SpecialFileSkip
+	source, err := walkInodes(sourceDir, skip)
+	if err != nil {
+		return errors.Wrapf(err, "failed to walk source directory %s", sourceDir)
+	}
+	mounted, err := walkInodes(mountDir, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to walk mounted image %s", mountDir)
+	}
+	mismatches := compareInodes(source, mounted, req.Hardlink == HardlinkCopy)
+	if len(mismatches) == 0 {
+		return nil
+	}
+	reported := mismatches[:min(len(mismatches), maxReportedMismatches)]
+	return errors.Errorf("found %d mismatched files in mounted image:\n%s", len(mismatches), strings.Join(reported, "\n"))
+}
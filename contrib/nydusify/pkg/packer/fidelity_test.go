@@ -0,0 +1,125 @@
+//go:build !windows
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func prepareFidelitySource(t *testing.T) string {
+	sourceDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "file"), []byte("file"), 0644))
+	require.NoError(t, os.Link(filepath.Join(sourceDir, "file"), filepath.Join(sourceDir, "link")))
+	require.NoError(t, syscall.Mkfifo(filepath.Join(sourceDir, "fifo"), 0644))
+	sparse, err := os.Create(filepath.Join(sourceDir, "sparse"))
+	require.NoError(t, err)
+	require.NoError(t, sparse.Truncate(64<<20))
+	require.NoError(t, sparse.Close())
+	return sourceDir
+}
+
+func TestScanSource(t *testing.T) {
+	sourceDir := prepareFidelitySource(t)
+
+	stats, err := scanSource(sourceDir)
+	require.NoError(t, err)
+	require.Equal(t, 1, stats.Hardlinks)
+	require.Equal(t, []string{"fifo"}, stats.SpecialFiles)
+	require.Equal(t, 0, stats.Sockets)
+	require.Equal(t, []string{"sparse"}, stats.SparseFiles)
+	require.Greater(t, stats.HoleBytes, int64(0))
+
+	req := &PackRequest{}
+	require.NoError(t, validateFidelity(req))
+	withTar, err := checkSource(req, stats)
+	require.NoError(t, err)
+	require.False(t, withTar)
+
+	req = &PackRequest{Hardlink: HardlinkCopy}
+	require.NoError(t, validateFidelity(req))
+	withTar, err = checkSource(req, stats)
+	require.NoError(t, err)
+	require.True(t, withTar)
+
+	req = &PackRequest{SpecialFile: SpecialFileFail}
+	require.NoError(t, validateFidelity(req))
+	_, err = checkSource(req, stats)
+	require.ErrorContains(t, err, "found 1 special files")
+
+	req = &PackRequest{Sparse: SparseFail}
+	require.NoError(t, validateFidelity(req))
+	_, err = checkSource(req, stats)
+	require.ErrorContains(t, err, "found 1 sparse files")
+
+	require.ErrorContains(t, validateFidelity(&PackRequest{Hardlink: "keep"}), "invalid hardlink policy")
+	require.ErrorContains(t, validateFidelity(&PackRequest{VerifyMount: true, Parent: "parent"}), "unable to read the blobs")
+}
+
+func TestWriteTarOption(t *testing.T) {
+	sourceDir := prepareFidelitySource(t)
+
+	entries := func(opt tarOption) map[string]byte {
+		var buf bytes.Buffer
+		require.NoError(t, writeTar(sourceDir, &buf, opt))
+		types := map[string]byte{}
+		reader := tar.NewReader(&buf)
+		for {
+			hdr, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			types[hdr.Name] = hdr.Typeflag
+		}
+		return types
+	}
+
+	require.Equal(t, map[string]byte{
+		"fifo":   tar.TypeFifo,
+		"file":   tar.TypeReg,
+		"link":   tar.TypeLink,
+		"sparse": tar.TypeReg,
+	}, entries(tarOption{}))
+	require.Equal(t, map[string]byte{
+		"file":   tar.TypeReg,
+		"link":   tar.TypeReg,
+		"sparse": tar.TypeReg,
+	}, entries(tarOption{copyHardlinks: true, skipSpecialFiles: true}))
+}
+
+func TestCompareInodes(t *testing.T) {
+	sourceDir := prepareFidelitySource(t)
+	source, err := walkInodes(sourceDir, false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), source["file"].Nlink)
+	require.Equal(t, uint64(2), source["link"].Nlink)
+	require.Empty(t, compareInodes(source, source, false))
+
+	skipped, err := walkInodes(sourceDir, true)
+	require.NoError(t, err)
+	require.NotContains(t, skipped, "fifo")
+	require.Equal(t, []string{"fifo: missing file"}, compareInodes(source, skipped, false))
+
+	// The copied hardlinks are expected as separated files.
+	copied := map[string]inodeStat{}
+	for path, stat := range source {
+		if stat.Mode.IsRegular() {
+			stat.Nlink = 1
+		}
+		copied[path] = stat
+	}
+	require.Empty(t, compareInodes(source, copied, true))
+	require.Len(t, compareInodes(source, copied, false), 2)
+}
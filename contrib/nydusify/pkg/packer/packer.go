@@ -7,11 +7,16 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/build"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/compactor"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/workspace"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -19,6 +24,9 @@ import (
 const (
 	nydusBinaryName  = "nydus-image"
 	defaultOutputDir = "./.nydus-build-output"
+
+	builderHint    = "check the nydus-image logs above, the source directory is readable and the nydus-image version supports the build options"
+	outputJSONHint = "output.json is written by nydus-image, check the nydus-image version is compatible with nydusify and the output directory is not shared by concurrent builds"
 )
 
 var (
@@ -27,21 +35,47 @@ var (
 	ErrNoSupport                = errors.New("invalid chunk-dict type")
 )
 
+// Opt configures the packer, the zero value of optional fields uses the
+// default behavior.
 type Opt struct {
 	LogLevel       logrus.Level
 	NydusImagePath string
 	OutputDir      string
 	BackendConfig  BackendConfig
+	// SkipSpaceCheck disables checking the available disk space of output
+	// directory before building.
+	SkipSpaceCheck bool
+	// BackendTimeout bounds each operation of storage backend, for example
+	// uploading a blob, 0 means no limit.
+	BackendTimeout time.Duration
+	// BlobExistenceCache records the blobs known to exist in storage
+	// backend, it's able to be shared by packers to skip pushing the same
+	// parent blobs repeatedly.
+	BlobExistenceCache *backend.ExistenceCache
+
+	// Logger is used to log the progress instead of the logger created
+	// with LogLevel, so that the embedding service is able to attach its
+	// own fields and outputs.
+	Logger logrus.FieldLogger
+	// Builder builds the image instead of calling nydus-image directly.
+	Builder Builder
 }
 
+// Builder builds the bootstrap and blob from the source directory, the build
+// should be aborted when the context is done.
 type Builder interface {
-	Run(option build.BuilderOption) error
+	RunContext(ctx context.Context, option build.BuilderOption) error
 }
 
+// Packer builds the nydus image from a directory and pushes or pulls the
+// artifacts to or from the storage backend, it holds no global state and
+// multiple packers are able to run in the same process with different output
+// directories.
 type Packer struct {
-	logger         *logrus.Logger
+	logger         logrus.FieldLogger
 	nydusImagePath string
 	BackendConfig  BackendConfig
+	skipSpaceCheck bool
 	pusher         *Pusher
 	builder        Builder
 	Artifact
@@ -58,22 +92,56 @@ type PackRequest struct {
 	Compressor   string
 	ChunkSize    string
 	PushToRemote bool
+	// DigestAlgorithm is used to calculate the extra digests of built
+	// bootstrap and blob for verification, possible values: sha256, sha512,
+	// blake3. The blobs are still named by the sha256 blob ID.
+	DigestAlgorithm string
 
 	ChunkDict         string
 	Parent            string
 	TryCompact        bool
 	CompactConfigPath string
+
+	// Reproducible builds the image from a tar stream of source directory
+	// with the entries sorted and the modification time fixed to Timestamp
+	// (default to Unix epoch), and pins the builder options, so that
+	// packing the same directory yields the same bootstrap and blob.
+	Reproducible bool
+	Timestamp    time.Time
+
+	// Hardlink handles the hardlinks in source directory, possible values:
+	// 'preserve' (default), 'copy'.
+	Hardlink string
+	// SpecialFile handles the sockets, fifos and device files in source
+	// directory, possible values: 'keep' (default), 'skip', 'fail'.
+	SpecialFile string
+	// Sparse handles the sparse files in source directory, possible values:
+	// 'dedup' (default), 'fail'.
+	Sparse string
+	// VerifyMount mounts the built image by nydusd at NydusdPath, and
+	// compares the inode stats of files with the source directory.
+	VerifyMount bool
+	NydusdPath  string
 }
 
 type PackResult struct {
 	Meta string
 	Blob string
+	// MetaDigest and BlobDigest are formatted as `<algorithm>:<hex>`,
+	// BlobDigest is empty if no new blob is built.
+	MetaDigest string
+	BlobDigest string
 }
 
+// New creates the packer, the pusher is created only if the backend config
+// is specified.
 func New(opt Opt) (*Packer, error) {
-	logger, err := initLogger(opt.LogLevel)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to init logger")
+	logger := opt.Logger
+	if logger == nil {
+		var err error
+		if logger, err = initLogger(opt.LogLevel); err != nil {
+			return nil, errors.Wrap(err, "failed to init logger")
+		}
 	}
 	artifact, err := NewArtifact(opt.OutputDir)
 	if err != nil {
@@ -84,16 +152,23 @@ func New(opt Opt) (*Packer, error) {
 		BackendConfig:  opt.BackendConfig,
 		logger:         logger,
 		nydusImagePath: opt.NydusImagePath,
+		skipSpaceCheck: opt.SkipSpaceCheck,
 	}
 	if err = p.ensureNydusImagePath(); err != nil {
 		return nil, err
 	}
-	p.builder = build.NewBuilder(p.nydusImagePath)
+	p.builder = opt.Builder
+	if p.builder == nil {
+		p.builder = build.NewBuilder(p.nydusImagePath)
+	}
 	if p.BackendConfig != nil {
 		p.pusher, err = NewPusher(NewPusherOpt{
 			Artifact:      artifact,
 			BackendConfig: opt.BackendConfig,
 			Logger:        p.logger,
+			Timeout:       opt.BackendTimeout,
+
+			ExistenceCache: opt.BlobExistenceCache,
 		})
 		if err != nil {
 			return nil, err
@@ -149,13 +224,13 @@ func (p *Packer) getNewBlobsHash(exists []string) (string, error) {
 	for _, blob := range exists {
 		m[blob] = true
 	}
-	content, err := os.ReadFile(p.outputJSONPath())
+	content, err := os.ReadFile(p.OutputJSONPath())
 	if err != nil {
-		return "", err
+		return "", artifactError(err, outputJSONHint)
 	}
 	var manifest BlobManifest
 	if err = json.Unmarshal(content, &manifest); err != nil {
-		return "", err
+		return "", newError(ErrorKindInvalidOutput, outputJSONHint, errors.Wrapf(err, "invalid %s", p.OutputJSONPath()))
 	}
 	for _, blob := range manifest.Blobs {
 		if _, ok := m[blob]; !ok {
@@ -166,6 +241,146 @@ func (p *Packer) getNewBlobsHash(exists []string) (string, error) {
 	return "", nil
 }
 
+// recordDigests calculates the digests of bootstrap and blob with the
+// algorithm, and records them in output.json as `bootstrap_digest` and
+// `blob_digest` fields.
+func (p *Packer) recordDigests(bootstrapPath, blobPath, algorithm string) (string, string, error) {
+	metaDigest, err := utils.DigestFile(bootstrapPath, algorithm)
+	if err != nil {
+		return "", "", artifactError(err, builderHint)
+	}
+	var blobDigest digest.Digest
+	if blobPath != "" {
+		if blobDigest, err = utils.DigestFile(blobPath, algorithm); err != nil {
+			return "", "", artifactError(err, builderHint)
+		}
+	}
+
+	content, err := os.ReadFile(p.OutputJSONPath())
+	if err != nil {
+		return "", "", artifactError(err, outputJSONHint)
+	}
+	output := map[string]interface{}{}
+	if err = json.Unmarshal(content, &output); err != nil {
+		return "", "", newError(ErrorKindInvalidOutput, outputJSONHint, errors.Wrapf(err, "invalid %s", p.OutputJSONPath()))
+	}
+	output["bootstrap_digest"] = metaDigest
+	if blobDigest != "" {
+		output["blob_digest"] = blobDigest
+	}
+	if content, err = json.MarshalIndent(output, "", "  "); err != nil {
+		return "", "", err
+	}
+	if err = os.WriteFile(p.OutputJSONPath(), content, 0644); err != nil {
+		return "", "", err
+	}
+
+	return metaDigest.String(), blobDigest.String(), nil
+}
+
+// preflight checks the available space of output directory is enough for
+// the blob built from the source directory, which is not bigger than the
+// total size of source files.
+func (p *Packer) preflight(sourceDir string, withTar bool) error {
+	required, err := workspace.DirSize(sourceDir)
+	if err != nil {
+		return errors.Wrap(err, "failed to estimate size of source directory")
+	}
+	if withTar {
+		// The tar stream of source directory is also written to the output
+		// directory.
+		required *= 2
+	}
+	ws, err := workspace.New(p.OutputDir)
+	if err != nil {
+		return err
+	}
+	return ws.Preflight(required)
+}
+
+// writeSourceTar writes the tar stream of source directory into the output
+// directory, the returned cleanup function removes it.
+func (p *Packer) writeSourceTar(sourceDir string, opt tarOption) (string, func(), error) {
+	file, err := os.CreateTemp(p.OutputDir, "source-*.tar")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "failed to create tar file of source directory")
+	}
+	cleanup := func() {
+		os.Remove(file.Name())
+	}
+	if err := writeTar(sourceDir, file, opt); err != nil {
+		file.Close()
+		cleanup()
+		return "", nil, errors.Wrapf(err, "failed to write tar file of source directory %s", sourceDir)
+	}
+	if err := file.Close(); err != nil {
+		cleanup()
+		return "", nil, errors.Wrap(err, "failed to write tar file of source directory")
+	}
+	return file.Name(), cleanup, nil
+}
+
+// verifyMount mounts the built image by nydusd with the local blob, and
+// compares the inode stats of files with the source directory.
+func (p *Packer) verifyMount(req *PackRequest, bootstrapPath, blobPath, blobID string) error {
+	workDir, err := os.MkdirTemp(p.OutputDir, "verify-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	// The localfs backend of nydusd reads the blob by its id.
+	blobDir := filepath.Join(workDir, "blobs")
+	mountDir := filepath.Join(workDir, "mnt")
+	for _, dir := range []string{blobDir, mountDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	if blobPath != "" {
+		blobPath, err := filepath.Abs(blobPath)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(blobPath, filepath.Join(blobDir, blobID)); err != nil {
+			return err
+		}
+	}
+
+	nydusdPath := req.NydusdPath
+	if nydusdPath == "" {
+		nydusdPath = "nydusd"
+	}
+	nydusd, err := tool.NewNydusd(tool.NydusdConfig{
+		NydusdPath:    nydusdPath,
+		BootstrapPath: bootstrapPath,
+		ConfigPath:    filepath.Join(workDir, "nydusd-config.json"),
+		BlobDir:       blobDir,
+		BlobCacheDir:  filepath.Join(workDir, "cache"),
+		APISockPath:   filepath.Join(workDir, "nydusd-api.sock"),
+		MountPath:     mountDir,
+		Mode:          "direct",
+	})
+	if err != nil {
+		return err
+	}
+	if err := nydusd.Mount(); err != nil {
+		return errors.Wrap(err, "failed to mount packed image by nydusd")
+	}
+	defer func() {
+		if err := nydusd.Umount(false); err != nil {
+			p.logger.Warnf("failed to umount packed image: %v", err)
+		}
+	}()
+
+	if err := verifyInodes(req.SourceDir, mountDir, req); err != nil {
+		return err
+	}
+	p.logger.Infof("verified mount of packed image %s", bootstrapPath)
+
+	return nil
+}
+
 func (p *Packer) dumpBlobBackendConfig(filePath string) (func(), error) {
 	file, err := os.OpenFile(filePath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -180,7 +395,7 @@ func (p *Packer) dumpBlobBackendConfig(filePath string) (func(), error) {
 		zeros := make([]byte, n)
 		file, err = os.OpenFile(filePath, os.O_WRONLY, 0644)
 		if err != nil {
-			logrus.Errorf("failed to open config file %s, err = %v", filePath, err)
+			p.logger.Errorf("failed to open config file %s, err = %v", filePath, err)
 			return
 		}
 		file.Write(zeros)
@@ -227,8 +442,57 @@ func (p *Packer) tryCompactParent(req *PackRequest) error {
 	return nil
 }
 
-func (p *Packer) Pack(_ context.Context, req PackRequest) (PackResult, error) {
+// Pack builds the image from the source directory, and pushes the bootstrap
+// and blob to the storage backend if PushToRemote is true.
+func (p *Packer) Pack(ctx context.Context, req PackRequest) (PackResult, error) {
 	p.logger.Infof("start to build image from source directory %q", req.SourceDir)
+	if req.FsVersion == "" {
+		req.FsVersion = "6"
+	}
+	if err := (utils.FsOption{
+		FsVersion:  req.FsVersion,
+		Compressor: req.Compressor,
+		ChunkSize:  req.ChunkSize,
+	}).Validate(); err != nil {
+		return PackResult{}, utils.WithExitCode(utils.ExitCodeValidation, errors.Wrap(err, "invalid build option"))
+	}
+	if req.Reproducible {
+		if req.Compressor == "" {
+			req.Compressor = reproducibleCompressor
+		}
+		if req.ChunkSize == "" {
+			req.ChunkSize = reproducibleChunkSize
+		}
+		if req.Timestamp.IsZero() {
+			req.Timestamp = time.Unix(0, 0)
+		}
+	}
+	if req.DigestAlgorithm == "" {
+		req.DigestAlgorithm = utils.DigestSHA256
+	}
+	if err := utils.ValidateDigestAlgorithm(req.DigestAlgorithm); err != nil {
+		return PackResult{}, utils.WithExitCode(utils.ExitCodeValidation, err)
+	}
+	if err := validateFidelity(&req); err != nil {
+		return PackResult{}, utils.WithExitCode(utils.ExitCodeValidation, err)
+	}
+	if req.VerifyMount {
+		if err := utils.RequireLinux("verifying mount of packed image"); err != nil {
+			return PackResult{}, err
+		}
+	}
+	stats, err := scanSource(req.SourceDir)
+	if err != nil {
+		return PackResult{}, err
+	}
+	if stats.Hardlinks > 0 || len(stats.SpecialFiles) > 0 || len(stats.SparseFiles) > 0 {
+		p.logger.Infof("found %d hardlinks, %d special files, %d sparse files with %d bytes of holes in source directory",
+			stats.Hardlinks, len(stats.SpecialFiles), len(stats.SparseFiles), stats.HoleBytes)
+	}
+	withTar, err := checkSource(&req, stats)
+	if err != nil {
+		return PackResult{}, err
+	}
 	if err := p.tryCompactParent(&req); err != nil {
 		return PackResult{}, err
 	}
@@ -240,21 +504,52 @@ func (p *Packer) Pack(_ context.Context, req PackRequest) (PackResult, error) {
 	if err != nil {
 		return PackResult{}, errors.Wrap(err, "failed to get blobs from chunk-dict")
 	}
-	blobPath := p.blobFilePath(req.ImageName, false)
-	bootstrapPath := p.bootstrapPath(req.ImageName)
-	if err = p.builder.Run(build.BuilderOption{
+	if !p.skipSpaceCheck {
+		if err := p.preflight(req.SourceDir, withTar); err != nil {
+			return PackResult{}, err
+		}
+	}
+	rootfsPath, sourceType := req.SourceDir, ""
+	if withTar {
+		opt := tarOption{
+			copyHardlinks:    req.Hardlink == HardlinkCopy,
+			skipSpecialFiles: req.SpecialFile == SpecialFileSkip,
+		}
+		if req.Reproducible {
+			opt.mtime = req.Timestamp
+		}
+		tarPath, cleanup, err := p.writeSourceTar(req.SourceDir, opt)
+		if err != nil {
+			return PackResult{}, err
+		}
+		defer cleanup()
+		rootfsPath, sourceType = tarPath, "tar-rafs"
+	}
+	blobPath := p.BlobFilePath(req.ImageName, false)
+	bootstrapPath := p.BootstrapPath(req.ImageName)
+	if err = p.builder.RunContext(ctx, build.BuilderOption{
 		ParentBootstrapPath: req.Parent,
 		ChunkDict:           req.ChunkDict,
 		BootstrapPath:       bootstrapPath,
 		BlobPath:            blobPath,
-		OutputJSONPath:      p.outputJSONPath(),
-		RootfsPath:          req.SourceDir,
+		OutputJSONPath:      p.OutputJSONPath(),
+		RootfsPath:          rootfsPath,
+		SourceType:          sourceType,
 		WhiteoutSpec:        "oci",
 		Compressor:          req.Compressor,
 		ChunkSize:           req.ChunkSize,
 		FsVersion:           req.FsVersion,
 	}); err != nil {
-		return PackResult{}, errors.Wrapf(err, "failed to build image from directory %s", req.SourceDir)
+		// Remove the partial build artifact.
+		os.Remove(blobPath)
+		os.Remove(bootstrapPath)
+		if ctx.Err() != nil {
+			return PackResult{}, errors.Wrapf(err, "failed to build image from directory %s", req.SourceDir)
+		}
+		return PackResult{}, newError(ErrorKindBuilder, builderHint, errors.Wrapf(err, "failed to build image from directory %s", req.SourceDir))
+	}
+	if err := ctx.Err(); err != nil {
+		return PackResult{}, err
 	}
 	newBlobHash, err := p.getNewBlobsHash(append(parentBlobs, chunkDictBlobs...))
 	if err != nil {
@@ -265,39 +560,70 @@ func (p *Packer) Pack(_ context.Context, req PackRequest) (PackResult, error) {
 	} else {
 		if req.Parent != "" || req.PushToRemote {
 			p.logger.Infof("rename blob file into sha256 csum")
-			newBlobName := p.blobFilePath(newBlobHash, true)
+			newBlobName := p.BlobFilePath(newBlobHash, true)
 			if err = os.Rename(blobPath, newBlobName); err != nil {
 				return PackResult{}, errors.Wrap(err, "failed to rename blob file")
 			}
 			blobPath = newBlobName
 		}
 	}
+	if req.VerifyMount {
+		if err := p.verifyMount(&req, bootstrapPath, blobPath, newBlobHash); err != nil {
+			return PackResult{}, errors.Wrap(err, "failed to verify mount of packed image")
+		}
+	}
+	metaDigest, blobDigest, err := p.recordDigests(bootstrapPath, blobPath, req.DigestAlgorithm)
+	if err != nil {
+		return PackResult{}, errors.Wrap(err, "failed to record digests of build artifact")
+	}
 	if !req.PushToRemote {
 		// if we don't need to push meta and blob to remote, just return the local build artifact
 		return PackResult{
-			Meta: bootstrapPath,
-			Blob: blobPath,
+			Meta:       bootstrapPath,
+			Blob:       blobPath,
+			MetaDigest: metaDigest,
+			BlobDigest: blobDigest,
 		}, nil
 	}
 
-	// if pusher is empty, that means backend config is not provided
-	if p.pusher == nil {
-		return PackResult{}, errors.New("can not push image to remote due to lack of backend configuration")
-	}
-	pushResult, err := p.pusher.Push(PushRequest{
+	pushResult, err := p.Push(ctx, PushRequest{
 		Meta:        req.ImageName,
 		Blob:        newBlobHash,
 		ParentBlobs: parentBlobs,
+		MetaDigest:  metaDigest,
+		BlobDigest:  blobDigest,
 	})
 	if err != nil {
 		return PackResult{}, errors.Wrap(err, "failed to push pack result to remote")
 	}
 	return PackResult{
-		Meta: pushResult.RemoteMeta,
-		Blob: pushResult.RemoteBlob,
+		Meta:       pushResult.RemoteMeta,
+		Blob:       pushResult.RemoteBlob,
+		MetaDigest: pushResult.MetaDigest,
+		BlobDigest: pushResult.BlobDigest,
 	}, nil
 }
 
+// Push pushes the built bootstrap and blob in the output directory to the
+// storage backend.
+func (p *Packer) Push(ctx context.Context, req PushRequest) (PushResult, error) {
+	// if pusher is empty, that means backend config is not provided
+	if p.pusher == nil {
+		return PushResult{}, errors.New("can not push image to remote due to lack of backend configuration")
+	}
+	result, err := p.pusher.Push(ctx, req)
+	return result, backendError(err)
+}
+
+// Pull downloads the bootstrap and blobs from the storage backend into the
+// output directory.
+func (p *Packer) Pull(ctx context.Context, req PullRequest) (PullResult, error) {
+	if p.pusher == nil {
+		return PullResult{}, errors.New("can not pull image from remote due to lack of backend configuration")
+	}
+	return p.pusher.Pull(ctx, req)
+}
+
 // ensureNydusImagePath ensure nydus-image binary exists, the Precedence for nydus-image is as follows
 // 1. if nydusImagePath is specified try nydusImagePath first
 // 2. if nydusImagePath not exists, try to find nydus-image from $PATH
@@ -317,7 +643,7 @@ func (p *Packer) ensureNydusImagePath() error {
 			return nil
 		}
 	}
-	return ErrNydusImageBinaryNotFound
+	return newError(ErrorKindBuilder, "install nydus-image in PATH, or specify the path of nydus-image binary", ErrNydusImageBinaryNotFound)
 }
 
 func initLogger(logLevel logrus.Level) (*logrus.Logger, error) {
@@ -14,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/build"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
@@ -24,7 +25,7 @@ type mockBuilder struct {
 	mock.Mock
 }
 
-func (m *mockBuilder) Run(option build.BuilderOption) error {
+func (m *mockBuilder) RunContext(_ context.Context, option build.BuilderOption) error {
 	args := m.Called(option)
 	return args.Error(0)
 }
@@ -133,9 +134,16 @@ func TestPack(t *testing.T) {
 	copyFile("testdata/output.json", filepath.Join(tmpDir, "output.json"))
 	require.NoError(t, err)
 
+	for _, name := range []string{"test.meta", "test.blob"} {
+		file, err := os.Create(filepath.Join(tmpDir, name))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+	}
+	emptySHA256 := "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
 	builder := &mockBuilder{}
 	p.builder = builder
-	builder.On("Run", mock.Anything).Return(nil)
+	builder.On("RunContext", mock.Anything).Return(nil)
 	res, err := p.Pack(context.Background(), PackRequest{
 		SourceDir:    tmpDir,
 		ImageName:    "test.meta",
@@ -143,13 +151,34 @@ func TestPack(t *testing.T) {
 	})
 	require.NoError(t, err)
 	require.Equal(t, PackResult{
-		Meta: "testdata/TestPack/test.meta",
-		Blob: "testdata/TestPack/test.blob",
+		Meta:       "testdata/TestPack/test.meta",
+		Blob:       "testdata/TestPack/test.blob",
+		MetaDigest: emptySHA256,
+		BlobDigest: emptySHA256,
 	}, res)
+	output, err := os.ReadFile(filepath.Join(tmpDir, "output.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(output), `"blob_digest": "`+emptySHA256+`"`)
+
+	res, err = p.Pack(context.Background(), PackRequest{
+		SourceDir:       tmpDir,
+		ImageName:       "test.meta",
+		DigestAlgorithm: "blake3",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "blake3:af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", res.BlobDigest)
+
+	_, err = p.Pack(context.Background(), PackRequest{
+		SourceDir:       tmpDir,
+		ImageName:       "test.meta",
+		DigestAlgorithm: "md5",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported digest algorithm md5")
 
 	errBuilder := &mockBuilder{}
 	p.builder = errBuilder
-	errBuilder.On("Run", mock.Anything).Return(errors.New("test"))
+	errBuilder.On("RunContext", mock.Anything).Return(errors.New("test"))
 	res, err = p.Pack(context.Background(), PackRequest{
 		SourceDir:    tmpDir,
 		ImageName:    "test.meta",
@@ -157,6 +186,21 @@ func TestPack(t *testing.T) {
 	})
 	require.Error(t, err)
 	require.Empty(t, res)
+	var packErr *Error
+	require.True(t, errors.As(err, &packErr))
+	require.Equal(t, ErrorKindBuilder, packErr.Kind)
+	require.NotEmpty(t, packErr.Hint)
+	require.Equal(t, utils.ExitCodeBuilder, utils.ExitCode(err))
+
+	p.builder = builder
+	_, err = p.Pack(context.Background(), PackRequest{
+		SourceDir: tmpDir,
+		ImageName: "test.meta",
+		FsVersion: "5",
+		ChunkSize: "0x100001",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid chunk size")
 
 	os.Create(filepath.Join(tmpDir, "test.meta"))
 	os.Create(filepath.Join(tmpDir, "test.blob"))
@@ -202,8 +246,10 @@ func TestPack(t *testing.T) {
 	})
 	require.NoError(t, err)
 	require.Equal(t, PackResult{
-		Meta: "oss://testbucket/testmetaprefix/test.meta",
-		Blob: "oss://testbucket/testblobprefix/3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090",
+		Meta:       "oss://testbucket/testmetaprefix/test.meta",
+		Blob:       "oss://testbucket/testblobprefix/3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090",
+		MetaDigest: emptySHA256,
+		BlobDigest: emptySHA256,
 	}, res)
 }
 
@@ -217,6 +263,17 @@ func TestPusher_getBlobHash(t *testing.T) {
 	hash, err := pusher.getNewBlobsHash(nil)
 	require.NoError(t, err)
 	require.Equal(t, "3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090", hash)
+
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+	pusher.Artifact = Artifact{OutputDir: tmpDir}
+	_, err = pusher.getNewBlobsHash(nil)
+	require.Equal(t, utils.ExitCodeArtifactMissing, utils.ExitCode(err))
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "output.json"), []byte("not json"), 0644))
+	_, err = pusher.getNewBlobsHash(nil)
+	require.Contains(t, err.Error(), "invalid "+filepath.Join(tmpDir, "output.json"))
+	require.Equal(t, utils.ExitCodeInvalidOutput, utils.ExitCode(err))
 }
 
 func setUpTmpDir(t *testing.T) (string, func()) {
@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
@@ -14,12 +19,20 @@ import (
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
 )
 
+// Pusher transfers the build artifacts between the output directory and the
+// storage backend.
 type Pusher struct {
 	Artifact
 	cfg         BackendConfig
 	blobBackend backend.Backend
 	metaBackend backend.Backend
-	logger      *logrus.Logger
+	logger      logrus.FieldLogger
+	timeout     time.Duration
+
+	// registry and newRemote are set if the artifacts are pushed to
+	// registry, instead of the blob backends.
+	registry  *RegistryBackendConfig
+	newRemote func(ref string) (artifactRemote, error)
 }
 
 type PushRequest struct {
@@ -27,17 +40,43 @@ type PushRequest struct {
 	Blob string
 
 	ParentBlobs []string
+	// MetaDigest and BlobDigest are verified against the local files
+	// before uploading if specified.
+	MetaDigest string
+	BlobDigest string
 }
 
 type PushResult struct {
 	RemoteMeta string
 	RemoteBlob string
+	MetaDigest string
+	BlobDigest string
+}
+
+// PullRequest specifies the bootstrap and blobs to download into the output
+// directory, the blobs are named by the blob digest.
+type PullRequest struct {
+	Meta  string
+	Blobs []string
+	// MetaDigest is verified against the downloaded bootstrap if specified.
+	MetaDigest string
+}
+
+type PullResult struct {
+	Meta  string
+	Blobs []string
 }
 
 type NewPusherOpt struct {
 	Artifact
 	BackendConfig BackendConfig
-	Logger        *logrus.Logger
+	Logger        logrus.FieldLogger
+	// Timeout bounds each backend operation, for example uploading a blob
+	// or completing the upload, 0 means no limit.
+	Timeout time.Duration
+	// ExistenceCache skips checking and uploading the blobs known to exist
+	// in the blob backend if specified.
+	ExistenceCache *backend.ExistenceCache
 }
 
 func NewPusher(opt NewPusherOpt) (*Pusher, error) {
@@ -49,6 +88,22 @@ func NewPusher(opt NewPusherOpt) (*Pusher, error) {
 	}
 	backendConfig := opt.BackendConfig
 
+	logger := opt.Logger
+	if logger == nil {
+		logger = logrus.StandardLogger()
+	}
+
+	if registry, ok := backendConfig.(*RegistryBackendConfig); ok {
+		return &Pusher{
+			Artifact:  opt.Artifact,
+			logger:    logger,
+			cfg:       opt.BackendConfig,
+			timeout:   opt.Timeout,
+			registry:  registry,
+			newRemote: newRegistryRemote(registry),
+		}, nil
+	}
+
 	metaBackend, err := backend.NewBackend(backendConfig.backendType(), backendConfig.rawMetaBackendCfg(), nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to init backend for bootstrap blob")
@@ -57,46 +112,94 @@ func NewPusher(opt NewPusherOpt) (*Pusher, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to init backend for data blob")
 	}
+	if opt.ExistenceCache != nil {
+		cfg, err := backend.ParseConfig(backendConfig.backendType(), backendConfig.rawBlobBackendCfg())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse backend config for data blob")
+		}
+		blobBackend = backend.WithExistenceCache(blobBackend, cfg, opt.ExistenceCache)
+	}
 
 	return &Pusher{
 		Artifact:    opt.Artifact,
-		logger:      opt.Logger,
+		logger:      logger,
 		metaBackend: metaBackend,
 		blobBackend: blobBackend,
 		cfg:         opt.BackendConfig,
+		timeout:     opt.Timeout,
 	}, nil
 }
 
+// withTimeout derives the context of a backend operation from the caller's
+// context, bounded by the configured timeout.
+func (p *Pusher) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, p.timeout)
+}
+
+func (p *Pusher) upload(ctx context.Context, be backend.Backend, key, path string, forcePush bool) (*ocispec.Descriptor, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return be.Upload(ctx, key, path, 0, forcePush)
+}
+
+func (p *Pusher) finalize(ctx context.Context, be backend.Backend, cancelUpload bool) error {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return be.Finalize(ctx, cancelUpload)
+}
+
 // Push will push the meta and blob file to remote backend
-// at this moment, only oss and s3 are the possible backends, the meta file name is user defined
-// and blob file name is the hash of the blobfile that is extracted from output.json
-func (p *Pusher) Push(req PushRequest) (pushResult PushResult, retErr error) {
+// at this moment, oss, s3 and registry are the possible backends, the meta file name is user defined
+// and blob file name is the hash of the blobfile that is extracted from output.json,
+// for registry, they are pushed as the layers of an OCI artifact tagged by the meta file name.
+func (p *Pusher) Push(ctx context.Context, req PushRequest) (pushResult PushResult, retErr error) {
+	artifacts := []string{p.BootstrapPath(req.Meta)}
+	if req.Blob != "" {
+		artifacts = append(artifacts, p.BlobFilePath(req.Blob, true))
+	}
+	if err := checkArtifacts(artifacts...); err != nil {
+		return PushResult{}, err
+	}
+
+	if p.newRemote != nil {
+		return p.pushArtifact(ctx, req)
+	}
+
 	p.logger.Info("start to push meta and blob to remote backend")
-	// todo: add a suitable timeout
-	ctx := context.Background()
 	// todo: use blob desc to build manifest
 
 	defer func() {
 		if retErr != nil {
-			if err := p.blobBackend.Finalize(true); err != nil {
-				logrus.WithError(err).Warnf("Cancel blob backend upload")
+			// Abort the uploads even if the caller's context is canceled.
+			ctx := context.WithoutCancel(ctx)
+			if err := p.finalize(ctx, p.blobBackend, true); err != nil {
+				p.logger.WithError(err).Warnf("Cancel blob backend upload")
 			}
-			if err := p.metaBackend.Finalize(true); err != nil {
-				logrus.WithError(err).Warnf("Cancel meta backend upload")
+			if err := p.finalize(ctx, p.metaBackend, true); err != nil {
+				p.logger.WithError(err).Warnf("Cancel meta backend upload")
 			}
 		}
 	}()
 
 	for _, blob := range req.ParentBlobs {
 		// try push parent blobs
-		if _, err := p.blobBackend.Upload(ctx, blob, p.blobFilePath(blob, true), 0, false); err != nil {
+		if _, err := p.upload(ctx, p.blobBackend, blob, p.BlobFilePath(blob, true), false); err != nil {
 			return PushResult{}, errors.Wrap(err, "failed to put blobfile to remote")
 		}
 	}
 
 	p.logger.Infof("push blob %s", req.Blob)
 	if req.Blob != "" {
-		desc, err := p.blobBackend.Upload(ctx, req.Blob, p.blobFilePath(req.Blob, true), 0, false)
+		if req.BlobDigest != "" {
+			if err := utils.VerifyFile(p.BlobFilePath(req.Blob, true), digest.Digest(req.BlobDigest)); err != nil {
+				return PushResult{}, errors.Wrap(err, "failed to verify blobfile")
+			}
+			pushResult.BlobDigest = req.BlobDigest
+		}
+		desc, err := p.upload(ctx, p.blobBackend, req.Blob, p.BlobFilePath(req.Blob, true), false)
 		if err != nil {
 			return PushResult{}, errors.Wrap(err, "failed to put blobfile to remote")
 		}
@@ -104,24 +207,120 @@ func (p *Pusher) Push(req PushRequest) (pushResult PushResult, retErr error) {
 			pushResult.RemoteBlob = desc.URLs[0]
 		}
 	}
-	if retErr = p.blobBackend.Finalize(false); retErr != nil {
+	if retErr = p.finalize(ctx, p.blobBackend, false); retErr != nil {
 		return PushResult{}, errors.Wrap(retErr, "Finalize blob backend upload")
 	}
 
-	desc, retErr := p.metaBackend.Upload(ctx, req.Meta, p.bootstrapPath(req.Meta), 0, true)
+	if req.MetaDigest != "" {
+		if retErr = utils.VerifyFile(p.BootstrapPath(req.Meta), digest.Digest(req.MetaDigest)); retErr != nil {
+			return PushResult{}, errors.Wrap(retErr, "failed to verify metafile")
+		}
+		pushResult.MetaDigest = req.MetaDigest
+	}
+	desc, retErr := p.upload(ctx, p.metaBackend, req.Meta, p.BootstrapPath(req.Meta), true)
 	if retErr != nil {
 		return PushResult{}, errors.Wrapf(retErr, "failed to put metafile to remote")
 	}
 	if len(desc.URLs) != 0 {
 		pushResult.RemoteMeta = desc.URLs[0]
 	}
-	if retErr = p.metaBackend.Finalize(false); retErr != nil {
+	if retErr = p.finalize(ctx, p.metaBackend, false); retErr != nil {
 		return PushResult{}, errors.Wrap(retErr, "Finalize meta backend upload")
 	}
 
 	return
 }
 
+// Pull downloads the bootstrap and blobs from the storage backend into the
+// output directory, the partial file is removed on failure.
+func (p *Pusher) Pull(ctx context.Context, req PullRequest) (PullResult, error) {
+	if p.newRemote != nil {
+		return p.pullArtifact(ctx, req)
+	}
+
+	p.logger.Info("start to pull meta and blob from remote backend")
+
+	var result PullResult
+	for _, blob := range req.Blobs {
+		p.logger.Infof("pull blob %s", blob)
+		blobPath := p.BlobFilePath(blob, true)
+		if err := p.download(ctx, p.blobBackend, blob, blobPath); err != nil {
+			return PullResult{}, errors.Wrap(err, "failed to get blobfile from remote")
+		}
+		result.Blobs = append(result.Blobs, blobPath)
+	}
+
+	metaPath := p.BootstrapPath(req.Meta)
+	if err := p.download(ctx, p.metaBackend, req.Meta, metaPath); err != nil {
+		return PullResult{}, errors.Wrap(err, "failed to get metafile from remote")
+	}
+	if req.MetaDigest != "" {
+		if err := utils.VerifyFile(metaPath, digest.Digest(req.MetaDigest)); err != nil {
+			os.Remove(metaPath)
+			return PullResult{}, errors.Wrap(err, "failed to verify metafile")
+		}
+	}
+	result.Meta = metaPath
+
+	return result, nil
+}
+
+// contextReader aborts the reading when the context is done.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(buf)
+}
+
+func (p *Pusher) download(ctx context.Context, be backend.Backend, key, path string) error {
+	return p.downloadFrom(ctx, func(ctx context.Context) (io.ReadCloser, error) {
+		return be.Reader(ctx, key)
+	}, path)
+}
+
+// downloadFrom writes the content of reader returned by open into path.
+func (p *Pusher) downloadFrom(ctx context.Context, open func(ctx context.Context) (io.ReadCloser, error), path string) (retErr error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	reader, err := open(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		if retErr != nil {
+			os.Remove(file.Name())
+		}
+	}()
+
+	if _, err := io.Copy(file, &contextReader{ctx: ctx, reader: reader}); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// ParseBackendConfig parses the backend config file of the backend type,
+// possible values: oss, s3, registry.
 func ParseBackendConfig(backendType, backendConfigFile string) (BackendConfig, error) {
 
 	cfgFile, err := os.Open(backendConfigFile)
@@ -142,11 +341,22 @@ func ParseBackendConfig(backendType, backendConfigFile string) (BackendConfig, e
 			return nil, errors.Wrapf(err, "failed to decode backend-config %s", backendConfigFile)
 		}
 		return &cfg, nil
+	case "registry":
+		var cfg RegistryBackendConfig
+		if err = json.NewDecoder(cfgFile).Decode(&cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode backend-config %s", backendConfigFile)
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
 	default:
 		return nil, fmt.Errorf("unsupported backend type %s", backendType)
 	}
 }
 
+// ParseBackendConfigString is the same as ParseBackendConfig, but parses the
+// config content directly.
 func ParseBackendConfigString(backendType, backendConfigContent string) (BackendConfig, error) {
 	switch strings.ToLower(backendType) {
 	case "oss":
@@ -162,6 +372,15 @@ func ParseBackendConfigString(backendType, backendConfigContent string) (Backend
 			return nil, errors.Wrapf(err, "failed to decode backend-config %s", backendConfigContent)
 		}
 		return &cfg, nil
+	case "registry":
+		var cfg RegistryBackendConfig
+		if err := json.Unmarshal([]byte(backendConfigContent), &cfg); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode backend-config %s", backendConfigContent)
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+		return &cfg, nil
 	default:
 		return nil, fmt.Errorf("unsupported backend type %s", backendType)
 	}
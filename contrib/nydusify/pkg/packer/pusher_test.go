@@ -5,13 +5,24 @@
 package packer
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/mock"
@@ -28,11 +39,11 @@ func (m *mockBackend) Upload(ctx context.Context, blobID, blobPath string, blobS
 	return desc.(*ocispec.Descriptor), nil
 }
 
-func (m *mockBackend) Finalize(_ bool) error {
+func (m *mockBackend) Finalize(_ context.Context, _ bool) error {
 	return nil
 }
 
-func (m *mockBackend) Check(_ string) (bool, error) {
+func (m *mockBackend) Check(_ context.Context, _ string) (bool, error) {
 	return false, nil
 }
 
@@ -40,11 +51,12 @@ func (m *mockBackend) Type() backend.Type {
 	return backend.OssBackend
 }
 
-func (m *mockBackend) Reader(_ string) (io.ReadCloser, error) {
-	panic("not implemented")
+func (m *mockBackend) Reader(_ context.Context, blobID string) (io.ReadCloser, error) {
+	args := m.Called(blobID)
+	return io.NopCloser(strings.NewReader(args.String(0))), args.Error(1)
 }
 
-func (m *mockBackend) Size(_ string) (int64, error) {
+func (m *mockBackend) Size(_ context.Context, _ string) (int64, error) {
 	panic("not implemented")
 }
 
@@ -105,7 +117,7 @@ func Test_parseBackendConfigString(t *testing.T) {
 		BlobPrefix:      "blob/",
 	}, cfg)
 
-	cfg, err = ParseBackendConfigString("registry", "")
+	cfg, err = ParseBackendConfigString("localfs", "")
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "unsupported backend type")
 	require.Empty(t, cfg)
@@ -115,8 +127,9 @@ func TestPusher_Push(t *testing.T) {
 	tmpDir, tearDown := setUpTmpDir(t)
 	defer tearDown()
 
+	hash := "3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090"
 	os.Create(filepath.Join(tmpDir, "mock.meta"))
-	os.Create(filepath.Join(tmpDir, "mock.blob"))
+	os.Create(filepath.Join(tmpDir, hash))
 	content, _ := os.ReadFile(filepath.Join("testdata", "output.json"))
 	os.WriteFile(filepath.Join(tmpDir, "output.json"), content, 0755)
 
@@ -135,7 +148,6 @@ func TestPusher_Push(t *testing.T) {
 		metaBackend: mp,
 		blobBackend: mp,
 	}
-	hash := "3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090"
 	mp.On("Upload", mock.Anything, "mock.meta", mock.Anything, mock.Anything, mock.Anything).Return(&ocispec.Descriptor{
 		URLs: []string{"oss://testbucket/testmetaprefix/mock.meta"},
 	}, nil)
@@ -143,7 +155,7 @@ func TestPusher_Push(t *testing.T) {
 		URLs: []string{"oss://testbucket/testblobprefix/3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090"},
 	}, nil)
 
-	res, err := pusher.Push(PushRequest{
+	res, err := pusher.Push(context.Background(), PushRequest{
 		Meta: "mock.meta",
 		Blob: hash,
 	})
@@ -156,6 +168,112 @@ func TestPusher_Push(t *testing.T) {
 		},
 		res,
 	)
+
+	_, err = pusher.Push(context.Background(), PushRequest{
+		Meta:       "mock.meta",
+		MetaDigest: "sha512:0000",
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to verify metafile")
+
+	_, err = pusher.Push(context.Background(), PushRequest{
+		Meta: "missing.meta",
+	})
+	require.Error(t, err)
+	var packErr *Error
+	require.True(t, errors.As(err, &packErr))
+	require.Equal(t, ErrorKindArtifactMissing, packErr.Kind)
+	require.Equal(t, utils.ExitCodeArtifactMissing, utils.ExitCode(err))
+}
+
+// blockingBackend simulates a stuck upload.
+type blockingBackend struct {
+	mockBackend
+}
+
+func (m *blockingBackend) Upload(ctx context.Context, _, _ string, _ int64, _ bool) (*ocispec.Descriptor, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestPusher_PushTimeout(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+
+	os.Create(filepath.Join(tmpDir, "mock.meta"))
+	artifact, err := NewArtifact(tmpDir)
+	require.NoError(t, err)
+
+	bb := &blockingBackend{}
+	pusher := Pusher{
+		Artifact:    artifact,
+		logger:      logrus.New(),
+		metaBackend: bb,
+		blobBackend: bb,
+		timeout:     10 * time.Millisecond,
+	}
+	_, err = pusher.Push(context.Background(), PushRequest{Meta: "mock.meta"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	pusher.timeout = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err = pusher.Push(ctx, PushRequest{Meta: "mock.meta"})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPusher_Pull(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+
+	artifact, err := NewArtifact(tmpDir)
+	require.NoError(t, err)
+
+	mp := &mockBackend{}
+	pusher := Pusher{
+		Artifact:    artifact,
+		logger:      logrus.New(),
+		metaBackend: mp,
+		blobBackend: mp,
+	}
+	hash := "3093776c78a21e47f0a8b4c80a1f019b1e838fc1ade274209332af1ca5f57090"
+	mp.On("Reader", "mock.meta").Return("meta", nil)
+	mp.On("Reader", hash).Return("blob", nil)
+	mp.On("Reader", "missing.meta").Return("", errors.New("not found"))
+
+	res, err := pusher.Pull(context.Background(), PullRequest{
+		Meta:       "mock.meta",
+		Blobs:      []string{hash},
+		MetaDigest: digest.FromString("meta").String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, PullResult{
+		Meta:  filepath.Join(tmpDir, "mock.meta"),
+		Blobs: []string{filepath.Join(tmpDir, hash)},
+	}, res)
+	content, err := os.ReadFile(res.Blobs[0])
+	require.NoError(t, err)
+	require.Equal(t, "blob", string(content))
+
+	_, err = pusher.Pull(context.Background(), PullRequest{
+		Meta:       "mock.meta",
+		MetaDigest: digest.FromString("other").String(),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to verify metafile")
+	require.NoFileExists(t, filepath.Join(tmpDir, "mock.meta"))
+
+	_, err = pusher.Pull(context.Background(), PullRequest{Meta: "missing.meta"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to get metafile from remote")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = pusher.Pull(ctx, PullRequest{Meta: "mock.meta"})
+	require.ErrorIs(t, err, context.Canceled)
 }
 
 func TestNewPusher(t *testing.T) {
@@ -204,3 +322,136 @@ func TestNewPusher(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "failed to init backend for bootstrap blob")
 }
+
+// fakeObjectStore serves the subset of S3 and OSS API used by the blob
+// backends, the objects are addressed in path style as `/<bucket>/<key>`.
+type fakeObjectStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// parts are the uploaded parts of OSS multipart uploads by upload ID.
+	parts map[string]map[int][]byte
+}
+
+func newFakeObjectStore(t *testing.T) (*fakeObjectStore, string) {
+	store := &fakeObjectStore{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}}
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+	return store, strings.TrimPrefix(server.URL, "http://")
+}
+
+func (s *fakeObjectStore) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := req.URL.Path
+	query := req.URL.Query()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case req.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := fmt.Sprintf("upload-%d", len(s.parts))
+		s.parts[uploadID] = map[int][]byte{}
+		w.Header().Set("Content-Type", "application/xml")
+		bucket, object, _ := strings.Cut(strings.TrimPrefix(key, "/"), "/")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", bucket, object, uploadID)
+	case req.Method == http.MethodPut && query.Has("uploadId"):
+		var number int
+		fmt.Sscanf(query.Get("partNumber"), "%d", &number)
+		s.parts[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", digest.FromBytes(body).Encoded()))
+	case req.Method == http.MethodPost && query.Has("uploadId"):
+		parts := s.parts[query.Get("uploadId")]
+		numbers := []int{}
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		slices.Sort(numbers)
+		var object bytes.Buffer
+		for _, number := range numbers {
+			object.Write(parts[number])
+		}
+		s.objects[key] = object.Bytes()
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case req.Method == http.MethodPut:
+		s.objects[key] = body
+		w.Header().Set("ETag", fmt.Sprintf("%q", digest.FromBytes(body).Encoded()))
+	case req.Method == http.MethodHead:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(object)))
+	case req.Method == http.MethodGet:
+		object, ok := s.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(req.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			w.Write(object)
+			return
+		}
+		end = min(end, len(object)-1)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object)))
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(object[start : end+1])
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// pushToObjectStore pushes the artifacts through the real backend of config,
+// the size of blob is unknown by pusher.
+func pushToObjectStore(t *testing.T, store *fakeObjectStore, cfg BackendConfig, metaKey, blobKey string) {
+	outputDir := t.TempDir()
+	meta := []byte("bootstrap")
+	blob := bytes.Repeat([]byte("nydus"), 1024)
+	blobID := digest.FromBytes(blob).Encoded()
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "image.meta"), meta, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, blobID), blob, 0644))
+
+	pusher, err := NewPusher(NewPusherOpt{
+		Artifact:      Artifact{OutputDir: outputDir},
+		BackendConfig: cfg,
+		Logger:        logrus.New(),
+	})
+	require.NoError(t, err)
+	_, err = pusher.Push(context.Background(), PushRequest{Meta: "image.meta", Blob: blobID})
+	require.NoError(t, err)
+	require.Equal(t, meta, store.objects[metaKey])
+	require.Equal(t, blob, store.objects[blobKey+blobID])
+}
+
+func TestPusher_PushS3(t *testing.T) {
+	store, endpoint := newFakeObjectStore(t)
+	pushToObjectStore(t, store, &S3BackendConfig{
+		Endpoint:        endpoint,
+		Scheme:          "http",
+		AccessKeyID:     "testAK",
+		AccessKeySecret: "testSK",
+		Region:          "us-east-1",
+		BucketName:      "testbucket",
+		MetaPrefix:      "meta/",
+		BlobPrefix:      "blob/",
+	}, "/testbucket/meta/image.meta", "/testbucket/blob/")
+}
+
+func TestPusher_PushOSS(t *testing.T) {
+	store, endpoint := newFakeObjectStore(t)
+	pushToObjectStore(t, store, &OssBackendConfig{
+		Endpoint:        "http://" + endpoint,
+		AccessKeyID:     "testid",
+		AccessKeySecret: "testkey",
+		BucketName:      "testbucket",
+		MetaPrefix:      "meta/",
+		BlobPrefix:      "blob/",
+	}, "/testbucket/meta/image.meta", "/testbucket/blob/")
+}
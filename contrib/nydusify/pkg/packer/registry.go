@@ -0,0 +1,316 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+const (
+	// ArtifactTypeNydus is the artifact type of the manifest pushed by packer,
+	// the layers are the nydus blobs and the bootstrap at last.
+	ArtifactTypeNydus = "application/vnd.nydus.image.v1"
+	// MediaTypeNydusBootstrap is the media type of the bootstrap layer in
+	// artifact, which is the uncompressed bootstrap file.
+	MediaTypeNydusBootstrap = "application/vnd.oci.image.layer.nydus.bootstrap.v1"
+
+	// maxManifestSize limits the size of artifact manifest read from registry.
+	maxManifestSize = 4 * 1024 * 1024
+)
+
+// artifactRemote is the registry storing the artifact, implemented by
+// remote.Remote.
+type artifactRemote interface {
+	Push(ctx context.Context, desc ocispec.Descriptor, byDigest bool, reader io.Reader) error
+	Pull(ctx context.Context, desc ocispec.Descriptor, byDigest bool) (io.ReadCloser, error)
+	Resolve(ctx context.Context) (*ocispec.Descriptor, error)
+	MaybeWithHTTP(err error)
+}
+
+func newRegistryRemote(cfg *RegistryBackendConfig) func(ref string) (artifactRemote, error) {
+	return func(ref string) (artifactRemote, error) {
+		// Read the auth from docker config if not specified.
+		if cfg.Auth == "" {
+			return provider.DefaultRemote(ref, cfg.SkipVerify)
+		}
+		return provider.DefaultRemoteWithAuth(ref, cfg.SkipVerify, cfg.Auth)
+	}
+}
+
+// artifactRef returns the reference of artifact, which is tagged by the
+// image name.
+func (p *Pusher) artifactRef(imageName string) (string, error) {
+	ref := fmt.Sprintf("%s/%s:%s", p.registry.Host, p.registry.Repo, imageName)
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return "", errors.Wrapf(err, "invalid artifact reference %s, the image name is used as tag", ref)
+	}
+	return ref, nil
+}
+
+// withHTTPRetry retries the request in plain HTTP if the registry doesn't
+// support HTTPS.
+func withHTTPRetry(remoter artifactRemote, fn func() error) error {
+	err := fn()
+	if err != nil && utils.RetryWithHTTP(err) {
+		remoter.MaybeWithHTTP(err)
+		err = fn()
+	}
+	return err
+}
+
+func (p *Pusher) pushFile(ctx context.Context, remoter artifactRemote, path string, desc ocispec.Descriptor) (ocispec.Descriptor, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	desc.Size = info.Size()
+	if desc.Digest == "" {
+		if desc.Digest, err = utils.DigestFile(path, utils.DigestSHA256); err != nil {
+			return ocispec.Descriptor{}, err
+		}
+	}
+
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	err = withHTTPRetry(remoter, func() error {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return remoter.Push(ctx, desc, true, file)
+	})
+	return desc, err
+}
+
+// pushArtifact pushes the blobs and bootstrap as the layers of an OCI
+// artifact, the manifest is tagged by the image name.
+func (p *Pusher) pushArtifact(ctx context.Context, req PushRequest) (PushResult, error) {
+	ref, err := p.artifactRef(req.Meta)
+	if err != nil {
+		return PushResult{}, err
+	}
+	remoter, err := p.newRemote(ref)
+	if err != nil {
+		return PushResult{}, errors.Wrap(err, "failed to create remote")
+	}
+	p.logger.Infof("start to push meta and blob to %s", ref)
+
+	var pushResult PushResult
+	blobs := req.ParentBlobs
+	if req.Blob != "" {
+		if req.BlobDigest != "" {
+			if err := utils.VerifyFile(p.BlobFilePath(req.Blob, true), digest.Digest(req.BlobDigest)); err != nil {
+				return PushResult{}, errors.Wrap(err, "failed to verify blobfile")
+			}
+			pushResult.BlobDigest = req.BlobDigest
+		}
+		blobs = append(blobs, req.Blob)
+	}
+
+	layers := []ocispec.Descriptor{}
+	for _, blob := range blobs {
+		p.logger.Infof("push blob %s", blob)
+		desc, err := p.pushFile(ctx, remoter, p.BlobFilePath(blob, true), ocispec.Descriptor{
+			MediaType: utils.MediaTypeNydusBlob,
+			Digest:    digest.NewDigestFromEncoded(digest.SHA256, blob),
+			Annotations: map[string]string{
+				utils.LayerAnnotationNydusBlob: "true",
+				ocispec.AnnotationTitle:        blob,
+			},
+		})
+		if err != nil {
+			return PushResult{}, errors.Wrap(err, "failed to put blobfile to remote")
+		}
+		layers = append(layers, desc)
+		if blob == req.Blob {
+			pushResult.RemoteBlob = fmt.Sprintf("%s/%s@%s", p.registry.Host, p.registry.Repo, desc.Digest)
+		}
+	}
+
+	if req.MetaDigest != "" {
+		if err := utils.VerifyFile(p.BootstrapPath(req.Meta), digest.Digest(req.MetaDigest)); err != nil {
+			return PushResult{}, errors.Wrap(err, "failed to verify metafile")
+		}
+		pushResult.MetaDigest = req.MetaDigest
+	}
+	bootstrapDesc, err := p.pushFile(ctx, remoter, p.BootstrapPath(req.Meta), ocispec.Descriptor{
+		MediaType: MediaTypeNydusBootstrap,
+		Annotations: map[string]string{
+			utils.LayerAnnotationNydusBootstrap: "true",
+			ocispec.AnnotationTitle:             req.Meta,
+		},
+	})
+	if err != nil {
+		return PushResult{}, errors.Wrap(err, "failed to put metafile to remote")
+	}
+	layers = append(layers, bootstrapDesc)
+
+	manifestDesc, err := p.pushManifest(ctx, remoter, layers)
+	if err != nil {
+		return PushResult{}, errors.Wrap(err, "failed to put artifact manifest to remote")
+	}
+	pushResult.RemoteMeta = fmt.Sprintf("%s@%s", ref, manifestDesc.Digest)
+
+	return pushResult, nil
+}
+
+func (p *Pusher) pushManifest(ctx context.Context, remoter artifactRemote, layers []ocispec.Descriptor) (*ocispec.Descriptor, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	config := ocispec.DescriptorEmptyJSON
+	if err := withHTTPRetry(remoter, func() error {
+		return remoter.Push(ctx, config, true, bytes.NewReader(config.Data))
+	}); err != nil {
+		return nil, errors.Wrap(err, "push config")
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{
+			SchemaVersion: 2,
+		},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: ArtifactTypeNydus,
+		Config:       config,
+		Layers:       layers,
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal manifest")
+	}
+	desc := ocispec.Descriptor{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: ArtifactTypeNydus,
+		Digest:       digest.FromBytes(data),
+		Size:         int64(len(data)),
+	}
+	if err := withHTTPRetry(remoter, func() error {
+		return remoter.Push(ctx, desc, false, bytes.NewReader(data))
+	}); err != nil {
+		return nil, errors.Wrap(err, "push manifest")
+	}
+
+	return &desc, nil
+}
+
+func (p *Pusher) pullManifest(ctx context.Context, remoter artifactRemote) (*ocispec.Manifest, error) {
+	ctx, cancel := p.withTimeout(ctx)
+	defer cancel()
+
+	var desc *ocispec.Descriptor
+	if err := withHTTPRetry(remoter, func() (err error) {
+		desc, err = remoter.Resolve(ctx)
+		return err
+	}); err != nil {
+		return nil, errors.Wrap(err, "resolve artifact")
+	}
+	if desc.MediaType != ocispec.MediaTypeImageManifest {
+		return nil, errors.Errorf("unsupported artifact media type %s", desc.MediaType)
+	}
+
+	reader, err := remoter.Pull(ctx, *desc, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "pull manifest")
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxManifestSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifest")
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal manifest")
+	}
+	if manifest.ArtifactType != ArtifactTypeNydus {
+		return nil, errors.Errorf("not a nydus artifact, artifact type is %q", manifest.ArtifactType)
+	}
+
+	return &manifest, nil
+}
+
+// pullArtifact downloads the bootstrap and blobs from the layers of artifact
+// tagged by the image name.
+func (p *Pusher) pullArtifact(ctx context.Context, req PullRequest) (PullResult, error) {
+	ref, err := p.artifactRef(req.Meta)
+	if err != nil {
+		return PullResult{}, err
+	}
+	remoter, err := p.newRemote(ref)
+	if err != nil {
+		return PullResult{}, errors.Wrap(err, "failed to create remote")
+	}
+	p.logger.Infof("start to pull meta and blob from %s", ref)
+
+	manifest, err := p.pullManifest(ctx, remoter)
+	if err != nil {
+		return PullResult{}, errors.Wrap(err, "failed to get artifact manifest from remote")
+	}
+	var bootstrapDesc *ocispec.Descriptor
+	blobDescs := map[string]ocispec.Descriptor{}
+	for idx, layer := range manifest.Layers {
+		if layer.Annotations[utils.LayerAnnotationNydusBootstrap] == "true" {
+			bootstrapDesc = &manifest.Layers[idx]
+		} else if layer.MediaType == utils.MediaTypeNydusBlob {
+			blobDescs[layer.Digest.Encoded()] = layer
+		}
+	}
+
+	open := func(desc ocispec.Descriptor) func(ctx context.Context) (io.ReadCloser, error) {
+		return func(ctx context.Context) (io.ReadCloser, error) {
+			return remoter.Pull(ctx, desc, true)
+		}
+	}
+
+	var result PullResult
+	for _, blob := range req.Blobs {
+		p.logger.Infof("pull blob %s", blob)
+		desc, ok := blobDescs[blob]
+		if !ok {
+			return PullResult{}, errors.Errorf("failed to get blobfile from remote: blob %s not found in artifact", blob)
+		}
+		blobPath := p.BlobFilePath(blob, true)
+		if err := p.downloadFrom(ctx, open(desc), blobPath); err != nil {
+			return PullResult{}, errors.Wrap(err, "failed to get blobfile from remote")
+		}
+		result.Blobs = append(result.Blobs, blobPath)
+	}
+
+	if bootstrapDesc == nil {
+		return PullResult{}, errors.New("failed to get metafile from remote: bootstrap not found in artifact")
+	}
+	metaPath := p.BootstrapPath(req.Meta)
+	if err := p.downloadFrom(ctx, open(*bootstrapDesc), metaPath); err != nil {
+		return PullResult{}, errors.Wrap(err, "failed to get metafile from remote")
+	}
+	if req.MetaDigest != "" {
+		if err := utils.VerifyFile(metaPath, digest.Digest(req.MetaDigest)); err != nil {
+			os.Remove(metaPath)
+			return PullResult{}, errors.Wrap(err, "failed to verify metafile")
+		}
+	}
+	result.Meta = metaPath
+
+	return result, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// memRemote stores the blobs and the tagged manifest in memory.
+type memRemote struct {
+	blobs map[digest.Digest][]byte
+	tag   *ocispec.Descriptor
+}
+
+func (r *memRemote) Push(_ context.Context, desc ocispec.Descriptor, byDigest bool, reader io.Reader) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if digest.FromBytes(data) != desc.Digest || int64(len(data)) != desc.Size {
+		return fmt.Errorf("unexpected content of %s", desc.Digest)
+	}
+	r.blobs[desc.Digest] = data
+	if !byDigest {
+		r.tag = &desc
+	}
+	return nil
+}
+
+func (r *memRemote) Pull(_ context.Context, desc ocispec.Descriptor, _ bool) (io.ReadCloser, error) {
+	data, ok := r.blobs[desc.Digest]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", desc.Digest)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (r *memRemote) Resolve(_ context.Context) (*ocispec.Descriptor, error) {
+	if r.tag == nil {
+		return nil, fmt.Errorf("not found")
+	}
+	return r.tag, nil
+}
+
+func (r *memRemote) MaybeWithHTTP(_ error) {}
+
+func TestPusher_PushArtifact(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+
+	blob := []byte("blob")
+	hash := digest.FromBytes(blob).Encoded()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "mock.meta"), []byte("meta"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, hash), blob, 0644))
+
+	artifact, err := NewArtifact(tmpDir)
+	require.NoError(t, err)
+
+	registry := &RegistryBackendConfig{backend.RegistryConfig{Host: "localhost:5000", Repo: "nydus/test"}}
+	remote := &memRemote{blobs: map[digest.Digest][]byte{}}
+	pusher := Pusher{
+		Artifact: artifact,
+		logger:   logrus.New(),
+		cfg:      registry,
+		registry: registry,
+		newRemote: func(ref string) (artifactRemote, error) {
+			require.Equal(t, "localhost:5000/nydus/test:mock.meta", ref)
+			return remote, nil
+		},
+	}
+
+	res, err := pusher.Push(context.Background(), PushRequest{
+		Meta:       "mock.meta",
+		Blob:       hash,
+		MetaDigest: digest.FromString("meta").String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "localhost:5000/nydus/test@sha256:"+hash, res.RemoteBlob)
+	require.Equal(t, fmt.Sprintf("localhost:5000/nydus/test:mock.meta@%s", remote.tag.Digest), res.RemoteMeta)
+
+	var manifest ocispec.Manifest
+	require.NoError(t, json.Unmarshal(remote.blobs[remote.tag.Digest], &manifest))
+	require.Equal(t, ArtifactTypeNydus, manifest.ArtifactType)
+	require.Len(t, manifest.Layers, 2)
+	require.Equal(t, utils.MediaTypeNydusBlob, manifest.Layers[0].MediaType)
+	require.Equal(t, MediaTypeNydusBootstrap, manifest.Layers[1].MediaType)
+	require.Equal(t, "true", manifest.Layers[1].Annotations[utils.LayerAnnotationNydusBootstrap])
+
+	require.NoError(t, os.Remove(filepath.Join(tmpDir, "mock.meta")))
+	require.NoError(t, os.Remove(filepath.Join(tmpDir, hash)))
+	pullRes, err := pusher.Pull(context.Background(), PullRequest{
+		Meta:       "mock.meta",
+		Blobs:      []string{hash},
+		MetaDigest: digest.FromString("meta").String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, PullResult{
+		Meta:  filepath.Join(tmpDir, "mock.meta"),
+		Blobs: []string{filepath.Join(tmpDir, hash)},
+	}, pullRes)
+	content, err := os.ReadFile(pullRes.Blobs[0])
+	require.NoError(t, err)
+	require.Equal(t, blob, content)
+
+	_, err = pusher.Pull(context.Background(), PullRequest{
+		Meta:  "mock.meta",
+		Blobs: []string{digest.FromString("missing").Encoded()},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not found in artifact")
+}
+
+func TestParseRegistryBackendConfig(t *testing.T) {
+	cfg, err := ParseBackendConfigString("registry", `{"scheme": "https", "host": "localhost:5000", "repo": "nydus/test"}`)
+	require.NoError(t, err)
+	require.Equal(t, "registry", cfg.backendType())
+	require.JSONEq(t, `{"scheme": "https", "host": "localhost:5000", "repo": "nydus/test", "proxy": {"url": "", "fallback": false, "ping_url": ""}}`, string(cfg.rawBlobBackendCfg()))
+
+	_, err = ParseBackendConfigString("registry", `{"host": "localhost:5000"}`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing 'host' or 'repo'")
+}
@@ -0,0 +1,157 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/xattr"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// The builder options pinned in reproducible mode, so that the output
+	// is not changed by the defaults of nydus-image.
+	reproducibleCompressor = "zstd"
+	reproducibleChunkSize  = "0x100000"
+
+	paxSchilyXattr = "SCHILY.xattr."
+)
+
+// tarOption controls how the source directory is written as tar stream.
+type tarOption struct {
+	// mtime fixes the modification time of all entries if not zero.
+	mtime time.Time
+	// copyHardlinks writes the hardlinks as separated regular files.
+	copyHardlinks bool
+	// skipSpecialFiles drops the sockets, fifos and device files.
+	skipSpecialFiles bool
+}
+
+// tarHeader returns the tar header of the file, the access and change times
+// and the host specific fields are cleared, only the content, mode,
+// modification time, ownership and xattrs of file are kept. The modification
+// time is replaced with mtime if not zero.
+func tarHeader(path, name string, info fs.FileInfo, mtime time.Time) (*tar.Header, error) {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return nil, errors.Wrapf(err, "read link %s", path)
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create tar header of %s", path)
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if !mtime.IsZero() {
+		hdr.ModTime = mtime
+	}
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	// The user and group names are looked up from the host.
+	hdr.Uname = ""
+	hdr.Gname = ""
+	hdr.Format = tar.FormatPAX
+
+	if !xattr.XATTR_SUPPORTED {
+		return hdr, nil
+	}
+	names, err := xattr.LList(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list xattrs of %s", path)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		value, err := xattr.LGet(path, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get xattr %s of %s", key, path)
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = map[string]string{}
+		}
+		hdr.PAXRecords[paxSchilyXattr+key] = string(value)
+	}
+
+	return hdr, nil
+}
+
+// writeTar writes the files of source directory as a tar stream for building
+// in reproducible mode, or with the hardlinks and special files handled by
+// option. The entries are written in lexical order, and the hardlinks are
+// written as link entries to the first path unless copyHardlinks is set.
+func writeTar(sourceDir string, writer io.Writer, opt tarOption) error {
+	tw := tar.NewWriter(writer)
+	// The first path of each hardlinked file.
+	linked := map[fileID]string{}
+
+	// WalkDir walks the entries in lexical order.
+	if err := filepath.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		name = filepath.ToSlash(name)
+		info, err := entry.Info()
+		if err != nil {
+			return errors.Wrapf(err, "stat %s", path)
+		}
+
+		if opt.skipSpecialFiles && isSpecialFile(info.Mode()) {
+			logrus.Debugf("skip special file %s", path)
+			return nil
+		}
+		hdr, err := tarHeader(path, name, info, opt.mtime)
+		if err != nil {
+			return err
+		}
+		if id, ok := hardlinkID(info); ok && info.Mode().IsRegular() && !opt.copyHardlinks {
+			if target, ok := linked[id]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				hdr.Size = 0
+			} else {
+				linked[id] = name
+			}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "write tar header of %s", path)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if _, err := io.Copy(tw, file); err != nil {
+			return errors.Wrapf(err, "write %s", path)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTar(t *testing.T) {
+	sourceDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "b/c"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "b/c/file"), []byte("file"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "a"), []byte("a"), 0600))
+	require.NoError(t, os.Symlink("a", filepath.Join(sourceDir, "link")))
+
+	mtime := time.Unix(1700000000, 0)
+	var first bytes.Buffer
+	require.NoError(t, writeTar(sourceDir, &first, tarOption{mtime: mtime}))
+
+	// The timestamps of source files don't change the tar stream.
+	now := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(sourceDir, "a"), now, now))
+	require.NoError(t, os.Chtimes(filepath.Join(sourceDir, "b"), now, now))
+	var second bytes.Buffer
+	require.NoError(t, writeTar(sourceDir, &second, tarOption{mtime: mtime}))
+	require.Equal(t, first.Bytes(), second.Bytes())
+
+	names := []string{}
+	reader := tar.NewReader(&first)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.True(t, hdr.ModTime.Equal(mtime))
+		require.Empty(t, hdr.Uname)
+		names = append(names, hdr.Name)
+		if hdr.Name == "link" {
+			require.Equal(t, "a", hdr.Linkname)
+		}
+	}
+	require.Equal(t, []string{"a", "b/", "b/c/", "b/c/file", "link"}, names)
+}
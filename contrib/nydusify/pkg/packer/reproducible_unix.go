@@ -0,0 +1,45 @@
+//go:build !windows
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID identifies a file by its device and inode number.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// hardlinkID returns the identity of file if it has multiple links.
+func hardlinkID(info fs.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
+
+// fileStat returns the ownership and device number of file.
+func fileStat(info fs.FileInfo) inodeStat {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return inodeStat{}
+	}
+	return inodeStat{UID: stat.Uid, GID: stat.Gid, Rdev: uint64(stat.Rdev)}
+}
+
+// allocatedSize returns the size of disk blocks allocated to file.
+func allocatedSize(info fs.FileInfo) (int64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(stat.Blocks) * 512, true
+}
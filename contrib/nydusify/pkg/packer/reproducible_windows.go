@@ -0,0 +1,25 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import "io/fs"
+
+type fileID struct{}
+
+// hardlinkID never reports hardlinks, the linked files are written as
+// separated regular files.
+func hardlinkID(_ fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+// fileStat returns no ownership and device number on Windows.
+func fileStat(_ fs.FileInfo) inodeStat {
+	return inodeStat{}
+}
+
+// allocatedSize is unknown on Windows, the sparse files are not detected.
+func allocatedSize(_ fs.FileInfo) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// selfTestBlobSize is the size of random blob pushed by self test.
+const selfTestBlobSize = 1 << 20
+
+// The status of self test steps.
+const (
+	SelfTestOK   = "ok"
+	SelfTestFail = "fail"
+	// SelfTestSkip means the step is not supported by the backend, for
+	// example checking and deleting the artifact in registry.
+	SelfTestSkip = "skip"
+)
+
+// SelfTestStep is the result of a step of self test.
+type SelfTestStep struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// SelfTestReport is the result of self test, it's passed if no step fails.
+type SelfTestReport struct {
+	Passed bool           `json:"passed"`
+	Steps  []SelfTestStep `json:"steps"`
+}
+
+// run records the step of fn, the step is skipped if fn returns the reason
+// without error.
+func (report *SelfTestReport) run(name string, fn func() (string, error)) error {
+	start := time.Now()
+	status := SelfTestOK
+	message, err := fn()
+	if err != nil {
+		status = SelfTestFail
+		message = err.Error()
+		report.Passed = false
+	} else if message != "" {
+		status = SelfTestSkip
+	}
+	report.Steps = append(report.Steps, SelfTestStep{
+		Name:     name,
+		Status:   status,
+		Message:  message,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	})
+	return err
+}
+
+// SelfTest runs the push, check, pull and delete cycle of a random artifact
+// against the backend, to validate the credentials and permissions before
+// the real pushes. The artifact is generated in opt.OutputDir and deleted
+// from the backend at last if the backend supports.
+func SelfTest(ctx context.Context, opt NewPusherOpt) (*SelfTestReport, error) {
+	pusher, err := NewPusher(opt)
+	if err != nil {
+		return nil, err
+	}
+	pullDir := filepath.Join(opt.OutputDir, "pull")
+	if err := os.MkdirAll(pullDir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create pull directory")
+	}
+	return pusher.selfTest(ctx, pullDir)
+}
+
+func (p *Pusher) selfTest(ctx context.Context, pullDir string) (*SelfTestReport, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, errors.Wrap(err, "generate self test name")
+	}
+	meta := "nydusify-self-test-" + hex.EncodeToString(suffix)
+	metaDigest, err := writeRandomFile(p.BootstrapPath(meta), 4096)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate self test bootstrap")
+	}
+	blobPath := filepath.Join(p.OutputDir, "self-test.blob")
+	blobDigest, err := writeRandomFile(blobPath, selfTestBlobSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate self test blob")
+	}
+	// The blobs are named by the digest in backend.
+	blob := blobDigest.Encoded()
+	if err := os.Rename(blobPath, p.BlobFilePath(blob, true)); err != nil {
+		return nil, errors.Wrap(err, "generate self test blob")
+	}
+
+	report := &SelfTestReport{Passed: true}
+	if err := report.run("push", func() (string, error) {
+		_, err := p.Push(ctx, PushRequest{
+			Meta:       meta,
+			Blob:       blob,
+			MetaDigest: metaDigest.String(),
+			BlobDigest: blobDigest.String(),
+		})
+		return "", err
+	}); err != nil {
+		// The partial uploads are still deleted if possible.
+		p.selfTestDelete(ctx, report, meta, blob)
+		return report, nil
+	}
+
+	report.run("check", func() (string, error) {
+		if p.newRemote != nil {
+			return "checking is not supported by registry backend", nil
+		}
+		for _, item := range []struct {
+			be  backend.Backend
+			key string
+		}{{p.blobBackend, blob}, {p.metaBackend, meta}} {
+			exist, err := item.be.Check(ctx, item.key)
+			if err != nil {
+				return "", errors.Wrapf(err, "check %s", item.key)
+			}
+			if !exist {
+				return "", errors.Errorf("%s doesn't exist after push", item.key)
+			}
+		}
+		return "", nil
+	})
+
+	report.run("pull", func() (string, error) {
+		puller := *p
+		puller.Artifact = Artifact{OutputDir: pullDir}
+		result, err := puller.Pull(ctx, PullRequest{
+			Meta:       meta,
+			Blobs:      []string{blob},
+			MetaDigest: metaDigest.String(),
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := utils.VerifyFile(result.Blobs[0], blobDigest); err != nil {
+			return "", errors.Wrap(err, "verify pulled blob")
+		}
+		return "", nil
+	})
+
+	p.selfTestDelete(ctx, report, meta, blob)
+	return report, nil
+}
+
+// selfTestDelete deletes the artifact of self test and checks it no longer
+// exists.
+func (p *Pusher) selfTestDelete(ctx context.Context, report *SelfTestReport, meta, blob string) {
+	report.run("delete", func() (string, error) {
+		if p.newRemote != nil {
+			return fmt.Sprintf("deleting is not supported by registry backend, please delete tag %s manually", meta), nil
+		}
+		for _, item := range []struct {
+			be  backend.Backend
+			key string
+		}{{p.blobBackend, blob}, {p.metaBackend, meta}} {
+			if err := backend.Delete(ctx, item.be, item.key); err != nil {
+				if errors.Is(err, backend.ErrDeleteUnsupported) {
+					return fmt.Sprintf("%s, please delete %s manually", err, item.key), nil
+				}
+				return "", errors.Wrapf(err, "delete %s", item.key)
+			}
+			exist, err := item.be.Check(ctx, item.key)
+			if err != nil {
+				return "", errors.Wrapf(err, "check %s", item.key)
+			}
+			if exist {
+				return "", errors.Errorf("%s still exists after delete", item.key)
+			}
+		}
+		return "", nil
+	})
+}
+
+// writeRandomFile writes size random bytes to path and returns the digest.
+func writeRandomFile(path string, size int64) (digest.Digest, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	digester := digest.SHA256.Digester()
+	if _, err := io.CopyN(io.MultiWriter(file, digester.Hash()), rand.Reader, size); err != nil {
+		return "", err
+	}
+	return digester.Digest(), file.Close()
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build integration
+
+package packer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awscfg "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+)
+
+// The integration tests run the self test against the ephemeral MinIO and
+// zot registry containers, they require docker and are run by
+// `make integration-test`.
+const (
+	minioImage    = "minio/minio:latest"
+	zotImage      = "ghcr.io/project-zot/zot-linux-amd64:latest"
+	minioUser     = "nydusify"
+	minioPassword = "nydusify-secret"
+	minioBucket   = "nydusify-test"
+)
+
+// startContainer runs the container in background with the port published
+// on localhost, and returns the published address. The container is removed
+// when the test finishes.
+func startContainer(t *testing.T, port int, args ...string) string {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is required by integration test")
+	}
+
+	runArgs := append([]string{"run", "-d", "--rm", "-p", fmt.Sprintf("127.0.0.1::%d", port)}, args...)
+	output, err := exec.Command("docker", runArgs...).CombinedOutput()
+	require.NoError(t, err, string(output))
+	id := strings.TrimSpace(string(output))
+	t.Cleanup(func() {
+		exec.Command("docker", "rm", "-f", id).Run()
+	})
+
+	output, err = exec.Command("docker", "port", id, fmt.Sprintf("%d/tcp", port)).CombinedOutput()
+	require.NoError(t, err, string(output))
+	return strings.TrimSpace(strings.Split(string(output), "\n")[0])
+}
+
+// waitReady waits for the HTTP service at url to respond.
+func waitReady(t *testing.T, url string) {
+	deadline := time.Now().Add(time.Minute)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusInternalServerError {
+				return
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	t.Fatalf("%s is not ready in time", url)
+}
+
+func runSelfTest(t *testing.T, cfg BackendConfig) *SelfTestReport {
+	report, err := SelfTest(context.Background(), NewPusherOpt{
+		Artifact:      Artifact{OutputDir: t.TempDir()},
+		BackendConfig: cfg,
+		Timeout:       time.Minute,
+	})
+	require.NoError(t, err)
+	require.True(t, report.Passed, "%+v", report.Steps)
+	return report
+}
+
+func TestIntegrationSelfTestS3(t *testing.T) {
+	addr := startContainer(t, 9000,
+		"-e", "MINIO_ROOT_USER="+minioUser,
+		"-e", "MINIO_ROOT_PASSWORD="+minioPassword,
+		minioImage, "server", "/data",
+	)
+	waitReady(t, "http://"+addr+"/minio/health/ready")
+
+	awsConfig, err := awscfg.LoadDefaultConfig(context.Background())
+	require.NoError(t, err)
+	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String("http://" + addr)
+		o.Region = "us-east-1"
+		o.UsePathStyle = true
+		o.Credentials = credentials.NewStaticCredentialsProvider(minioUser, minioPassword, "")
+	})
+	_, err = client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String(minioBucket)})
+	require.NoError(t, err)
+
+	report := runSelfTest(t, &S3BackendConfig{
+		Endpoint:        addr,
+		Scheme:          "http",
+		AccessKeyID:     minioUser,
+		AccessKeySecret: minioPassword,
+		Region:          "us-east-1",
+		BucketName:      minioBucket,
+		MetaPrefix:      "meta/",
+		BlobPrefix:      "blob/",
+	})
+	for _, step := range report.Steps {
+		require.Equal(t, SelfTestOK, step.Status, step.Name)
+	}
+
+	// The wrong credentials are reported by the push step.
+	report, err = SelfTest(context.Background(), NewPusherOpt{
+		Artifact: Artifact{OutputDir: t.TempDir()},
+		BackendConfig: &S3BackendConfig{
+			Endpoint:        addr,
+			Scheme:          "http",
+			AccessKeyID:     minioUser,
+			AccessKeySecret: "wrong",
+			Region:          "us-east-1",
+			BucketName:      minioBucket,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+	require.Equal(t, SelfTestFail, report.Steps[0].Status)
+}
+
+func TestIntegrationSelfTestRegistry(t *testing.T) {
+	addr := startContainer(t, 5000, zotImage)
+	waitReady(t, "http://"+addr+"/v2/")
+
+	report := runSelfTest(t, &RegistryBackendConfig{backend.RegistryConfig{
+		Scheme: "http",
+		Host:   addr,
+		Repo:   "nydus/self-test",
+	}})
+	require.Equal(t, SelfTestOK, report.Steps[0].Status)
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package packer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+)
+
+// memBackend stores the objects in memory, it doesn't support deleting.
+type memBackend struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (b *memBackend) Upload(_ context.Context, blobID, blobPath string, _ int64, _ bool) (*ocispec.Descriptor, error) {
+	data, err := os.ReadFile(blobPath)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[blobID] = data
+	return &ocispec.Descriptor{Size: int64(len(data))}, nil
+}
+
+func (b *memBackend) Finalize(_ context.Context, _ bool) error {
+	return nil
+}
+
+func (b *memBackend) Check(_ context.Context, blobID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.objects[blobID]
+	return ok, nil
+}
+
+func (b *memBackend) Type() backend.Type {
+	return backend.S3backend
+}
+
+func (b *memBackend) Reader(_ context.Context, blobID string) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[blobID]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", blobID)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *memBackend) Size(_ context.Context, blobID string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int64(len(b.objects[blobID])), nil
+}
+
+// deletableBackend implements backend.Deleter on memBackend.
+type deletableBackend struct {
+	*memBackend
+}
+
+func (b deletableBackend) Delete(_ context.Context, blobID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.objects, blobID)
+	return nil
+}
+
+// lossyBackend accepts the uploads but never stores them.
+type lossyBackend struct {
+	*memBackend
+}
+
+func (b lossyBackend) Upload(_ context.Context, _, _ string, _ int64, _ bool) (*ocispec.Descriptor, error) {
+	return &ocispec.Descriptor{}, nil
+}
+
+func selfTestStatus(report *SelfTestReport) map[string]string {
+	status := map[string]string{}
+	for _, step := range report.Steps {
+		status[step.Name] = step.Status
+	}
+	return status
+}
+
+func TestPusher_SelfTest(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+	pullDir := t.TempDir()
+
+	objects := &memBackend{objects: map[string][]byte{}}
+	pusher := Pusher{
+		Artifact:    Artifact{OutputDir: tmpDir},
+		logger:      logrus.New(),
+		blobBackend: deletableBackend{objects},
+		metaBackend: deletableBackend{objects},
+	}
+	report, err := pusher.selfTest(context.Background(), pullDir)
+	require.NoError(t, err)
+	require.True(t, report.Passed, "%+v", report.Steps)
+	require.Equal(t, map[string]string{
+		"push":   SelfTestOK,
+		"check":  SelfTestOK,
+		"pull":   SelfTestOK,
+		"delete": SelfTestOK,
+	}, selfTestStatus(report))
+	require.Empty(t, objects.objects)
+
+	// The artifact is kept if the backend doesn't support deleting.
+	pusher.blobBackend = objects
+	pusher.metaBackend = objects
+	report, err = pusher.selfTest(context.Background(), pullDir)
+	require.NoError(t, err)
+	require.True(t, report.Passed)
+	require.Equal(t, SelfTestSkip, selfTestStatus(report)["delete"])
+	require.Len(t, objects.objects, 2)
+}
+
+func TestPusher_SelfTestFailure(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+
+	objects := lossyBackend{&memBackend{objects: map[string][]byte{}}}
+	pusher := Pusher{
+		Artifact:    Artifact{OutputDir: tmpDir},
+		logger:      logrus.New(),
+		blobBackend: objects,
+		metaBackend: objects,
+	}
+	report, err := pusher.selfTest(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+	require.Equal(t, map[string]string{
+		"push":   SelfTestOK,
+		"check":  SelfTestFail,
+		"pull":   SelfTestFail,
+		"delete": SelfTestSkip,
+	}, selfTestStatus(report))
+}
+
+func TestPusher_SelfTestRegistry(t *testing.T) {
+	tmpDir, tearDown := setUpTmpDir(t)
+	defer tearDown()
+
+	registry := &RegistryBackendConfig{backend.RegistryConfig{Host: "localhost:5000", Repo: "nydus/test"}}
+	remote := &memRemote{blobs: map[digest.Digest][]byte{}}
+	pusher := Pusher{
+		Artifact: Artifact{OutputDir: tmpDir},
+		logger:   logrus.New(),
+		cfg:      registry,
+		registry: registry,
+		newRemote: func(_ string) (artifactRemote, error) {
+			return remote, nil
+		},
+	}
+	report, err := pusher.selfTest(context.Background(), t.TempDir())
+	require.NoError(t, err)
+	require.True(t, report.Passed, "%+v", report.Steps)
+	require.Equal(t, map[string]string{
+		"push":   SelfTestOK,
+		"check":  SelfTestSkip,
+		"pull":   SelfTestOK,
+		"delete": SelfTestSkip,
+	}, selfTestStatus(report))
+}
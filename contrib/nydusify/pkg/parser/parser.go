@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"strings"
 
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
@@ -48,6 +49,19 @@ type Parsed struct {
 	NydusImage *Image
 }
 
+// NydusAnnotations returns the annotations of Nydus image manifest, and the
+// annotations of index which are added to the merged multi-platform image.
+func (parsed *Parsed) NydusAnnotations() map[string]string {
+	annotations := map[string]string{}
+	if parsed.Index != nil {
+		maps.Copy(annotations, parsed.Index.Annotations)
+	}
+	if parsed.NydusImage != nil {
+		maps.Copy(annotations, parsed.NydusImage.Manifest.Annotations)
+	}
+	return annotations
+}
+
 // New creates Nydus image parser instance.
 func New(remote *remote.Remote, interestedArch string) (*Parser, error) {
 	if !utils.IsSupportedArch(interestedArch) {
@@ -0,0 +1,347 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package prefetch generates the prefetch file list of Nydus image from the
+// file access trace of container runtime, the list can be stored in image
+// annotations and used by the subsequent conversions.
+package prefetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+const (
+	// TraceFormatNydusd is the access pattern metrics of nydusd, which is
+	// got from the API `/api/v1/metrics/pattern` with `access_pattern`
+	// enabled in nydusd configuration.
+	TraceFormatNydusd = "nydusd"
+	// TraceFormatFanotify is the file list recorded by fanotify, one path
+	// per line in access order, or JSON object per line with `path` field.
+	TraceFormatFanotify = "fanotify"
+)
+
+type Opt struct {
+	// TraceFormat is the format of trace, possible values: 'nydusd', 'fanotify'.
+	TraceFormat string
+	// NydusImagePath and BootstrapPath are required by nydusd trace format to
+	// resolve the file paths from inode numbers.
+	NydusImagePath string
+	BootstrapPath  string
+	// StripPrefix is removed from the paths in trace, for example the rootfs
+	// mountpoint of container recorded by fanotify.
+	StripPrefix string
+	// MaxFiles limits the number of files in prefetch list, 0 means no limit.
+	MaxFiles uint
+}
+
+type accessPattern struct {
+	Ino                  uint64 `json:"ino"`
+	NRRead               uint64 `json:"nr_read"`
+	FirstAccessTimeSecs  uint64 `json:"first_access_time_secs"`
+	FirstAccessTimeNanos uint64 `json:"first_access_time_nanos"`
+}
+
+type fanotifyEvent struct {
+	Path string `json:"path"`
+}
+
+// Generate parses the file access trace, returns the accessed files in the
+// order of first access time, the duplicated files are removed.
+func Generate(opt Opt, trace io.Reader) ([]string, error) {
+	var (
+		files []string
+		err   error
+	)
+	switch opt.TraceFormat {
+	case TraceFormatNydusd:
+		files, err = parseNydusdTrace(opt, trace)
+	case TraceFormatFanotify:
+		files, err = parseFanotifyTrace(trace)
+	default:
+		return nil, fmt.Errorf("unsupported trace format %s", opt.TraceFormat)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s trace", opt.TraceFormat)
+	}
+
+	result := []string{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		if opt.StripPrefix != "" {
+			if !strings.HasPrefix(file, opt.StripPrefix) {
+				continue
+			}
+			file = strings.TrimPrefix(file, opt.StripPrefix)
+		}
+		file = path.Clean("/" + file)
+		if file == "/" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		result = append(result, file)
+		if opt.MaxFiles > 0 && uint(len(result)) >= opt.MaxFiles {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func parseNydusdTrace(opt Opt, trace io.Reader) ([]string, error) {
+	data, err := io.ReadAll(trace)
+	if err != nil {
+		return nil, errors.Wrap(err, "read trace")
+	}
+
+	// The metrics of all mounted instances is a map of instance ID to
+	// the access patterns.
+	var patterns []accessPattern
+	if data = bytes.TrimSpace(data); bytes.HasPrefix(data, []byte("{")) {
+		instances := map[string][]accessPattern{}
+		if err := json.Unmarshal(data, &instances); err != nil {
+			return nil, errors.Wrap(err, "unmarshal access patterns")
+		}
+		for _, instance := range instances {
+			patterns = append(patterns, instance...)
+		}
+	} else if err := json.Unmarshal(data, &patterns); err != nil {
+		return nil, errors.Wrap(err, "unmarshal access patterns")
+	}
+
+	files, err := tool.NewInspector(opt.NydusImagePath).Inspect(tool.InspectOption{
+		Operation: tool.GetFiles,
+		Bootstrap: opt.BootstrapPath,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get files from bootstrap")
+	}
+	paths := map[uint64]string{}
+	for _, file := range files.(tool.FileInfoList) {
+		paths[file.Inode] = file.Path
+	}
+
+	return sortAccessPatterns(patterns, paths), nil
+}
+
+// sortAccessPatterns returns the paths of the accessed inodes in the order
+// of first access time, the inodes not found in bootstrap are ignored.
+func sortAccessPatterns(patterns []accessPattern, paths map[uint64]string) []string {
+	accessed := []accessPattern{}
+	for _, pattern := range patterns {
+		if pattern.FirstAccessTimeSecs == 0 && pattern.FirstAccessTimeNanos == 0 {
+			continue
+		}
+		accessed = append(accessed, pattern)
+	}
+	sort.SliceStable(accessed, func(i, j int) bool {
+		if accessed[i].FirstAccessTimeSecs != accessed[j].FirstAccessTimeSecs {
+			return accessed[i].FirstAccessTimeSecs < accessed[j].FirstAccessTimeSecs
+		}
+		return accessed[i].FirstAccessTimeNanos < accessed[j].FirstAccessTimeNanos
+	})
+
+	files := []string{}
+	for _, pattern := range accessed {
+		if file, ok := paths[pattern.Ino]; ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func parseFanotifyTrace(trace io.Reader) ([]string, error) {
+	files := []string{}
+	scanner := bufio.NewScanner(trace)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var event fanotifyEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				return nil, errors.Wrapf(err, "unmarshal event %s", line)
+			}
+			line = event.Path
+		}
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read trace")
+	}
+	return files, nil
+}
+
+// ParsePatterns parses the prefetch patterns, one absolute path or glob per
+// line, the empty lines and lines starting with `#` are ignored. The builder
+// prefetches the directories recursively, so a glob is reduced to the
+// directory of its static prefix, for example `/usr/lib/*.so` to `/usr/lib`.
+func ParsePatterns(reader io.Reader) ([]string, error) {
+	patterns := []string{}
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") {
+			return nil, fmt.Errorf("prefetch pattern %q should be an absolute path", line)
+		}
+		if idx := strings.IndexAny(line, "*?["); idx >= 0 {
+			if _, err := path.Match(line, ""); err != nil {
+				return nil, errors.Wrapf(err, "invalid prefetch pattern %q", line)
+			}
+			line = path.Dir(line[:idx+1])
+		}
+		line = path.Clean(line)
+		if !seen[line] {
+			seen[line] = true
+			patterns = append(patterns, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read prefetch patterns")
+	}
+	return patterns, nil
+}
+
+func newRemote(ref string, insecure bool) (*remote.Remote, error) {
+	remoter, err := provider.DefaultRemote(ref, insecure)
+	if err != nil {
+		return nil, errors.Wrap(err, "create remote")
+	}
+	return remoter, nil
+}
+
+func resolve(ctx context.Context, remoter *remote.Remote) (*ocispec.Descriptor, error) {
+	desc, err := remoter.Resolve(ctx)
+	if err != nil && utils.RetryWithHTTP(err) {
+		remoter.MaybeWithHTTP(err)
+		desc, err = remoter.Resolve(ctx)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve image")
+	}
+	return desc, nil
+}
+
+func fetchManifest(ctx context.Context, remoter *remote.Remote, desc ocispec.Descriptor) (map[string]json.RawMessage, error) {
+	if !images.IsManifestType(desc.MediaType) && !images.IsIndexType(desc.MediaType) {
+		return nil, fmt.Errorf("unsupported image media type %s", desc.MediaType)
+	}
+	reader, err := remoter.Pull(ctx, desc, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "pull image manifest")
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "read image manifest")
+	}
+	manifest := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, errors.Wrap(err, "unmarshal image manifest")
+	}
+	return manifest, nil
+}
+
+// Annotate stores the prefetch list in the annotation of image manifest (or
+// index for multi-platform image), the image is pushed to the same reference.
+func Annotate(ctx context.Context, ref string, insecure bool, files []string) (*ocispec.Descriptor, error) {
+	remoter, err := newRemote(ref, insecure)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := resolve(ctx, remoter)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := fetchManifest(ctx, remoter, *desc)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{}
+	if raw, ok := manifest["annotations"]; ok {
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			return nil, errors.Wrap(err, "unmarshal image annotations")
+		}
+	}
+	annotations[utils.ManifestNydusPrefetchFiles] = strings.Join(files, "\n")
+	if manifest["annotations"], err = json.Marshal(annotations); err != nil {
+		return nil, errors.Wrap(err, "marshal image annotations")
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal image manifest")
+	}
+	newDesc := ocispec.Descriptor{
+		MediaType: desc.MediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	if err := remoter.Push(ctx, newDesc, false, bytes.NewReader(data)); err != nil {
+		return nil, errors.Wrap(err, "push image manifest")
+	}
+
+	return &newDesc, nil
+}
+
+// FromImage reads the prefetch list from the annotation of image.
+func FromImage(ctx context.Context, ref string, insecure bool) ([]string, error) {
+	remoter, err := newRemote(ref, insecure)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := resolve(ctx, remoter)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := fetchManifest(ctx, remoter, *desc)
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := map[string]string{}
+	if raw, ok := manifest["annotations"]; ok {
+		if err := json.Unmarshal(raw, &annotations); err != nil {
+			return nil, errors.Wrap(err, "unmarshal image annotations")
+		}
+	}
+	list, ok := annotations[utils.ManifestNydusPrefetchFiles]
+	if !ok {
+		return nil, fmt.Errorf("prefetch list is not found in annotation %s of image %s", utils.ManifestNydusPrefetchFiles, ref)
+	}
+
+	files := []string{}
+	for _, file := range strings.Split(list, "\n") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package prefetch
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateFromFanotifyTrace(t *testing.T) {
+	trace := `
+# recorded by fanotify
+/rootfs/usr/bin/nginx
+{"path": "/rootfs/etc/nginx/nginx.conf", "size": 1024}
+/rootfs/usr/bin/nginx
+/proc/self/status
+/rootfs/usr/lib/libc.so
+`
+	files, err := Generate(Opt{TraceFormat: TraceFormatFanotify, StripPrefix: "/rootfs"}, strings.NewReader(trace))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/nginx", "/etc/nginx/nginx.conf", "/usr/lib/libc.so"}, files)
+
+	files, err = Generate(Opt{TraceFormat: TraceFormatFanotify, StripPrefix: "/rootfs", MaxFiles: 2}, strings.NewReader(trace))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/nginx", "/etc/nginx/nginx.conf"}, files)
+
+	_, err = Generate(Opt{TraceFormat: TraceFormatFanotify}, strings.NewReader("{invalid"))
+	require.Error(t, err)
+	_, err = Generate(Opt{TraceFormat: "unknown"}, strings.NewReader(trace))
+	require.Error(t, err)
+}
+
+func TestSortAccessPatterns(t *testing.T) {
+	paths := map[uint64]string{1: "/", 2: "/bin/sh", 3: "/etc/passwd", 4: "/lib/libc.so"}
+	patterns := []accessPattern{
+		{Ino: 3, NRRead: 1, FirstAccessTimeSecs: 100, FirstAccessTimeNanos: 500},
+		{Ino: 2, NRRead: 4, FirstAccessTimeSecs: 100, FirstAccessTimeNanos: 100},
+		// Never accessed.
+		{Ino: 4},
+		// Not found in bootstrap.
+		{Ino: 5, NRRead: 1, FirstAccessTimeSecs: 99},
+		{Ino: 4, NRRead: 1, FirstAccessTimeSecs: 101},
+	}
+	require.Equal(t, []string{"/bin/sh", "/etc/passwd", "/lib/libc.so"}, sortAccessPatterns(patterns, paths))
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns(strings.NewReader(`
+# prefetch the binaries and libraries
+/usr/bin/nginx
+/usr/lib/*.so
+/usr/lib/x86_64-linux-gnu/
+/etc/nginx/conf.d/*/
+/usr/lib/libc.so*
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/usr/bin/nginx", "/usr/lib", "/usr/lib/x86_64-linux-gnu", "/etc/nginx/conf.d"}, patterns)
+
+	_, err = ParsePatterns(strings.NewReader("etc/passwd"))
+	require.ErrorContains(t, err, "should be an absolute path")
+	_, err = ParsePatterns(strings.NewReader("/usr/[lib"))
+	require.ErrorContains(t, err, "invalid prefetch pattern")
+}
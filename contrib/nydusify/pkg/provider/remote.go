@@ -5,41 +5,20 @@
 package provider
 
 import (
-	"crypto/tls"
 	"encoding/base64"
-	"net"
 	"net/http"
-	"os"
 	"strings"
-	"time"
 
-	"github.com/containerd/containerd/remotes"
 	"github.com/containerd/containerd/remotes/docker"
-	dockerconfig "github.com/docker/cli/cli/config"
 	"github.com/pkg/errors"
 
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/auth"
 	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
 )
 
 func newDefaultClient(skipTLSVerify bool) *http.Client {
 	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-				DualStack: true,
-			}).DialContext,
-			MaxIdleConns:          10,
-			IdleConnTimeout:       30 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 5 * time.Second,
-			DisableKeepAlives:     true,
-			TLSNextProto:          make(map[string]func(authority string, c *tls.Conn) http.RoundTripper),
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: skipTLSVerify,
-			},
-		},
+		Transport: remote.NewRetryTransport(remote.SharedTransport(remote.DefaultTransportConfig, skipTLSVerify)),
 	}
 }
 
@@ -50,48 +29,33 @@ type withCredentialFunc = func(string) (string, string, error)
 // withRemote creates a remote instance, it uses the implementation of containerd
 // docker remote to access image from remote registry.
 func withRemote(ref string, insecure bool, credFunc withCredentialFunc) (*remote.Remote, error) {
-	resolverFunc := func(retryWithHTTP bool) remotes.Resolver {
-		registryHosts := docker.ConfigureDefaultRegistries(
-			docker.WithAuthorizer(
-				docker.NewDockerAuthorizer(
-					docker.WithAuthClient(newDefaultClient(insecure)),
-					docker.WithAuthCreds(credFunc),
-				),
-			),
-			docker.WithClient(newDefaultClient(insecure)),
+	// The authorizer and client are shared by all requests of the remote,
+	// so that the bearer tokens are reused across blob pushes, and the
+	// throttling state of registry is tracked by the client transport.
+	authorizer := docker.NewDockerAuthorizer(
+		docker.WithAuthClient(newDefaultClient(insecure)),
+		docker.WithAuthCreds(credFunc),
+	)
+	client := newDefaultClient(insecure)
+	hostsFunc := func(retryWithHTTP bool) docker.RegistryHosts {
+		return docker.ConfigureDefaultRegistries(
+			docker.WithAuthorizer(authorizer),
+			docker.WithClient(client),
 			docker.WithPlainHTTP(func(_ string) (bool, error) {
 				return retryWithHTTP, nil
 			}),
 		)
-
-		return docker.NewResolver(docker.ResolverOptions{
-			Hosts: registryHosts,
-		})
 	}
 
-	return remote.New(ref, resolverFunc)
+	return remote.New(ref, hostsFunc)
 }
 
-// DefaultRemote creates a remote instance, it attempts to read docker auth config
-// file `$DOCKER_CONFIG/config.json` to communicate with remote registry, `$DOCKER_CONFIG`
-// defaults to `~/.docker`.
+// DefaultRemote creates a remote instance, it resolves registry credentials from
+// `$DOCKER_AUTH_CONFIG` environment variable or docker config file `$DOCKER_CONFIG/config.json`
+// (including the configured credential helpers) to communicate with remote registry,
+// `$DOCKER_CONFIG` defaults to `~/.docker`.
 func DefaultRemote(ref string, insecure bool) (*remote.Remote, error) {
-	return withRemote(ref, insecure, func(host string) (string, string, error) {
-		// The host of docker hub image will be converted to `registry-1.docker.io` in:
-		// github.com/containerd/containerd/remotes/docker/registry.go
-		// But we need use the key `https://index.docker.io/v1/` to find auth from docker config.
-		if host == "registry-1.docker.io" {
-			host = "https://index.docker.io/v1/"
-		}
-
-		config := dockerconfig.LoadDefaultConfigFile(os.Stderr)
-		authConfig, err := config.GetAuthConfig(host)
-		if err != nil {
-			return "", "", err
-		}
-
-		return authConfig.Username, authConfig.Password, nil
-	})
+	return withRemote(ref, insecure, auth.CredFunc)
 }
 
 // DefaultRemoteWithAuth creates a remote instance, it parses base64 encoded auth string
@@ -0,0 +1,116 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TransportConfig tunes the HTTP connection pool of registry and storage
+// backends, the zero fields use the default values. The timeouts are in
+// seconds.
+type TransportConfig struct {
+	// MaxIdleConns limits the idle connections across all hosts.
+	MaxIdleConns int `json:"max_idle_conns,omitempty"`
+	// MaxIdleConnsPerHost limits the idle connections kept for each host,
+	// it should be close to the upload concurrency for many small blobs.
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host,omitempty"`
+	// IdleConnTimeout closes the idle connections after the timeout.
+	IdleConnTimeout int `json:"idle_conn_timeout,omitempty"`
+	// KeepAlive is the interval of TCP keep-alive probes.
+	KeepAlive int `json:"keep_alive,omitempty"`
+	// ConnectTimeout limits the time of dialing and TLS handshake.
+	ConnectTimeout int `json:"connect_timeout,omitempty"`
+	// ResponseHeaderTimeout limits the time waiting for response headers
+	// after the request is written, 0 means no limit.
+	ResponseHeaderTimeout int `json:"response_header_timeout,omitempty"`
+	// DisableKeepAlives creates a fresh connection for each request.
+	DisableKeepAlives bool `json:"disable_keep_alives,omitempty"`
+	// HTTP2 attempts HTTP/2 for HTTPS hosts, which multiplexes the requests
+	// over one connection.
+	HTTP2 bool `json:"http2,omitempty"`
+}
+
+var DefaultTransportConfig = TransportConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90,
+	KeepAlive:           30,
+	ConnectTimeout:      30,
+}
+
+type transportKey struct {
+	config   TransportConfig
+	insecure bool
+}
+
+var (
+	transportsMutex sync.Mutex
+	transports      = map[transportKey]*http.Transport{}
+)
+
+func seconds(value, defaultValue int) time.Duration {
+	if value <= 0 {
+		value = defaultValue
+	}
+	return time.Duration(value) * time.Second
+}
+
+func newTransport(cfg TransportConfig, insecure bool) *http.Transport {
+	maxIdleConns := cfg.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = DefaultTransportConfig.MaxIdleConns
+	}
+	maxIdleConnsPerHost := cfg.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultTransportConfig.MaxIdleConnsPerHost
+	}
+	connectTimeout := seconds(cfg.ConnectTimeout, DefaultTransportConfig.ConnectTimeout)
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout,
+			KeepAlive: seconds(cfg.KeepAlive, DefaultTransportConfig.KeepAlive),
+		}).DialContext,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		IdleConnTimeout:       seconds(cfg.IdleConnTimeout, DefaultTransportConfig.IdleConnTimeout),
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: time.Duration(cfg.ResponseHeaderTimeout) * time.Second,
+		ExpectContinueTimeout: 5 * time.Second,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		ForceAttemptHTTP2:     cfg.HTTP2,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecure,
+		},
+	}
+	if !cfg.HTTP2 {
+		// A non-nil empty map disables HTTP/2.
+		transport.TLSNextProto = make(map[string]func(authority string, c *tls.Conn) http.RoundTripper)
+	}
+
+	return transport
+}
+
+// SharedTransport returns the HTTP transport shared by all backend instances
+// with the same configuration, so that the idle connections are reused across
+// the operations instead of dialing a fresh connection for each.
+func SharedTransport(cfg TransportConfig, insecure bool) *http.Transport {
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+
+	key := transportKey{config: cfg, insecure: insecure}
+	transport, ok := transports[key]
+	if !ok {
+		transport = newTransport(cfg, insecure)
+		transports[key] = transport
+	}
+	return transport
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedTransport(t *testing.T) {
+	transport := SharedTransport(DefaultTransportConfig, false)
+	require.Same(t, transport, SharedTransport(DefaultTransportConfig, false))
+	require.NotSame(t, transport, SharedTransport(DefaultTransportConfig, true))
+	require.Equal(t, 16, transport.MaxIdleConnsPerHost)
+	require.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+	require.False(t, transport.DisableKeepAlives)
+	require.NotNil(t, transport.TLSNextProto)
+
+	tuned := SharedTransport(TransportConfig{
+		MaxIdleConnsPerHost:   64,
+		ResponseHeaderTimeout: 10,
+		HTTP2:                 true,
+	}, false)
+	require.NotSame(t, transport, tuned)
+	require.Equal(t, 64, tuned.MaxIdleConnsPerHost)
+	require.Equal(t, 100, tuned.MaxIdleConns)
+	require.Equal(t, 10*time.Second, tuned.ResponseHeaderTimeout)
+	require.True(t, tuned.ForceAttemptHTTP2)
+	require.Nil(t, tuned.TLSNextProto)
+}
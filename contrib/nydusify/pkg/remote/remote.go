@@ -14,8 +14,11 @@ import (
 	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/errdefs"
 	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
 	"github.com/distribution/reference"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // Remote provides the ability to access remote registry
@@ -25,29 +28,42 @@ type Remote struct {
 	parsed reference.Named
 	// The resolver is used for image pull or fetches requests. The best practice
 	// in containerd is that each resolver instance is used only once for a request
-	// and is destroyed when the request completes. When a registry token expires,
-	// the resolver does not re-apply for a new token, so it's better to create a
-	// new resolver instance using resolverFunc for each request.
-	resolverFunc func(insecure bool) remotes.Resolver
-	pushed       sync.Map
+	// and is destroyed when the request completes, so we create a new resolver
+	// instance from hostsFunc for each request. The authorizer of registry hosts
+	// is expected to be shared between requests to reuse the bearer tokens, an
+	// expired token is dropped and re-applied by the authorizer.
+	hostsFunc func(retryWithHTTP bool) docker.RegistryHosts
+	pushed    sync.Map
+
+	// ChunkSize is the size of each chunk in resumable chunked blob upload,
+	// the blob larger than it is uploaded in chunks if the reader implements
+	// `io.ReaderAt`, zero disables the chunked upload.
+	ChunkSize int64
 
 	retryWithHTTP bool
 }
 
-// New creates remote instance from docker remote resolver
-func New(ref string, resolverFunc func(bool) remotes.Resolver) (*Remote, error) {
+// New creates remote instance from the docker registry hosts.
+func New(ref string, hostsFunc func(retryWithHTTP bool) docker.RegistryHosts) (*Remote, error) {
 	parsed, err := reference.ParseNormalizedNamed(ref)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Remote{
-		Ref:          ref,
-		parsed:       parsed,
-		resolverFunc: resolverFunc,
+		Ref:       ref,
+		parsed:    parsed,
+		hostsFunc: hostsFunc,
+		ChunkSize: DefaultChunkSize,
 	}, nil
 }
 
+func (remote *Remote) resolver() remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: remote.hostsFunc(remote.retryWithHTTP),
+	})
+}
+
 func (remote *Remote) MaybeWithHTTP(err error) {
 	parsed, _ := reference.ParseNormalizedNamed(remote.Ref)
 	if parsed != nil {
@@ -75,6 +91,14 @@ func (remote *Remote) Push(ctx context.Context, desc ocispec.Descriptor, byDiges
 	lock.(*sync.Mutex).Lock()
 	defer lock.(*sync.Mutex).Unlock()
 
+	if ra, ok := reader.(io.ReaderAt); ok && byDigest && remote.ChunkSize > 0 && desc.Size > remote.ChunkSize {
+		err := remote.pushChunked(ctx, desc, ra)
+		if !errors.Is(err, errChunkedUnsupported) {
+			return err
+		}
+		logrus.WithError(err).Warnf("fallback to push blob %s in monolithic", desc.Digest)
+	}
+
 	var ref string
 	if byDigest {
 		ref = remote.parsed.Name()
@@ -83,7 +107,7 @@ func (remote *Remote) Push(ctx context.Context, desc ocispec.Descriptor, byDiges
 	}
 
 	// Create a new resolver instance for the request
-	pusher, err := remote.resolverFunc(remote.retryWithHTTP).Pusher(ctx, ref)
+	pusher, err := remote.resolver().Pusher(ctx, ref)
 	if err != nil {
 		return err
 	}
@@ -110,7 +134,7 @@ func (remote *Remote) Pull(ctx context.Context, desc ocispec.Descriptor, byDiges
 	}
 
 	// Create a new resolver instance for the request
-	puller, err := remote.resolverFunc(remote.retryWithHTTP).Fetcher(ctx, ref)
+	puller, err := remote.resolver().Fetcher(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +152,7 @@ func (remote *Remote) Resolve(ctx context.Context) (*ocispec.Descriptor, error)
 	ref := reference.TagNameOnly(remote.parsed).String()
 
 	// Create a new resolver instance for the request
-	_, desc, err := remote.resolverFunc(remote.retryWithHTTP).Resolve(ctx, ref)
+	_, desc, err := remote.resolver().Resolve(ctx, ref)
 	if err != nil {
 		return nil, err
 	}
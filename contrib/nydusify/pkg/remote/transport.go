@@ -0,0 +1,161 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxRetries = 8
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = 2 * time.Minute
+)
+
+// RetryTransport retries the requests throttled by registry (429 Too Many
+// Requests or 503 Service Unavailable). The delay follows the `Retry-After`
+// header if returned by registry, or grows exponentially otherwise.
+//
+// The throttling state is shared by the requests to the same host, so that
+// the concurrent requests (e.g. pushing layers in parallel) back off together
+// instead of hammering the registry.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mutex     sync.Mutex
+	throttled map[string]time.Time
+}
+
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	return &RetryTransport{
+		Base:       base,
+		MaxRetries: defaultMaxRetries,
+		MinBackoff: defaultMinBackoff,
+		MaxBackoff: defaultMaxBackoff,
+		throttled:  make(map[string]time.Time),
+	}
+}
+
+func isThrottled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the `Retry-After` header, which may be
+// delay seconds or a HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.MinBackoff << uint(attempt)
+	if delay <= 0 || delay > t.MaxBackoff {
+		delay = t.MaxBackoff
+	}
+	// Add jitter to avoid the concurrent requests retrying at the same time.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (t *RetryTransport) wait(req *http.Request) error {
+	t.mutex.Lock()
+	until := t.throttled[req.URL.Host]
+	t.mutex.Unlock()
+
+	delay := time.Until(until)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+func (t *RetryTransport) throttle(host string, delay time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if until := time.Now().Add(delay); until.After(t.throttled[host]) {
+		t.throttled[host] = until
+	}
+}
+
+// rewind prepares the request body for retry, returns false
+// if the body can't be replayed.
+func rewind(req *http.Request) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	newReq := req.Clone(req.Context())
+	newReq.Body = body
+	return newReq, true
+}
+
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Base.RoundTrip(req)
+		if err != nil || !isThrottled(resp) {
+			return resp, err
+		}
+
+		delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			delay = t.backoff(attempt)
+		}
+		if delay > t.MaxBackoff {
+			delay = t.MaxBackoff
+		}
+		t.throttle(req.URL.Host, delay)
+
+		if attempt >= t.MaxRetries {
+			return resp, nil
+		}
+		retryReq, ok := rewind(req)
+		if !ok {
+			// Leave it to the caller to retry the request.
+			return resp, nil
+		}
+
+		logrus.Warnf("request %s %s is throttled with status %d, retry after %s", req.Method, req.URL.Redacted(), resp.StatusCode, delay)
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		req = retryReq
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	containerdref "github.com/containerd/containerd/reference"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultChunkSize is the default chunk size of resumable blob upload.
+const DefaultChunkSize int64 = 64 << 20
+
+// maxChunkRetries is the maximum number of consecutive retries
+// to resume the upload from the failed chunk.
+const maxChunkRetries = 5
+
+var errChunkedUnsupported = errors.New("chunked upload is unsupported by registry")
+
+// uploader implements the chunked blob upload defined in OCI distribution spec:
+// https://github.com/opencontainers/distribution-spec/blob/main/spec.md#pushing-a-blob-in-chunks
+type uploader struct {
+	host docker.RegistryHost
+	// repoURL is formatted as `<scheme>://<host>/v2/<repo>`.
+	repoURL string
+}
+
+func (remote *Remote) newUploader() (*uploader, error) {
+	domain := reference.Domain(remote.parsed)
+	hosts, err := remote.hostsFunc(remote.retryWithHTTP)(domain)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get registry hosts of %s", domain)
+	}
+	for _, host := range hosts {
+		if host.Capabilities.Has(docker.HostCapabilityPush) {
+			return &uploader{
+				host:    host,
+				repoURL: fmt.Sprintf("%s://%s%s/%s", host.Scheme, host.Host, host.Path, reference.Path(remote.parsed)),
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("no registry host of %s is capable to push", domain)
+}
+
+func (u *uploader) do(ctx context.Context, method, rawURL string, header http.Header, body *io.SectionReader) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(io.NewSectionReader(body, 0, body.Size())), nil
+			}
+			req.Body, _ = req.GetBody()
+			req.ContentLength = body.Size()
+		}
+		for key, values := range u.host.Header {
+			req.Header[key] = values
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if u.host.Authorizer != nil {
+			if err := u.host.Authorizer.Authorize(ctx, req); err != nil {
+				return nil, errors.Wrap(err, "authorize request")
+			}
+		}
+
+		resp, err := u.host.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		// Apply for a new token if it's missing or expired, the token is
+		// cached in authorizer and reused by the subsequent requests.
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 && u.host.Authorizer != nil {
+			err := u.host.Authorizer.AddResponses(ctx, []*http.Response{resp})
+			resp.Body.Close()
+			if err != nil {
+				return nil, errors.Wrap(err, "add auth responses")
+			}
+			continue
+		}
+
+		return resp, nil
+	}
+}
+
+func location(resp *http.Response) (string, error) {
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", fmt.Errorf("missing location header in response of %s", resp.Request.URL.Redacted())
+	}
+	// Location may be relative to the request URL.
+	parsed, err := resp.Request.URL.Parse(loc)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse location %s", loc)
+	}
+	return parsed.String(), nil
+}
+
+// parseRange parses the `Range` header formatted as `0-<end>`,
+// returns the offset of the next chunk.
+func parseRange(resp *http.Response) (int64, bool) {
+	parts := strings.SplitN(resp.Header.Get("Range"), "-", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(strings.TrimPrefix(parts[1], " "), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return end + 1, true
+}
+
+func (u *uploader) exists(ctx context.Context, dgst digest.Digest) (bool, error) {
+	resp, err := u.do(ctx, http.MethodHead, u.repoURL+"/blobs/"+dgst.String(), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// start starts an upload session, returns the upload location.
+func (u *uploader) start(ctx context.Context) (string, error) {
+	resp, err := u.do(ctx, http.MethodPost, u.repoURL+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", remoteserrors.NewUnexpectedStatusErr(resp)
+	}
+	return location(resp)
+}
+
+// patch uploads a chunk, returns the next upload location
+// and the offset of next chunk.
+func (u *uploader) patch(ctx context.Context, loc string, offset int64, chunk *io.SectionReader) (string, int64, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+chunk.Size()-1))
+	resp, err := u.do(ctx, http.MethodPatch, loc, header, chunk)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusNoContent:
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return "", 0, fmt.Errorf("%w: %v", errChunkedUnsupported, remoteserrors.NewUnexpectedStatusErr(resp))
+	default:
+		return "", 0, remoteserrors.NewUnexpectedStatusErr(resp)
+	}
+	next, err := location(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	nextOffset, ok := parseRange(resp)
+	if !ok {
+		nextOffset = offset + chunk.Size()
+	}
+	return next, nextOffset, nil
+}
+
+// status queries the upload session, returns the upload location
+// and the offset of data that has been received by registry.
+func (u *uploader) status(ctx context.Context, loc string) (string, int64, error) {
+	resp, err := u.do(ctx, http.MethodGet, loc, nil, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return "", 0, remoteserrors.NewUnexpectedStatusErr(resp)
+	}
+	next, err := location(resp)
+	if err != nil {
+		return "", 0, err
+	}
+	// The received data is unknown without range, it's unsafe to resume
+	// the upload from offset 0 in the same session.
+	offset, ok := parseRange(resp)
+	if !ok {
+		return "", 0, errors.New("missing range in upload status")
+	}
+	return next, offset, nil
+}
+
+// commit completes the upload session with blob digest.
+func (u *uploader) commit(ctx context.Context, loc string, dgst digest.Digest) error {
+	parsed, err := url.Parse(loc)
+	if err != nil {
+		return errors.Wrapf(err, "parse location %s", loc)
+	}
+	query := parsed.Query()
+	query.Set("digest", dgst.String())
+	parsed.RawQuery = query.Encode()
+
+	resp, err := u.do(ctx, http.MethodPut, parsed.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusOK, http.StatusNoContent:
+		return nil
+	default:
+		return remoteserrors.NewUnexpectedStatusErr(resp)
+	}
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pushChunked pushes blob in chunks, the upload is resumed from the offset
+// received by registry if a chunk fails, so that a transient failure near
+// the end doesn't require re-uploading the whole large blob.
+func (remote *Remote) pushChunked(ctx context.Context, desc ocispec.Descriptor, ra io.ReaderAt) error {
+	refspec, err := containerdref.Parse(remote.parsed.String())
+	if err != nil {
+		return errors.Wrapf(err, "parse reference %s", remote.parsed)
+	}
+	ctx, err = docker.ContextWithRepositoryScope(ctx, refspec, true)
+	if err != nil {
+		return err
+	}
+	u, err := remote.newUploader()
+	if err != nil {
+		return err
+	}
+
+	if exists, err := u.exists(ctx, desc.Digest); err != nil {
+		return errors.Wrap(err, "check blob existence")
+	} else if exists {
+		return nil
+	}
+
+	loc, err := u.start(ctx)
+	if err != nil {
+		return errors.Wrap(err, "start blob upload")
+	}
+
+	offset := int64(0)
+	retries := 0
+	for offset < desc.Size {
+		size := remote.ChunkSize
+		if desc.Size-offset < size {
+			size = desc.Size - offset
+		}
+		next, nextOffset, err := u.patch(ctx, loc, offset, io.NewSectionReader(ra, offset, size))
+		if err == nil {
+			loc, offset, retries = next, nextOffset, 0
+			continue
+		}
+		if errors.Is(err, errChunkedUnsupported) {
+			return err
+		}
+
+		retries++
+		if retries > maxChunkRetries {
+			return errors.Wrapf(err, "upload chunk at offset %d", offset)
+		}
+		logrus.WithError(err).Warnf("failed to upload chunk of blob %s at offset %d, resume after retry %d", desc.Digest, offset, retries)
+		if err := sleep(ctx, time.Duration(retries)*time.Second); err != nil {
+			return err
+		}
+
+		if loc, offset, err = u.status(ctx, loc); err != nil {
+			// The upload session may be expired or its received data is
+			// unknown, restart the upload.
+			logrus.WithError(err).Warnf("failed to get upload status of blob %s, restart the upload", desc.Digest)
+			if loc, err = u.start(ctx); err != nil {
+				return errors.Wrap(err, "restart blob upload")
+			}
+			offset = 0
+		}
+	}
+
+	if err := u.commit(ctx, loc, desc.Digest); err != nil {
+		return errors.Wrap(err, "commit blob upload")
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry supports the chunked blob upload, it fails the
+// specified PATCH requests to simulate the transient failures.
+type fakeRegistry struct {
+	mutex    sync.Mutex
+	uploaded bytes.Buffer
+	blobs    map[digest.Digest][]byte
+	patches  int
+	failAt   map[int]int
+	sessions int
+	// noStatusRange omits the range in the upload status.
+	noStatusRange bool
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	const uploadPath = "/v2/test/blob/blobs/uploads/"
+	switch {
+	case req.Method == http.MethodHead:
+		dgst := digest.Digest(req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:])
+		if _, ok := r.blobs[dgst]; ok {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case req.Method == http.MethodPost && req.URL.Path == uploadPath:
+		r.uploaded.Reset()
+		r.sessions++
+		w.Header().Set("Location", uploadPath+"session")
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodPatch:
+		r.patches++
+		if status, ok := r.failAt[r.patches]; ok {
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			} else {
+				// Receive half of the chunk to simulate the interrupted upload.
+				data, _ := io.ReadAll(req.Body)
+				r.uploaded.Write(data[:len(data)/2])
+			}
+			w.WriteHeader(status)
+			return
+		}
+		var start, end int
+		fmt.Sscanf(req.Header.Get("Content-Range"), "%d-%d", &start, &end)
+		if start != r.uploaded.Len() {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		io.Copy(&r.uploaded, req.Body)
+		w.Header().Set("Location", uploadPath+"session")
+		w.Header().Set("Range", fmt.Sprintf("0-%d", r.uploaded.Len()-1))
+		w.WriteHeader(http.StatusAccepted)
+	case req.Method == http.MethodGet && req.URL.Path == uploadPath+"session":
+		w.Header().Set("Location", uploadPath+"session")
+		if !r.noStatusRange {
+			w.Header().Set("Range", fmt.Sprintf("0-%d", r.uploaded.Len()-1))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodPut && req.URL.Path == uploadPath+"session":
+		dgst := digest.Digest(req.URL.Query().Get("digest"))
+		if digest.FromBytes(r.uploaded.Bytes()) != dgst {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[dgst] = append([]byte{}, r.uploaded.Bytes()...)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestRemote(t *testing.T, registry *fakeRegistry) *Remote {
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport)}
+	hostsFunc := func(_ bool) docker.RegistryHosts {
+		return docker.ConfigureDefaultRegistries(
+			docker.WithClient(client),
+			docker.WithPlainHTTP(docker.MatchAllHosts),
+		)
+	}
+	remote, err := New(strings.TrimPrefix(server.URL, "http://")+"/test/blob:latest", hostsFunc)
+	require.NoError(t, err)
+	remote.ChunkSize = 100
+	return remote
+}
+
+func TestPushChunked(t *testing.T) {
+	registry := &fakeRegistry{
+		blobs: map[digest.Digest][]byte{},
+		// The 2nd PATCH request is throttled, the 5th is interrupted.
+		failAt: map[int]int{2: http.StatusTooManyRequests, 5: http.StatusInternalServerError},
+	}
+	remote := newTestRemote(t, registry)
+
+	data := bytes.Repeat([]byte("nydus"), 110)
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	require.NoError(t, remote.Push(context.Background(), desc, true, bytes.NewReader(data)))
+	require.Equal(t, data, registry.blobs[desc.Digest])
+
+	// Skip the existing blob.
+	patches := registry.patches
+	require.NoError(t, remote.Push(context.Background(), desc, true, bytes.NewReader(data)))
+	require.Equal(t, patches, registry.patches)
+}
+
+func TestPushChunkedWithoutStatusRange(t *testing.T) {
+	registry := &fakeRegistry{
+		blobs:         map[digest.Digest][]byte{},
+		failAt:        map[int]int{3: http.StatusInternalServerError},
+		noStatusRange: true,
+	}
+	remote := newTestRemote(t, registry)
+
+	data := bytes.Repeat([]byte("nydus"), 110)
+	desc := ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageLayer,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	// The upload is restarted in a new session, since the received data
+	// of the interrupted session is unknown.
+	require.NoError(t, remote.Push(context.Background(), desc, true, bytes.NewReader(data)))
+	require.Equal(t, data, registry.blobs[desc.Digest])
+	require.Equal(t, 2, registry.sessions)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+
+	delay, ok := parseRetryAfter("", now)
+	require.False(t, ok)
+	require.Zero(t, delay)
+
+	delay, ok = parseRetryAfter("3", now)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, delay)
+
+	delay, ok = parseRetryAfter(now.Add(10*time.Second).UTC().Format(http.TimeFormat), now)
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Second, delay, float64(time.Second))
+
+	_, ok = parseRetryAfter("invalid", now)
+	require.False(t, ok)
+}
+
+func TestRetryTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		body, _ := io.ReadAll(req.Body)
+		if requests < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRetryTransport(http.DefaultTransport)}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("nydus"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "nydus", string(body))
+	require.Equal(t, 3, requests)
+}
@@ -0,0 +1,238 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// JobState is the state of a conversion job.
+type JobState string
+
+const (
+	// JobQueued means the job is waiting for a free worker, the running
+	// jobs interrupted by shutdown are queued again.
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+)
+
+// The stages of a running job, reported as its progress.
+const (
+	StagePulling    = "pulling"
+	StageConverting = "converting"
+	StagePushing    = "pushing"
+)
+
+// JobOptions overrides the conversion options of server for a job, the
+// options of server are used if not specified.
+type JobOptions struct {
+	Platforms     string `json:"platforms,omitempty"`
+	AllPlatforms  bool   `json:"all_platforms,omitempty"`
+	FsVersion     string `json:"fs_version,omitempty"`
+	Compressor    string `json:"compressor,omitempty"`
+	ChunkSize     string `json:"chunk_size,omitempty"`
+	OCI           bool   `json:"oci,omitempty"`
+	OCIRef        bool   `json:"oci_ref,omitempty"`
+	MergePlatform bool   `json:"merge_platform,omitempty"`
+}
+
+// JobRequest is the conversion submitted to server.
+type JobRequest struct {
+	Source  string     `json:"source"`
+	Target  string     `json:"target"`
+	Options JobOptions `json:"options"`
+}
+
+func (req *JobRequest) validate() error {
+	if req.Source == "" || req.Target == "" {
+		return errors.New("source and target are required")
+	}
+	for _, ref := range []string{req.Source, req.Target} {
+		if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+			return errors.Wrapf(err, "invalid image reference %s", ref)
+		}
+	}
+	if fsVersion := req.Options.FsVersion; fsVersion != "" && !slices.Contains([]string{"5", "6"}, fsVersion) {
+		return errors.New("fs_version should be one of [5 6]")
+	}
+	if req.Options.AllPlatforms && req.Options.Platforms != "" {
+		return errors.New("all_platforms conflicts with platforms")
+	}
+	return nil
+}
+
+// Job is a conversion job tracked by server.
+type Job struct {
+	ID string `json:"id"`
+	JobRequest
+	State JobState `json:"state"`
+	// Stage and Layers are the progress of running job, Layers is the
+	// number of target layers built.
+	Stage  string `json:"stage,omitempty"`
+	Layers int    `json:"layers,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func newJobID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", errors.Wrap(err, "generate job id")
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// jobStore persists the jobs as `<id>.json` files in the state directory,
+// so that the queue survives restarts of server.
+type jobStore struct {
+	dir  string
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func loadJobStore(dir string) (*jobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "create state directory")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read state directory")
+	}
+
+	store := &jobStore{dir: dir, jobs: map[string]*Job{}}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read job %s", path)
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			logrus.WithError(err).Warnf("skip corrupted job %s", path)
+			continue
+		}
+		// The job was interrupted by the last shutdown.
+		if job.State == JobRunning {
+			job.State = JobQueued
+			job.Stage = ""
+			job.Layers = 0
+			job.StartedAt = nil
+		}
+		store.jobs[job.ID] = &job
+	}
+	return store, nil
+}
+
+// save persists the job, the caller must hold the lock.
+func (store *jobStore) save(job *Job) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal job")
+	}
+	// Write to a temporary file then rename it, to avoid leaving a
+	// corrupted job if server is killed.
+	path := filepath.Join(store.dir, job.ID+".json")
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.Wrap(err, "write job")
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (store *jobStore) add(job *Job) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.save(job); err != nil {
+		return err
+	}
+	// The job is copied since it's returned to the caller.
+	stored := *job
+	store.jobs[job.ID] = &stored
+	return nil
+}
+
+// update modifies the job by fn and persists it, the failure of persisting
+// is logged since the job state in memory is still valid.
+func (store *jobStore) update(id string, fn func(job *Job)) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job, ok := store.jobs[id]
+	if !ok {
+		return
+	}
+	fn(job)
+	if err := store.save(job); err != nil {
+		logrus.WithError(err).Warnf("persist job %s", id)
+	}
+}
+
+func (store *jobStore) get(id string) (Job, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	job, ok := store.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// list returns the jobs sorted by creation time.
+func (store *jobStore) list() []Job {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	jobs := make([]Job, 0, len(store.jobs))
+	for _, job := range store.jobs {
+		jobs = append(jobs, *job)
+	}
+	slices.SortStableFunc(jobs, func(a, b Job) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return jobs
+}
+
+// next marks the oldest queued job as running and returns it, nil is
+// returned if no job is queued.
+func (store *jobStore) next() *Job {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var next *Job
+	for _, job := range store.jobs {
+		if job.State == JobQueued && (next == nil || job.CreatedAt.Before(next.CreatedAt)) {
+			next = job
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	now := time.Now()
+	next.State = JobRunning
+	next.Stage = StagePulling
+	next.StartedAt = &now
+	if err := store.save(next); err != nil {
+		logrus.WithError(err).Warnf("persist job %s", next.ID)
+	}
+	job := *next
+	return &job
+}
@@ -0,0 +1,277 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package server runs nydusify as a long-running conversion service, the
+// conversion jobs are submitted by HTTP API, persisted in a queue and run
+// by the converter with bounded concurrency.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
+)
+
+// maxRequestSize limits the size of job request body.
+const maxRequestSize = 1 << 20
+
+// ConvertFunc converts an image, it's converter.Convert by default.
+type ConvertFunc func(ctx context.Context, opt converter.Opt) error
+
+type Opt struct {
+	// StateDir persists the jobs, the queued and interrupted jobs are
+	// resumed when the server restarts with the same directory.
+	StateDir string
+	// Concurrency is the maximum number of jobs run in parallel.
+	Concurrency uint
+	// Base is the conversion options of jobs, Source and Target are set
+	// by each job, and some options are overridden by JobOptions.
+	Base converter.Opt
+	// Convert is replaced in tests.
+	Convert ConvertFunc
+}
+
+// Server accepts the conversion jobs and runs them in background.
+type Server struct {
+	opt   Opt
+	store *jobStore
+	// notify wakes up an idle worker when a job is queued.
+	notify chan struct{}
+}
+
+func New(opt Opt) (*Server, error) {
+	if opt.StateDir == "" {
+		return nil, errors.New("state directory is required")
+	}
+	if opt.Concurrency == 0 {
+		opt.Concurrency = 1
+	}
+	if opt.Convert == nil {
+		opt.Convert = converter.Convert
+	}
+	store, err := loadJobStore(opt.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		opt:    opt,
+		store:  store,
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+// Submit queues the conversion job.
+func (s *Server) Submit(req JobRequest) (*Job, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:         id,
+		JobRequest: req,
+		State:      JobQueued,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.store.add(job); err != nil {
+		return nil, errors.Wrap(err, "persist job")
+	}
+	logrus.Infof("queued job %s converting %s to %s", job.ID, job.Source, job.Target)
+	s.wake()
+	return job, nil
+}
+
+func (s *Server) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run runs the queued jobs until the context is canceled, the running jobs
+// are interrupted and queued again to be resumed by the next run.
+func (s *Server) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := uint(0); i < s.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Server) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job := s.store.next()
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.notify:
+				continue
+			}
+		}
+		// Other idle workers may take the remaining jobs.
+		s.wake()
+		s.runJob(ctx, job)
+	}
+}
+
+// jobOpt returns the conversion options of job.
+func (s *Server) jobOpt(job *Job) converter.Opt {
+	opt := s.opt.Base
+	opt.Source = job.Source
+	opt.Target = job.Target
+	// The metrics of jobs are not dumped to the same file.
+	opt.OutputJSON = ""
+
+	options := job.Options
+	if options.Platforms != "" || options.AllPlatforms {
+		opt.Platforms = options.Platforms
+		opt.AllPlatforms = options.AllPlatforms
+	}
+	if options.FsVersion != "" {
+		opt.FsVersion = options.FsVersion
+	}
+	if options.Compressor != "" {
+		opt.Compressor = options.Compressor
+	}
+	if options.ChunkSize != "" {
+		opt.ChunkSize = options.ChunkSize
+	}
+	opt.Docker2OCI = opt.Docker2OCI || options.OCI || options.OCIRef
+	opt.OCIRef = opt.OCIRef || options.OCIRef
+	opt.MergePlatform = opt.MergePlatform || options.MergePlatform
+
+	opt.Hooks = append(slices.Clone(opt.Hooks), &progressHook{store: s.store, id: job.ID})
+	return opt
+}
+
+func (s *Server) runJob(ctx context.Context, job *Job) {
+	logrus.Infof("start job %s converting %s to %s", job.ID, job.Source, job.Target)
+	err := s.opt.Convert(ctx, s.jobOpt(job))
+	if err != nil && ctx.Err() != nil {
+		logrus.Warnf("job %s is interrupted and will be resumed", job.ID)
+		s.store.update(job.ID, func(job *Job) {
+			job.State = JobQueued
+			job.Stage = ""
+			job.Layers = 0
+			job.StartedAt = nil
+		})
+		return
+	}
+
+	s.store.update(job.ID, func(job *Job) {
+		now := time.Now()
+		job.FinishedAt = &now
+		job.Stage = ""
+		if err != nil {
+			job.State = JobFailed
+			job.Error = err.Error()
+		} else {
+			job.State = JobSucceeded
+		}
+	})
+	if err != nil {
+		logrus.WithError(err).Errorf("job %s failed", job.ID)
+	} else {
+		logrus.Infof("job %s succeeded", job.ID)
+	}
+}
+
+// progressHook updates the progress of job by the conversion stages.
+type progressHook struct {
+	store *jobStore
+	id    string
+}
+
+func (h *progressHook) Run(_ context.Context, event *hook.Event) (*hook.Result, error) {
+	h.store.update(h.id, func(job *Job) {
+		switch event.Stage {
+		case hook.StagePreLayer:
+			// The pre-layer hooks are invoked after the source image is pulled.
+			job.Stage = StageConverting
+		case hook.StagePostLayer:
+			job.Layers++
+		case hook.StagePrePush:
+			job.Stage = StagePushing
+		}
+	})
+	return nil, nil
+}
+
+// Handler serves the HTTP API of server:
+//
+//	POST /api/v1/jobs       submit a job, the body is JobRequest
+//	GET  /api/v1/jobs       list the jobs
+//	GET  /api/v1/jobs/<id>  get the job
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/jobs", s.handleJobs)
+	mux.HandleFunc("/api/v1/jobs/", s.handleJob)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Warn("write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string][]Job{"jobs": s.store.list()})
+	case http.MethodPost:
+		var req JobRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "decode job request"))
+			return
+		}
+		job, err := s.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/")
+	job, ok := s.store.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("job %s not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,189 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/converter"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/hook"
+)
+
+// fakeConvert runs the hooks of each stage, and fails the source images
+// tagged `fail`.
+func fakeConvert(ctx context.Context, opt converter.Opt) error {
+	for _, stage := range []string{hook.StagePreLayer, hook.StagePostLayer, hook.StagePostLayer, hook.StagePrePush} {
+		for _, h := range opt.Hooks {
+			if _, err := h.Run(ctx, &hook.Event{Stage: stage}); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.Source == "localhost:5000/app:fail" {
+		return fmt.Errorf("failed to pull %s", opt.Source)
+	}
+	return nil
+}
+
+func waitJob(t *testing.T, s *Server, id string, state JobState) Job {
+	for i := 0; i < 100; i++ {
+		job, ok := s.store.get(id)
+		require.True(t, ok)
+		if job.State == state {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s is not %s in time", id, state)
+	return Job{}
+}
+
+func TestJobRequestValidate(t *testing.T) {
+	for _, req := range []JobRequest{
+		{Source: "localhost:5000/app:v1"},
+		{Source: "localhost:5000/app:v1", Target: "Invalid:Ref"},
+		{Source: "localhost:5000/app:v1", Target: "localhost:5000/app:nydus", Options: JobOptions{FsVersion: "7"}},
+		{Source: "localhost:5000/app:v1", Target: "localhost:5000/app:nydus", Options: JobOptions{AllPlatforms: true, Platforms: "linux/amd64"}},
+	} {
+		require.Error(t, req.validate(), "%+v", req)
+	}
+	req := JobRequest{Source: "localhost:5000/app:v1", Target: "localhost:5000/app:nydus", Options: JobOptions{FsVersion: "5"}}
+	require.NoError(t, req.validate())
+}
+
+func TestServer(t *testing.T) {
+	stateDir := t.TempDir()
+	var opts []converter.Opt
+	s, err := New(Opt{
+		StateDir:    stateDir,
+		Concurrency: 2,
+		Base:        converter.Opt{FsVersion: "6", Compressor: "zstd", OutputJSON: "metrics.json"},
+		Convert: func(ctx context.Context, opt converter.Opt) error {
+			opts = append(opts, opt)
+			return fakeConvert(ctx, opt)
+		},
+	})
+	require.NoError(t, err)
+
+	handler := s.Handler()
+	submit := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/jobs", bytes.NewBufferString(body)))
+		return recorder
+	}
+
+	recorder := submit(`{"source": "localhost:5000/app:v1", "target": "localhost:5000/app:nydus", "options": {"fs_version": "5"}}`)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	var job Job
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Equal(t, JobQueued, job.State)
+
+	recorder = submit(`{"source": "localhost:5000/app:v1"}`)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "source and target are required")
+
+	// The jobs are persisted before running.
+	reloaded, err := loadJobStore(stateDir)
+	require.NoError(t, err)
+	require.Len(t, reloaded.list(), 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	succeeded := waitJob(t, s, job.ID, JobSucceeded)
+	require.Equal(t, 2, succeeded.Layers)
+	require.Empty(t, succeeded.Stage)
+	require.NotNil(t, succeeded.StartedAt)
+	require.NotNil(t, succeeded.FinishedAt)
+	require.Len(t, opts, 1)
+	require.Equal(t, "localhost:5000/app:v1", opts[0].Source)
+	require.Equal(t, "5", opts[0].FsVersion)
+	require.Equal(t, "zstd", opts[0].Compressor)
+	require.Empty(t, opts[0].OutputJSON)
+
+	recorder = submit(`{"source": "localhost:5000/app:fail", "target": "localhost:5000/app:nydus"}`)
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	failed := waitJob(t, s, job.ID, JobFailed)
+	require.Contains(t, failed.Error, "failed to pull")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+job.ID, nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+	require.Equal(t, JobFailed, job.State)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var list map[string][]Job
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list["jobs"], 2)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/missing", nil))
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	cancel()
+	<-done
+}
+
+func TestServerResume(t *testing.T) {
+	stateDir := t.TempDir()
+	started := make(chan struct{})
+	s, err := New(Opt{
+		StateDir: stateDir,
+		Convert: func(ctx context.Context, _ converter.Opt) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	require.NoError(t, err)
+	job, err := s.Submit(JobRequest{Source: "localhost:5000/app:v1", Target: "localhost:5000/app:nydus"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	<-started
+	require.Equal(t, JobRunning, waitJob(t, s, job.ID, JobRunning).State)
+
+	// The interrupted job is queued again.
+	cancel()
+	<-done
+	require.Equal(t, JobQueued, waitJob(t, s, job.ID, JobQueued).State)
+
+	// The job left running by a killed server is also queued again.
+	s.store.update(job.ID, func(job *Job) {
+		job.State = JobRunning
+	})
+	resumed, err := New(Opt{StateDir: stateDir, Convert: fakeConvert})
+	require.NoError(t, err)
+	loaded, ok := resumed.store.get(job.ID)
+	require.True(t, ok)
+	require.Equal(t, JobQueued, loaded.State)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go resumed.Run(ctx)
+	waitJob(t, resumed, job.ID, JobSucceeded)
+}
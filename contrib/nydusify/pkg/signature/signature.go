@@ -0,0 +1,214 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package signature signs and verifies image manifests by calling the
+// `cosign` or `notation` CLI, so that supply-chain policies can also
+// cover the converted Nydus images.
+package signature
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/provider"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+const (
+	ToolCosign   = "cosign"
+	ToolNotation = "notation"
+)
+
+var possibleTools = []string{ToolCosign, ToolNotation}
+
+// Opt defines the signing and verification options.
+type Opt struct {
+	// Tool is the signing tool, possible values: 'cosign', 'notation'.
+	Tool string
+	// BinaryPath is the path to the tool binary, default to search in PATH.
+	BinaryPath string
+	// Key is the private key (for signing) or public key (for verification)
+	// reference of cosign, or the key name of notation. Cosign works in
+	// keyless mode if it's empty.
+	Key string
+	// CertificateIdentity and CertificateOIDCIssuer are required by cosign
+	// to verify the signature signed in keyless mode.
+	CertificateIdentity   string
+	CertificateOIDCIssuer string
+	// Verify is true if the signer is used to verify signatures.
+	Verify bool
+}
+
+// Signer signs or verifies an image reference by its manifest digest.
+type Signer struct {
+	Opt
+}
+
+func New(opt Opt) (*Signer, error) {
+	found := false
+	for _, tool := range possibleTools {
+		if opt.Tool == tool {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("signature tool should be one of %v", possibleTools)
+	}
+	if opt.Verify && opt.Tool == ToolCosign && opt.Key == "" &&
+		(opt.CertificateIdentity == "" || opt.CertificateOIDCIssuer == "") {
+		return nil, errors.New("certificate identity and OIDC issuer are required to verify signature in cosign keyless mode")
+	}
+	if opt.BinaryPath == "" {
+		opt.BinaryPath = opt.Tool
+	}
+	if _, err := exec.LookPath(opt.BinaryPath); err != nil {
+		return nil, errors.Wrapf(err, "find %s binary", opt.Tool)
+	}
+	return &Signer{Opt: opt}, nil
+}
+
+// resolve returns the manifest digest of image reference, because signing
+// or verifying a mutable tag is unsafe.
+func (signer *Signer) resolve(ctx context.Context, ref string, insecure bool) (digest.Digest, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse image reference %s", ref)
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest(), nil
+	}
+
+	remoter, err := provider.DefaultRemote(ref, insecure)
+	if err != nil {
+		return "", errors.Wrap(err, "create remote")
+	}
+	desc, err := remoter.Resolve(ctx)
+	if err != nil {
+		if !utils.RetryWithHTTP(err) {
+			return "", errors.Wrapf(err, "resolve image %s", ref)
+		}
+		remoter.MaybeWithHTTP(err)
+		if desc, err = remoter.Resolve(ctx); err != nil {
+			return "", errors.Wrapf(err, "resolve image %s", ref)
+		}
+	}
+
+	return desc.Digest, nil
+}
+
+// pin returns the reference of image manifest by the digest.
+func pin(ref string, dgst digest.Digest) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse image reference %s", ref)
+	}
+	pinned, err := reference.WithDigest(reference.TrimNamed(named), dgst)
+	if err != nil {
+		return "", errors.Wrapf(err, "pin image reference %s", ref)
+	}
+	return pinned.String(), nil
+}
+
+func (signer *Signer) signArgs(ref string, insecure bool) []string {
+	switch signer.Tool {
+	case ToolCosign:
+		args := []string{"sign", "--yes"}
+		if signer.Key != "" {
+			args = append(args, "--key", signer.Key)
+		}
+		if insecure {
+			args = append(args, "--allow-insecure-registry")
+		}
+		return append(args, ref)
+	default:
+		args := []string{"sign"}
+		if signer.Key != "" {
+			args = append(args, "--key", signer.Key)
+		}
+		if insecure {
+			args = append(args, "--insecure-registry")
+		}
+		return append(args, ref)
+	}
+}
+
+func (signer *Signer) verifyArgs(ref string, insecure bool) []string {
+	switch signer.Tool {
+	case ToolCosign:
+		args := []string{"verify"}
+		if signer.Key != "" {
+			args = append(args, "--key", signer.Key)
+		} else {
+			args = append(
+				args,
+				"--certificate-identity", signer.CertificateIdentity,
+				"--certificate-oidc-issuer", signer.CertificateOIDCIssuer,
+			)
+		}
+		if insecure {
+			args = append(args, "--allow-insecure-registry")
+		}
+		return append(args, ref)
+	default:
+		args := []string{"verify"}
+		if insecure {
+			args = append(args, "--insecure-registry")
+		}
+		return append(args, ref)
+	}
+}
+
+func (signer *Signer) run(ctx context.Context, args []string) error {
+	logrus.Debugf("\tCommand: %s %s", signer.BinaryPath, strings.Join(args, " "))
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, signer.BinaryPath, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "run %s: %s", signer.Tool, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// Sign signs the manifest of image reference by the digest, the digest is
+// got from the pushed image instead of resolving the reference again.
+func (signer *Signer) Sign(ctx context.Context, ref string, dgst digest.Digest, insecure bool) error {
+	digestedRef, err := pin(ref, dgst)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Signing image %s with %s", digestedRef, signer.Tool)
+	if err := signer.run(ctx, signer.signArgs(digestedRef, insecure)); err != nil {
+		return errors.Wrapf(err, "sign image %s", digestedRef)
+	}
+	return nil
+}
+
+// Verify verifies the signature of image reference, and returns the digest
+// of verified manifest, the image should be used by the digest afterwards.
+func (signer *Signer) Verify(ctx context.Context, ref string, insecure bool) (digest.Digest, error) {
+	dgst, err := signer.resolve(ctx, ref, insecure)
+	if err != nil {
+		return "", err
+	}
+	digestedRef, err := pin(ref, dgst)
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Verifying signature of image %s with %s", digestedRef, signer.Tool)
+	if err := signer.run(ctx, signer.verifyArgs(digestedRef, insecure)); err != nil {
+		return "", errors.Wrapf(err, "verify signature of image %s", digestedRef)
+	}
+	return dgst, nil
+}
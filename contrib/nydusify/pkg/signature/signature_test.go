@@ -0,0 +1,65 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package signature
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+const testRef = "localhost:5000/nginx@sha256:757574c5a2102627de54971a0083d4ecd24eb48fdf06b234d063f19f7bbc22fb"
+
+func TestNew(t *testing.T) {
+	_, err := New(Opt{Tool: "gpg"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "signature tool should be one of")
+
+	_, err = New(Opt{Tool: ToolCosign, BinaryPath: "/non-existent/cosign"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "find cosign binary")
+
+	// The keyless verification requires the expected certificate.
+	_, err = New(Opt{Tool: ToolCosign, CertificateIdentity: "user@example.com", Verify: true})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate identity and OIDC issuer are required")
+}
+
+func TestPin(t *testing.T) {
+	dgst := digest.Digest("sha256:757574c5a2102627de54971a0083d4ecd24eb48fdf06b234d063f19f7bbc22fb")
+	ref, err := pin("localhost:5000/nginx:latest", dgst)
+	require.NoError(t, err)
+	require.Equal(t, testRef, ref)
+
+	ref, err = pin("nginx", dgst)
+	require.NoError(t, err)
+	require.Equal(t, "docker.io/library/nginx@"+dgst.String(), ref)
+}
+
+func TestCosignArgs(t *testing.T) {
+	signer := &Signer{Opt: Opt{Tool: ToolCosign, Key: "cosign.key"}}
+	require.Equal(t, []string{"sign", "--yes", "--key", "cosign.key", testRef}, signer.signArgs(testRef, false))
+	require.Equal(t, []string{"verify", "--key", "cosign.key", "--allow-insecure-registry", testRef}, signer.verifyArgs(testRef, true))
+
+	signer = &Signer{Opt: Opt{
+		Tool:                  ToolCosign,
+		CertificateIdentity:   "user@example.com",
+		CertificateOIDCIssuer: "https://accounts.example.com",
+	}}
+	require.Equal(t, []string{"sign", "--yes", testRef}, signer.signArgs(testRef, false))
+	require.Equal(t, []string{
+		"verify",
+		"--certificate-identity", "user@example.com",
+		"--certificate-oidc-issuer", "https://accounts.example.com",
+		testRef,
+	}, signer.verifyArgs(testRef, false))
+}
+
+func TestNotationArgs(t *testing.T) {
+	signer := &Signer{Opt: Opt{Tool: ToolNotation, Key: "release"}}
+	require.Equal(t, []string{"sign", "--key", "release", "--insecure-registry", testRef}, signer.signArgs(testRef, true))
+	require.Equal(t, []string{"verify", testRef}, signer.verifyArgs(testRef, false))
+}
@@ -12,8 +12,6 @@ import (
 	"os"
 	"path/filepath"
 
-	"golang.org/x/sys/unix"
-
 	"github.com/containerd/containerd/archive"
 	"github.com/containerd/containerd/archive/compression"
 	"github.com/opencontainers/go-digest"
@@ -139,8 +137,8 @@ func UnpackTargz(ctx context.Context, dst string, r io.Reader, overlay bool) err
 	defer ds.Close()
 
 	// Guarantee that umask won't affect file/directory creation
-	mask := unix.Umask(0)
-	defer unix.Umask(mask)
+	mask := umask(0)
+	defer umask(mask)
 
 	if err := os.MkdirAll(dst, 0755); err != nil {
 		return err
@@ -151,7 +149,7 @@ func UnpackTargz(ctx context.Context, dst string, r io.Reader, overlay bool) err
 			ctx,
 			dst,
 			ds,
-			archive.WithConvertWhiteout(archive.OverlayConvertWhiteout),
+			archive.WithConvertWhiteout(overlayConvertWhiteout),
 		)
 	} else {
 		_, err = archive.Apply(
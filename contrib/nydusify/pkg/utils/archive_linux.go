@@ -0,0 +1,11 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import "github.com/containerd/containerd/archive"
+
+// overlayConvertWhiteout converts the whiteouts of OCI layer to the format
+// of overlayfs.
+var overlayConvertWhiteout = archive.OverlayConvertWhiteout
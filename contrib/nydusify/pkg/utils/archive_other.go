@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import "archive/tar"
+
+// overlayConvertWhiteout refuses to unpack the layers for overlayfs, which
+// is only available on Linux.
+func overlayConvertWhiteout(_ *tar.Header, _ string) (bool, error) {
+	return false, Unsupported("unpacking layers for overlayfs")
+}
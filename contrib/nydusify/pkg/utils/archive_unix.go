@@ -0,0 +1,13 @@
+//go:build !windows
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import "golang.org/x/sys/unix"
+
+func umask(mask int) int {
+	return unix.Umask(mask)
+}
@@ -0,0 +1,10 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+// umask does nothing since there is no umask on Windows.
+func umask(_ int) int {
+	return 0
+}
@@ -9,7 +9,13 @@ const (
 	MediaTypeNydusBlob       = "application/vnd.oci.image.layer.nydus.blob.v1"
 	BootstrapFileNameInLayer = "image/image.boot"
 
-	ManifestNydusCache = "containerd.io/snapshot/nydus-cache"
+	ManifestNydusCache         = "containerd.io/snapshot/nydus-cache"
+	ManifestNydusPrefetchFiles = "containerd.io/snapshot/nydus-prefetch-files"
+	ManifestNydusSkippedLayers = "containerd.io/snapshot/nydus-skipped-layers"
+
+	ManifestNydusRequiredNydusdVersion = "containerd.io/snapshot/nydus-required-nydusd-version"
+	ManifestNydusRequiredFsVersion     = "containerd.io/snapshot/nydus-required-fs-version"
+	ManifestNydusRequiredCompressor    = "containerd.io/snapshot/nydus-required-compressor"
 
 	LayerAnnotationNydusBlob          = "containerd.io/snapshot/nydus-blob"
 	LayerAnnotationNydusBlobDigest    = "containerd.io/snapshot/nydus-blob-digest"
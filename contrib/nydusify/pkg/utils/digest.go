@@ -0,0 +1,86 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/pkg/errors"
+	"lukechampine.com/blake3"
+)
+
+// The digest algorithms to verify the blobs built by nydusify.
+const (
+	DigestSHA256 = "sha256"
+	DigestSHA512 = "sha512"
+	DigestBlake3 = "blake3"
+)
+
+var DigestAlgorithms = []string{DigestSHA256, DigestSHA512, DigestBlake3}
+
+func newHasher(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case DigestSHA256:
+		return sha256.New(), nil
+	case DigestSHA512:
+		return sha512.New(), nil
+	case DigestBlake3:
+		return blake3.New(32, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported digest algorithm %s, possible values: %s", algorithm, strings.Join(DigestAlgorithms, ", "))
+	}
+}
+
+// ValidateDigestAlgorithm checks the digest algorithm is supported.
+func ValidateDigestAlgorithm(algorithm string) error {
+	_, err := newHasher(algorithm)
+	return err
+}
+
+// DigestFile calculates the digest of file with the algorithm, the digest
+// is formatted as `<algorithm>:<hex>`.
+func DigestFile(path, algorithm string) (digest.Digest, error) {
+	hasher, err := newHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", errors.Wrapf(err, "calculate %s digest of file %s", algorithm, path)
+	}
+
+	return digest.NewDigestFromEncoded(digest.Algorithm(algorithm), hex.EncodeToString(hasher.Sum(nil))), nil
+}
+
+// VerifyFile checks the file matches the digest, the algorithm is parsed
+// from the digest.
+func VerifyFile(path string, expected digest.Digest) error {
+	parts := strings.SplitN(expected.String(), ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("invalid digest %s", expected)
+	}
+	actual, err := DigestFile(path, parts[0])
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("digest of file %s mismatches, expected %s, got %s", path, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob")
+	require.NoError(t, os.WriteFile(path, []byte("nydus"), 0644))
+
+	for _, algorithm := range DigestAlgorithms {
+		dgst, err := DigestFile(path, algorithm)
+		require.NoError(t, err)
+		require.Equal(t, algorithm, dgst.Algorithm().String())
+		require.NoError(t, VerifyFile(path, dgst))
+	}
+
+	dgst, err := DigestFile(path, DigestSHA256)
+	require.NoError(t, err)
+	require.Equal(t, digest.FromString("nydus"), dgst)
+
+	_, err = DigestFile(path, "md5")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unsupported digest algorithm md5")
+	require.Error(t, ValidateDigestAlgorithm("md5"))
+
+	err = VerifyFile(path, digest.FromString("nydus-snapshotter"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "mismatches")
+	require.Error(t, VerifyFile(path, "invalid"))
+}
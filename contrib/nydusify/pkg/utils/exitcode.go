@@ -0,0 +1,149 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/pkg/errors"
+)
+
+// The exit codes of nydusify commands, so that the CI systems are able to
+// branch on the failure type without parsing the logs.
+const (
+	// ExitCodeFailure is for the failures not classified below.
+	ExitCodeFailure = 1
+	// ExitCodeValidation is for the invalid command line options or build
+	// options, and the image failed to pass the check.
+	ExitCodeValidation = 2
+	// ExitCodeAuth is for the authentication or authorization failures of
+	// registry or storage backend.
+	ExitCodeAuth = 3
+	// ExitCodeBackendUnreachable is for the network failures of connecting
+	// to registry or storage backend.
+	ExitCodeBackendUnreachable = 4
+	// ExitCodeBuilder is for the failures of external programs, for example
+	// nydus-image exits with non-zero code.
+	ExitCodeBuilder = 5
+	// ExitCodeArtifactMissing is for the missing build artifacts, for
+	// example the bootstrap or blob to push is not found.
+	ExitCodeArtifactMissing = 6
+	// ExitCodeInvalidOutput is for the invalid output of external programs,
+	// for example the output.json of nydus-image can't be parsed.
+	ExitCodeInvalidOutput = 7
+)
+
+// ExitCodeError attaches the exit code to the error.
+type ExitCodeError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// WithExitCode attaches the exit code to the error, it returns nil if the
+// error is nil.
+func WithExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ExitCodeError{Code: code, Err: err}
+}
+
+// ExitCode classifies the error into the exit code, the code attached by
+// WithExitCode takes precedence over the classification by error type.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var codeErr *ExitCodeError
+	if errors.As(err, &codeErr) {
+		return codeErr.Code
+	}
+
+	if isAuthError(err) {
+		return ExitCodeAuth
+	}
+
+	if isNetworkError(err) {
+		return ExitCodeBackendUnreachable
+	}
+
+	var execErr *exec.ExitError
+	if errors.As(err, &execErr) || errors.Is(err, exec.ErrNotFound) {
+		return ExitCodeBuilder
+	}
+
+	return ExitCodeFailure
+}
+
+func isAuthStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+func isAuthError(err error) bool {
+	if errors.Is(err, docker.ErrInvalidAuthorization) {
+		return true
+	}
+
+	var statusErr remoteserrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) && isAuthStatus(statusErr.StatusCode) {
+		return true
+	}
+
+	// The response error of S3 backend.
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) && isAuthStatus(respErr.HTTPStatusCode()) {
+		return true
+	}
+
+	// The service error of OSS backend.
+	var ossErr oss.ServiceError
+	if errors.As(err, &ossErr) && isAuthStatus(ossErr.StatusCode) {
+		return true
+	}
+
+	// Some libraries format the status without wrapping the error.
+	msg := err.Error()
+	return strings.Contains(msg, "401 Unauthorized") || strings.Contains(msg, "403 Forbidden")
+}
+
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"syscall"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteserrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitCode(t *testing.T) {
+	require.Equal(t, 0, ExitCode(nil))
+	require.Equal(t, ExitCodeFailure, ExitCode(errors.New("unknown")))
+
+	validation := WithExitCode(ExitCodeValidation, errors.New("invalid option"))
+	require.Equal(t, "invalid option", validation.Error())
+	require.Equal(t, ExitCodeValidation, ExitCode(errors.Wrap(validation, "convert")))
+	require.Nil(t, WithExitCode(ExitCodeValidation, nil))
+
+	require.Equal(t, ExitCodeAuth, ExitCode(fmt.Errorf("%w: no basic auth credentials", docker.ErrInvalidAuthorization)))
+	require.Equal(t, ExitCodeAuth, ExitCode(errors.Wrap(remoteserrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized}, "push blob")))
+	require.Equal(t, ExitCodeFailure, ExitCode(remoteserrors.ErrUnexpectedStatus{StatusCode: http.StatusInternalServerError}))
+	require.Equal(t, ExitCodeAuth, ExitCode(errors.Wrap(oss.ServiceError{Code: "AccessDenied", StatusCode: http.StatusForbidden}, "put blob")))
+
+	require.Equal(t, ExitCodeBackendUnreachable, ExitCode(errors.Wrap(syscall.ECONNREFUSED, "resolve image")))
+	require.Equal(t, ExitCodeBackendUnreachable, ExitCode(&net.DNSError{Err: "no such host", Name: "registry.invalid"}))
+	require.Equal(t, ExitCodeBackendUnreachable, ExitCode(errors.Wrap(context.DeadlineExceeded, "pull layer")))
+
+	err := exec.Command("sh", "-c", "exit 3").Run()
+	require.Equal(t, ExitCodeBuilder, ExitCode(errors.Wrap(err, "build layer")))
+}
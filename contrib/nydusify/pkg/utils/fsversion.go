@@ -0,0 +1,114 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultChunkSize is the default chunk size of nydus-image (1MB).
+	defaultChunkSize = 0x100000
+	// minChunkSize is the block size of RAFS v6 (EROFS), the chunks must be
+	// aligned to the block so that the kernel EROFS is able to map the blobs.
+	minChunkSize = 0x1000
+	// maxChunkSize is the maximum chunk size supported by nydus-image (16MB).
+	maxChunkSize = 0x1000000
+)
+
+var supportedCompressors = []string{"none", "lz4_block", "zstd"}
+
+// FsOption is the build option of Nydus image depending on the RAFS version.
+type FsOption struct {
+	FsVersion  string
+	Compressor string
+	ChunkSize  string
+	BatchSize  string
+}
+
+// ParseFsVersion parses the RAFS version, possible values: 5, 6.
+func ParseFsVersion(version string) (FsVersion, error) {
+	switch version {
+	case "5":
+		return V5, nil
+	case "6":
+		return V6, nil
+	default:
+		return 0, fmt.Errorf("invalid fs version %s, possible values: 5, 6", version)
+	}
+}
+
+// parseSize parses the size in decimal or hexadecimal (with 0x prefix).
+func parseSize(size string) (uint64, error) {
+	lower := strings.ToLower(size)
+	if strings.HasPrefix(lower, "0x") {
+		return strconv.ParseUint(lower[2:], 16, 64)
+	}
+	return strconv.ParseUint(lower, 10, 64)
+}
+
+func validateSize(name, size string) (uint64, error) {
+	value, err := parseSize(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s", name, size)
+	}
+	if value < minChunkSize || value > maxChunkSize || value&(value-1) != 0 {
+		return 0, fmt.Errorf("invalid %s %s, must be power of two and between 0x%x-0x%x", name, size, minChunkSize, maxChunkSize)
+	}
+	return value, nil
+}
+
+// Validate checks the build option is compatible with the RAFS version,
+// the empty fields use the default values of nydus-image, and the default
+// fs version is 6.
+func (opt FsOption) Validate() error {
+	version := V6
+	if opt.FsVersion != "" {
+		var err error
+		if version, err = ParseFsVersion(opt.FsVersion); err != nil {
+			return err
+		}
+	}
+
+	if opt.Compressor != "" {
+		supported := false
+		for _, compressor := range supportedCompressors {
+			if strings.ToLower(opt.Compressor) == compressor {
+				supported = true
+			}
+		}
+		if !supported {
+			return fmt.Errorf("invalid compressor %s, possible values: %s", opt.Compressor, strings.Join(supportedCompressors, ", "))
+		}
+	}
+
+	chunkSize := uint64(defaultChunkSize)
+	if opt.ChunkSize != "" {
+		var err error
+		if chunkSize, err = validateSize("chunk size", opt.ChunkSize); err != nil {
+			return err
+		}
+	}
+
+	if opt.BatchSize != "" {
+		if value, err := parseSize(opt.BatchSize); err == nil && value == 0 {
+			return nil
+		}
+		if version != V6 {
+			return fmt.Errorf("batch size %s is only supported by fs version 6", opt.BatchSize)
+		}
+		batchSize, err := validateSize("batch size", opt.BatchSize)
+		if err != nil {
+			return err
+		}
+		if batchSize > chunkSize {
+			return fmt.Errorf("batch size 0x%x is bigger than chunk size 0x%x", batchSize, chunkSize)
+		}
+	}
+
+	return nil
+}
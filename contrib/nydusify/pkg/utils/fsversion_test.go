@@ -0,0 +1,31 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFsOptionValidate(t *testing.T) {
+	require.NoError(t, FsOption{}.Validate())
+	require.NoError(t, FsOption{FsVersion: "5", Compressor: "lz4_block", ChunkSize: "0x100000", BatchSize: "0"}.Validate())
+	require.NoError(t, FsOption{FsVersion: "6", Compressor: "zstd", ChunkSize: "0x200000", BatchSize: "0x100000"}.Validate())
+	require.NoError(t, FsOption{FsVersion: "6", ChunkSize: "4096"}.Validate())
+
+	for _, opt := range []FsOption{
+		{FsVersion: "7"},
+		{FsVersion: "6", Compressor: "gzip"},
+		{FsVersion: "6", ChunkSize: "0x800"},
+		{FsVersion: "6", ChunkSize: "0x100001"},
+		{FsVersion: "6", ChunkSize: "0x2000000"},
+		{FsVersion: "6", ChunkSize: "invalid"},
+		{FsVersion: "5", BatchSize: "0x10000"},
+		{FsVersion: "6", ChunkSize: "0x10000", BatchSize: "0x100000"},
+	} {
+		require.Error(t, opt.Validate(), "%+v", opt)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Unsupported returns the error of the feature unavailable on the current
+// platform, for example mounting the image with overlayfs on macOS. The
+// registry and storage backend operations are available on all platforms.
+func Unsupported(feature string) error {
+	return WithExitCode(ExitCodeValidation, fmt.Errorf("%s is unsupported on %s", feature, runtime.GOOS))
+}
+
+// RequireLinux returns the error by Unsupported if not running on Linux.
+func RequireLinux(feature string) error {
+	if runtime.GOOS == "linux" {
+		return nil
+	}
+	return Unsupported(feature)
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The minimum nydusd versions supporting the image features.
+const (
+	// baseNydusdVersion supports RAFS v5 and v6 with the none, lz4_block
+	// and zstd compressors.
+	baseNydusdVersion = "v2.0.0"
+	// batchNydusdVersion supports the batch chunks.
+	batchNydusdVersion = "v2.2.0"
+	// zranNydusdVersion supports the OCI reference (zran) images.
+	zranNydusdVersion = "v2.2.0"
+)
+
+var versionPattern = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+// Requirements are the runtime requirements of a Nydus image, which are
+// recorded in the annotations of target image during conversion, so that the
+// runtime is able to check them against the local nydusd before mounting.
+type Requirements struct {
+	// NydusdVersion is the minimum nydusd version, e.g. v2.2.0.
+	NydusdVersion string
+	FsVersion     string
+	Compressor    string
+}
+
+// Requirements returns the runtime requirements of the image built with the
+// option, the empty fields use the default values of nydus-image.
+func (opt FsOption) Requirements(ociRef bool) Requirements {
+	req := Requirements{
+		NydusdVersion: baseNydusdVersion,
+		FsVersion:     opt.FsVersion,
+		Compressor:    strings.ToLower(opt.Compressor),
+	}
+	if req.FsVersion == "" {
+		req.FsVersion = "6"
+	}
+	if req.Compressor == "" {
+		req.Compressor = "zstd"
+	}
+	if ociRef {
+		// The OCI reference image reads the gzip layers of source image.
+		req.Compressor = "gzip"
+		req.NydusdVersion = zranNydusdVersion
+	}
+	if value, err := parseSize(opt.BatchSize); err == nil && value > 0 {
+		req.NydusdVersion = maxVersion(req.NydusdVersion, batchNydusdVersion)
+	}
+	return req
+}
+
+// Annotations returns the annotations recording the requirements.
+func (req Requirements) Annotations() map[string]string {
+	return map[string]string{
+		ManifestNydusRequiredNydusdVersion: req.NydusdVersion,
+		ManifestNydusRequiredFsVersion:     req.FsVersion,
+		ManifestNydusRequiredCompressor:    req.Compressor,
+	}
+}
+
+// RequirementsFromAnnotations returns the requirements recorded in the
+// annotations, it returns nil if the image was converted without them.
+func RequirementsFromAnnotations(annotations map[string]string) *Requirements {
+	version, ok := annotations[ManifestNydusRequiredNydusdVersion]
+	if !ok {
+		return nil
+	}
+	return &Requirements{
+		NydusdVersion: version,
+		FsVersion:     annotations[ManifestNydusRequiredFsVersion],
+		Compressor:    annotations[ManifestNydusRequiredCompressor],
+	}
+}
+
+// parseVersion parses the major, minor and patch numbers of version, the
+// version of nydusd built from git may have a suffix like `-12-gabcdef`.
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	matches := versionPattern.FindStringSubmatch(version)
+	if matches == nil {
+		return parsed, false
+	}
+	for i := range parsed {
+		// The numbers are matched by the pattern.
+		parsed[i], _ = strconv.Atoi(matches[i+1])
+	}
+	return parsed, true
+}
+
+// compareVersion compares the parsed versions like strings.Compare.
+func compareVersion(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func maxVersion(a, b string) string {
+	parsedA, _ := parseVersion(a)
+	parsedB, _ := parseVersion(b)
+	if compareVersion(parsedA, parsedB) < 0 {
+		return b
+	}
+	return a
+}
+
+// Check checks the nydusd of version satisfies the requirements, the
+// unparsable version of a development build is not checked.
+func (req Requirements) Check(nydusdVersion string) error {
+	required, ok := parseVersion(req.NydusdVersion)
+	if !ok {
+		return fmt.Errorf("invalid required nydusd version %q", req.NydusdVersion)
+	}
+	actual, ok := parseVersion(nydusdVersion)
+	if !ok {
+		return nil
+	}
+	if compareVersion(actual, required) < 0 {
+		return fmt.Errorf(
+			"image requires nydusd %s or later (fs version %s, compressor %s), but the local nydusd is %s, please upgrade nydusd",
+			req.NydusdVersion, req.FsVersion, req.Compressor, nydusdVersion,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequirements(t *testing.T) {
+	req := FsOption{}.Requirements(false)
+	require.Equal(t, Requirements{NydusdVersion: "v2.0.0", FsVersion: "6", Compressor: "zstd"}, req)
+
+	req = FsOption{FsVersion: "6", Compressor: "LZ4_BLOCK", BatchSize: "0x100000"}.Requirements(false)
+	require.Equal(t, Requirements{NydusdVersion: "v2.2.0", FsVersion: "6", Compressor: "lz4_block"}, req)
+	require.Equal(t, "v2.0.0", FsOption{BatchSize: "0"}.Requirements(false).NydusdVersion)
+
+	req = FsOption{FsVersion: "6"}.Requirements(true)
+	require.Equal(t, Requirements{NydusdVersion: "v2.2.0", FsVersion: "6", Compressor: "gzip"}, req)
+
+	parsed := RequirementsFromAnnotations(req.Annotations())
+	require.Equal(t, &req, parsed)
+	require.Nil(t, RequirementsFromAnnotations(map[string]string{}))
+
+	require.NoError(t, req.Check("v2.2.0"))
+	require.NoError(t, req.Check("v2.3.1-12-gabcdef"))
+	require.NoError(t, req.Check("3.0.0"))
+	// The development build is not checked.
+	require.NoError(t, req.Check("master"))
+	err := req.Check("v2.1.9")
+	require.ErrorContains(t, err, "image requires nydusd v2.2.0 or later (fs version 6, compressor gzip), but the local nydusd is v2.1.9")
+
+	require.ErrorContains(t, Requirements{NydusdVersion: "latest"}.Check("v2.2.0"), "invalid required nydusd version")
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package verifier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"lukechampine.com/blake3"
+)
+
+// The compressor and digester names are formatted by `nydus-image inspect`.
+const (
+	compressorNone     = "none"
+	compressorLz4Block = "lz4block"
+	compressorGZip     = "gzip"
+	compressorZstd     = "zstd"
+
+	digesterBlake3 = "blake3"
+	digesterSha256 = "sha256"
+)
+
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+func decompress(compressor string, data []byte, size uint32) ([]byte, error) {
+	switch strings.ToLower(compressor) {
+	case compressorNone:
+		return data, nil
+	case compressorLz4Block:
+		buf := make([]byte, size)
+		n, err := lz4.UncompressBlock(data, buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case compressorZstd:
+		return zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+	case compressorGZip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	default:
+		return nil, fmt.Errorf("unsupported compressor %s", compressor)
+	}
+}
+
+func hash(digester string, data []byte) (string, error) {
+	switch strings.ToLower(digester) {
+	case digesterBlake3:
+		sum := blake3.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	case digesterSha256:
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:]), nil
+	default:
+		return "", fmt.Errorf("unsupported digester %s", digester)
+	}
+}
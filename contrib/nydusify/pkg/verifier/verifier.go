@@ -0,0 +1,306 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package verifier audits the integrity of data blobs referenced by a Nydus
+// bootstrap, it fetches every chunk from storage backend, decompresses and
+// verifies the chunk digest recorded in bootstrap.
+package verifier
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/backend"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/remote"
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+const (
+	StatusCorrupted = "corrupted"
+	StatusMissing   = "missing"
+)
+
+// Blob features defined in nydus storage, the chunk offsets in these
+// blobs don't point to the nydus compressed chunk data.
+const (
+	blobFeatureZran  = 0x0000_0008
+	blobFeatureTarfs = 0x0000_0040
+)
+
+// BlobReader opens the data blob from storage backend by blob ID.
+type BlobReader func(ctx context.Context, blob tool.BlobInfo) (io.ReadCloser, error)
+
+// BackendBlobReader reads data blobs from OSS or S3 backend.
+func BackendBlobReader(bkd backend.Backend) BlobReader {
+	return func(ctx context.Context, blob tool.BlobInfo) (io.ReadCloser, error) {
+		return bkd.Reader(ctx, blob.BlobID)
+	}
+}
+
+// RemoteBlobReader reads data blobs from the registry repository.
+func RemoteBlobReader(remoter *remote.Remote) BlobReader {
+	return func(ctx context.Context, blob tool.BlobInfo) (io.ReadCloser, error) {
+		desc := ocispec.Descriptor{
+			MediaType: utils.MediaTypeNydusBlob,
+			Digest:    digest.NewDigestFromEncoded(digest.SHA256, blob.BlobID),
+			Size:      int64(blob.CompressedSize),
+		}
+		reader, err := remoter.Pull(ctx, desc, true)
+		if err != nil {
+			if !utils.RetryWithHTTP(err) {
+				return nil, err
+			}
+			remoter.MaybeWithHTTP(err)
+			return remoter.Pull(ctx, desc, true)
+		}
+		return reader, nil
+	}
+}
+
+// LocalBlobReader reads data blobs from the local directory.
+func LocalBlobReader(dir string) BlobReader {
+	return func(_ context.Context, blob tool.BlobInfo) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(dir, blob.BlobID))
+	}
+}
+
+type Opt struct {
+	NydusImagePath string
+	BootstrapPath  string
+	// BlobIDs limits the verification to specified blobs,
+	// all blobs in bootstrap are verified if it's empty.
+	BlobIDs []string
+	// Concurrency is the maximum number of blobs verified in parallel.
+	Concurrency uint
+	BlobReader  BlobReader
+}
+
+// ChunkFailure is a corrupted or missing chunk.
+type ChunkFailure struct {
+	BlobID           string `json:"blob_id"`
+	ChunkID          string `json:"chunk_id"`
+	CompressedOffset uint64 `json:"compressed_offset"`
+	CompressedSize   uint32 `json:"compressed_size"`
+	Status           string `json:"status"`
+	Reason           string `json:"reason"`
+}
+
+type BlobReport struct {
+	BlobID    string `json:"blob_id"`
+	Chunks    int    `json:"chunks"`
+	Verified  int    `json:"verified"`
+	Skipped   int    `json:"skipped"`
+	Corrupted int    `json:"corrupted"`
+	Missing   int    `json:"missing"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Blobs    []BlobReport   `json:"blobs"`
+	Failures []ChunkFailure `json:"failures"`
+}
+
+// Corrupted returns the number of corrupted and missing chunks.
+func (report *Report) Corrupted() (int, int) {
+	var corrupted, missing int
+	for _, blob := range report.Blobs {
+		corrupted += blob.Corrupted
+		missing += blob.Missing
+	}
+	return corrupted, missing
+}
+
+type Verifier struct {
+	Opt
+	inspector *tool.Inspector
+}
+
+func New(opt Opt) (*Verifier, error) {
+	if opt.BlobReader == nil {
+		return nil, fmt.Errorf("blob reader is not specified")
+	}
+	if opt.Concurrency == 0 {
+		opt.Concurrency = 1
+	}
+	return &Verifier{
+		Opt:       opt,
+		inspector: tool.NewInspector(opt.NydusImagePath),
+	}, nil
+}
+
+// Verify verifies all chunks referenced by bootstrap, the corrupted or missing
+// chunks are recorded in report instead of returning an error.
+func (verifier *Verifier) Verify(ctx context.Context) (*Report, error) {
+	blobs, err := verifier.inspector.Inspect(tool.InspectOption{
+		Operation: tool.GetBlobs,
+		Bootstrap: verifier.BootstrapPath,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get blobs from bootstrap")
+	}
+	chunks, err := verifier.inspector.Inspect(tool.InspectOption{
+		Operation: tool.GetChunks,
+		Bootstrap: verifier.BootstrapPath,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get chunks from bootstrap")
+	}
+
+	chunksByBlob := map[string][]tool.ChunkInfo{}
+	for _, chunk := range chunks.(tool.ChunkInfoList) {
+		chunksByBlob[chunk.BlobID] = append(chunksByBlob[chunk.BlobID], chunk)
+	}
+
+	filter := map[string]bool{}
+	for _, blobID := range verifier.BlobIDs {
+		filter[blobID] = true
+	}
+
+	report := &Report{Failures: []ChunkFailure{}}
+	var mutex sync.Mutex
+	eg := errgroup.Group{}
+	eg.SetLimit(int(verifier.Concurrency))
+	for _, blob := range blobs.(tool.BlobInfoList) {
+		blob := blob
+		if len(filter) > 0 && !filter[blob.BlobID] {
+			continue
+		}
+		eg.Go(func() error {
+			blobReport, failures := verifier.verifyBlob(ctx, blob, chunksByBlob[blob.BlobID])
+			logrus.Infof(
+				"verified blob %s: chunks %d, verified %d, skipped %d, corrupted %d, missing %d",
+				blob.BlobID, blobReport.Chunks, blobReport.Verified, blobReport.Skipped, blobReport.Corrupted, blobReport.Missing,
+			)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Blobs = append(report.Blobs, *blobReport)
+			report.Failures = append(report.Failures, failures...)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Blobs, func(i, j int) bool {
+		return report.Blobs[i].BlobID < report.Blobs[j].BlobID
+	})
+
+	return report, nil
+}
+
+func (verifier *Verifier) verifyBlob(ctx context.Context, blob tool.BlobInfo, chunks []tool.ChunkInfo) (*BlobReport, []ChunkFailure) {
+	report := &BlobReport{BlobID: blob.BlobID, Chunks: len(chunks)}
+	failures := []ChunkFailure{}
+	fail := func(chunk tool.ChunkInfo, status, reason string) {
+		if status == StatusMissing {
+			report.Missing++
+		} else {
+			report.Corrupted++
+		}
+		failures = append(failures, ChunkFailure{
+			BlobID:           blob.BlobID,
+			ChunkID:          chunk.ChunkID,
+			CompressedOffset: chunk.CompressedOffset,
+			CompressedSize:   chunk.CompressedSize,
+			Status:           status,
+			Reason:           reason,
+		})
+	}
+
+	if blob.Features&(blobFeatureZran|blobFeatureTarfs) != 0 {
+		report.Skipped = len(chunks)
+		report.Error = "unsupported blob for OCI reference or tarfs image"
+		return report, failures
+	}
+
+	reader, err := verifier.BlobReader(ctx, blob)
+	if err != nil {
+		report.Error = errors.Wrap(err, "open blob").Error()
+		for _, chunk := range chunks {
+			fail(chunk, StatusMissing, "blob is unavailable")
+		}
+		return report, failures
+	}
+	defer reader.Close()
+
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].CompressedOffset < chunks[j].CompressedOffset
+	})
+
+	bufReader := bufio.NewReaderSize(reader, 1<<20)
+	pos := uint64(0)
+	var readErr error
+	for _, chunk := range chunks {
+		if readErr != nil {
+			fail(chunk, StatusMissing, readErr.Error())
+			continue
+		}
+		// The batch chunks share the compressed data with each other,
+		// and the encrypted chunks require the cipher key to verify.
+		if chunk.Batch || chunk.Encrypted {
+			report.Skipped++
+			continue
+		}
+		if chunk.CompressedOffset < pos {
+			fail(chunk, StatusCorrupted, "chunk overlaps with the previous chunk")
+			continue
+		}
+
+		if _, err := io.CopyN(io.Discard, bufReader, int64(chunk.CompressedOffset-pos)); err != nil {
+			readErr = errors.Wrap(err, "blob is truncated")
+			fail(chunk, StatusMissing, readErr.Error())
+			continue
+		}
+		data := make([]byte, chunk.CompressedSize)
+		if _, err := io.ReadFull(bufReader, data); err != nil {
+			readErr = errors.Wrap(err, "blob is truncated")
+			fail(chunk, StatusMissing, readErr.Error())
+			continue
+		}
+		pos = chunk.CompressedOffset + uint64(chunk.CompressedSize)
+
+		if reason := verifyChunk(blob, chunk, data); reason != "" {
+			fail(chunk, StatusCorrupted, reason)
+			continue
+		}
+		report.Verified++
+	}
+
+	return report, failures
+}
+
+// verifyChunk returns the reason if the chunk is corrupted.
+func verifyChunk(blob tool.BlobInfo, chunk tool.ChunkInfo, data []byte) string {
+	if chunk.Compressed {
+		var err error
+		if data, err = decompress(blob.Compressor, data, chunk.UncompressedSize); err != nil {
+			return fmt.Sprintf("decompress chunk: %s", err)
+		}
+	}
+	if len(data) != int(chunk.UncompressedSize) {
+		return fmt.Sprintf("unexpected uncompressed size %d, expected %d", len(data), chunk.UncompressedSize)
+	}
+	sum, err := hash(blob.Digester, data)
+	if err != nil {
+		return err.Error()
+	}
+	if sum != chunk.ChunkID {
+		return fmt.Sprintf("unexpected digest %s, expected %s", sum, chunk.ChunkID)
+	}
+	return ""
+}
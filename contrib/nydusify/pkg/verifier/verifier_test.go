@@ -0,0 +1,107 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/checker/tool"
+)
+
+type testChunk struct {
+	data       []byte
+	compressed []byte
+}
+
+// buildBlob generates a blob with the compressed chunks, and the chunk list
+// with the digests of uncompressed data.
+func buildBlob(t *testing.T, compressor string, chunks []testChunk) ([]byte, []tool.ChunkInfo) {
+	var blob bytes.Buffer
+	infos := []tool.ChunkInfo{}
+	for _, chunk := range chunks {
+		sum, err := hash(digesterBlake3, chunk.data)
+		require.NoError(t, err)
+		compressed := chunk.compressed
+		if compressed == nil {
+			switch compressor {
+			case compressorZstd:
+				encoder, err := zstd.NewWriter(nil)
+				require.NoError(t, err)
+				compressed = encoder.EncodeAll(chunk.data, nil)
+			case compressorLz4Block:
+				compressed = make([]byte, lz4.CompressBlockBound(len(chunk.data)))
+				n, err := lz4.CompressBlock(chunk.data, compressed, nil)
+				require.NoError(t, err)
+				compressed = compressed[:n]
+			}
+		}
+		infos = append(infos, tool.ChunkInfo{
+			BlobID:           "blob",
+			ChunkID:          sum,
+			CompressedOffset: uint64(blob.Len()),
+			CompressedSize:   uint32(len(compressed)),
+			UncompressedSize: uint32(len(chunk.data)),
+			Compressed:       true,
+		})
+		blob.Write(compressed)
+	}
+	return blob.Bytes(), infos
+}
+
+func TestVerifyBlob(t *testing.T) {
+	chunks := []testChunk{
+		{data: bytes.Repeat([]byte("nydus"), 1000)},
+		{data: bytes.Repeat([]byte("image"), 2000)},
+		{data: bytes.Repeat([]byte("chunk"), 3000)},
+	}
+
+	for _, compressor := range []string{compressorZstd, compressorLz4Block} {
+		t.Run(compressor, func(t *testing.T) {
+			dir := t.TempDir()
+			blobData, infos := buildBlob(t, compressor, chunks)
+			blob := tool.BlobInfo{
+				BlobID:         "blob",
+				CompressedSize: uint64(len(blobData)),
+				Compressor:     compressor,
+				Digester:       "Blake3",
+			}
+			verifier, err := New(Opt{BlobReader: LocalBlobReader(dir)})
+			require.NoError(t, err)
+
+			// Blob is missing.
+			report, failures := verifier.verifyBlob(context.Background(), blob, infos)
+			require.Equal(t, 3, report.Missing)
+			require.Len(t, failures, 3)
+
+			// Blob is valid.
+			blobPath := filepath.Join(dir, "blob")
+			require.NoError(t, os.WriteFile(blobPath, blobData, 0644))
+			report, failures = verifier.verifyBlob(context.Background(), blob, infos)
+			require.Equal(t, 3, report.Verified)
+			require.Empty(t, failures)
+
+			// The 2nd chunk is tampered, the 3rd chunk is truncated.
+			tampered := append([]byte{}, blobData[:len(blobData)-1]...)
+			tampered[infos[1].CompressedOffset+1] ^= 0xff
+			require.NoError(t, os.WriteFile(blobPath, tampered, 0644))
+			report, failures = verifier.verifyBlob(context.Background(), blob, infos)
+			require.Equal(t, 1, report.Verified)
+			require.Equal(t, 1, report.Corrupted)
+			require.Equal(t, 1, report.Missing)
+			require.Len(t, failures, 2)
+			require.Equal(t, StatusCorrupted, failures[0].Status)
+			require.Equal(t, infos[1].ChunkID, failures[0].ChunkID)
+			require.Equal(t, StatusMissing, failures[1].Status)
+		})
+	}
+}
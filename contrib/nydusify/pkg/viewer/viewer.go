@@ -45,6 +45,7 @@ type FsViewer struct {
 	Opt
 	Parser       *parser.Parser
 	NydusdConfig tool.NydusdConfig
+	nydusd       *tool.Nydusd
 }
 
 // New creates fsViewer instance, Target is the Nydus image reference
@@ -145,18 +146,63 @@ func (fsViewer *FsViewer) MountImage() error {
 	if err := nydusd.Mount(); err != nil {
 		return errors.Wrap(err, "failed to mount Nydus image")
 	}
+	fsViewer.nydusd = nydusd
 
 	return nil
 }
 
+// UmountImage umounts the nydus image mounted by MountImage, the
+// nydusd daemon exits once its mountpoint is detached.
+func (fsViewer *FsViewer) UmountImage() error {
+	if fsViewer.nydusd == nil {
+		return nil
+	}
+	logrus.Infof("Umounting Nydus image from %s", fsViewer.NydusdConfig.MountPath)
+	if err := fsViewer.nydusd.Umount(false); err != nil {
+		return errors.Wrap(err, "failed to umount Nydus image")
+	}
+	fsViewer.nydusd = nil
+	return nil
+}
+
 // View provides the structure of the file system in target nydus image
 // It includes two steps, pull the boostrap of the image, and mount the
 // image under specified path.
 func (fsViewer *FsViewer) View(ctx context.Context) error {
-	if err := fsViewer.view(ctx); err != nil {
+	if err := fsViewer.Prepare(ctx); err != nil {
+		return err
+	}
+
+	// Block current goroutine in order to umount the file system and clean up workdir
+	sigs := make(chan os.Signal, 1)
+	done := make(chan bool, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigs
+		logrus.Infof("Received Signal: %s", sig)
+		done <- true
+	}()
+
+	logrus.Infof("Please send signal SIGINT/SIGTERM to umount the file system")
+	<-done
+	if err := fsViewer.UmountImage(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(fsViewer.WorkDir); err != nil {
+		return errors.Wrap(err, "failed to clean up working directory")
+	}
+
+	return nil
+}
+
+// Prepare pulls the bootstrap of target image and mounts the image, the
+// image is ready to read once it returns.
+func (fsViewer *FsViewer) Prepare(ctx context.Context) error {
+	if err := fsViewer.prepare(ctx); err != nil {
 		if utils.RetryWithHTTP(err) {
 			fsViewer.Parser.Remote.MaybeWithHTTP(err)
-			return fsViewer.view(ctx)
+			return fsViewer.prepare(ctx)
 		}
 		return err
 
@@ -164,7 +210,7 @@ func (fsViewer *FsViewer) View(ctx context.Context) error {
 	return nil
 }
 
-func (fsViewer *FsViewer) view(ctx context.Context) error {
+func (fsViewer *FsViewer) prepare(ctx context.Context) error {
 	// Pull bootstrap
 	targetParsed, err := fsViewer.Parser.Parse(ctx)
 	if err != nil {
@@ -175,6 +221,10 @@ func (fsViewer *FsViewer) view(ctx context.Context) error {
 		return errors.Wrap(err, "failed to pull Nydus image bootstrap")
 	}
 
+	if err := tool.CheckRequirements(fsViewer.NydusdConfig.NydusdPath, targetParsed.NydusAnnotations()); err != nil {
+		return utils.WithExitCode(utils.ExitCodeValidation, errors.Wrap(err, "check image requirements"))
+	}
+
 	// Adjust nydusd parameters(DigestValidate) according to rafs format
 	nydusManifest := parser.FindNydusBootstrapDesc(&targetParsed.NydusImage.Manifest)
 	if nydusManifest != nil {
@@ -187,27 +237,5 @@ func (fsViewer *FsViewer) view(ctx context.Context) error {
 		}
 	}
 
-	err = fsViewer.MountImage()
-	if err != nil {
-		return err
-	}
-
-	// Block current goroutine in order to umount the file system and clean up workdir
-	sigs := make(chan os.Signal, 1)
-	done := make(chan bool, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		sig := <-sigs
-		logrus.Infof("Received Signal: %s", sig)
-		done <- true
-	}()
-
-	logrus.Infof("Please send signal SIGINT/SIGTERM to umount the file system")
-	<-done
-	if err := os.RemoveAll(fsViewer.WorkDir); err != nil {
-		return errors.Wrap(err, "failed to clean up working directory")
-	}
-
-	return nil
+	return fsViewer.MountImage()
 }
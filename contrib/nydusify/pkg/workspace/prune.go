@@ -0,0 +1,179 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// EntryKind classifies the leftovers of nydusify in workspace roots.
+type EntryKind string
+
+const (
+	// KindWorkDir is the temporary directory of conversion, copy, commit
+	// or analysis, including the content store caching the pulled layers.
+	KindWorkDir EntryKind = "work_dir"
+	// KindCheckpoint is the checkpoint of an interrupted conversion.
+	KindCheckpoint EntryKind = "checkpoint"
+	// KindPacker is the source tarball or verification directory of pack.
+	KindPacker EntryKind = "packer"
+	// KindTemp is the partial file of an interrupted write or upload.
+	KindTemp EntryKind = "temp"
+)
+
+// activeAge protects the recently modified entries, which probably belong
+// to a running operation, from being pruned to meet the size budget.
+const activeAge = time.Hour
+
+// entryPatterns match the names created by nydusify in workspace roots, the
+// specific patterns are matched first.
+var entryPatterns = []struct {
+	kind    EntryKind
+	pattern *regexp.Regexp
+}{
+	{KindCheckpoint, regexp.MustCompile(`^nydusify-checkpoint-[0-9a-f]+$`)},
+	{KindWorkDir, regexp.MustCompile(`^nydusify-.+$`)},
+	{KindPacker, regexp.MustCompile(`^(verify-\d+|source-\d+\.tar)$`)},
+	{KindTemp, regexp.MustCompile(`^(.+\.\d+\.tmp|split-(part|manifest)-\d+)$`)},
+}
+
+func entryKind(name string) (EntryKind, bool) {
+	for _, entry := range entryPatterns {
+		if entry.pattern.MatchString(name) {
+			return entry.kind, true
+		}
+	}
+	return "", false
+}
+
+// Entry is a leftover of nydusify in workspace root.
+type Entry struct {
+	Path string    `json:"path"`
+	Kind EntryKind `json:"kind"`
+	Size uint64    `json:"size"`
+	// ModTime is the latest modification time of the files in entry.
+	ModTime time.Time `json:"mod_time"`
+	Pruned  bool      `json:"pruned"`
+}
+
+// PruneOpt defines the retention of leftovers, nothing is pruned if neither
+// OlderThan nor MaxSize is specified.
+type PruneOpt struct {
+	Roots []string
+	// OlderThan prunes the entries not modified within the duration.
+	OlderThan time.Duration
+	// MaxSize prunes the oldest entries until the total size of entries is
+	// within it, the entries modified in the last hour are kept.
+	MaxSize uint64
+	// DryRun only reports the entries to be pruned.
+	DryRun bool
+}
+
+// PruneReport is the inventory of leftovers and the pruned ones.
+type PruneReport struct {
+	Entries    []Entry `json:"entries"`
+	TotalSize  uint64  `json:"total_size"`
+	PrunedSize uint64  `json:"pruned_size"`
+}
+
+// inspect returns the total size and the latest modification time of the
+// regular files and directories in path.
+func inspect(path string) (uint64, time.Time, error) {
+	size := uint64(0)
+	var modTime time.Time
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		return nil
+	})
+	return size, modTime, err
+}
+
+// Inventory lists the leftovers of nydusify directly under the roots, the
+// roots not existing are ignored. The entries are sorted from the oldest.
+func Inventory(roots []string) ([]Entry, error) {
+	var entries []Entry
+	for _, root := range roots {
+		children, err := os.ReadDir(root)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				logrus.Debugf("skip not existing workspace root %s", root)
+				continue
+			}
+			return nil, errors.Wrapf(err, "read workspace root %s", root)
+		}
+		for _, child := range children {
+			kind, ok := entryKind(child.Name())
+			if !ok {
+				continue
+			}
+			path := filepath.Join(root, child.Name())
+			size, modTime, err := inspect(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "inspect %s", path)
+			}
+			entries = append(entries, Entry{
+				Path:    path,
+				Kind:    kind,
+				Size:    size,
+				ModTime: modTime,
+			})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime.Before(entries[j].ModTime)
+	})
+	return entries, nil
+}
+
+// Prune removes the leftovers beyond the retention, the entries are marked
+// as pruned in the report.
+func Prune(opt PruneOpt) (*PruneReport, error) {
+	entries, err := Inventory(opt.Roots)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PruneReport{Entries: entries}
+	for _, entry := range entries {
+		report.TotalSize += entry.Size
+	}
+
+	now := time.Now()
+	remaining := report.TotalSize
+	for idx := range report.Entries {
+		entry := &report.Entries[idx]
+		age := now.Sub(entry.ModTime)
+		expired := opt.OlderThan > 0 && age > opt.OlderThan
+		overBudget := opt.MaxSize > 0 && remaining > opt.MaxSize && age > activeAge
+		if !expired && !overBudget {
+			continue
+		}
+		if !opt.DryRun {
+			if err := os.RemoveAll(entry.Path); err != nil {
+				return report, errors.Wrapf(err, "remove %s", entry.Path)
+			}
+		}
+		entry.Pruned = true
+		remaining -= entry.Size
+		report.PrunedSize += entry.Size
+	}
+
+	return report, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntryKind(t *testing.T) {
+	for name, expected := range map[string]EntryKind{
+		"nydusify-checkpoint-0123abcd": KindCheckpoint,
+		"nydusify-123":                 KindWorkDir,
+		"nydusify-build-456":           KindWorkDir,
+		"verify-789":                   KindPacker,
+		"source-789.tar":               KindPacker,
+		"blobs.json.123.tmp":           KindTemp,
+		"split-part-123":               KindTemp,
+	} {
+		kind, ok := entryKind(name)
+		require.True(t, ok, name)
+		require.Equal(t, expected, kind, name)
+	}
+	for _, name := range []string{"nydusify", "verify-abc", "source.tar", "data.tmp", "bootstrap"} {
+		_, ok := entryKind(name)
+		require.False(t, ok, name)
+	}
+}
+
+// createEntry creates a directory with a file of size modified at time.
+func createEntry(t *testing.T, path string, size int, modTime time.Time) {
+	require.NoError(t, os.MkdirAll(path, 0755))
+	file := filepath.Join(path, "data")
+	require.NoError(t, os.WriteFile(file, make([]byte, size), 0644))
+	require.NoError(t, os.Chtimes(file, modTime, modTime))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestPrune(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	old := filepath.Join(root, "nydusify-1")
+	stale := filepath.Join(root, "nydusify-checkpoint-abcd")
+	recent := filepath.Join(root, "nydusify-build-2")
+	active := filepath.Join(root, "nydusify-3")
+	user := filepath.Join(root, "user-data")
+	createEntry(t, old, 100, now.Add(-10*24*time.Hour))
+	createEntry(t, stale, 200, now.Add(-2*24*time.Hour))
+	createEntry(t, recent, 300, now.Add(-2*time.Hour))
+	createEntry(t, active, 400, now)
+	createEntry(t, user, 500, now.Add(-30*24*time.Hour))
+
+	entries, err := Inventory([]string{root, filepath.Join(root, "missing")})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, old, entries[0].Path)
+	require.Equal(t, KindWorkDir, entries[0].Kind)
+	require.Equal(t, uint64(100), entries[0].Size)
+	require.Equal(t, KindCheckpoint, entries[1].Kind)
+
+	report, err := Prune(PruneOpt{Roots: []string{root}, OlderThan: 7 * 24 * time.Hour, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), report.TotalSize)
+	require.Equal(t, uint64(100), report.PrunedSize)
+	require.True(t, report.Entries[0].Pruned)
+	require.DirExists(t, old)
+
+	// The active entry is kept even if it exceeds the budget.
+	report, err = Prune(PruneOpt{Roots: []string{root}, OlderThan: 7 * 24 * time.Hour, MaxSize: 100})
+	require.NoError(t, err)
+	require.Equal(t, uint64(600), report.PrunedSize)
+	require.NoDirExists(t, old)
+	require.NoDirExists(t, stale)
+	require.NoDirExists(t, recent)
+	require.DirExists(t, active)
+	require.DirExists(t, user)
+
+	report, err = Prune(PruneOpt{Roots: []string{root}})
+	require.NoError(t, err)
+	require.Len(t, report.Entries, 1)
+	require.Zero(t, report.PrunedSize)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package workspace manages the temporary directories of image conversion
+// and packing, it checks the available disk space before the long running
+// operations, spreads the temporary directories across multiple volumes,
+// and removes them on failure.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+// Workspace allocates the temporary directories in the parent directories,
+// the directory with the most available space is chosen for each one.
+type Workspace struct {
+	dirs []string
+
+	mutex sync.Mutex
+	// removals are the directories created by workspace, which are removed
+	// in reverse order on cleanup.
+	removals []string
+}
+
+// New creates the workspace on the parent directories, the directories not
+// existing are created and removed on cleanup, the existing ones are kept to
+// avoid deleting user data by mistake.
+func New(dirs ...string) (*Workspace, error) {
+	ws := &Workspace{}
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if strings.TrimSpace(dir) == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		if _, err := os.Stat(dir); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				ws.Cleanup()
+				return nil, errors.Wrapf(err, "stat work directory %s", dir)
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				ws.Cleanup()
+				return nil, errors.Wrapf(err, "prepare work directory %s", dir)
+			}
+			ws.removals = append(ws.removals, dir)
+		}
+		ws.dirs = append(ws.dirs, dir)
+	}
+	if len(ws.dirs) == 0 {
+		return nil, errors.New("work directory is required")
+	}
+	return ws, nil
+}
+
+// Dirs returns the parent directories of workspace.
+func (ws *Workspace) Dirs() []string {
+	return ws.dirs
+}
+
+// Preflight checks the available space of workspace is enough for the
+// required bytes, the directories on the same file system are counted once.
+func (ws *Workspace) Preflight(required uint64) error {
+	total := uint64(0)
+	devices := map[uint64]bool{}
+	for _, dir := range ws.dirs {
+		dev, err := device(dir)
+		if err != nil {
+			return errors.Wrapf(err, "stat work directory %s", dir)
+		}
+		if devices[dev] {
+			continue
+		}
+		devices[dev] = true
+		available, err := Available(dir)
+		if err != nil {
+			return err
+		}
+		total += available
+	}
+
+	logrus.Debugf("workspace requires %s, available %s in %v", humanize.IBytes(required), humanize.IBytes(total), ws.dirs)
+	if total < required {
+		return utils.WithExitCode(utils.ExitCodeValidation, fmt.Errorf(
+			"insufficient disk space in work directory %s: requires about %s, but only %s available, free up space or specify more directories on other volumes",
+			strings.Join(ws.dirs, ", "), humanize.IBytes(required), humanize.IBytes(total),
+		))
+	}
+	return nil
+}
+
+// MkdirTemp creates a temporary directory in the parent directory with the
+// most available space, the directory is removed on cleanup.
+func (ws *Workspace) MkdirTemp(pattern string) (string, error) {
+	parent := ws.dirs[0]
+	if len(ws.dirs) > 1 {
+		most := uint64(0)
+		for _, dir := range ws.dirs {
+			if available, err := Available(dir); err == nil && available > most {
+				parent, most = dir, available
+			}
+		}
+	}
+
+	dir, err := os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return "", errors.Wrap(err, "create temp directory")
+	}
+
+	ws.mutex.Lock()
+	ws.removals = append(ws.removals, dir)
+	ws.mutex.Unlock()
+
+	return dir, nil
+}
+
+// Cleanup removes the directories created by workspace, it's safe to be
+// called multiple times.
+func (ws *Workspace) Cleanup() {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	for idx := len(ws.removals) - 1; idx >= 0; idx-- {
+		if err := os.RemoveAll(ws.removals[idx]); err != nil {
+			logrus.WithError(err).Warnf("remove work directory %s", ws.removals[idx])
+		}
+	}
+	ws.removals = nil
+}
+
+// DirSize returns the total size of regular files in the directory.
+func DirSize(dir string) (uint64, error) {
+	size := uint64(0)
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "walk directory %s", dir)
+	}
+	return size, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workspace
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dragonflyoss/nydus/contrib/nydusify/pkg/utils"
+)
+
+func TestWorkspace(t *testing.T) {
+	root := t.TempDir()
+	existing := filepath.Join(root, "existing")
+	require.NoError(t, os.Mkdir(existing, 0755))
+	created := filepath.Join(root, "created")
+
+	_, err := New("", " ")
+	require.Error(t, err)
+
+	ws, err := New(existing, created, existing)
+	require.NoError(t, err)
+	require.Equal(t, []string{existing, created}, ws.Dirs())
+	require.DirExists(t, created)
+
+	tmpDir, err := ws.MkdirTemp("nydusify-")
+	require.NoError(t, err)
+	require.DirExists(t, tmpDir)
+
+	require.NoError(t, ws.Preflight(1))
+	err = ws.Preflight(math.MaxUint64)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "insufficient disk space")
+	require.Equal(t, utils.ExitCodeValidation, utils.ExitCode(err))
+
+	ws.Cleanup()
+	ws.Cleanup()
+	require.NoDirExists(t, tmpDir)
+	require.NoDirExists(t, created)
+	require.DirExists(t, existing)
+}
+
+func TestDirSize(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("nydus"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b"), []byte("image"), 0644))
+
+	size, err := DirSize(dir)
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), size)
+
+	_, err = DirSize(filepath.Join(dir, "not-found"))
+	require.Error(t, err)
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Available returns the available bytes of the file system containing dir.
+func Available(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, errors.Wrapf(err, "statfs %s", dir)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+func device(dir string) (uint64, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("unsupported file info of %s", dir)
+	}
+	return uint64(stat.Dev), nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2024 Nydus Developers. All rights reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package workspace
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// Available returns the available bytes of the volume containing dir.
+func Available(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid path %s", dir)
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); err != nil {
+		return 0, errors.Wrapf(err, "get free space of %s", dir)
+	}
+	return available, nil
+}
+
+// device identifies the volume containing dir by its volume name.
+func device(dir string) (uint64, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.ToLower(filepath.VolumeName(abs))))
+	return hash.Sum64(), nil
+}
@@ -3,7 +3,7 @@
 // SPDX-License-Identifier: Apache-2.0
 
 use std::{
-    collections::BTreeMap,
+    collections::{BTreeMap, HashSet},
     ffi::OsString,
     fs::Permissions,
     io::{Error, ErrorKind, Write},
@@ -288,7 +288,11 @@ impl RafsInspector {
                                     "readahead_offset": blob_info.prefetch_offset(),
                                     "readahead_size": blob_info.prefetch_size(),
                                     "decompressed_size": blob_info.uncompressed_size(),
-                                    "compressed_size": blob_info.compressed_size(),});
+                                    "compressed_size": blob_info.compressed_size(),
+                                    "compressor": blob_info.compressor().to_string(),
+                                    "digester": blob_info.digester().to_string(),
+                                    "chunk_count": blob_info.chunk_count(),
+                                    "features": blob_info.features().bits(),});
                 value.as_array_mut().unwrap().push(v);
             } else {
                 let mapped_blkaddr = extra_infos
@@ -492,6 +496,101 @@ Blob ID: {}
         Ok(None)
     }
 
+    // Implement command "files"
+    // List the path of all files and directories with inode number, only the
+    // first path is listed for the hard linked files.
+    fn cmd_list_files(&self) -> Result<Option<Value>, anyhow::Error> {
+        let mut inodes = HashSet::new();
+        let mut value = json!([]);
+        self.rafs_meta.walk_directory::<PathBuf>(
+            self.rafs_meta.superblock.root_ino(),
+            None,
+            &mut |inode: Arc<dyn RafsInodeExt>, path: &Path| -> anyhow::Result<()> {
+                if !inodes.insert(inode.ino()) {
+                    return Ok(());
+                }
+                if self.request_mode {
+                    let v = json!({"inode": inode.ino(), "path": path});
+                    value.as_array_mut().unwrap().push(v);
+                } else {
+                    println!(
+                        r#"Inode Number:{inode_number:10} | Path: {path:?}"#,
+                        inode_number = inode.ino(),
+                        path = path,
+                    );
+                }
+                Ok(())
+            },
+        )?;
+
+        if self.request_mode {
+            return Ok(Some(value));
+        }
+
+        Ok(None)
+    }
+
+    // Implement command "chunks"
+    // List all data chunks referenced by the filesystem, chunks shared by
+    // multiple files are listed only once, sorted by blob and offset.
+    fn cmd_list_chunks(&self) -> Result<Option<Value>, anyhow::Error> {
+        let mut chunks = BTreeMap::new();
+        self.rafs_meta.walk_directory::<PathBuf>(
+            self.rafs_meta.superblock.root_ino(),
+            None,
+            &mut |inode: Arc<dyn RafsInodeExt>, _path: &Path| -> anyhow::Result<()> {
+                // only regular file has data chunks
+                if !inode.is_reg() {
+                    return Ok(());
+                }
+                let chunk_count = inode.get_chunk_count();
+                for idx in 0..chunk_count {
+                    let chunk = inode.get_chunk_info(idx)?;
+                    let key = (
+                        chunk.blob_index(),
+                        chunk.compressed_offset(),
+                        chunk.uncompressed_offset(),
+                    );
+                    chunks.entry(key).or_insert(chunk);
+                }
+                Ok(())
+            },
+        )?;
+
+        let mut value = json!([]);
+        for ((blob_index, _, _), chunk) in chunks.iter() {
+            let blob_id = self.get_blob_id_by_index(*blob_index)?;
+            if self.request_mode {
+                let v = json!({"blob_id": blob_id,
+                                    "blob_index": blob_index,
+                                    "chunk_id": chunk.chunk_id().to_string(),
+                                    "compressed_offset": chunk.compressed_offset(),
+                                    "compressed_size": chunk.compressed_size(),
+                                    "uncompressed_offset": chunk.uncompressed_offset(),
+                                    "uncompressed_size": chunk.uncompressed_size(),
+                                    "compressed": chunk.is_compressed(),
+                                    "batch": chunk.is_batch(),
+                                    "encrypted": chunk.is_encrypted(),});
+                value.as_array_mut().unwrap().push(v);
+            } else {
+                println!(
+                    r#"Blob ID: {} | Chunk ID: {} | Compressed Offset: {} | Compressed Size: {} | Decompressed Size: {}"#,
+                    blob_id,
+                    chunk.chunk_id(),
+                    chunk.compressed_offset(),
+                    chunk.compressed_size(),
+                    chunk.uncompressed_size(),
+                );
+            }
+        }
+
+        if self.request_mode {
+            return Ok(Some(value));
+        }
+
+        Ok(None)
+    }
+
     #[allow(clippy::type_complexity)]
     /// Walkthrough the file tree rooted at ino, calling cb for each file or directory
     /// in the tree by DFS order, including ino, please ensure ino is a directory.
@@ -703,6 +802,8 @@ impl Executor {
             ("stat", Some(file_name)) => inspector.cmd_stat_file(file_name),
             ("blobs", None) => inspector.cmd_list_blobs(),
             ("prefetch", None) => inspector.cmd_list_prefetch(),
+            ("chunks", None) => inspector.cmd_list_chunks(),
+            ("files", None) => inspector.cmd_list_files(),
             ("chunk", Some(argument)) => {
                 let offset: u64 = argument.parse().unwrap();
                 inspector.cmd_show_chunk(offset)
@@ -736,6 +837,8 @@ impl Executor {
     stat FILE_NAME:     Show particular information of RAFS file
     blobs:              Show blob table
     prefetch:           Show prefetch table
+    chunks:             List all data chunks referenced by the filesystem
+    files:              List all files with inode number
     chunk OFFSET:       List basic info of a single chunk together with a list of files that share it
     icheck INODE:       Show path of the inode and basic information
     exit:               Exit